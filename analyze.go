@@ -0,0 +1,311 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//  dmake analyze builds the module and runs a static analyzer over its
+//  source files, cppcheck or clang's static analyzer. The ANALYZER
+//  variable, or $ANALYZER, selects the analyzer, by default cppcheck
+//  if it's found, otherwise clang, and ANALYZER_FLAGS adds options.
+//  Both report problems as compiler style diagnostics which dmake
+//  collects and, with -sarif, writes as a SARIF log for code review
+//  tools. Problems only fail the build with -Werror.
+//
+const (
+	cppcheckAnalyzer = "cppcheck"
+	clangAnalyzer    = "clang"
+	cppcheckTemplate = "{file}:{line}:{column}: {severity}: {message} [{id}]"
+	sarifVersion     = "2.1.0"
+	sarifSchema      = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+//  A problem reported by an analyzer.
+//
+type Finding struct {
+	path     string
+	line     int
+	column   int
+	severity string // error, warning, style, etc.
+	message  string
+	check    string // the analyzer's name for the check, if given
+}
+
+var diagnosticRegexp = regexp.MustCompile(`^(.+?):(\d+):(\d+): ([a-z ]+): (.*?)(?: \[([^\]]+)\])?$`)
+
+// dmake analyze in cwd
+//
+// Runs the static analyzer over the receiver's source files.
+//
+func (dmake *Dmake) AnalyzeAction(env []string) error {
+	analyzer, command, err := dmake.Analyzer(env)
+	if err != nil {
+		return err
+	}
+	if _, err := exec.LookPath(command[0]); err != nil && !*dryRunFlag {
+		return fmt.Errorf("%s: not found, define $ANALYZER to use another command", command[0])
+	}
+	target, err := dmake.ExportTarget()
+	if err != nil {
+		return err
+	}
+	flags := strings.Fields(dmake.vars.GetString("ANALYZER_FLAGS"))
+
+	var paths []string
+	var commands [][]string
+	switch analyzer {
+	case cppcheckAnalyzer:
+		args := append(command[1:len(command):len(command)],
+			"--quiet",
+			"--enable=warning,style,performance,portability",
+			"--inline-suppr",
+			"--suppress=missingIncludeSystem",
+			"--template="+cppcheckTemplate,
+			"-j", strconv.Itoa(*jobsFlag),
+		)
+		var options []string
+		for _, source := range target.sources {
+			for _, option := range PreprocessorOptions(append(source.options, dmake.GeneratedOptions()...)) {
+				if !Contains(options, option) {
+					options = append(options, option)
+				}
+			}
+		}
+		args = append(args, options...)
+		args = append(args, flags...)
+		for _, source := range target.sources {
+			if dmake.OriginalSource(source.path) == source.path {
+				args = append(args, source.path)
+			}
+		}
+		paths = append(paths, dmake.Name())
+		commands = append(commands, append([]string{command[0]}, args...))
+	case clangAnalyzer:
+		for _, source := range target.sources {
+			if dmake.OriginalSource(source.path) != source.path {
+				continue // generated
+			}
+			args := append(command[1:len(command):len(command)], "--analyze", "--analyzer-output", "text")
+			args = append(args, source.options...)
+			args = append(args, dmake.GeneratedOptions()...)
+			args = append(args, flags...)
+			args = append(args, "-o", os.DevNull, source.path)
+			paths = append(paths, source.path)
+			commands = append(commands, append([]string{command[0]}, args...))
+		}
+	}
+
+	var findings []Finding
+	failed := RunFileCommands(env, paths, commands, func(path string, output []byte, err error) {
+		annotations.Writer(CommandOutput()).Write(output)
+		if err != nil {
+			logger.Warnf("FAIL %s (%s)", path, err)
+		}
+		findings = append(findings, ParseDiagnostics(bytes.NewReader(output))...)
+	})
+	if *dryRunFlag {
+		return nil
+	}
+	findings = UniqueFindings(findings)
+	if *sarifFlag != "" {
+		if err := WriteSarifFile(*sarifFlag, analyzer, findings); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%s failed for %d of %d commands", analyzer, failed, len(commands))
+	}
+	if len(findings) > 0 && *werrorFlag {
+		return fmt.Errorf("%s found %d problems", analyzer, len(findings))
+	}
+	logger.Infof("%s found %d problems", analyzer, len(findings))
+	return nil
+}
+
+//  Return the analyzer, cppcheck or clang, and the command used to
+//  run it. The .dmake ANALYZER variable, or $ANALYZER, names either
+//  analyzer or a command for it, e.g. clang-17.
+//
+func (dmake *Dmake) Analyzer(env []string) (string, []string, error) {
+	value, found := dmake.vars.GetValue("ANALYZER")
+	if !found || value == "" {
+		value, found = LookupEnv(env, "ANALYZER")
+	}
+	if !found || value == "" {
+		if _, err := exec.LookPath(cppcheckAnalyzer); err == nil {
+			return cppcheckAnalyzer, []string{cppcheckAnalyzer}, nil
+		}
+		return clangAnalyzer, []string{clangAnalyzer}, nil
+	}
+	command := strings.Fields(value)
+	name := filepath.Base(command[0])
+	switch {
+	case strings.Contains(name, cppcheckAnalyzer):
+		return cppcheckAnalyzer, command, nil
+	case strings.Contains(name, clangAnalyzer):
+		return clangAnalyzer, command, nil
+	}
+	return "", nil, fmt.Errorf("%q: unknown analyzer, use cppcheck or clang", value)
+}
+
+//  Return the preprocessor options, -I, -D and -U, from compiler
+//  options.
+//
+func PreprocessorOptions(options []string) []string {
+	var result []string
+	for i := 0; i < len(options); i++ {
+		option := options[i]
+		switch option {
+		case "-I", "-D", "-U":
+			if i+1 < len(options) {
+				result = append(result, option+options[i+1])
+				i++
+			}
+			continue
+		}
+		if strings.HasPrefix(option, "-I") || strings.HasPrefix(option, "-D") || strings.HasPrefix(option, "-U") {
+			result = append(result, option)
+		}
+	}
+	return result
+}
+
+//  Parse the compiler style diagnostics output by an analyzer, e.g.
+//
+//	lib.c:12:5: warning: Division by zero [core.DivideZero]
+//
+//  Notes explain the problem before them and aren't problems
+//  themselves.
+//
+func ParseDiagnostics(r io.Reader) []Finding {
+	var findings []Finding
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m := diagnosticRegexp.FindStringSubmatch(scanner.Text())
+		if m == nil || m[4] == "note" || m[4] == "information" {
+			continue
+		}
+		line, _ := strconv.Atoi(m[2])
+		column, _ := strconv.Atoi(m[3])
+		findings = append(findings, Finding{
+			path:     filepath.Clean(m[1]),
+			line:     line,
+			column:   column,
+			severity: m[4],
+			message:  m[5],
+			check:    m[6],
+		})
+	}
+	return findings
+}
+
+//  Sort findings by location and remove duplicates, such as problems
+//  in a header reported for each file including it.
+//
+func UniqueFindings(findings []Finding) []Finding {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		if a.line != b.line {
+			return a.line < b.line
+		}
+		return a.column < b.column
+	})
+	var unique []Finding
+	seen := make(map[Finding]bool)
+	for _, f := range findings {
+		if !seen[f] {
+			seen[f] = true
+			unique = append(unique, f)
+		}
+	}
+	return unique
+}
+
+//  Return the SARIF level of an analyzer's severity.
+//
+func sarifLevel(severity string) string {
+	switch severity {
+	case "error", "fatal error":
+		return "error"
+	case "warning":
+		return "warning"
+	}
+	return "note"
+}
+
+//  Write findings as a SARIF log, a single run of the analyzer.
+//
+func WriteSarif(w io.Writer, analyzer string, findings []Finding) error {
+	type object = map[string]interface{}
+	rules := []object{}
+	results := []object{}
+	for _, f := range findings {
+		result := object{
+			"level":   sarifLevel(f.severity),
+			"message": object{"text": f.message},
+			"locations": []object{{
+				"physicalLocation": object{
+					"artifactLocation": object{"uri": filepath.ToSlash(f.path)},
+					"region":           object{"startLine": f.line, "startColumn": f.column},
+				},
+			}},
+		}
+		if f.check != "" {
+			result["ruleId"] = f.check
+			known := false
+			for _, rule := range rules {
+				known = known || rule["id"] == f.check
+			}
+			if !known {
+				rules = append(rules, object{"id": f.check})
+			}
+		}
+		results = append(results, result)
+	}
+	sarif := object{
+		"version": sarifVersion,
+		"$schema": sarifSchema,
+		"runs": []object{{
+			"tool":    object{"driver": object{"name": analyzer, "rules": rules}},
+			"results": results,
+		}},
+	}
+	data, err := json.MarshalIndent(sarif, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+//  Write findings as a SARIF log to a file.
+//
+func WriteSarifFile(path string, analyzer string, findings []Finding) error {
+	var buf bytes.Buffer
+	if err := WriteSarif(&buf, analyzer, findings); err != nil {
+		return err
+	}
+	return CreateFile(path, buf.String())
+}
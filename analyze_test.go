@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	output := `In file included from main.c:1:
+lib.h:3:12: warning: Division by zero [core.DivideZero]
+lib.h:2:7: note: Assuming 'n' is equal to 0
+main.c:9:3: style: Variable 'x' is assigned a value that is never used. [unreadVariable]
+lib.h:3:12: warning: Division by zero [core.DivideZero]
+1 warning generated.
+`
+	expected := []Finding{
+		{path: "lib.h", line: 3, column: 12, severity: "warning", message: "Division by zero", check: "core.DivideZero"},
+		{path: "main.c", line: 9, column: 3, severity: "style", message: "Variable 'x' is assigned a value that is never used.", check: "unreadVariable"},
+	}
+	findings := UniqueFindings(ParseDiagnostics(strings.NewReader(output)))
+	if !reflect.DeepEqual(findings, expected) {
+		t.Fatalf("parsed %+v, expected %+v", findings, expected)
+	}
+
+	var buf strings.Builder
+	if err := WriteSarif(&buf, "clang", findings); err != nil {
+		t.Fatal(err)
+	}
+	var sarif struct {
+		Version string
+		Runs    []struct {
+			Results []struct {
+				RuleID string
+				Level  string
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(buf.String()), &sarif); err != nil {
+		t.Fatal(err)
+	}
+	if sarif.Version != "2.1.0" || len(sarif.Runs) != 1 || len(sarif.Runs[0].Results) != 2 {
+		t.Fatalf("unexpected SARIF log %s", buf.String())
+	}
+	if r := sarif.Runs[0].Results[1]; r.RuleID != "unreadVariable" || r.Level != "note" {
+		t.Errorf("result %+v, expected rule unreadVariable with level note", r)
+	}
+}
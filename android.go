@@ -0,0 +1,183 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//  Android targets are named by their ABIs, arm64-v8a, armeabi-v7a,
+//  x86_64 and x86, or android/<arch>, and built using the NDK's clang.
+//  The NDK is found using $ANDROID_NDK_HOME, $ANDROID_NDK_ROOT or the
+//  latest installed below the SDK, $ANDROID_HOME/ndk. The minimum API
+//  level is defined by a directory's ANDROID_API variable, or the
+//  environment variable, by default 21. The NDK's compilers for the ABI and API
+//  level, e.g. aarch64-linux-android21-clang, set the target and
+//  sysroot.
+//
+//  As with ndk-build, outputs go in a directory for the ABI,
+//  libs/<abi>, e.g. libs/arm64-v8a/libfoo.so, the layout of an AAR's,
+//  or Gradle's jniLibs, directory.
+//
+const (
+	androidOS            = "android"
+	androidDefaultAPI    = "21"
+	androidLibsDirectory = "libs"
+)
+
+//  The ABI and the NDK's target triple for each architecture.
+//
+var androidABIs = map[string][2]string{
+	"arm64": {"arm64-v8a", "aarch64-linux-android"},
+	"arm":   {"armeabi-v7a", "armv7a-linux-androideabi"},
+	"amd64": {"x86_64", "x86_64-linux-android"},
+	"386":   {"x86", "i686-linux-android"},
+}
+
+//  Return the Android ABI of the target, e.g. arm64-v8a.
+//
+func (t *Target) AndroidABI() string {
+	if abi, found := androidABIs[t.arch]; found {
+		return abi[0]
+	}
+	return t.arch
+}
+
+//  Return the minimum API level the receiver's outputs are built for,
+//  that defined by its .dmake file's ANDROID_API variable or the
+//  environment.
+//
+func (dmake *Dmake) AndroidAPI(env []string) (string, error) {
+	api := dmake.androidAPI
+	if api == "" {
+		api = androidDefaultAPI
+		if value, found := LookupEnv(env, "ANDROID_API"); found && value != "" {
+			api = value
+		}
+	}
+	if _, err := strconv.Atoi(api); err != nil {
+		return "", fmt.Errorf("ANDROID_API: %q: not an API level", api)
+	}
+	return api, nil
+}
+
+//  Return the directory holding the Android NDK.
+//
+func AndroidNDK(env []string) (string, error) {
+	for _, name := range []string{"ANDROID_NDK_HOME", "ANDROID_NDK_ROOT", "ANDROID_NDK"} {
+		if dir, found := LookupEnv(env, name); found && dir != "" {
+			return dir, nil
+		}
+	}
+	for _, name := range []string{"ANDROID_HOME", "ANDROID_SDK_ROOT"} {
+		sdk, found := LookupEnv(env, name)
+		if !found || sdk == "" {
+			continue
+		}
+		if versions, err := filepath.Glob(filepath.Join(sdk, "ndk", "*")); err == nil && len(versions) > 0 {
+			sort.Slice(versions, func(i, j int) bool {
+				return CompareVersions(filepath.Base(versions[i]), filepath.Base(versions[j])) < 0
+			})
+			return versions[len(versions)-1], nil
+		}
+		dir := filepath.Join(sdk, "ndk-bundle")
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("the Android NDK wasn't found, define ANDROID_NDK_HOME")
+}
+
+//  Return the directory holding the NDK's compilers and tools.
+//
+func AndroidToolsDirectory(ndk string) string {
+	return filepath.Join(ndk, "toolchains", "llvm", "prebuilt", runtime.GOOS+"-x86_64", "bin")
+}
+
+//  Return the environment used to build for Android, with the NDK's
+//  compilers and archiver, unless already defined.
+//
+func (dmake *Dmake) AndroidEnvironment(env []string) []string {
+	ndk, err := AndroidNDK(env)
+	if err != nil {
+		return env
+	}
+	api, err := dmake.AndroidAPI(env)
+	if err != nil {
+		return env
+	}
+	bin := AndroidToolsDirectory(ndk)
+	compiler := filepath.Join(bin, androidABIs[dmake.Target().arch][1]+api+"-clang")
+	suffix := ""
+	if runtime.GOOS == "windows" {
+		suffix = ".cmd"
+	}
+	env = DefaultEnv(env, "CC", compiler+suffix)
+	env = DefaultEnv(env, "CXX", compiler+"++"+suffix)
+	return DefaultEnv(env, "AR", filepath.Join(bin, "llvm-ar"))
+}
+
+//  Check the NDK can be used to build for the receiver's target.
+//
+func (dmake *Dmake) CheckAndroidTarget(env []string) error {
+	target := dmake.Target()
+	if _, found := androidABIs[target.arch]; !found {
+		return fmt.Errorf("%s: Android doesn't support the architecture", target.Name())
+	}
+	if _, err := AndroidNDK(env); err != nil {
+		return err
+	}
+	_, err := dmake.AndroidAPI(env)
+	return err
+}
+
+//  Return the command used to strip Android outputs, the NDK's
+//  llvm-strip.
+//
+func AndroidStripCommand() []string {
+	ndk, err := AndroidNDK(os.Environ())
+	if err != nil {
+		return []string{"llvm-strip"}
+	}
+	return []string{filepath.Join(AndroidToolsDirectory(ndk), "llvm-strip")}
+}
+
+//  Return the directory the receiver's outputs built for Android go
+//  in, below any mode's directory.
+//
+func (dmake *Dmake) AndroidOutputDirectory(dir string) string {
+	return filepath.Join(dir, androidLibsDirectory, dmake.Target().AndroidABI())
+}
+
+//  Compare version numbers, e.g. 25.2.9519653, numerically.
+//
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, errx := strconv.Atoi(as[i])
+		y, erry := strconv.Atoi(bs[i])
+		switch {
+		case errx != nil || erry != nil:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return len(as) - len(bs)
+}
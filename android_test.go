@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAndroidNDK(t *testing.T) {
+	sdk := t.TempDir()
+	for _, version := range []string{"9.1.2", "25.2.9519653", "25.10.1"} {
+		if err := os.MkdirAll(filepath.Join(sdk, "ndk", version), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ndk, err := AndroidNDK([]string{"ANDROID_HOME=" + sdk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(sdk, "ndk", "25.10.1"); ndk != expected {
+		t.Errorf("NDK %s, expected %s", ndk, expected)
+	}
+	if ndk, _ := AndroidNDK([]string{"ANDROID_NDK_HOME=/ndk", "ANDROID_HOME=" + sdk}); ndk != "/ndk" {
+		t.Errorf("NDK %s, expected $ANDROID_NDK_HOME", ndk)
+	}
+	if _, err := AndroidNDK(nil); err == nil {
+		t.Error("expected an error without an NDK")
+	}
+	if _, err := (&Dmake{}).AndroidAPI([]string{"ANDROID_API=latest"}); err == nil {
+		t.Error("expected an error for a malformed API level")
+	}
+}
+
+func TestDirectoryAndroidAPI(t *testing.T) {
+	android, other := &Dmake{}, &Dmake{}
+	vars := make(Vars)
+	vars.SetValue("ANDROID_API", "28")
+	if err := android.InitFromVars(vars); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.InitFromVars(make(Vars)); err != nil {
+		t.Fatal(err)
+	}
+	if api, _ := android.AndroidAPI(nil); api != "28" {
+		t.Errorf("API level %s, expected 28", api)
+	}
+	if api, _ := other.AndroidAPI(nil); api != androidDefaultAPI {
+		t.Errorf("another directory's API level %s, ANDROID_API leaked", api)
+	}
+	if api, _ := other.AndroidAPI([]string{"ANDROID_API=30"}); api != "30" {
+		t.Errorf("API level %s, expected $ANDROID_API", api)
+	}
+}
@@ -0,0 +1,294 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//  With -ci-annotations dmake picks out the errors and warnings in the
+//  compiler diagnostics passing through it, from dcc, tidy and analyze,
+//  so a CI system can show them alongside a pull request's changes.
+//  For GitHub Actions each is followed by a workflow command, e.g.
+//
+//	::error file=lib/util.c,line=12,col=5::'x' undeclared
+//
+//  For GitLab they're written, once the build finishes, as a code
+//  quality report, gl-code-quality-report.json in the directory dmake
+//  was started in, for the job's artifacts:reports:codequality. With
+//  -ci-annotations=auto the CI system dmake is running on is used, if
+//  any. File names are relative to the CI's checkout, $GITHUB_WORKSPACE
+//  or $CI_PROJECT_DIR, or the directory dmake was started in.
+//
+const (
+	githubAnnotations         = "github"
+	gitlabAnnotations         = "gitlab"
+	autoAnnotations           = "auto"
+	codeQualityReportFilename = "gl-code-quality-report.json"
+)
+
+//  A child dmake, run to build a sub-directory concurrently, writes
+//  the problems it found to the file named by this environment
+//  variable. The parent adds them to its own.
+//
+const annotationsEnvVar = "DMAKEANNOTATIONS"
+
+//  The problems found in the diagnostics.
+//
+type Annotations struct {
+	sync.Mutex
+	format   string    // github or gitlab
+	findings []Finding // with absolute paths
+}
+
+//  The problems being annotated, if any.
+//
+var annotations *Annotations
+
+//  Start annotating diagnostics for the CI system named by the
+//  -ci-annotations option.
+//
+func StartAnnotations(name string) error {
+	format := name
+	if name == autoAnnotations {
+		switch {
+		case os.Getenv("GITHUB_ACTIONS") == "true":
+			format = githubAnnotations
+		case os.Getenv("GITLAB_CI") != "":
+			format = gitlabAnnotations
+		default:
+			return nil
+		}
+	}
+	switch format {
+	case "":
+		return nil
+	case githubAnnotations, gitlabAnnotations:
+	default:
+		return fmt.Errorf("-ci-annotations=%s: unknown CI system, use github, gitlab or auto", name)
+	}
+	annotations = &Annotations{format: format}
+	return nil
+}
+
+//  Return a writer that copies command output to w, annotating the
+//  diagnostics in it. File names in diagnostics are relative to the
+//  current directory.
+//
+func (a *Annotations) Writer(w io.Writer) io.Writer {
+	if a == nil {
+		return w
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return w
+	}
+	return &annotatingWriter{a: a, w: w, dir: dir}
+}
+
+type annotatingWriter struct {
+	a    *Annotations
+	w    io.Writer
+	dir  string
+	line []byte // the incomplete last line
+}
+
+func (aw *annotatingWriter) Write(p []byte) (int, error) {
+	n, err := aw.w.Write(p)
+	aw.line = append(aw.line, p[:n]...)
+	for {
+		i := bytes.IndexByte(aw.line, '\n')
+		if i < 0 {
+			break
+		}
+		if annotation := aw.a.Add(aw.dir, string(bytes.TrimRight(aw.line[:i], "\r"))); annotation != "" {
+			io.WriteString(aw.w, annotation)
+		}
+		aw.line = aw.line[i+1:]
+	}
+	return n, err
+}
+
+//  Record the problem reported by a line of output, if any, and return
+//  the annotation written after it.
+//
+func (a *Annotations) Add(dir, text string) string {
+	findings := ParseDiagnostics(strings.NewReader(text))
+	if len(findings) == 0 {
+		return ""
+	}
+	f := findings[0]
+	if f.severity != "error" && f.severity != "fatal error" && f.severity != "warning" {
+		return ""
+	}
+	if !filepath.IsAbs(f.path) {
+		f.path = filepath.Join(dir, f.path)
+	}
+	a.Lock()
+	a.findings = append(a.findings, f)
+	a.Unlock()
+	if a.format != githubAnnotations {
+		return ""
+	}
+	return GithubAnnotation(f, AnnotationRoot())
+}
+
+//  Add the problems found by a child dmake.
+//
+func (a *Annotations) AddFindings(findings []Finding) {
+	a.Lock()
+	defer a.Unlock()
+	a.findings = append(a.findings, findings...)
+}
+
+//  Return the directory file names in annotations are relative to.
+//
+func AnnotationRoot() string {
+	for _, name := range []string{"GITHUB_WORKSPACE", "CI_PROJECT_DIR"} {
+		if dir := os.Getenv(name); dir != "" {
+			return dir
+		}
+	}
+	return topDirectory
+}
+
+//  Return a file's name relative to the annotation root, if it's
+//  below it.
+//
+func annotationPath(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		path = rel
+	}
+	return filepath.ToSlash(path)
+}
+
+//  Return the GitHub Actions workflow command annotating a problem.
+//
+func GithubAnnotation(f Finding, root string) string {
+	escapeData := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	escapeProperty := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	level := "warning"
+	if strings.HasSuffix(f.severity, "error") {
+		level = "error"
+	}
+	properties := fmt.Sprintf("file=%s,line=%d,col=%d", escapeProperty.Replace(annotationPath(root, f.path)), f.line, f.column)
+	if f.check != "" {
+		properties += ",title=" + escapeProperty.Replace(f.check)
+	}
+	return fmt.Sprintf("::%s %s::%s\n", level, properties, escapeData.Replace(f.message))
+}
+
+//  Write a GitLab code quality report of the problems.
+//
+func WriteCodeQualityReport(w io.Writer, root string, findings []Finding) error {
+	type location struct {
+		Path  string `json:"path"`
+		Lines struct {
+			Begin int `json:"begin"`
+		} `json:"lines"`
+	}
+	type issue struct {
+		Description string   `json:"description"`
+		CheckName   string   `json:"check_name"`
+		Fingerprint string   `json:"fingerprint"`
+		Severity    string   `json:"severity"`
+		Location    location `json:"location"`
+	}
+	issues := []issue{}
+	for _, f := range findings {
+		i := issue{Description: f.message, CheckName: f.check, Severity: "minor"}
+		if i.CheckName == "" {
+			i.CheckName = f.severity
+		}
+		if strings.HasSuffix(f.severity, "error") {
+			i.Severity = "major"
+		}
+		i.Location.Path = annotationPath(root, f.path)
+		i.Location.Lines.Begin = f.line
+		sum := md5.Sum([]byte(fmt.Sprintf("%s:%d:%d:%s", i.Location.Path, f.line, f.column, f.message)))
+		i.Fingerprint = hex.EncodeToString(sum[:])
+		issues = append(issues, i)
+	}
+	data, err := json.MarshalIndent(issues, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+//  Finish annotating. A child dmake writes the problems it found for
+//  its parent, otherwise the GitLab code quality report is written.
+//
+func (a *Annotations) Finish() error {
+	if a == nil {
+		return nil
+	}
+	a.Lock()
+	defer a.Unlock()
+	if path := os.Getenv(annotationsEnvVar); path != "" {
+		return WriteFindings(path, a.findings)
+	}
+	if a.format != gitlabAnnotations {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := WriteCodeQualityReport(&buf, AnnotationRoot(), UniqueFindings(a.findings)); err != nil {
+		return err
+	}
+	path := filepath.Join(topDirectory, codeQualityReportFilename)
+	logger.Verbosef("writing %s", path)
+	return CreateFile(path, buf.String())
+}
+
+//  Write problems to a file, one per line, for a parent dmake to read.
+//
+func WriteFindings(path string, findings []Finding) error {
+	var b strings.Builder
+	for _, f := range findings {
+		fmt.Fprintf(&b, "%s\t%d\t%d\t%s\t%s\t%s\n", f.path, f.line, f.column, f.severity, f.check, f.message)
+	}
+	return CreateFile(path, b.String())
+}
+
+//  Read the problems written by a child dmake.
+//
+func ReadFindings(path string) ([]Finding, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var findings []Finding
+	input := bufio.NewScanner(file)
+	for input.Scan() {
+		fields := strings.SplitN(input.Text(), "\t", 6)
+		if len(fields) != 6 {
+			continue
+		}
+		line, err1 := strconv.Atoi(fields[1])
+		column, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("%s: malformed problem %q", path, input.Text())
+		}
+		findings = append(findings, Finding{fields[0], line, column, fields[3], fields[5], fields[4]})
+	}
+	return findings, input.Err()
+}
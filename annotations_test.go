@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnnotations(t *testing.T) {
+	topDirectory = "/src"
+	defer func() { topDirectory = "" }()
+	os.Unsetenv("GITHUB_WORKSPACE")
+	os.Unsetenv("CI_PROJECT_DIR")
+
+	var b strings.Builder
+	a := &Annotations{format: githubAnnotations}
+	w := &annotatingWriter{a: a, w: &b, dir: "/src/lib"}
+	w.Write([]byte("util.c: In function 'f':\nutil.c:12:5: warning: unused variable 'x' [-Wunused-variable]\n"))
+	w.Write([]byte("util.c:13:1: note: declared here\nutil.c:14:9: error: 'y' undeclared, use x"))
+	w.Write([]byte("\n"))
+	expected := "util.c: In function 'f':\n" +
+		"util.c:12:5: warning: unused variable 'x' [-Wunused-variable]\n" +
+		"::warning file=lib/util.c,line=12,col=5,title=-Wunused-variable::unused variable 'x'\n" +
+		"util.c:13:1: note: declared here\n" +
+		"util.c:14:9: error: 'y' undeclared, use x\n" +
+		"::error file=lib/util.c,line=14,col=9::'y' undeclared, use x\n"
+	if b.String() != expected {
+		t.Errorf("annotated output %q", b.String())
+	}
+	if len(a.findings) != 2 || a.findings[1].path != "/src/lib/util.c" {
+		t.Fatalf("found %+v", a.findings)
+	}
+
+	path := filepath.Join(t.TempDir(), "findings")
+	if err := WriteFindings(path, a.findings); err != nil {
+		t.Fatal(err)
+	}
+	if findings, err := ReadFindings(path); err != nil || !reflect.DeepEqual(findings, a.findings) {
+		t.Errorf("read %+v, %v", findings, err)
+	}
+
+	var report strings.Builder
+	if err := WriteCodeQualityReport(&report, "/src", a.findings[1:]); err != nil {
+		t.Fatal(err)
+	}
+	var issues []map[string]interface{}
+	if err := json.Unmarshal([]byte(report.String()), &issues); err != nil || len(issues) != 1 {
+		t.Fatalf("report %s, %v", report.String(), err)
+	}
+	location := issues[0]["location"].(map[string]interface{})
+	if issues[0]["severity"] != "major" || location["path"] != "lib/util.c" {
+		t.Errorf("report %s", report.String())
+	}
+}
@@ -0,0 +1,142 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+//  Outputs are linked in a temporary directory next to the output,
+//  .<name>.tmp, and renamed into place only if the link succeeds, so
+//  a failed or interrupted link never leaves a truncated output that
+//  later builds, or other programs, would use. The files the linker
+//  creates along with the output, e.g. a PDB or an Emscripten
+//  program's WebAssembly, are moved with it.
+//
+//  The temporary output starts as a copy of the existing output, with
+//  the same modification time, so dcc only relinks when it's out of
+//  date. It's a copy, not a link, as an archiver updating a library
+//  writes to the existing file and would change the output in place.
+//
+const temporaryOutputSuffix = ".tmp"
+
+//  Return the directory an output is linked in.
+//
+func TemporaryOutputDirectory(output string) string {
+	return filepath.Join(filepath.Dir(output), "."+filepath.Base(output)+temporaryOutputSuffix)
+}
+
+//  Return the output a path names, the output itself if it's the
+//  temporary name an output is linked as, so messages name the file
+//  being built.
+//
+func FinalOutputName(path string) string {
+	dir := filepath.Dir(path)
+	if filepath.Base(dir) == "."+filepath.Base(path)+temporaryOutputSuffix {
+		return filepath.Join(filepath.Dir(dir), filepath.Base(path))
+	}
+	return path
+}
+
+//  Create the temporary directory used to link an output and return
+//  the name to link the output as.
+//
+func PrepareTemporaryOutput(output string) (string, error) {
+	dir := TemporaryOutputDirectory(output)
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+	temporary := filepath.Join(dir, filepath.Base(output))
+	if info, err := os.Lstat(output); err == nil && info.Mode().IsRegular() {
+		// Without a copy dcc simply relinks the output.
+		copyOutput(output, temporary, info)
+	}
+	return temporary, nil
+}
+
+//  Copy an output to its temporary name keeping its mode and
+//  modification time. A copy with any other time is removed, it
+//  would look up to date when it's not.
+//
+func copyOutput(output, temporary string, info os.FileInfo) {
+	src, err := os.Open(output)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(temporary, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(temporary, info.ModTime(), info.ModTime())
+	}
+	if err != nil {
+		os.Remove(temporary)
+	}
+}
+
+//  Return true if the temporary output is still the unchanged copy of
+//  the output, i.e. it wasn't relinked.
+//
+func unchangedOutput(output string, tinfo os.FileInfo) bool {
+	info, err := os.Stat(output)
+	if err != nil {
+		return false
+	}
+	if os.SameFile(info, tinfo) {
+		return true
+	}
+	return info.Size() == tinfo.Size() && info.ModTime().Equal(tinfo.ModTime())
+}
+
+//  Finish linking an output. If linking succeeded the files in the
+//  temporary directory are renamed into the output's directory, the
+//  output last, otherwise they're removed. An output that wasn't
+//  relinked, its copy still has its size and modification time, is
+//  left as it is. The temporary directory is removed in either case.
+//
+func FinishTemporaryOutput(output, temporary string, err error) error {
+	dir := filepath.Dir(temporary)
+	defer os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if path := filepath.Join(dir, entry.Name()); path != temporary {
+			if err := renameIntoPlace(path, filepath.Join(filepath.Dir(output), entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	tinfo, err := os.Stat(temporary)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if unchangedOutput(output, tinfo) {
+		return nil
+	}
+	return renameIntoPlace(temporary, output)
+}
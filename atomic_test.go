@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemporaryOutput(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "prog")
+	if err := os.WriteFile(output, []byte("old"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	temporary, err := PrepareTemporaryOutput(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(temporary) != TemporaryOutputDirectory(output) || filepath.Base(temporary) != "prog" {
+		t.Errorf("temporary output %q", temporary)
+	}
+	outputInfo, _ := os.Stat(output)
+	if info, err := os.Stat(temporary); err != nil {
+		t.Error(err)
+	} else if os.SameFile(info, outputInfo) || !info.ModTime().Equal(outputInfo.ModTime()) {
+		t.Error("temporary output isn't a copy of the output with its modification time")
+	}
+	// Writing to the temporary output, as an archiver updating a
+	// library does, leaves the output as it was.
+	if f, err := os.OpenFile(temporary, os.O_WRONLY|os.O_APPEND, 0); err == nil {
+		f.WriteString("more")
+		f.Close()
+	}
+	if contents, _ := os.ReadFile(output); string(contents) != "old" {
+		t.Errorf("writing the temporary output changed the output to %q", contents)
+	}
+	if name := FinalOutputName(temporary); name != output {
+		t.Errorf("temporary output named %q, expected %q", name, output)
+	}
+	if name := FinalOutputName(output); name != output {
+		t.Errorf("output named %q", name)
+	}
+	if err := FinishTemporaryOutput(output, temporary, errors.New("link failed")); err == nil {
+		t.Error("expected the link's error")
+	}
+	if contents, _ := os.ReadFile(output); string(contents) != "old" {
+		t.Errorf("failed link changed the output to %q", contents)
+	}
+
+	if temporary, err = PrepareTemporaryOutput(output); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(temporary)
+	if err := os.WriteFile(temporary, []byte("new"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(temporary), "prog.pdb"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := FinishTemporaryOutput(output, temporary, nil); err != nil {
+		t.Fatal(err)
+	}
+	if contents, _ := os.ReadFile(output); string(contents) != "new" {
+		t.Errorf("output is %q, expected new", contents)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "prog.pdb")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(TemporaryOutputDirectory(output)); !os.IsNotExist(err) {
+		t.Error("temporary directory not removed")
+	}
+}
+
+func TestUnchangedTemporaryOutput(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "prog")
+	if err := os.WriteFile(output, []byte("old"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	savedLogger := logger
+	logger = &Logger{w: &b, level: VerboseLevel}
+	defer func() { logger = savedLogger }()
+
+	// A build with nothing to do doesn't relink the output.
+	temporary, err := PrepareTemporaryOutput(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := FinishTemporaryOutput(output, temporary, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() > 0 {
+		t.Errorf("unexpected messages %q", b.String())
+	}
+	after, err := os.Stat(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) {
+		t.Error("an output that wasn't relinked was replaced")
+	}
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("output's modification time changed from %v to %v", before.ModTime(), after.ModTime())
+	}
+	if _, err := os.Stat(TemporaryOutputDirectory(output)); !os.IsNotExist(err) {
+		t.Error("temporary directory not removed")
+	}
+}
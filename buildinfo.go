@@ -0,0 +1,248 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//  With -build-info, or the .dmake BUILD_INFO variable, a successful
+//  build writes build-info.json describing what was built, for
+//  attesting to a build's provenance or finding out where a binary
+//  came from. It has the SHA-256 of each output, the sources it was
+//  built from and their SHA-256, the compiler and linker options used,
+//  and the versions of dmake, dcc and the compilers. A directory
+//  building sub-directories includes their outputs, so the top
+//  directory's file describes the entire build.
+//
+const buildInfoFilename = "build-info.json"
+
+//  The contents of a build-info.json file.
+//
+type BuildInfo struct {
+	Dmake     string            `json:"dmake"`
+	Dcc       string            `json:"dcc"`
+	Compilers map[string]string `json:"compilers,omitempty"` // CC and CXX
+	Target    string            `json:"target"`
+	Mode      string            `json:"mode,omitempty"`
+	Date      string            `json:"date"`
+	Outputs   []BuildInfoOutput `json:"outputs"`
+}
+
+//  An output described by a build-info.json file. Paths are relative
+//  to the file's directory.
+//
+type BuildInfoOutput struct {
+	Path    string              `json:"path"`
+	Type    string              `json:"type"`
+	SHA256  string              `json:"sha256"`
+	Options map[string][]string `json:"options,omitempty"` // compiler options by language
+	Ldflags []string            `json:"ldflags,omitempty"`
+	Libs    []string            `json:"libs,omitempty"`
+	Sources []BuildInfoSource   `json:"sources"`
+}
+
+//  A source file an output is built from.
+//
+type BuildInfoSource struct {
+	Path    string   `json:"path"`
+	SHA256  string   `json:"sha256"`
+	Options []string `json:"options,omitempty"` // the file's own options
+}
+
+//  Return true if an action builds outputs, leaving them in place.
+//
+func BuildsOutputs(action Action) bool {
+	switch action {
+	case Building, Installing, Running, Testing:
+		return !*noBuildFlag
+	}
+	return false
+}
+
+//  Return true if build-info.json is written.
+//
+func (dmake *Dmake) WritingBuildInfo() bool {
+	_, found := dmake.vars.Get("BUILD_INFO")
+	return found || *buildInfoFlag
+}
+
+//  Write the build-info.json describing the receiver's outputs and
+//  those of its sub-directories.
+//
+func (dmake *Dmake) WriteBuildInfo(env []string) error {
+	targets, err := dmake.PreparedTargets()
+	if err != nil {
+		return err
+	}
+	info := &BuildInfo{
+		Dmake:     strings.TrimSpace(versionNumber),
+		Dcc:       dmake.DccVersion(dmake.DccCommand()),
+		Compilers: make(map[string]string),
+		Target:    dmake.Target().os + "/" + dmake.Target().arch,
+		Mode:      dmake.Mode(),
+		Date:      BuildTime().UTC().Format("2006-01-02T15:04:05Z"),
+		Outputs:   []BuildInfoOutput{},
+	}
+	env = dmake.TargetEnvironment(env)
+	for _, target := range targets {
+		output, err := target.BuildInfoOutput()
+		if err != nil {
+			return err
+		}
+		info.Outputs = append(info.Outputs, *output)
+		for _, language := range []Language{target.LinkerLanguage(), CLanguage} {
+			name, defaultValue := dmake.Toolchain().CompilerVariable(language)
+			if _, found := info.Compilers[name]; !found {
+				info.Compilers[name] = CompilerVersion(exportTool(env, name, defaultValue))
+			}
+		}
+	}
+	for _, path := range dmake.directories {
+		sub, err := ReadBuildInfo(filepath.Join(path, buildInfoFilename))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return AddDetail(err, "%s", path)
+		}
+		info.Merge(path, sub)
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	logger.Verbosef("writing %s", buildInfoFilename)
+	return CreateFile(buildInfoFilename, string(data)+"\n")
+}
+
+//  Return the description of the receiver's output. The receiver must
+//  have been prepared and built.
+//
+func (dmake *Dmake) BuildInfoOutput() (*BuildInfoOutput, error) {
+	target, err := dmake.ExportTarget()
+	if err != nil {
+		return nil, err
+	}
+	output := &BuildInfoOutput{
+		Path:    filepath.ToSlash(target.output),
+		Type:    dmake.outputtype.String(),
+		Options: make(map[string][]string),
+		Ldflags: target.ldflags,
+		Libs:    target.libs,
+	}
+	if output.SHA256, err = FileSHA256(target.output); err != nil {
+		return nil, err
+	}
+	for language, options := range target.languageOptions {
+		if len(options) > 0 {
+			output.Options[language.String()] = options
+		}
+	}
+	for _, source := range target.sources {
+		sum, err := FileSHA256(source.path)
+		if err != nil {
+			return nil, err
+		}
+		output.Sources = append(output.Sources, BuildInfoSource{
+			Path:    filepath.ToSlash(source.path),
+			SHA256:  sum,
+			Options: source.fileOptions,
+		})
+	}
+	return output, nil
+}
+
+//  Add the outputs described by a sub-directory's build-info.json.
+//
+func (info *BuildInfo) Merge(dir string, sub *BuildInfo) {
+	relative := func(path string) string {
+		if filepath.IsAbs(filepath.FromSlash(path)) {
+			return path
+		}
+		return filepath.ToSlash(filepath.Join(dir, filepath.FromSlash(path)))
+	}
+	for _, output := range sub.Outputs {
+		output.Path = relative(output.Path)
+		sources := make([]BuildInfoSource, len(output.Sources))
+		for i, source := range output.Sources {
+			source.Path = relative(source.Path)
+			sources[i] = source
+		}
+		output.Sources = sources
+		info.Outputs = append(info.Outputs, output)
+	}
+	for name, version := range sub.Compilers {
+		if _, found := info.Compilers[name]; !found {
+			info.Compilers[name] = version
+		}
+	}
+}
+
+//  Read a build-info.json file.
+//
+func ReadBuildInfo(path string) (*BuildInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info := &BuildInfo{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+//  Return the SHA-256 of a file's contents, in hex.
+//
+func FileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+//  Return the version of dcc, "built-in" if the built-in compiler
+//  driver is used to build the receiver's outputs.
+//
+func (dmake *Dmake) DccVersion(dcc string) string {
+	if dmake.UsingBuiltinDcc(dcc) {
+		return "built-in"
+	}
+	return CompilerVersion(dcc)
+}
+
+//  Return the first line a command outputs given --version, or
+//  "unknown" if it fails.
+//
+func CompilerVersion(command string) string {
+	words := strings.Fields(command)
+	if len(words) == 0 {
+		return unknownVersion
+	}
+	output, err := exec.Command(words[0], append(words[1:], "--version")...).Output()
+	if err != nil {
+		logger.Debugf("%s --version: %s", command, err)
+		return unknownVersion
+	}
+	return strings.SplitN(strings.TrimSpace(string(output)), "\n", 2)[0]
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildInfo(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f.c")
+	if err := os.WriteFile(path, []byte("int f;\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := FileSHA256(path)
+	if err != nil || sum != "a683a60152ee89b912f85b61613ca25a330bc9a6af9d1eb0c86de8bd80c536fa" {
+		t.Errorf("sha256 %s, %v", sum, err)
+	}
+
+	info := &BuildInfo{Compilers: map[string]string{"CC": "cc 12"}}
+	sub := &BuildInfo{
+		Compilers: map[string]string{"CC": "cc 11", "CXX": "c++ 12"},
+		Outputs: []BuildInfoOutput{{
+			Path:    "libf.a",
+			Sources: []BuildInfoSource{{Path: "src/f.c"}, {Path: "/gen/g.c"}},
+		}},
+	}
+	info.Merge("lib", sub)
+	if len(info.Outputs) != 1 || info.Outputs[0].Path != "lib/libf.a" {
+		t.Fatalf("merged outputs %+v", info.Outputs)
+	}
+	if sources := info.Outputs[0].Sources; sources[0].Path != "lib/src/f.c" || sources[1].Path != "/gen/g.c" {
+		t.Errorf("merged sources %+v", sources)
+	}
+	if sub.Outputs[0].Sources[0].Path != "src/f.c" {
+		t.Error("merging modified the sub-directory's sources")
+	}
+	if !reflect.DeepEqual(info.Compilers, map[string]string{"CC": "cc 12", "CXX": "c++ 12"}) {
+		t.Errorf("merged compilers %v", info.Compilers)
+	}
+}
@@ -0,0 +1,398 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//  The built-in compiler driver is used when dcc isn't installed, or
+//  for toolchains dcc doesn't drive. It accepts the same arguments
+//  dmake passes to dcc and implements enough of dcc to build simple
+//  projects, compiling each source file using $CC or $CXX, tracking
+//  header dependencies using the compiler's -MMD, or /showIncludes,
+//  output, and linking or archiving the result.
+//
+//  The command used to create each object file is recorded in a file
+//  next to it, with the suffix .cmd, and that creating the output in
+//  the objects directory, output.link.cmd, so changing the compiler or
+//  its options rebuilds what it built as well as changing a source or
+//  header file.
+//
+type builtinDcc struct {
+	env         []string   // environment, for CC, CXX, etc...
+	language    Language   // the language of all source files, if given
+	outputtype  OutputType // what's being built
+	output      string     // output filename
+	objdir      string     // where object files go
+	compileOnly bool       // -c, compile but don't link
+	target      *Target    // the platform built for
+	toolchain   *Toolchain // the tools used
+	crt         string     // the MSVC runtime library option, e.g. /MD
+	options     []string   // compiler options from the command line
+	inputs      []string   // source and object files
+}
+
+//  Objects and libraries, named or given by -l options, passed as
+//  inputs are given to the linker.
+//
+var linkerInputSuffixes = []string{".o", ".obj", ".res", ".a", ".lib", ".so", ".dylib", ".dll"}
+
+const commandFileSuffix = ".cmd"
+
+//  Run the built-in compiler driver with dcc-style arguments to build
+//  for the receiver's target. The language, if forced, is that of all
+//  the source files, otherwise each file's language is determined by
+//  its filename extension.
+//
+func (dmake *Dmake) BuiltinDcc(env []string, args []string) error {
+	b, err := parseBuiltinArgs(env, args, dmake.ForcedLanguage())
+	if err != nil {
+		return err
+	}
+	b.target = dmake.Target()
+	b.toolchain = dmake.Toolchain()
+	if b.crt, err = dmake.MsvcRuntime(); err != nil {
+		return err
+	}
+	objects, err := b.compileAll()
+	if err != nil {
+		return err
+	}
+	if b.compileOnly {
+		return nil
+	}
+	return b.link(objects)
+}
+
+//  Return the built-in compiler driver for dcc-style arguments.
+//
+func parseBuiltinArgs(env []string, args []string, language Language) (*builtinDcc, error) {
+	b := &builtinDcc{env: env, language: language, objdir: defaultObjFileDir, target: DefaultTarget(), toolchain: toolchain}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "--debug", "--quiet", "--write-compile-commands":
+			continue
+		case "--exe", "--lib", "--dll", "--plugin", "--objdir":
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("%s requires an argument", arg)
+			}
+			i++
+			switch arg {
+			case "--exe":
+				b.outputtype, b.output = ExeOutputType, args[i]
+			case "--lib":
+				b.outputtype, b.output = LibOutputType, args[i]
+			case "--dll":
+				b.outputtype, b.output = DllOutputType, args[i]
+			case "--plugin":
+				b.outputtype, b.output = PluginOutputType, args[i]
+			case "--objdir":
+				b.objdir = args[i]
+			}
+		case "-c":
+			b.compileOnly = true
+		default:
+			if FileLanguage(arg) != UnknownLanguage || isLinkerInput(arg) {
+				b.inputs = append(b.inputs, arg)
+			} else {
+				b.options = append(b.options, arg)
+			}
+		}
+	}
+	if !b.compileOnly && b.outputtype == UnknownOutputType {
+		return nil, fmt.Errorf("built-in dcc: no output defined")
+	}
+	return b, nil
+}
+
+func isLinkerInput(path string) bool {
+	if strings.HasPrefix(path, "-l") {
+		return true
+	}
+	for _, suffix := range linkerInputSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+//  Compile the source files and return the object files to link,
+//  in the order of the inputs. Up to $NJOBS files are compiled at
+//  once and no more are started once one fails.
+//
+func (b *builtinDcc) compileAll() ([]string, error) {
+	jobs, err := strconv.Atoi(b.getenv(dccJobsEnvVar, "1"))
+	if err != nil || jobs < 1 {
+		jobs = 1
+	}
+	objects := make([]string, len(b.inputs))
+	semaphore := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed error
+	for i, path := range b.inputs {
+		if isLinkerInput(path) {
+			objects[i] = path
+			continue
+		}
+		semaphore <- struct{}{}
+		mu.Lock()
+		stop := failed != nil
+		mu.Unlock()
+		if stop {
+			break
+		}
+		wg.Add(1)
+		go func(i int, path string) {
+			defer func() { <-semaphore; wg.Done() }()
+			object, err := b.compile(path)
+			mu.Lock()
+			objects[i] = object
+			if err != nil && failed == nil {
+				failed = err
+			}
+			mu.Unlock()
+		}(i, path)
+	}
+	wg.Wait()
+	return objects, failed
+}
+
+//  Compile a source file, if its object file is out of date, and
+//  return the name of the object file.
+//
+func (b *builtinDcc) compile(path string) (string, error) {
+	language := b.language
+	if language == UnknownLanguage {
+		language = FileLanguage(path)
+	}
+	object := b.target.ObjectFilename(path, b.objdir)
+	base := strings.TrimSuffix(object, filepath.Ext(object))
+	depsfile, commandFile := base+".d", base+commandFileSuffix
+	optionsFile := filepath.Join(dccOptionsDirectory, compilerOptionsFilename[language])
+
+	options, err := ReadOptionsFile(optionsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	args := b.compileArgs(options)
+	command := append(b.compiler(language), args...)
+
+	inputs := append(ExistingFiles(path, optionsFile), ReadDepsFile(depsfile)...)
+	if IsUpToDate(object, inputs) && !CommandChanged(commandFile, command) {
+		return object, nil
+	}
+
+	logger.Verbosef("compiling %s", path)
+	os.MkdirAll(filepath.Dir(object), 0777)
+	if b.toolchain.msvc {
+		err = b.compileMsvc(language, args, path, object, depsfile)
+	} else {
+		args = append(args, "-MMD", "-MF", depsfile, "-c", path, "-o", object)
+		err = b.run(b.compiler(language), args, object)
+	}
+	if err != nil {
+		return object, err
+	}
+	return object, WriteCommandFile(commandFile, command)
+}
+
+//  Return the options used to compile a source file, those from its
+//  language's options file followed by those given.
+//
+func (b *builtinDcc) compileArgs(options []string) []string {
+	args := append(options[:len(options):len(options)], b.options...)
+	return append(args, b.target.CompileTypeOptions(b.outputtype)...)
+}
+
+//  Compile a source file using cl.exe, or clang-cl, writing the
+//  dependency file from the header files it reports.
+//
+func (b *builtinDcc) compileMsvc(language Language, options []string, path, object, depsfile string) error {
+	command := b.compiler(language)
+	args := append(command[1:len(command):len(command)], MsvcCompileArgs(options, b.crt, language, path, object)...)
+	logger.Debugf("RUN: %s %v", command[0], args)
+	var output bytes.Buffer
+	cmd := exec.Command(command[0], args...)
+	cmd.Env = b.env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, &output, annotations.Writer(os.Stderr)
+	err := RunCommand(cmd, object)
+	headers, messages := ParseShowIncludes(output.Bytes(), path, filepath.SplitList(b.getenv("INCLUDE", "")))
+	annotations.Writer(CommandOutput()).Write(messages)
+	if err != nil {
+		return err
+	}
+	return WriteDepsFile(depsfile, object, headers)
+}
+
+//  Link, or archive, the object files to create the output, if it's
+//  out of date.
+//
+func (b *builtinDcc) link(objects []string) error {
+	ldflagsFile := filepath.Join(dccOptionsDirectory, "LDFLAGS")
+	libsFile := filepath.Join(dccOptionsDirectory, "LIBS")
+
+	inputs := ExistingFiles(ldflagsFile, libsFile)
+	for _, object := range objects {
+		if !strings.HasPrefix(object, "-l") {
+			inputs = append(inputs, object)
+		}
+	}
+
+	ldflags, err := ReadOptionsFile(ldflagsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	libs, err := ReadOptionsFile(libsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	command := b.linkCommand(objects, ldflags, libs)
+	commandFile := filepath.Join(b.objdir, filepath.Base(b.output)+".link"+commandFileSuffix)
+	if IsUpToDate(b.output, inputs) && !CommandChanged(commandFile, command) {
+		return nil
+	}
+	os.MkdirAll(filepath.Dir(b.output), 0777)
+
+	logger.Verbosef("creating %s", FinalOutputName(b.output))
+
+	if b.outputtype == LibOutputType {
+		os.Remove(b.output)
+	}
+	if err := b.run(command[:1], command[1:], b.output); err != nil {
+		return err
+	}
+	os.MkdirAll(b.objdir, 0777)
+	return WriteCommandFile(commandFile, command)
+}
+
+//  Return the command linking, or archiving, the object files to
+//  create the output.
+//
+func (b *builtinDcc) linkCommand(objects, ldflags, libs []string) []string {
+	if b.outputtype == LibOutputType {
+		ar := strings.Fields(b.getenv("AR", b.toolchain.ar))
+		if b.toolchain.msvc {
+			return append(append(ar, "/nologo", "/OUT:"+b.output), objects...)
+		}
+		return append(append(ar, b.target.ArchiveFlags(), b.output), objects...)
+	}
+
+	if b.toolchain.msvc {
+		ld := strings.Fields(b.getenv("LD", b.toolchain.ld))
+		return append(ld, MsvcLinkArgs(append(ldflags, b.options...), b.outputtype, b.output, append(objects, libs...))...)
+	}
+
+	linker := LinkerLanguage(b.inputs)
+	if b.language == CplusplusLanguage || b.language == ObjcplusplusLanguage {
+		linker = CplusplusLanguage
+	}
+	args := append(b.compiler(linker), ldflags...)
+	args = append(args, b.options...)
+	args = append(args, b.target.LinkTypeOptions(b.outputtype)...)
+	args = append(args, "-o", b.output)
+	args = append(args, objects...)
+	return append(args, libs...)
+}
+
+//  Return true if a command differs from that recorded in a file by
+//  WriteCommandFile, or the file doesn't exist.
+//
+func CommandChanged(path string, command []string) bool {
+	data, err := os.ReadFile(path)
+	return err != nil || string(data) != strings.Join(command, "\n")+"\n"
+}
+
+//  Record the command used to create a file, an argument per line.
+//
+func WriteCommandFile(path string, command []string) error {
+	return os.WriteFile(path, []byte(strings.Join(command, "\n")+"\n"), 0666)
+}
+
+//  Return the compiler command, possibly more than one word, for a
+//  language.
+//
+func (b *builtinDcc) compiler(language Language) []string {
+	name, defaultValue := b.toolchain.CompilerVariable(language)
+	return strings.Fields(b.getenv(name, defaultValue))
+}
+
+//  Return the language whose compiler is used to link a set of
+//  files. C++ is used if any file is C++.
+//
+func LinkerLanguage(paths []string) Language {
+	for _, path := range paths {
+		language := LanguageOf([]string{path})
+		if language == CplusplusLanguage || language == ObjcplusplusLanguage {
+			return CplusplusLanguage
+		}
+	}
+	return CLanguage
+}
+
+func (b *builtinDcc) getenv(name, defaultValue string) string {
+	if value, found := LookupEnv(b.env, name); found && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func (b *builtinDcc) run(command []string, args []string, output string) error {
+	args = append(command[1:len(command):len(command)], args...)
+	logger.Debugf("RUN: %s %v", command[0], args)
+	cmd := exec.Command(command[0], args...)
+	cmd.Env = b.env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, annotations.Writer(CommandOutput()), annotations.Writer(os.Stderr)
+	return RunCommand(cmd, output)
+}
+
+//  Return the names of the files listed as prerequisites in a
+//  make-style dependency file, as written by the compiler's -MMD
+//  option. A missing or malformed file results in no names.
+//
+func ReadDepsFile(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	text := strings.ReplaceAll(string(data), "\\\n", " ")
+	colon := strings.Index(text, ": ")
+	if colon == -1 {
+		return nil
+	}
+	return strings.Fields(text[colon+1:])
+}
+
+//  Return true if a file exists and is newer than all of its input
+//  files. A missing input, e.g. a deleted header file, makes the
+//  file out of date.
+//
+func IsUpToDate(path string, inputs []string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	for _, input := range inputs {
+		inputInfo, err := os.Stat(input)
+		if err != nil || inputInfo.ModTime().After(info.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinArgs(t *testing.T) {
+	args := []string{"--quiet", "--exe", "prog", "--objdir", "objs", "-O2", "-DX=1", "main.c", "util.cpp", "libx.a", "-lm"}
+	b, err := parseBuiltinArgs(nil, args, UnknownLanguage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.outputtype != ExeOutputType || b.output != "prog" || b.objdir != "objs" || b.compileOnly {
+		t.Errorf("output %v %q, objects in %q, compile only %v", b.outputtype, b.output, b.objdir, b.compileOnly)
+	}
+	if !reflect.DeepEqual(b.options, []string{"-O2", "-DX=1"}) {
+		t.Errorf("options %q", b.options)
+	}
+	if !reflect.DeepEqual(b.inputs, []string{"main.c", "util.cpp", "libx.a", "-lm"}) {
+		t.Errorf("inputs %q", b.inputs)
+	}
+
+	b, err = parseBuiltinArgs(nil, []string{"-c", "-std=c++17", "main.c"}, CplusplusLanguage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.compileOnly || !reflect.DeepEqual(b.options, []string{"-std=c++17"}) || !reflect.DeepEqual(b.inputs, []string{"main.c"}) {
+		t.Errorf("with -lang, options %q and inputs %q", b.options, b.inputs)
+	}
+
+	if _, err := parseBuiltinArgs(nil, []string{"main.c"}, UnknownLanguage); err == nil {
+		t.Error("no output defined, expected an error")
+	}
+	if _, err := parseBuiltinArgs(nil, []string{"--exe"}, UnknownLanguage); err == nil {
+		t.Error("--exe without an argument, expected an error")
+	}
+}
+
+func TestBuiltinLinkCommand(t *testing.T) {
+	if toolchain.msvc {
+		t.Skip("not using a gcc-like toolchain")
+	}
+	env := []string{"CC=mycc", "CXX=myc++ -stdlib=libc++", "AR=myar"}
+	b := &builtinDcc{env: env, target: DefaultTarget(), toolchain: &gnuToolchain, outputtype: ExeOutputType, output: "prog", options: []string{"-g"}, inputs: []string{"main.c"}}
+	command := b.linkCommand([]string{"main.o"}, []string{"-L/opt/lib"}, []string{"-lz"})
+	expected := append([]string{"mycc", "-L/opt/lib", "-g"}, DefaultTarget().LinkTypeOptions(ExeOutputType)...)
+	expected = append(expected, "-o", "prog", "main.o", "-lz")
+	if !reflect.DeepEqual(command, expected) {
+		t.Errorf("link command %q, expected %q", command, expected)
+	}
+
+	b.language = CplusplusLanguage
+	if command := b.linkCommand([]string{"main.o"}, nil, nil); !reflect.DeepEqual(command[:2], []string{"myc++", "-stdlib=libc++"}) {
+		t.Errorf("C++ link command %q", command)
+	}
+
+	b = &builtinDcc{env: env, target: DefaultTarget(), toolchain: &gnuToolchain, outputtype: LibOutputType, output: "libx.a"}
+	if command := b.linkCommand([]string{"a.o", "b.o"}, nil, nil); !reflect.DeepEqual(command, []string{"myar", DefaultTarget().ArchiveFlags(), "libx.a", "a.o", "b.o"}) {
+		t.Errorf("archive command %q", command)
+	}
+}
+
+func TestBuiltinUpToDate(t *testing.T) {
+	if runtime.GOOS == "windows" || toolchain.msvc {
+		t.Skip("uses a shell script as the compiler")
+	}
+	dir := inTempProject(t, map[string]string{"main.c": "int main(void) { return 0; }\n"})
+
+	// The "compiler" records each run and creates its -o output.
+	compiler := filepath.Join(dir, "cc.sh")
+	script := "#!/bin/sh\necho run >> runs\nwhile [ $# -gt 0 ]; do\n  if [ \"$1\" = -o ]; then shift; : > \"$1\"; fi\n  shift\ndone\n"
+	if err := os.WriteFile(compiler, []byte(script), 0777); err != nil {
+		t.Fatal(err)
+	}
+	env := []string{"CC=" + compiler, "PATH=" + os.Getenv("PATH")}
+
+	runs := func() int {
+		data, _ := os.ReadFile("runs")
+		return strings.Count(string(data), "run")
+	}
+	build := func(options ...string) {
+		args := append([]string{"--exe", "prog", "--objdir", "objs"}, options...)
+		if err := (&Dmake{}).BuiltinDcc(env, append(args, "main.c")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	build("-O2")
+	if n := runs(); n != 2 {
+		t.Fatalf("first build ran the compiler %d times, expected 2", n)
+	}
+	build("-O2")
+	if n := runs(); n != 2 {
+		t.Errorf("an up to date build ran the compiler %d more times", n-2)
+	}
+	build("-O0")
+	if n := runs(); n != 4 {
+		t.Errorf("changing the options ran the compiler %d more times, expected 2", n-2)
+	}
+	if _, err := os.Stat(filepath.Join("objs", "main"+commandFileSuffix)); err != nil {
+		t.Errorf("the compile command wasn't recorded: %v", err)
+	}
+	if !CommandChanged(filepath.Join("objs", "prog.link"+commandFileSuffix), []string{"cc"}) {
+		t.Error("a different link command wasn't seen as a change")
+	}
+}
@@ -0,0 +1,248 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//  macOS frameworks and application bundles are directories
+//  containing the executable code, an Info.plist describing it and
+//  any resources. A framework,
+//
+//	Foo.framework/
+//		Foo -> Versions/Current/Foo
+//		Headers -> Versions/Current/Headers
+//		Resources -> Versions/Current/Resources
+//		Versions/
+//			Current -> A
+//			A/
+//				Foo
+//				Headers/
+//				Resources/Info.plist
+//
+//  and an application,
+//
+//	Foo.app/
+//		Contents/
+//			Info.plist
+//			MacOS/Foo
+//			Resources/
+//
+
+const (
+	frameworkVersion     = "A"
+	defaultBundleVersion = "1.0"
+)
+
+func (p *PlatformSpecific) FrameworkFilename(path string) string {
+	name := filepath.Base(strings.TrimSuffix(path, ".framework"))
+	return filepath.Join(filepath.Dir(path), name+".framework", "Versions", frameworkVersion, name)
+}
+
+func (p *PlatformSpecific) AppBundleFilename(path string) string {
+	name := filepath.Base(strings.TrimSuffix(path, ".app"))
+	return filepath.Join(filepath.Dir(path), name+".app", "Contents", "MacOS", name)
+}
+
+//  Return true if the receiver builds a framework or application
+//  bundle.
+//
+func (dmake *Dmake) IsBundle() bool {
+	return dmake.outputtype == FrameworkOutputType || dmake.outputtype == AppBundleOutputType
+}
+
+//  Return the pathname of the bundle directory, e.g. Foo.app, built by
+//  the receiver. The output path is the executable within the bundle
+//  and three levels down in both types of bundle.
+//
+func (dmake *Dmake) BundlePath() string {
+	return filepath.Dir(filepath.Dir(filepath.Dir(dmake.OutputPath())))
+}
+
+//  Return the pathname of the directory holding a bundle's resources.
+//
+func (dmake *Dmake) BundleResourcesPath() string {
+	if dmake.outputtype == FrameworkOutputType {
+		return filepath.Join(filepath.Dir(dmake.OutputPath()), "Resources")
+	}
+	return filepath.Join(dmake.BundlePath(), "Contents", "Resources")
+}
+
+//  Return the contents of the Info.plist describing the receiver's
+//  bundle. The identifier is defined by the BUNDLE_ID variable and
+//  the version by VERSION.
+//
+func (dmake *Dmake) InfoPlist() string {
+	name := dmake.Name()
+	identifier, found := dmake.vars.GetValue("BUNDLE_ID")
+	if !found {
+		identifier = name
+	}
+	version, found := dmake.vars.GetValue("VERSION")
+	if !found {
+		version = defaultBundleVersion
+	}
+	packageType := "APPL"
+	if dmake.outputtype == FrameworkOutputType {
+		packageType = "FMWK"
+	}
+
+	var b strings.Builder
+	fmt.Fprintln(&b, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(&b, `<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">`)
+	fmt.Fprintln(&b, `<plist version="1.0">`)
+	fmt.Fprintln(&b, "<dict>")
+	for _, kv := range [][2]string{
+		{"CFBundleExecutable", name},
+		{"CFBundleIdentifier", identifier},
+		{"CFBundleInfoDictionaryVersion", "6.0"},
+		{"CFBundleName", name},
+		{"CFBundlePackageType", packageType},
+		{"CFBundleShortVersionString", version},
+		{"CFBundleVersion", version},
+	} {
+		fmt.Fprintf(&b, "\t<key>%s</key>\n\t<string>%s</string>\n", kv[0], xmlEscape(kv[1]))
+	}
+	fmt.Fprintln(&b, "</dict>")
+	fmt.Fprintln(&b, "</plist>")
+	return b.String()
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(s)
+}
+
+//  Complete the receiver's bundle once its executable has been
+//  built. The Info.plist is written, the files named by the RESOURCES
+//  variable are copied into the bundle's resources and, for
+//  frameworks, the public header files copied into its Headers and
+//  the framework's symbolic links created.
+//
+func (dmake *Dmake) FinishBundle() error {
+	resources := dmake.BundleResourcesPath()
+	if !*dryRunFlag {
+		if err := os.MkdirAll(resources, 0777); err != nil {
+			return err
+		}
+	}
+
+	plist := filepath.Join(dmake.BundlePath(), "Contents", "Info.plist")
+	if dmake.outputtype == FrameworkOutputType {
+		plist = filepath.Join(resources, "Info.plist")
+	}
+	if !*dryRunFlag {
+		if err := CreateFile(plist, dmake.InfoPlist()); err != nil {
+			return err
+		}
+	}
+
+	if patterns, found := dmake.vars.GetValue("RESOURCES"); found {
+		paths, err := dmake.Target().ExpandGlobs(patterns)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if err = CopyFile(path, resources); err != nil {
+				return err
+			}
+		}
+	}
+
+	if dmake.outputtype != FrameworkOutputType {
+		return nil
+	}
+
+	if len(dmake.headerFiles) > 0 {
+		headers := filepath.Join(filepath.Dir(dmake.OutputPath()), "Headers")
+		root := dmake.headersRoot
+		if root == "" {
+			root = "."
+		}
+		for _, path := range dmake.headerFiles {
+			rel, err := filepath.Rel(root, path)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				return fmt.Errorf("%s: header file is not below HEADERS_ROOT %q", path, root)
+			}
+			if err = CopyFile(path, filepath.Join(headers, filepath.Dir(rel))); err != nil {
+				return err
+			}
+		}
+	}
+
+	framework := dmake.BundlePath()
+	links := [][2]string{
+		{frameworkVersion, filepath.Join(framework, "Versions", "Current")},
+		{filepath.Join("Versions", "Current", dmake.Name()), filepath.Join(framework, dmake.Name())},
+		{filepath.Join("Versions", "Current", "Resources"), filepath.Join(framework, "Resources")},
+	}
+	if len(dmake.headerFiles) > 0 {
+		links = append(links, [2]string{filepath.Join("Versions", "Current", "Headers"), filepath.Join(framework, "Headers")})
+	}
+	for _, link := range links {
+		if err := Symlink(link[0], link[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//  Install the receiver's bundle, frameworks into
+//  prefix/Library/Frameworks and applications into
+//  prefix/Applications, recording every file in the install
+//  manifest.
+//
+func (dmake *Dmake) InstallBundle(prefix string) error {
+	dest := filepath.Join(prefix, "Applications")
+	if dmake.outputtype == FrameworkOutputType {
+		dest = filepath.Join(prefix, "Library", "Frameworks")
+	}
+	bundle := dmake.BundlePath()
+	return filepath.Walk(bundle, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(filepath.Dir(bundle), path)
+		if err != nil {
+			return err
+		}
+		destdir := filepath.Join(dest, filepath.Dir(rel))
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return dmake.InstallSymlink(target, destdir, info.Name())
+		case info.IsDir():
+			return nil
+		default:
+			mode := os.FileMode(0444)
+			if info.Mode()&0111 != 0 {
+				mode = 0555
+			}
+			return dmake.InstallFile(path, destdir, mode)
+		}
+	})
+}
+
+//  Copy a file into a directory, creating the directory if required.
+//
+func CopyFile(path, destdir string) error {
+	if DryRun("cp", path, filepath.Join(destdir, filepath.Base(path))) {
+		return nil
+	}
+	if err := os.MkdirAll(destdir, 0777); err != nil {
+		return err
+	}
+	return installByCopyingFile(path, destdir, 0644)
+}
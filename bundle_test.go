@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestAppBundle(t *testing.T) {
+	inTempProject(t, map[string]string{
+		"main.m":           "",
+		"res/icon.icns":    "icon",
+		"res/strings.json": "{}",
+	})
+	dmake := &Dmake{vars: make(Vars), outputtype: AppBundleOutputType, outputname: "Viewer"}
+	dmake.vars.SetValue("BUNDLE_ID", "org.example.viewer")
+	dmake.vars.SetValue("VERSION", "2.1")
+	dmake.vars.SetValue("RESOURCES", "res/*")
+	dmake.SetOutputNameFromType()
+	if output := dmake.OutputPath(); output != filepath.Join("Viewer.app", "Contents", "MacOS", "Viewer") {
+		t.Fatalf("application output %q", output)
+	}
+	if path := dmake.BundlePath(); path != "Viewer.app" {
+		t.Errorf("bundle path %q", path)
+	}
+	writeFiles(t, ".", map[string]string{dmake.OutputPath(): "exe"})
+	if err := dmake.FinishBundle(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"Contents/Resources/icon.icns", "Contents/Resources/strings.json"} {
+		if _, err := os.Stat(filepath.Join("Viewer.app", filepath.FromSlash(path))); err != nil {
+			t.Error(err)
+		}
+	}
+	plist, err := os.ReadFile(filepath.Join("Viewer.app", "Contents", "Info.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"<key>CFBundleExecutable</key>\n\t<string>Viewer</string>",
+		"<key>CFBundleIdentifier</key>\n\t<string>org.example.viewer</string>",
+		"<key>CFBundlePackageType</key>\n\t<string>APPL</string>",
+		"<key>CFBundleVersion</key>\n\t<string>2.1</string>",
+	} {
+		if !strings.Contains(string(plist), s) {
+			t.Errorf("Info.plist doesn't contain %q\n%s", s, plist)
+		}
+	}
+}
+
+func TestFramework(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("frameworks use symbolic links")
+	}
+	inTempProject(t, map[string]string{
+		"include/vec/vec.h": "",
+		"vec.c":             "",
+		"data.txt":          "data",
+	})
+	dmake := &Dmake{vars: make(Vars), outputtype: FrameworkOutputType, outputname: "Vec"}
+	dmake.vars.SetValue("RESOURCES", "data.txt")
+	dmake.headerFiles, dmake.headersRoot = []string{filepath.Join("include", "vec", "vec.h")}, "include"
+	dmake.SetOutputNameFromType()
+	writeFiles(t, ".", map[string]string{dmake.OutputPath(): "lib"})
+	if err := dmake.FinishBundle(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{
+		"Vec",
+		"Versions/Current/Vec",
+		"Resources/Info.plist",
+		"Resources/data.txt",
+		"Headers/vec/vec.h",
+		"Versions/A/Headers/vec/vec.h",
+	} {
+		if _, err := os.Stat(filepath.Join("Vec.framework", filepath.FromSlash(path))); err != nil {
+			t.Error(err)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join("Vec.framework", "Versions", "Current")); err != nil || target != frameworkVersion {
+		t.Errorf("Versions/Current links to %q, %v", target, err)
+	}
+	if plist := dmake.InfoPlist(); !strings.Contains(plist, "<string>FMWK</string>") || !strings.Contains(plist, "<string>"+defaultBundleVersion+"</string>") {
+		t.Errorf("framework Info.plist\n%s", plist)
+	}
+}
@@ -0,0 +1,75 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//  A compiler cache, ccache or sccache, avoids recompiling files
+//  whose preprocessed source and options are unchanged, even after
+//  a clean. Caching is enabled by the -cache option or the CACHE
+//  variable, which may name the cache command or be "yes" to use
+//  whichever is found, or "no" to not cache.
+//
+var compilerCaches = []string{"ccache", "sccache"}
+
+//  Return the compiler cache command used when compiling, if any.
+//
+func (dmake *Dmake) CompilerCache() (string, error) {
+	value, found := dmake.vars.GetValue("CACHE")
+	if !found {
+		if !*cacheFlag {
+			return "", nil
+		}
+		value = "yes"
+	}
+	switch strings.ToLower(value) {
+	case "no", "off", "false", "0":
+		return "", nil
+	case "", "yes", "on", "true", "1", "auto":
+		for _, name := range compilerCaches {
+			if path, err := exec.LookPath(name); err == nil {
+				return path, nil
+			}
+		}
+		return "", nil
+	}
+	path, err := exec.LookPath(value)
+	if err != nil {
+		return "", fmt.Errorf("CACHE: %s not found", value)
+	}
+	return path, nil
+}
+
+//  Return the environment used to compile with a compiler cache,
+//  $CC and $CXX, by default the toolchain's compilers, are prefixed
+//  with the cache command.
+//
+func CacheEnvironment(env []string, cache string, toolchain *Toolchain) []string {
+	if cache == "" {
+		return env
+	}
+	name := strings.TrimSuffix(filepath.Base(cache), ".exe")
+	for _, language := range []Language{CLanguage, CplusplusLanguage} {
+		variable, compiler := toolchain.CompilerVariable(language)
+		if value, found := LookupEnv(env, variable); found && value != "" {
+			compiler = value
+		}
+		words := strings.Fields(compiler)
+		if strings.TrimSuffix(filepath.Base(words[0]), ".exe") == name {
+			continue
+		}
+		env = append(env[:len(env):len(env)], variable+"="+cache+" "+compiler)
+	}
+	return env
+}
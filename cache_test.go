@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCacheEnvironment(t *testing.T) {
+	env := CacheEnvironment([]string{"CXX=g++ -m32", "PATH=/bin"}, "/usr/bin/ccache", &gnuToolchain)
+	if cc, _ := LookupEnv(env, "CC"); cc != "/usr/bin/ccache cc" {
+		t.Errorf("CC is %q", cc)
+	}
+	if cxx, _ := LookupEnv(env, "CXX"); cxx != "/usr/bin/ccache g++ -m32" {
+		t.Errorf("CXX is %q", cxx)
+	}
+	env = CacheEnvironment([]string{"CC=ccache gcc"}, "/usr/bin/ccache", &gnuToolchain)
+	if cc, _ := LookupEnv(env, "CC"); cc != "ccache gcc" {
+		t.Errorf("CC is %q, cached twice", cc)
+	}
+	if env := CacheEnvironment([]string{"CC=gcc"}, "", &gnuToolchain); len(env) != 1 {
+		t.Errorf("environment changed without a cache, %q", env)
+	}
+}
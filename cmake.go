@@ -0,0 +1,159 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const cmakeListsFilename = "CMakeLists.txt"
+
+var (
+	// The CMake library types for dmake's library output types.
+	//
+	cmakeLibraryType = map[OutputType]string{
+		LibOutputType:    "STATIC",
+		DllOutputType:    "SHARED",
+		PluginOutputType: "MODULE",
+	}
+
+	// The CMake names of the languages.
+	//
+	cmakeLanguageName = map[Language]string{
+		CLanguage:            "C",
+		CplusplusLanguage:    "CXX",
+		ObjcLanguage:         "OBJC",
+		ObjcplusplusLanguage: "OBJCXX",
+	}
+)
+
+//  Write a CMakeLists.txt for a project with the given name that
+//  defines the targets and adds the sub-directories, which have
+//  their own CMakeLists.txt.
+//
+//  Include directories are taken from -I options and libraries from
+//  -l options, everything else is passed through as compile or link
+//  options.
+//
+func WriteCMakeLists(path string, project string, targets []*ExportTarget, directories []string) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s generated by dmake export cmake\n\n", path)
+	fmt.Fprintln(&b, "cmake_minimum_required(VERSION 3.13)")
+	fmt.Fprintf(&b, "project(%s LANGUAGES C CXX)\n\n", cmakeQuote(project))
+
+	for _, dir := range directories {
+		fmt.Fprintf(&b, "add_subdirectory(%s)\n", cmakeQuote(filepath.ToSlash(dir)))
+	}
+	if len(directories) > 0 {
+		fmt.Fprintln(&b)
+	}
+
+	for _, target := range targets {
+		name := cmakeQuote(target.name)
+		if target.name == "" {
+			name = cmakeQuote(project)
+		}
+		var sources []string
+		for _, source := range target.sources {
+			sources = append(sources, cmakeQuote(filepath.ToSlash(source.path)))
+		}
+		if target.outputtype == ExeOutputType {
+			fmt.Fprintf(&b, "add_executable(%s\n    %s)\n", name, strings.Join(sources, "\n    "))
+		} else {
+			fmt.Fprintf(&b, "add_library(%s %s\n    %s)\n", name, cmakeLibraryType[target.outputtype], strings.Join(sources, "\n    "))
+		}
+
+		var languages []Language
+		for language := range target.languageOptions {
+			languages = append(languages, language)
+		}
+		sort.Slice(languages, func(i, j int) bool { return languages[i] < languages[j] })
+
+		var includes, options []string
+		for _, language := range languages {
+			dirs, rest := splitOption(target.languageOptions[language], "-I")
+			for _, dir := range dirs {
+				if !Contains(includes, dir) {
+					includes = append(includes, dir)
+				}
+			}
+			for _, option := range rest {
+				options = append(options, cmakeQuote(fmt.Sprintf("$<$<COMPILE_LANGUAGE:%s>:%s>", cmakeLanguageName[language], option)))
+			}
+		}
+		if len(includes) > 0 {
+			fmt.Fprintf(&b, "target_include_directories(%s PRIVATE %s)\n", name, cmakeQuoteAll(includes))
+		}
+		if len(options) > 0 {
+			fmt.Fprintf(&b, "target_compile_options(%s PRIVATE\n    %s)\n", name, strings.Join(options, "\n    "))
+		}
+		for _, source := range target.sources {
+			if len(source.fileOptions) > 0 {
+				fmt.Fprintf(&b, "set_source_files_properties(%s PROPERTIES COMPILE_OPTIONS %s)\n",
+					cmakeQuote(filepath.ToSlash(source.path)),
+					cmakeQuote(strings.Join(source.fileOptions, ";")))
+			}
+		}
+
+		if target.outputtype != LibOutputType {
+			ldflags := Without(target.ldflags, target.platform.LinkTypeOptions(target.outputtype))
+			if len(ldflags) > 0 {
+				fmt.Fprintf(&b, "target_link_options(%s PRIVATE %s)\n", name, cmakeQuoteAll(ldflags))
+			}
+			libs, rest := splitOption(target.libs, "-l")
+			libs = append(libs, rest...)
+			if len(libs) > 0 {
+				fmt.Fprintf(&b, "target_link_libraries(%s PRIVATE %s)\n", name, cmakeQuoteAll(libs))
+			}
+		}
+		fmt.Fprintln(&b)
+	}
+
+	return CreateFile(path, b.String())
+}
+
+//  Split a list of options into the values of a particular option,
+//  given as "-Xvalue" or "-X value", and the remaining options.
+//
+func splitOption(options []string, option string) (values []string, rest []string) {
+	for i := 0; i < len(options); i++ {
+		switch {
+		case options[i] == option && i+1 < len(options):
+			i++
+			values = append(values, options[i])
+		case strings.HasPrefix(options[i], option) && len(options[i]) > len(option):
+			values = append(values, options[i][len(option):])
+		default:
+			rest = append(rest, options[i])
+		}
+	}
+	return
+}
+
+func cmakeQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\"()#;$\\") {
+		return s
+	}
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	s = strings.ReplaceAll(s, "${", "\\${")
+	return "\"" + s + "\""
+}
+
+func cmakeQuoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, s := range values {
+		quoted[i] = cmakeQuote(s)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestExportCMake(t *testing.T) {
+	files := exportProject(t, "cmake", cmakeListsFilename)
+	checkExported(t, files, map[string]string{
+		"CMakeLists.txt": `# CMakeLists.txt generated by dmake export cmake
+
+cmake_minimum_required(VERSION 3.13)
+project(app LANGUAGES C CXX)
+
+add_subdirectory(lib)
+
+add_executable(app
+    main.c)
+target_include_directories(app PRIVATE include)
+target_compile_options(app PRIVATE
+    "$<$<COMPILE_LANGUAGE:C>:-Wall>")
+target_link_libraries(app PRIVATE lib m -Llib)
+
+`,
+		"lib/CMakeLists.txt": `# CMakeLists.txt generated by dmake export cmake
+
+cmake_minimum_required(VERSION 3.13)
+project(lib LANGUAGES C CXX)
+
+add_library(lib STATIC
+    lib.c)
+
+`,
+	})
+}
@@ -0,0 +1,108 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//  When building for macOS, programs, shared libraries, plugins and
+//  bundles may be signed by codesign once they're built, and before
+//  they're installed. The -sign option, or CODESIGN_IDENTITY variable,
+//  names the signing identity, "-" signing ad-hoc. Outputs are signed
+//  with the hardened runtime, which notarization requires, unless
+//  CODESIGN_RUNTIME is "no". CODESIGN_ENTITLEMENTS names an
+//  entitlements file and CODESIGN_FLAGS defines other options.
+//
+//  Signing is slow so a stamp file, in the object files directory,
+//  records the identity an output was signed with and outputs are
+//  only signed again when they, or the identity, change.
+//
+const (
+	adhocIdentity     = "-"
+	signedStampSuffix = ".signed"
+)
+
+//  Return the identity used to sign the receiver's outputs, or "" if
+//  they're not signed.
+//
+func (dmake *Dmake) SigningIdentity() string {
+	if *signFlag != "" {
+		return *signFlag
+	}
+	return dmake.vars.GetString("CODESIGN_IDENTITY")
+}
+
+//  Return the file, or bundle, signed for the receiver's output.
+//
+func (dmake *Dmake) SignedPath() string {
+	if dmake.IsBundle() {
+		return dmake.BundlePath()
+	}
+	if version := dmake.LibraryVersion(); version != "" {
+		real, _ := dmake.VersionedOutputPaths(version)
+		return real
+	}
+	return dmake.OutputPath()
+}
+
+//  Sign the receiver's output if an identity is defined, the target is
+//  macOS and the output has changed since it was last signed. Static
+//  libraries aren't signed.
+//
+func (dmake *Dmake) Sign(env []string) error {
+	identity := dmake.SigningIdentity()
+	if identity == "" || dmake.Target().os != "darwin" || dmake.outputtype == LibOutputType {
+		return nil
+	}
+	path := dmake.SignedPath()
+	stamp := filepath.Join(dmake.ObjsDir(), filepath.Base(path)+signedStampSuffix)
+	if data, err := os.ReadFile(stamp); err == nil && strings.TrimSpace(string(data)) == identity {
+		if info, err := os.Stat(stamp); err == nil && !NewestModTime(path).After(info.ModTime()) {
+			return nil
+		}
+	}
+
+	args := []string{"--force", "--sign", identity}
+	if runtime := strings.ToLower(dmake.vars.GetString("CODESIGN_RUNTIME")); runtime != "no" && runtime != "off" && runtime != "false" && runtime != "0" {
+		args = append(args, "--options", "runtime")
+	}
+	if identity != adhocIdentity {
+		args = append(args, "--timestamp")
+	}
+	if entitlements := dmake.vars.GetString("CODESIGN_ENTITLEMENTS"); entitlements != "" {
+		args = append(args, "--entitlements", entitlements)
+	}
+	args = append(args, strings.Fields(dmake.vars.GetString("CODESIGN_FLAGS"))...)
+	args = append(args, path)
+	if err := runTool(env, append([]string{Getenv("CODESIGN", "codesign")}, args...)); err != nil {
+		return err
+	}
+	if *dryRunFlag {
+		return nil
+	}
+	return CreateFile(stamp, identity+"\n")
+}
+
+//  Return the most recent modification time of a file or, for a
+//  directory, of the files within it.
+//
+func NewestModTime(path string) time.Time {
+	var newest time.Time
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest
+}
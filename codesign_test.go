@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	inTempProject(t, nil)
+	fakeTool(t, "codesign", `printf '%s|' "$@" >> codesign.log
+echo >> codesign.log
+`)
+	t.Setenv("CODESIGN", "")
+	darwin, err := NewTarget("darwin/arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dmake := &Dmake{vars: make(Vars), target: darwin, outputtype: ExeOutputType, outputname: "prog"}
+	dmake.vars.SetValue("CODESIGN_IDENTITY", "Developer ID Application: Example")
+	dmake.vars.SetValue("CODESIGN_ENTITLEMENTS", "prog.entitlements")
+	dmake.vars.SetValue("CODESIGN_FLAGS", "--deep --strict")
+	writeFiles(t, ".", map[string]string{dmake.OutputPath(): "program"})
+	if err := os.MkdirAll(dmake.ObjsDir(), 0777); err != nil {
+		t.Fatal(err)
+	}
+	signings := func() []string {
+		log, _ := os.ReadFile("codesign.log")
+		return strings.Split(strings.TrimSpace(string(log)), "\n")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := dmake.Sign(os.Environ()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := "--force|--sign|Developer ID Application: Example|--options|runtime|--timestamp|--entitlements|prog.entitlements|--deep|--strict|" + dmake.OutputPath() + "|"
+	if s := signings(); len(s) != 1 || s[0] != expected {
+		t.Fatalf("codesign run as %q, expected, once, %q", s, expected)
+	}
+
+	// Changing the output, or the identity, signs it again.
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(dmake.OutputPath(), later, later)
+	if err := dmake.Sign(os.Environ()); err != nil {
+		t.Fatal(err)
+	}
+	dmake.vars = make(Vars)
+	dmake.vars.SetValue("CODESIGN_IDENTITY", adhocIdentity)
+	dmake.vars.SetValue("CODESIGN_RUNTIME", "no")
+	if err := dmake.Sign(os.Environ()); err != nil {
+		t.Fatal(err)
+	}
+	if s := signings(); len(s) != 3 || s[1] != expected || s[2] != "--force|--sign|-|"+dmake.OutputPath()+"|" {
+		t.Errorf("codesign run as %q", s)
+	}
+
+	// Static libraries, and outputs for other platforms, aren't signed.
+	os.Remove("codesign.log")
+	dmake.outputtype = LibOutputType
+	dmake.Sign(os.Environ())
+	dmake.outputtype, dmake.target = ExeOutputType, DefaultTarget()
+	dmake.target.os = "linux"
+	dmake.Sign(os.Environ())
+	if _, err := os.Stat("codesign.log"); !os.IsNotExist(err) {
+		t.Errorf("codesign run as %q", signings())
+	}
+}
@@ -0,0 +1,89 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+const compileCommandsFilename = "compile_commands.json"
+
+//  Return true if dcc is being asked to write compile_commands.json
+//  files.
+//
+func (dmake *Dmake) WritingCompileCommands() bool {
+	return *writeCompileCommandsFlag || dmake.writeCompileCommands
+}
+
+//  Merge the compile_commands.json files written in each of the
+//  receiver's sub-directories into the compile_commands.json in the
+//  current directory so tools see the entire tree.
+//
+//  Entries are identified by their directory and file, an entry from
+//  a sub-directory replaces any existing entry for the same file so
+//  repeatedly merging doesn't duplicate entries.
+//
+func (dmake *Dmake) MergeCompileCommands() error {
+	var merged []map[string]interface{}
+	index := make(map[[2]string]int)
+
+	add := func(path string) error {
+		entries, err := ReadCompileCommands(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return AddDetail(err, "%s", path)
+		}
+		for _, entry := range entries {
+			directory, _ := entry["directory"].(string)
+			file, _ := entry["file"].(string)
+			key := [2]string{directory, file}
+			if i, found := index[key]; found {
+				merged[i] = entry
+			} else {
+				index[key] = len(merged)
+				merged = append(merged, entry)
+			}
+		}
+		return nil
+	}
+
+	if err := add(compileCommandsFilename); err != nil {
+		return err
+	}
+	for _, path := range dmake.directories {
+		if err := add(filepath.Join(path, compileCommandsFilename)); err != nil {
+			return err
+		}
+	}
+	if merged == nil {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return err
+	}
+	return CreateFile(compileCommandsFilename, string(data)+"\n")
+}
+
+//  Read a compile_commands.json file.
+//
+func ReadCompileCommands(path string) ([]map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []map[string]interface{}
+	err = json.Unmarshal(data, &entries)
+	return entries, err
+}
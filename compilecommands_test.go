@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeCompileCommands(t *testing.T) {
+	inTempProject(t, map[string]string{
+		compileCommandsFilename: `[
+  {"directory": "/src", "file": "main.c", "command": "cc -c main.c"},
+  {"directory": "/src/lib", "file": "lib.c", "command": "cc -c lib.c -O0"}
+]`,
+		"lib/" + compileCommandsFilename: `[
+  {"directory": "/src/lib", "file": "lib.c", "command": "cc -c lib.c -O2"},
+  {"directory": "/src/lib", "file": "util.c", "command": "cc -c util.c"}
+]`,
+		"app/main.c": "int main() { return 0; }\n",
+	})
+	dmake := &Dmake{directories: []string{"lib", "app"}}
+	for i := 0; i < 2; i++ {
+		if err := dmake.MergeCompileCommands(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := ReadCompileCommands(compileCommandsFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commands []string
+	for _, entry := range entries {
+		commands = append(commands, entry["command"].(string))
+	}
+	expected := []string{"cc -c main.c", "cc -c lib.c -O2", "cc -c util.c"}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("merged commands %q, expected %q", commands, expected)
+	}
+
+	inTempProject(t, map[string]string{"lib/lib.c": ""})
+	if err := dmake.MergeCompileCommands(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCompileCommands(compileCommandsFilename); err == nil {
+		t.Error("compile_commands.json written without any entries to merge")
+	}
+}
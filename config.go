@@ -0,0 +1,150 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+//  Configuration files provide defaults for dmake's options. The
+//  user's, ~/.config/dmake/config, applies to every project and a
+//  project's, .dmake.conf in the directory dmake is run in or one of
+//  its parents, usually the repository's root, to every build of the
+//  project. They're written like .dmake files, each variable named
+//  for an option, e.g.
+//
+//	prefix = $(HOME)/.local
+//	mode = release
+//	j = 8
+//	quiet
+//
+//  Options are taken from, in increasing order of precedence, the
+//  user's configuration, the project's, the environment, e.g. PREFIX,
+//  DCC or DMAKEFLAGS, and the command line.
+//
+const (
+	userConfigFilename    = "dmake/config"
+	projectConfigFilename = ".dmake.conf"
+)
+
+//  Options configured by environment variables, which take precedence
+//  over configuration files.
+//
+var configEnvironment = map[string]string{
+	"dcc":    "DCC",
+	"prefix": "PREFIX",
+}
+
+//  Options that can't be used in configuration files.
+//
+var unconfigurableOptions = []string{"C", "dcc-arg", "version"}
+
+//  Return the user's configuration directory, $XDG_CONFIG_HOME or
+//  ~/.config.
+//
+func ConfigDirectory() (string, error) {
+	if config := os.Getenv("XDG_CONFIG_HOME"); config != "" {
+		return config, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config"), nil
+}
+
+//  Return the project configuration file used when building in a
+//  directory, if any.
+//
+func ProjectConfigFile(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, projectConfigFilename)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+//  Read the user's and project's configuration files and set the
+//  options they define that weren't given on the command line, or by
+//  the environment.
+//
+func ReadConfigFiles(dir string) error {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	var paths []string
+	if config, err := ConfigDirectory(); err == nil {
+		paths = append(paths, filepath.Join(config, userConfigFilename))
+	}
+	if path := ProjectConfigFile(dir); path != "" {
+		paths = append(paths, path)
+	}
+	for _, path := range paths {
+		options, err := ReadConfigFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, name := range options.Names() {
+			if given[name] {
+				continue
+			}
+			if env, found := configEnvironment[name]; found && os.Getenv(env) != "" {
+				continue
+			}
+			if err := flag.Set(name, options.GetString(name)); err != nil {
+				return fmt.Errorf("%s: %s: %v", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+//  Read a configuration file, returning the options it defines.
+//
+func ReadConfigFile(path string) (Vars, error) {
+	vars := make(Vars)
+	sections, err := vars.ReadFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(sections) > 0 {
+		return nil, fmt.Errorf("%s: a configuration file can't define targets", path)
+	}
+	options := make(Vars)
+	for _, name := range vars.Names() {
+		if name == "OS" || name == "ARCH" {
+			continue
+		}
+		if flag.Lookup(name) == nil {
+			return nil, fmt.Errorf("%s: %q isn't an option", path, name)
+		}
+		if Contains(unconfigurableOptions, name) {
+			return nil, fmt.Errorf("%s: %q can't be set in a configuration file", path, name)
+		}
+		options.SetValue(name, vars.GetString(name))
+	}
+	return options, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, projectConfigFilename)
+	if err := os.WriteFile(path, []byte("# defaults\nmode = release\nquiet\nj = 4\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "src", "lib")
+	if err := os.MkdirAll(sub, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if found := ProjectConfigFile(sub); found != path {
+		t.Errorf("project configuration %q, expected %q", found, path)
+	}
+
+	options, err := ReadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := options.Names(); !reflect.DeepEqual(names, []string{"j", "mode", "quiet"}) {
+		t.Errorf("options %q", names)
+	}
+	if quiet := options.GetString("quiet"); quiet != "true" {
+		t.Errorf("quiet is %q, expected true", quiet)
+	}
+
+	for _, contents := range []string{"no-such-option = 1\n", "dcc-arg = -g\n"} {
+		if err := os.WriteFile(path, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadConfigFile(path); err == nil {
+			t.Errorf("expected an error for %q", contents)
+		}
+	}
+}
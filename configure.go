@@ -0,0 +1,214 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const defaultConfigHeaderFilename = "config.h"
+
+//  The programs compiled to check for features.
+//
+const (
+	checkHeaderProgram = "#include <%s>\nint main(void) { return 0; }\n"
+	checkFuncProgram   = "char %s(void);\nint main(void) { return %[1]s() != 0; }\n"
+	checkLibProgram    = "int main(void) { return 0; }\n"
+)
+
+//  Probe for the features named by the CHECK_HEADERS, CHECK_FUNCS and
+//  CHECK_LIBS variables and write a header file, config.h or that
+//  named by CONFIG_HEADER, defining a HAVE_ macro for each one found,
+//  e.g. HAVE_UNISTD_H, HAVE_STRLCPY and HAVE_LIBM. Libraries found
+//  are also linked with the output.
+//
+//  Checks are only repeated when the .dmake file or options file is
+//  newer than the header, or the target, compiler or its options, such
+//  as those of the PKGS, differ from those recorded when the header was
+//  written. Otherwise the header's existing definitions are used.
+//
+func (dmake *Dmake) Configure(env []string) error {
+	if !dmake.HaveChecks() {
+		return nil
+	}
+	headers := strings.Fields(dmake.vars.GetString("CHECK_HEADERS"))
+	funcs := strings.Fields(dmake.vars.GetString("CHECK_FUNCS"))
+	libs := strings.Fields(dmake.vars.GetString("CHECK_LIBS"))
+	path := dmake.ConfigHeader()
+
+	env = dmake.TargetEnvironment(env)
+	cc, compilerName := dmake.Toolchain().CompilerVariable(CLanguage)
+	if value, found := LookupEnv(env, cc); found && value != "" {
+		compilerName = value
+	}
+	compiler := strings.Fields(compilerName)
+	optionsFile := filepath.Join(dccOptionsDirectory, compilerOptionsFilename[CLanguage])
+	options, err := ReadOptionsFile(optionsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	options = append(options, dmake.packageOptions...)
+
+	command := append([]string{dmake.Target().Name()}, compiler...)
+	command = append(command, options...)
+	command = append(command, dmake.packageLibs...)
+	commandFile := dmake.ConfigCommandPath()
+
+	inputs := []string{dmakeFileFilename}
+	if _, err := os.Stat(optionsFile); err == nil {
+		inputs = append(inputs, optionsFile)
+	}
+	if IsUpToDate(path, inputs) && !CommandChanged(commandFile, command) {
+		defined := ReadConfigHeader(path)
+		dmake.configLibs = nil
+		for _, lib := range libs {
+			if defined[HaveMacro("lib"+lib)] {
+				dmake.configLibs = append(dmake.configLibs, "-l"+lib)
+			}
+		}
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "dmake-configure-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	check := func(what, program string, link bool, extra ...string) bool {
+		source := filepath.Join(dir, "check.c")
+		if err := CreateFile(source, program); err != nil {
+			return false
+		}
+		args := append(compiler[1:len(compiler):len(compiler)], options...)
+		if link {
+			args = append(args, source, "-o", filepath.Join(dir, "check"))
+			args = append(args, extra...)
+			args = append(args, dmake.packageLibs...)
+		} else {
+			args = append(args, "-c", source, "-o", filepath.Join(dir, "check.o"))
+		}
+		logger.Debugf("RUN: %s %v", compiler[0], args)
+		cmd := exec.Command(compiler[0], args...)
+		cmd.Env = env
+		found := cmd.Run() == nil
+		if *verboseFlag {
+			result := "no"
+			if found {
+				result = "yes"
+			}
+			logger.Verbosef("checking for %s... %s", what, result)
+		}
+		return found
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "/* %s generated by dmake from %s */\n\n", filepath.Base(path), dmakeFileFilename)
+	define := func(name string, found bool) {
+		if found {
+			fmt.Fprintf(&b, "#define %s 1\n", HaveMacro(name))
+		} else {
+			fmt.Fprintf(&b, "/* #undef %s */\n", HaveMacro(name))
+		}
+	}
+
+	dmake.configLibs = nil
+	for _, lib := range libs {
+		found := check("library "+lib, checkLibProgram, true, "-l"+lib)
+		if found {
+			dmake.configLibs = append(dmake.configLibs, "-l"+lib)
+		}
+		define("lib"+lib, found)
+	}
+	for _, header := range headers {
+		define(header, check(header, fmt.Sprintf(checkHeaderProgram, header), false))
+	}
+	for _, fn := range funcs {
+		define(fn, check(fn+"()", fmt.Sprintf(checkFuncProgram, fn), true, dmake.configLibs...))
+	}
+
+	//  Only write a changed header, rewriting it would
+	//  needlessly recompile everything including it.
+	//
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, []byte(b.String())) {
+		now := time.Now()
+		err = os.Chtimes(path, now, now)
+	} else {
+		err = CreateFile(path, b.String())
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(commandFile), 0777); err != nil {
+		return err
+	}
+	return WriteCommandFile(commandFile, command)
+}
+
+//  Return the pathname of the file recording the target and compiler
+//  command used by the last Configure.
+//
+func (dmake *Dmake) ConfigCommandPath() string {
+	return filepath.Join(dmake.ObjsDir(), filepath.Base(dmake.ConfigHeader())+commandFileSuffix)
+}
+
+//  Return true if the receiver defines any feature checks.
+//
+func (dmake *Dmake) HaveChecks() bool {
+	for _, name := range []string{"CHECK_HEADERS", "CHECK_FUNCS", "CHECK_LIBS"} {
+		if len(strings.Fields(dmake.vars.GetString(name))) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//  Return the name of the header file written by Configure.
+//
+func (dmake *Dmake) ConfigHeader() string {
+	if name, found := dmake.vars.GetValue("CONFIG_HEADER"); found && name != "" {
+		return name
+	}
+	return defaultConfigHeaderFilename
+}
+
+//  Return the HAVE_ macro name for a feature, e.g. HAVE_SYS_TYPES_H
+//  for sys/types.h.
+//
+func HaveMacro(name string) string {
+	return "HAVE_" + strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+}
+
+//  Return the set of macros defined by a header written by Configure.
+//
+func ReadConfigHeader(path string) map[string]bool {
+	defined := make(map[string]bool)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return defined
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) == 3 && fields[0] == "#define" {
+			defined[fields[1]] = true
+		}
+	}
+	return defined
+}
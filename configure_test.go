@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigure(t *testing.T) {
+	if toolchain.msvc {
+		t.Skip("not using a gcc-like toolchain")
+	}
+	if _, err := exec.LookPath(toolchain.cc); err != nil {
+		t.Skip("no C compiler")
+	}
+	inTempProject(t, map[string]string{dmakeFileFilename: "CHECK_HEADERS = stdio.h no_such_header_dmake.h\n"})
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(dmakeFileFilename, old, old); err != nil {
+		t.Fatal(err)
+	}
+	dmake := &Dmake{vars: make(Vars)}
+	dmake.vars.SetValue("CHECK_HEADERS", "stdio.h no_such_header_dmake.h")
+
+	env := []string{"PATH=" + os.Getenv("PATH")}
+	if err := dmake.Configure(env); err != nil {
+		t.Fatal(err)
+	}
+	defined := ReadConfigHeader(defaultConfigHeaderFilename)
+	if !defined["HAVE_STDIO_H"] {
+		t.Error("stdio.h wasn't found")
+	}
+	if defined["HAVE_NO_SUCH_HEADER_DMAKE_H"] {
+		t.Error("a header that doesn't exist was found")
+	}
+
+	// An up to date header isn't checked again, one made with a
+	// different compiler command is.
+	if err := CreateFile(defaultConfigHeaderFilename, "/* unchanged */\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dmake.Configure(env); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(defaultConfigHeaderFilename); string(content) != "/* unchanged */\n" {
+		t.Errorf("an up to date header was rewritten:\n%s", content)
+	}
+	if err := dmake.Configure(append(env, "CC="+toolchain.cc+" -DDIFFERENT")); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(defaultConfigHeaderFilename); !strings.Contains(string(content), "HAVE_STDIO_H") {
+		t.Errorf("changing CC didn't repeat the checks:\n%s", content)
+	}
+}
@@ -0,0 +1,290 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+//  dmake coverage builds with --coverage, runs the tests and reports
+//  how much of the sources they executed. Instrumented objects can't
+//  be mixed with others so, as with sanitizers, the objects and output
+//  go in their own directories, e.g. .objs/cov. The report is written
+//  to the coverage directory, by gcovr, with an HTML report, if it's
+//  found, otherwise by gcov, or llvm-cov gcov when compiling with
+//  clang.
+//
+const (
+	coverageDirectory = "coverage"
+	coverageModeName  = "cov"
+)
+
+var coverageBuild bool
+
+//  Build with coverage instrumentation.
+//
+func SetCoverage() {
+	coverageBuild = true
+}
+
+//  Return the options used to compile and link with coverage
+//  instrumentation.
+//
+func CoverageOptions() []string {
+	if !coverageBuild {
+		return nil
+	}
+	return []string{"--coverage"}
+}
+
+//  The coverage of a source file.
+//
+type fileCoverage struct {
+	path     string
+	lines    int // the number of executable lines
+	executed int // the number executed
+}
+
+func (c fileCoverage) percent() float64 {
+	if c.lines == 0 {
+		return 100
+	}
+	return 100 * float64(c.executed) / float64(c.lines)
+}
+
+// dmake coverage in cwd
+//
+// Runs the tests, built with coverage, and reports the sources'
+// coverage.
+//
+func (dmake *Dmake) CoverageAction(env []string) error {
+	if len(dmake.testFiles) < 1 {
+		return fmt.Errorf("coverage requires tests, TESTS is not set")
+	}
+	objsdir := dmake.ObjsDir()
+	dirs := []string{objsdir}
+	for _, path := range append(dmake.sourceFiles, dmake.testFiles...) {
+		if dir := filepath.Dir(dmake.Target().ObjectFilename(path, objsdir)); !Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	if !*dryRunFlag {
+		// Counts accumulate, remove those of earlier runs.
+		for _, dir := range dirs {
+			counts, _ := filepath.Glob(filepath.Join(dir, "*.gcda"))
+			for _, path := range counts {
+				os.Remove(path)
+			}
+		}
+	}
+	if err := dmake.TestAction(env); err != nil {
+		return err
+	}
+
+	reportdir := dmake.BuildPath(coverageDirectory)
+	if *dryRunFlag {
+		return nil
+	}
+	if err := os.MkdirAll(reportdir, 0777); err != nil {
+		return err
+	}
+	gcov := dmake.GcovCommand(env)
+	if gcovr, err := exec.LookPath(Getenv("GCOVR", "gcovr")); err == nil {
+		return dmake.RunGcovr(gcovr, gcov, reportdir, dirs)
+	}
+	files, err := dmake.RunGcov(gcov, reportdir)
+	if err != nil {
+		return err
+	}
+	summary, err := os.Create(filepath.Join(reportdir, "summary.txt"))
+	if err != nil {
+		return err
+	}
+	WriteCoverageSummary(io.MultiWriter(CommandOutput(), summary), files)
+	if err := summary.Close(); err != nil {
+		return err
+	}
+	logger.Infof("coverage report written to %s", reportdir)
+	return nil
+}
+
+//  Return the gcov command matching the compiler, the .dmake GCOV
+//  variable or $GCOV if defined, otherwise gcov or, for clang,
+//  llvm-cov gcov.
+//
+func (dmake *Dmake) GcovCommand(env []string) []string {
+	if value, found := dmake.vars.GetValue("GCOV"); found && value != "" {
+		return strings.Fields(value)
+	}
+	if value, found := LookupEnv(env, "GCOV"); found && value != "" {
+		return strings.Fields(value)
+	}
+	variable, compiler := dmake.Toolchain().CompilerVariable(dmake.LanguageOf(dmake.sourceFiles))
+	if value, found := LookupEnv(env, variable); found && value != "" {
+		compiler = value
+	}
+	for _, word := range strings.Fields(compiler) {
+		if strings.Contains(filepath.Base(word), "clang") {
+			return []string{"llvm-cov", "gcov"}
+		}
+	}
+	return []string{"gcov"}
+}
+
+//  Report coverage using gcovr, writing a summary and an HTML report.
+//
+func (dmake *Dmake) RunGcovr(gcovr string, gcov []string, reportdir string, dirs []string) error {
+	args := []string{
+		"--root", ".",
+		"--gcov-executable", strings.Join(gcov, " "),
+		"--print-summary",
+		"--html-details", filepath.Join(reportdir, "index.html"),
+	}
+	for _, path := range dmake.testFiles {
+		args = append(args, "--exclude", "^"+regexp.QuoteMeta(filepath.ToSlash(path))+"$")
+	}
+	args = append(args, dirs...)
+	logger.Verbosef("RUN: %s %s", gcovr, ShellJoin(args))
+	cmd := exec.Command(gcovr, args...)
+	cmd.Stdout, cmd.Stderr = CommandOutput(), os.Stderr
+	if err := RunCommand(cmd); err != nil {
+		return fmt.Errorf("gcovr: %v", err)
+	}
+	logger.Infof("coverage report written to %s", filepath.Join(reportdir, "index.html"))
+	return nil
+}
+
+//  Run gcov for each object file, moving the annotated sources it
+//  writes to the report directory, and return the coverage of the
+//  sources. Sources compiled into more than one object, e.g. included
+//  by tests, have the best coverage found.
+//
+func (dmake *Dmake) RunGcov(gcov []string, reportdir string) ([]fileCoverage, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	absolute := func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(cwd, path)
+	}
+	best := make(map[string]fileCoverage)
+	for _, path := range append(dmake.sourceFiles, dmake.testFiles...) {
+		object := dmake.Target().ObjectFilename(path, dmake.ObjsDir())
+		args := append(gcov[1:len(gcov):len(gcov)], "-o", absolute(filepath.Dir(object)), absolute(path))
+		logger.Verbosef("RUN: %s %s", gcov[0], ShellJoin(args))
+		cmd := exec.Command(gcov[0], args...)
+		var output, errors bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &output, &errors
+		if err := RunCommand(cmd); err != nil {
+			os.Stderr.Write(errors.Bytes())
+			return nil, fmt.Errorf("%s: %v", strings.Join(gcov, " "), err)
+		}
+		if *verboseFlag {
+			os.Stderr.Write(errors.Bytes())
+		}
+		for _, line := range strings.Split(output.String(), "\n") {
+			if created := strings.TrimPrefix(line, "Creating '"); created != line {
+				created = strings.TrimSuffix(created, "'")
+				os.Rename(created, filepath.Join(reportdir, filepath.Base(created)))
+			}
+		}
+		for _, c := range ParseGcovOutput(&output) {
+			if rel, err := filepath.Rel(cwd, absolute(c.path)); err == nil && !strings.HasPrefix(rel, "..") {
+				c.path = rel
+			} else {
+				continue // system headers and the like
+			}
+			if Contains(dmake.testFiles, c.path) {
+				continue
+			}
+			if old, found := best[c.path]; !found || c.executed > old.executed {
+				best[c.path] = c
+			}
+		}
+	}
+	var files []fileCoverage
+	for _, c := range best {
+		files = append(files, c)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, nil
+}
+
+//  Parse gcov's output, for each file,
+//
+//	File 'lib.c'
+//	Lines executed:85.71% of 7
+//
+func ParseGcovOutput(r io.Reader) []fileCoverage {
+	var files []fileCoverage
+	var path string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "File '") && strings.HasSuffix(line, "'") {
+			path = line[len("File '") : len(line)-1]
+			continue
+		}
+		if path == "" || !strings.HasPrefix(line, "Lines executed:") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Lines executed:"))
+		if len(fields) != 3 || fields[1] != "of" {
+			continue
+		}
+		percent, err1 := strconv.ParseFloat(strings.TrimSuffix(fields[0], "%"), 64)
+		lines, err2 := strconv.Atoi(fields[2])
+		if err1 == nil && err2 == nil {
+			executed := int(percent*float64(lines)/100 + 0.5)
+			files = append(files, fileCoverage{path: path, lines: lines, executed: executed})
+		}
+		path = ""
+	}
+	return files
+}
+
+//  Return true if a directory holds a coverage report.
+//
+func IsCoverageReport(dir string) bool {
+	for _, name := range []string{"summary.txt", "index.html"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+//  Write a table of the files' coverage and the total.
+//
+func WriteCoverageSummary(w io.Writer, files []fileCoverage) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "File\tLines\tExecuted\tCover\t")
+	total := fileCoverage{path: "TOTAL"}
+	for _, c := range files {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\t\n", c.path, c.lines, c.executed, c.percent())
+		total.lines += c.lines
+		total.executed += c.executed
+	}
+	fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\t\n", total.path, total.lines, total.executed, total.percent())
+	tw.Flush()
+}
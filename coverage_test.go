@@ -0,0 +1,25 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGcovOutput(t *testing.T) {
+	output := `File 'lib.c'
+Lines executed:85.71% of 7
+Creating 'lib.c.gcov'
+
+File '/usr/include/stdio.h'
+No executable lines
+Lines executed:0.00% of 0
+`
+	expected := []fileCoverage{
+		{path: "lib.c", lines: 7, executed: 6},
+		{path: "/usr/include/stdio.h", lines: 0, executed: 0},
+	}
+	if files := ParseGcovOutput(strings.NewReader(output)); !reflect.DeepEqual(files, expected) {
+		t.Errorf("parsed %+v, expected %+v", files, expected)
+	}
+}
@@ -0,0 +1,653 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+//  "dmake daemon" runs a long-lived dmake for the directory it's
+//  started in, and those below it, so repeated builds of a large tree
+//  don't start from scratch. It listens on the unix socket
+//  .dmake-daemon.sock and, while it's running, dmake commands run in
+//  the tree send it their requests, write the output it sends back and
+//  exit with the build's status. The -no-daemon option builds without
+//  it, as do "dmake run", "dmake debug", "dmake docs", "dmake init"
+//  and -sudo, which need the terminal.
+//
+//  Each build is run, one at a time, by a dmake started by the daemon.
+//  These ask the daemon for the results of scanning source files for
+//  main functions and of expanding "**" patterns, which it keeps in
+//  memory, scanning a file again only once it's changed and walking a
+//  tree again only once one of its directories has. The .dmake files
+//  are read by every build as they may run commands and depend on the
+//  build's environment.
+//
+//  The socket is only accessible to the daemon's user. A build uses
+//  the environment of the dmake that requested it except for the
+//  variables naming the programs run, PATH, DCC, CC, CXX, LD and AR,
+//  which are the daemon's.
+//
+//  "dmake daemon -stop", or interrupting it, stops the daemon.
+//
+const daemonSocketFilename = ".dmake-daemon.sock"
+
+//  The environment variables taken from the daemon's environment, not
+//  that of the dmake requesting a build.
+//
+var daemonEnvironmentVariables = []string{"PATH", "DCC", "CC", "CXX", "LD", "AR"}
+
+//  A dmake run by the daemon is given the path of its socket in this
+//  environment variable.
+//
+const daemonEnvVar = "DMAKEDAEMON"
+
+//  The actions that need the terminal, and aren't sent to the daemon.
+//
+var daemonlessActions = []string{"run", "debug", "docs", "init"}
+
+//  A request sent to the daemon, as a JSON line.
+//
+type DaemonRequest struct {
+	Op      string   `json:"op"` // build, main, glob or stop
+	Dir     string   `json:"dir,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Env     []string `json:"env,omitempty"`
+	Path    string   `json:"path,omitempty"`    // the source file scanned for a main function
+	Pattern string   `json:"pattern,omitempty"` // the absolute "**" pattern expanded
+}
+
+//  A response from the daemon. A build's output is sent as it's
+//  written, followed by a response with Done set.
+//
+type DaemonResponse struct {
+	Stdout  string   `json:"stdout,omitempty"`
+	Stderr  string   `json:"stderr,omitempty"`
+	Done    bool     `json:"done,omitempty"`
+	Status  int      `json:"status,omitempty"`
+	Main    string   `json:"main,omitempty"`
+	Matches []string `json:"matches,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+//  A Daemon serves the requests made to its socket.
+//
+type Daemon struct {
+	sync.Mutex
+	socket    string
+	root      string   // the directory the daemon serves
+	env       []string // the environment of builds made using the API
+	listener  net.Listener
+	server    *http.Server               // serving the API, if it's used
+	tokenFile string                     // holding the API's token, if it's used
+	building  sync.Mutex                 // held while a build runs
+	build     *exec.Cmd                  // the build running, if any
+	stopping  bool                       // no more requests are accepted
+	mains     map[string]mainCacheEntry  // by absolute path
+	globs     map[string]*globCacheEntry // by absolute pattern
+}
+
+type globCacheEntry struct {
+	dirs    map[string]int64 // the directories walked and their modification times
+	matches []string
+}
+
+//  Return a daemon listening on the socket.
+//
+func NewDaemon(socket string, listener net.Listener) *Daemon {
+	return &Daemon{
+		socket:   socket,
+		root:     filepath.Dir(socket),
+		env:      os.Environ(),
+		listener: listener,
+		mains:    make(map[string]mainCacheEntry),
+		globs:    make(map[string]*globCacheEntry),
+	}
+}
+
+//  dmake daemon [-stop | -http[=address]] in dir
+//
+func DaemonAction(dir string, args []string) error {
+	if dir == "" {
+		dir = "."
+	}
+	socket, err := filepath.Abs(filepath.Join(dir, daemonSocketFilename))
+	if err != nil {
+		return err
+	}
+	address := ""
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && args[0] == "-stop":
+		return StopDaemon(socket)
+	case len(args) == 1 && args[0] == "-http":
+		address = defaultDaemonAddress
+	case len(args) == 1 && strings.HasPrefix(args[0], "-http="):
+		address = strings.TrimPrefix(args[0], "-http=")
+	default:
+		return fmt.Errorf("usage: dmake daemon [-stop | -http[=address]]")
+	}
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s: a daemon is already running", socket)
+	}
+	os.Remove(socket) // left by a daemon that didn't exit cleanly
+	listener, err := ListenPrivate(socket)
+	if err != nil {
+		return err
+	}
+	d := NewDaemon(socket, listener)
+	if address != "" {
+		if err := d.ServeAPI(address); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logger.Warnf("%v, stopping", sig)
+		d.Stop(sig)
+	}()
+	logger.Infof("listening on %s", socket)
+	return d.Serve()
+}
+
+//  Listen on a unix socket only the user can connect to. The socket is
+//  created in a directory only the user can use, made accessible only
+//  to the user and then moved into place, so others can never connect
+//  to it, whatever the umask. As it's moved, it's not removed when the
+//  listener's closed.
+//
+func ListenPrivate(socket string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(socket), ".dmake-daemon-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	private := filepath.Join(dir, filepath.Base(socket))
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: private, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	listener.SetUnlinkOnClose(false)
+	if err = os.Chmod(private, 0600); err == nil {
+		err = os.Rename(private, socket)
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+//  Ask the daemon listening on a socket to stop.
+//
+func StopDaemon(socket string) error {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return fmt.Errorf("%s: no daemon is running", socket)
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(&DaemonRequest{Op: "stop"}); err != nil {
+		return err
+	}
+	var resp DaemonResponse
+	return json.NewDecoder(conn).Decode(&resp)
+}
+
+//  Serve requests until the daemon's stopped, waiting for the build
+//  running, if any, to finish.
+//
+func (d *Daemon) Serve() error {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			d.Lock()
+			stopping := d.stopping
+			d.Unlock()
+			if !stopping {
+				return err
+			}
+			d.building.Lock()
+			d.building.Unlock()
+			return nil
+		}
+		go d.serveConnection(conn)
+	}
+}
+
+//  Stop accepting requests, forwarding the signal, if any, to the
+//  build running.
+//
+func (d *Daemon) Stop(sig os.Signal) {
+	d.Lock()
+	defer d.Unlock()
+	if d.stopping {
+		return
+	}
+	d.stopping = true
+	d.listener.Close()
+	os.Remove(d.socket)
+	if d.server != nil {
+		go d.server.Shutdown(context.Background())
+	}
+	if d.tokenFile != "" {
+		os.Remove(d.tokenFile)
+	}
+	if sig != nil && d.build != nil && d.build.Process != nil {
+		d.build.Process.Signal(sig)
+	}
+}
+
+func (d *Daemon) serveConnection(conn net.Conn) {
+	defer conn.Close()
+	input := json.NewDecoder(conn)
+	output := &daemonResponder{enc: json.NewEncoder(conn)}
+	for {
+		var req DaemonRequest
+		if err := input.Decode(&req); err != nil {
+			if err != io.EOF {
+				logger.Debugf("daemon: %v", err)
+			}
+			return
+		}
+		var resp DaemonResponse
+		var err error
+		switch req.Op {
+		case "build":
+			resp.Status, err = d.Build(&req, output, conn)
+			resp.Done = true
+		case "main":
+			resp.Main, err = d.MainFunction(req.Path)
+		case "glob":
+			resp.Matches, err = d.RecursiveGlob(req.Pattern)
+		case "stop":
+			d.Stop(nil)
+			resp.Done = true
+		default:
+			err = fmt.Errorf("%q: unknown request", req.Op)
+		}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		if output.Send(&resp) != nil || req.Op == "build" || req.Op == "stop" {
+			return
+		}
+	}
+}
+
+//  Run a build, sending its output to the client, and return its exit
+//  status. The build is interrupted if the client goes away.
+//
+func (d *Daemon) Build(req *DaemonRequest, output *daemonResponder, conn net.Conn) (int, error) {
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(gone)
+	}()
+	stdout := output.Writer(func(s string) *DaemonResponse { return &DaemonResponse{Stdout: s} })
+	stderr := output.Writer(func(s string) *DaemonResponse { return &DaemonResponse{Stderr: s} })
+	return d.Run(req.Dir, req.Args, DaemonBuildEnvironment(req.Env, d.env), stdout, stderr, gone)
+}
+
+//  Return the environment of a build requested by a client, the
+//  client's environment with the daemon's values of the variables
+//  naming the programs run.
+//
+func DaemonBuildEnvironment(client, daemon []string) []string {
+	env := client
+	for _, name := range daemonEnvironmentVariables {
+		env = RemoveEnv(env, name)
+		if value, found := LookupEnv(daemon, name); found {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+//  Run dmake, with the arguments and environment, in a directory, one
+//  at a time, and return its exit status. It's interrupted if cancel
+//  is closed before it finishes.
+//
+func (d *Daemon) Run(dir string, args, env []string, stdout, stderr io.Writer, cancel <-chan struct{}) (int, error) {
+	d.building.Lock()
+	defer d.building.Unlock()
+	self, err := os.Executable()
+	if err != nil {
+		return 1, err
+	}
+	logger.Infof("%s: dmake %s", dir, strings.Join(args, " "))
+	cmd := exec.Command(self, args...)
+	cmd.Dir = dir
+	cmd.Env = SetEnv(env, daemonEnvVar, d.socket)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	d.Lock()
+	if d.stopping {
+		d.Unlock()
+		return 1, fmt.Errorf("the daemon is stopping")
+	}
+	if err := cmd.Start(); err != nil {
+		d.Unlock()
+		return 1, err
+	}
+	d.build = cmd
+	d.Unlock()
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-finished:
+		case <-cancel:
+			logger.Warnf("%s: the client went away, interrupting the build", dir)
+			cmd.Process.Signal(os.Interrupt)
+		}
+	}()
+	err = cmd.Wait()
+	close(finished)
+	d.Lock()
+	d.build = nil
+	d.Unlock()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		logger.Infof("%s: exit status %d", dir, exitErr.ExitCode())
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+//  Return the main function defined by a source file, scanning it
+//  only if it's changed since it was last scanned.
+//
+func (d *Daemon) MainFunction(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	modtime := info.ModTime().UnixNano()
+	d.Lock()
+	entry, found := d.mains[path]
+	d.Unlock()
+	if found && entry.modtime == modtime {
+		return entry.name, nil
+	}
+	name := MainFunction(path)
+	d.Lock()
+	d.mains[path] = mainCacheEntry{modtime: modtime, name: name}
+	d.Unlock()
+	return name, nil
+}
+
+//  Return the files matching an absolute "**" pattern, walking the
+//  tree again only if one of its directories has changed.
+//
+func (d *Daemon) RecursiveGlob(pattern string) ([]string, error) {
+	d.Lock()
+	entry, found := d.globs[pattern]
+	d.Unlock()
+	if found && entry.Current() {
+		return entry.matches, nil
+	}
+	entry = &globCacheEntry{dirs: make(map[string]int64)}
+	matches, err := recursiveGlob(pattern, entry.dirs)
+	if err != nil {
+		return nil, err
+	}
+	entry.matches = matches
+	d.Lock()
+	d.globs[pattern] = entry
+	d.Unlock()
+	return matches, nil
+}
+
+//  Return true if none of the directories walked has changed.
+//
+func (entry *globCacheEntry) Current() bool {
+	for dir, modtime := range entry.dirs {
+		if directoryModtime(dir) != modtime {
+			return false
+		}
+	}
+	return true
+}
+
+//  Return a directory's modification time, -1 if it doesn't exist.
+//
+func directoryModtime(dir string) int64 {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return -1
+	}
+	return info.ModTime().UnixNano()
+}
+
+//  Writes a build's output to the client.
+//
+type daemonResponder struct {
+	sync.Mutex
+	enc *json.Encoder
+}
+
+func (r *daemonResponder) Send(resp *DaemonResponse) error {
+	r.Lock()
+	defer r.Unlock()
+	return r.enc.Encode(resp)
+}
+
+//  Return a writer sending what's written in the responses made by fn.
+//
+func (r *daemonResponder) Writer(fn func(string) *DaemonResponse) io.Writer {
+	return daemonWriterFunc(func(p []byte) (int, error) {
+		if err := r.Send(fn(string(p))); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	})
+}
+
+type daemonWriterFunc func([]byte) (int, error)
+
+func (fn daemonWriterFunc) Write(p []byte) (int, error) {
+	return fn(p)
+}
+
+//  ----------------------------------------------------------------
+
+//  Return the daemon's socket in dir, or the closest of its parents,
+//  or an empty string if there isn't one.
+//
+func FindDaemonSocket(dir string) string {
+	for {
+		path := filepath.Join(dir, daemonSocketFilename)
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+//  Return true if dmake, run with the arguments, sends its request to
+//  a daemon.
+//
+func UsesDaemon(args []string) bool {
+	if *noDaemonFlag || *sudoFlag || os.Getenv(daemonEnvVar) != "" {
+		return false
+	}
+	for _, arg := range args {
+		if Contains(daemonlessActions, arg) {
+			return false
+		}
+	}
+	return true
+}
+
+//  Have the daemon for the current directory, if one's running, do the
+//  build, writing its output. Returns the build's exit status and
+//  true if the daemon did the build. The environment is that dmake was
+//  started with.
+//
+func ForwardToDaemon(env []string) (int, bool) {
+	if !UsesDaemon(flag.Args()) {
+		return 0, false
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return 0, false
+	}
+	dir := *chdir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(cwd, dir)
+	}
+	socket := FindDaemonSocket(dir)
+	if socket == "" {
+		return 0, false
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		logger.Debugf("%s: %v", socket, err)
+		return 0, false
+	}
+	defer conn.Close()
+	logger.Debugf("building using the daemon at %s", socket)
+	if logger.color {
+		env = SetEnv(env, "CLICOLOR_FORCE", "1")
+	}
+	req := &DaemonRequest{Op: "build", Dir: cwd, Args: os.Args[1:], Env: env}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		logger.Errorf("%s: %v", socket, err)
+		return 1, true
+	}
+	input := json.NewDecoder(conn)
+	for {
+		var resp DaemonResponse
+		if err := input.Decode(&resp); err != nil {
+			logger.Errorf("%s: %v", socket, err)
+			return 1, true
+		}
+		io.WriteString(os.Stdout, resp.Stdout)
+		io.WriteString(os.Stderr, resp.Stderr)
+		if resp.Error != "" {
+			logger.Errorf("daemon: %s", resp.Error)
+		}
+		if resp.Done {
+			if resp.Error != "" && resp.Status == 0 {
+				return 1, true
+			}
+			return resp.Status, true
+		}
+	}
+}
+
+//  ----------------------------------------------------------------
+
+//  A DaemonClient is used by a dmake run by the daemon to ask for the
+//  results it's cached.
+//
+type DaemonClient struct {
+	sync.Mutex
+	conn   net.Conn
+	output *json.Encoder
+	input  *json.Decoder
+}
+
+//  The daemon the current build was started by, if any.
+//
+var daemonClient *DaemonClient
+
+//  Connect to the daemon listening on a socket.
+//
+func ConnectDaemon(socket string) (*DaemonClient, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	return &DaemonClient{conn: conn, output: json.NewEncoder(conn), input: json.NewDecoder(conn)}, nil
+}
+
+func (c *DaemonClient) request(req *DaemonRequest) (*DaemonResponse, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.output.Encode(req); err != nil {
+		return nil, err
+	}
+	resp := &DaemonResponse{}
+	if err := c.input.Decode(resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+//  Return the main function defined by a source file, asking the
+//  daemon if there is one.
+//
+func (c *DaemonClient) MainFunction(path string) string {
+	if c != nil {
+		if abs, err := filepath.Abs(path); err == nil {
+			resp, err := c.request(&DaemonRequest{Op: "main", Path: abs})
+			if err == nil {
+				return resp.Main
+			}
+			logger.Debugf("daemon: %v", err)
+		}
+	}
+	return MainFunction(path)
+}
+
+//  Return the names of the files matching a "**" pattern, asking the
+//  daemon if there is one. The names are as RecursiveGlob returns.
+//
+func (c *DaemonClient) RecursiveGlob(pattern string) ([]string, error) {
+	if c == nil {
+		return RecursiveGlob(pattern)
+	}
+	index := strings.Index(pattern, "**")
+	root := filepath.Clean(pattern[:index])
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return RecursiveGlob(pattern)
+	}
+	resp, err := c.request(&DaemonRequest{Op: "glob", Pattern: filepath.Join(abs, "**") + pattern[index+2:]})
+	if err != nil {
+		logger.Debugf("daemon: %v", err)
+		return RecursiveGlob(pattern)
+	}
+	matches := make([]string, 0, len(resp.Matches))
+	for _, match := range resp.Matches {
+		rel, err := filepath.Rel(abs, match)
+		if err != nil {
+			return RecursiveGlob(pattern)
+		}
+		matches = append(matches, filepath.Join(root, rel))
+	}
+	return matches, nil
+}
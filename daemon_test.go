@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestDaemon(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	src := filepath.Join(dir, "src")
+	then := time.Now().Add(-time.Hour)
+	os.Chtimes(src, then, then)
+
+	socket := filepath.Join(dir, daemonSocketFilename)
+	listener, err := ListenPrivate(socket)
+	if err != nil {
+		t.Skip(err)
+	}
+	if info, err := os.Stat(socket); err != nil || runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("socket %v, %v", info, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("%d files in the directory, expected src and the socket", len(entries))
+	}
+	d := NewDaemon(socket, listener)
+	go d.Serve()
+	defer d.Stop(nil)
+	if found := FindDaemonSocket(src); found != socket {
+		t.Errorf("found the socket %q, expected %q", found, socket)
+	}
+
+	client, err := ConnectDaemon(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := client.MainFunction(filepath.Join(src, "main.c")); name != "main" {
+		t.Errorf("main function %q", name)
+	}
+	pattern := filepath.Join(src, "**", "*.c")
+	matches, err := client.RecursiveGlob(pattern)
+	if err != nil || !reflect.DeepEqual(matches, []string{filepath.Join(src, "main.c")}) {
+		t.Errorf("glob matched %q, %v", matches, err)
+	}
+	os.WriteFile(filepath.Join(src, "util.c"), nil, 0666)
+	matches, err = client.RecursiveGlob(pattern)
+	if err != nil || len(matches) != 2 {
+		t.Errorf("glob matched %q after adding a file, %v", matches, err)
+	}
+	if _, err := client.request(&DaemonRequest{Op: "bogus"}); err == nil {
+		t.Errorf("unknown request succeeded")
+	}
+
+	env := DaemonBuildEnvironment([]string{"PATH=/tmp/evil", "CC=/tmp/evil/cc", "CXX=/tmp/evil/c++", "CFLAGS=-O2"}, []string{"PATH=/usr/bin", "CC=gcc"})
+	if !reflect.DeepEqual(env, []string{"CFLAGS=-O2", "PATH=/usr/bin", "CC=gcc"}) {
+		t.Errorf("build environment %q", env)
+	}
+}
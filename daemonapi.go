@@ -0,0 +1,514 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+//  With -http "dmake daemon" also serves a JSON API, on a loopback
+//  address, so editors and other tools can drive builds without
+//  running dmake and parsing its output,
+//
+//	POST /build {"dir": "app", "args": ["test"]}
+//		Build, as "dmake -json" run in the directory with the
+//		arguments. The response is the build's events, a JSON
+//		object per line, as they happen. The output of the
+//		commands run are "output" events and the last event,
+//		"exit", has the build's exit status.
+//
+//	GET /targets?dir=app
+//		The targets built in the directory and its
+//		sub-directories, as described by "dmake -json list".
+//
+//	GET /flags?file=app/main.c
+//		The language, compiler options and command used to
+//		compile a source file, as described by "dmake -json
+//		flags", one of those built in the directory named by
+//		dir, if given, or the daemon's directory.
+//
+//  Names are relative to the directory the daemon was started in and
+//  can't name anything outside it. A build's arguments are limited to
+//  the actions and options that only build, and report on, what's in
+//  the directory. Variables can't be defined, options naming commands,
+//  e.g. -dcc, or other directories, e.g. -C, aren't allowed and the
+//  files and directories named must be in the daemon's directory. Every request must have the header
+//  X-Dmake-Token holding the token the daemon writes, readable only by
+//  its user, to .dmake-daemon.token in its directory when it starts.
+//  Requests from web pages, those with an Origin header, those made to
+//  a host other than a loopback host and POST requests that aren't JSON
+//  are refused.
+//
+const (
+	defaultDaemonAddress  = "localhost:7878"
+	daemonTokenFilename   = ".dmake-daemon.token"
+	daemonTokenHeader     = "X-Dmake-Token"
+	daemonTokenRandomSize = 32
+)
+
+//  The actions the build API runs.
+//
+var daemonAPIActions = []string{"build", "test", "clean", "list", "graph", "explain", "flags", "doctor", "coverage", "tidy", "analyze"}
+
+//  The kinds of option the build API passes on.
+//
+const (
+	apiSwitch = iota // an option without a value
+	apiValue         // an option with a value
+	apiPath          // an option naming a file or directory
+)
+
+//  The options the build API passes on, by name, and their kinds.
+//
+var daemonAPIOptions = map[string]int{
+	"B":                      apiPath,
+	"builddir":               apiPath,
+	"o":                      apiPath,
+	"sarif":                  apiPath,
+	"toolchain":              apiPath,
+	"ci-annotations":         apiValue,
+	"j":                      apiValue,
+	"lang":                   apiValue,
+	"mode":                   apiValue,
+	"sanitize":               apiValue,
+	"target":                 apiValue,
+	"targets":                apiValue,
+	"build-info":             apiSwitch,
+	"cache":                  apiSwitch,
+	"dcc-debug":              apiSwitch,
+	"debug":                  apiSwitch,
+	"distcc":                 apiSwitch,
+	"dll":                    apiSwitch,
+	"embed-version":          apiSwitch,
+	"json":                   apiSwitch,
+	"k":                      apiSwitch,
+	"n":                      apiSwitch,
+	"no-color":               apiSwitch,
+	"plugin":                 apiSwitch,
+	"quiet":                  apiSwitch,
+	"reproducible":           apiSwitch,
+	"static":                 apiSwitch,
+	"time":                   apiSwitch,
+	"v":                      apiSwitch,
+	"Werror":                 apiSwitch,
+	"write-compile-commands": apiSwitch,
+}
+
+//  An event written by the build API, as well as those written by the
+//  build itself.
+//
+type DaemonEvent struct {
+	Event  string `json:"event"` // output or exit
+	Text   string `json:"text,omitempty"`
+	Status *int   `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+//  A target, and the directory it's built in, as returned by the
+//  targets API.
+//
+type DaemonTarget struct {
+	Directory string `json:"directory"`
+	*TargetDescription
+}
+
+//  Start serving the API at an address.
+//
+func (d *Daemon) ServeAPI(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	if addr, ok := listener.Addr().(*net.TCPAddr); !ok || !addr.IP.IsLoopback() {
+		listener.Close()
+		return fmt.Errorf("-http=%s: the API is only served on a loopback address, e.g. %s", address, defaultDaemonAddress)
+	}
+	token, err := d.WriteToken()
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/build", localOnly(token, d.handleBuild))
+	mux.HandleFunc("/targets", localOnly(token, d.handleTargets))
+	mux.HandleFunc("/flags", localOnly(token, d.handleFlags))
+	d.server = &http.Server{Handler: mux}
+	logger.Infof("serving the API at http://%s/", listener.Addr())
+	go func() {
+		if err := d.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("%v", err)
+		}
+	}()
+	return nil
+}
+
+//  Create the API's token, a random string, and write it to a file
+//  only the daemon's user can read.
+//
+func (d *Daemon) WriteToken() (string, error) {
+	random := make([]byte, daemonTokenRandomSize)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(random)
+	d.tokenFile = filepath.Join(d.root, daemonTokenFilename)
+	os.Remove(d.tokenFile) // left by a daemon that didn't exit cleanly
+	file, err := os.OpenFile(d.tokenFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.WriteString(file, token+"\n")
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(d.tokenFile)
+		return "", err
+	}
+	return token, nil
+}
+
+//  Return a handler refusing requests without the token, and those
+//  that may come from a web page: those with an Origin, those made to
+//  another host, by DNS rebinding, and POST requests that aren't
+//  JSON.
+//
+func localOnly(token string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !isLoopbackHost(host) {
+			httpError(w, http.StatusForbidden, fmt.Errorf("%s: not a loopback host", r.Host))
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			httpError(w, http.StatusForbidden, fmt.Errorf("%s: cross-origin requests are refused", origin))
+			return
+		}
+		if given := r.Header.Get(daemonTokenHeader); subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			httpError(w, http.StatusUnauthorized, fmt.Errorf("%s: missing or wrong, see %s", daemonTokenHeader, daemonTokenFilename))
+			return
+		}
+		if r.Method == http.MethodPost {
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+				httpError(w, http.StatusUnsupportedMediaType, fmt.Errorf("requests must be application/json"))
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+func httpError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&DaemonEvent{Event: "error", Error: err.Error()})
+}
+
+func httpReply(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+//  Return the path named in a request, relative to the daemon's
+//  directory, refusing absolute paths and any outside the directory.
+//
+func (d *Daemon) path(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("%s: names must be relative to the daemon's directory", name)
+	}
+	path := filepath.Join(d.root, name)
+	if rel, err := filepath.Rel(d.root, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: outside the daemon's directory", name)
+	}
+	return path, nil
+}
+
+//  Check the arguments of a build run in a directory, named relative
+//  to the daemon's, and return them with the files and directories
+//  they name made absolute. Only the allowed actions and options are
+//  accepted.
+//
+func (d *Daemon) BuildArgs(dir string, args []string) ([]string, error) {
+	path := func(name string) (string, error) {
+		if filepath.IsAbs(name) {
+			return d.path(name)
+		}
+		return d.path(filepath.Join(dir, name))
+	}
+	var result []string
+	files := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if files {
+			file, err := path(arg)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, file)
+			continue
+		}
+		if !strings.HasPrefix(arg, "-") {
+			if Contains(daemonAPIActions, arg) {
+				files = arg == "flags"
+			} else if isAction(arg) || arg == "daemon" {
+				return nil, fmt.Errorf("%s: not allowed", arg)
+			} else if strings.Contains(arg, "=") {
+				return nil, fmt.Errorf("%s: variables can't be defined", arg)
+			} else if subdir, err := path(arg); err != nil {
+				return nil, err
+			} else if info, err := os.Stat(subdir); err == nil && info.IsDir() {
+				arg = subdir
+			}
+			result = append(result, arg)
+			continue
+		}
+		option := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)
+		kind, found := daemonAPIOptions[option[0]]
+		if !found {
+			return nil, fmt.Errorf("%s: not allowed", arg)
+		}
+		if kind == apiSwitch {
+			result = append(result, arg)
+			continue
+		}
+		if len(option) == 1 {
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("%s: no value given", arg)
+			}
+			i++
+			option = append(option, args[i])
+		}
+		if kind == apiPath {
+			file, err := path(option[1])
+			if err != nil {
+				return nil, err
+			}
+			option[1] = file
+		}
+		result = append(result, "-"+option[0]+"="+option[1])
+	}
+	return result, nil
+}
+
+//  Return true if an argument names one of dmake's actions.
+//
+func isAction(arg string) bool {
+	for action := Building; action <= Debugging; action++ {
+		if action.String() == arg {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Daemon) handleBuild(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s: use POST", r.URL.Path))
+		return
+	}
+	var req struct {
+		Dir  string   `json:"dir"`
+		Args []string `json:"args"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	dir, err := d.path(req.Dir)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	buildArgs, err := d.BuildArgs(req.Dir, req.Args)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	events := &eventStream{w: w}
+	stdout := &lineWriter{fn: events.WriteLine}
+	stderr := &lineWriter{fn: func(line string) {
+		events.Send(&DaemonEvent{Event: "output", Text: line})
+	}}
+	args := append([]string{"-json"}, buildArgs...)
+	status, err := d.Run(dir, args, d.env, stdout, stderr, r.Context().Done())
+	stdout.Flush()
+	stderr.Flush()
+	exit := &DaemonEvent{Event: "exit", Status: &status}
+	if err != nil {
+		exit.Error = err.Error()
+	}
+	events.Send(exit)
+}
+
+func (d *Daemon) handleTargets(w http.ResponseWriter, r *http.Request) {
+	dir, err := d.path(r.URL.Query().Get("dir"))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	targets, err := d.Targets(dir, r.Context().Done())
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	httpReply(w, targets)
+}
+
+func (d *Daemon) handleFlags(w http.ResponseWriter, r *http.Request) {
+	file := r.URL.Query().Get("file")
+	if file == "" {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("no file given"))
+		return
+	}
+	dir, err := d.path(r.URL.Query().Get("dir"))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	path, err := d.path(file)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	events, err := d.Query(dir, r.Context().Done(), "flags", path)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, event := range events {
+		if event.Event == FlagsEvent && event.Flags != nil {
+			httpReply(w, event.Flags)
+			return
+		}
+	}
+	httpError(w, http.StatusNotFound, fmt.Errorf("%s: not compiled by any target", file))
+}
+
+//  Return the targets built in a directory and its sub-directories.
+//
+func (d *Daemon) Targets(dir string, cancel <-chan struct{}) ([]DaemonTarget, error) {
+	events, err := d.Query(dir, cancel, "list")
+	if err != nil {
+		return nil, err
+	}
+	targets := []DaemonTarget{}
+	for _, event := range events {
+		if event.Event == TargetEvent && event.Target != nil {
+			targets = append(targets, DaemonTarget{Directory: event.Directory, TargetDescription: event.Target})
+		}
+	}
+	return targets, nil
+}
+
+//  Run "dmake -json" with the arguments in a directory and return the
+//  events it writes.
+//
+func (d *Daemon) Query(dir string, cancel <-chan struct{}, args ...string) ([]Event, error) {
+	var stdout, stderr bytes.Buffer
+	status, err := d.Run(dir, append([]string{"-json"}, args...), d.env, &stdout, &stderr, cancel)
+	if err != nil {
+		return nil, err
+	}
+	if status != 0 {
+		return nil, fmt.Errorf("%s", strings.TrimSpace(stderr.String()))
+	}
+	var events []Event
+	for input := json.NewDecoder(&stdout); ; {
+		var event Event
+		if err := input.Decode(&event); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+}
+
+//  Writes events to an HTTP response as they happen.
+//
+type eventStream struct {
+	sync.Mutex
+	w io.Writer
+}
+
+//  Write a line of JSON written by the build.
+//
+func (s *eventStream) WriteLine(line string) {
+	s.Lock()
+	defer s.Unlock()
+	io.WriteString(s.w, line+"\n")
+	s.flush()
+}
+
+func (s *eventStream) Send(event *DaemonEvent) {
+	s.Lock()
+	defer s.Unlock()
+	json.NewEncoder(s.w).Encode(event)
+	s.flush()
+}
+
+func (s *eventStream) flush() {
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//  A lineWriter calls a function with each line written to it.
+//
+type lineWriter struct {
+	fn   func(string)
+	line []byte // the incomplete last line
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.line = append(lw.line, p...)
+	for {
+		i := bytes.IndexByte(lw.line, '\n')
+		if i < 0 {
+			break
+		}
+		lw.fn(string(bytes.TrimRight(lw.line[:i], "\r")))
+		lw.line = lw.line[i+1:]
+	}
+	return len(p), nil
+}
+
+//  Pass on any incomplete last line.
+//
+func (lw *lineWriter) Flush() {
+	if len(lw.line) > 0 {
+		lw.fn(string(lw.line))
+		lw.line = nil
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDaemonAPI(t *testing.T) {
+	called := false
+	handler := localOnly("secret", func(w http.ResponseWriter, r *http.Request) { called = true })
+	cases := []struct {
+		method, host, contentType, origin, token string
+		status                                   int
+	}{
+		{"GET", "localhost:7878", "", "", "secret", http.StatusOK},
+		{"GET", "127.0.0.1:7878", "", "", "secret", http.StatusOK},
+		{"GET", "[::1]:7878", "", "", "secret", http.StatusOK},
+		{"GET", "attacker.example:7878", "", "", "secret", http.StatusForbidden},
+		{"GET", "localhost:7878", "", "http://attacker.example", "secret", http.StatusForbidden},
+		{"GET", "localhost:7878", "", "", "", http.StatusUnauthorized},
+		{"GET", "localhost:7878", "", "", "guess", http.StatusUnauthorized},
+		{"POST", "localhost:7878", "text/plain", "", "secret", http.StatusUnsupportedMediaType},
+		{"POST", "localhost:7878", "application/json; charset=utf-8", "", "secret", http.StatusOK},
+	}
+	for _, c := range cases {
+		called = false
+		r := httptest.NewRequest(c.method, "/build", strings.NewReader("{}"))
+		r.Host = c.host
+		r.Header.Set("Content-Type", c.contentType)
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		r.Header.Set(daemonTokenHeader, c.token)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != c.status || called != (c.status == http.StatusOK) {
+			t.Errorf("%s %s %q origin %q token %q: status %d, handled %v", c.method, c.host, c.contentType, c.origin, c.token, w.Code, called)
+		}
+	}
+
+	d := &Daemon{root: t.TempDir()}
+	for _, name := range []string{"", "app", "app/../lib", "app/main.c"} {
+		if path, err := d.path(name); err != nil || path != filepath.Join(d.root, name) {
+			t.Errorf("%q: path %q, %v", name, path, err)
+		}
+	}
+	for _, name := range []string{"..", "../elsewhere", "app/../../elsewhere", "/etc/passwd"} {
+		if path, err := d.path(name); err == nil {
+			t.Errorf("%q: path %q, expected an error", name, path)
+		}
+	}
+	token, err := d.WriteToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(d.root, daemonTokenFilename)); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("token file %v, %v", info, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(d.root, daemonTokenFilename)); strings.TrimSpace(string(data)) != token {
+		t.Errorf("token file holds %q, expected %q", data, token)
+	}
+
+	var lines []string
+	lw := &lineWriter{fn: func(line string) { lines = append(lines, line) }}
+	io.WriteString(lw, "one\r\ntw")
+	io.WriteString(lw, "o\nthree")
+	lw.Flush()
+	if !reflect.DeepEqual(lines, []string{"one", "two", "three"}) {
+		t.Errorf("lines %q", lines)
+	}
+}
+
+func TestDaemonBuildArgs(t *testing.T) {
+	d := &Daemon{root: t.TempDir()}
+	if err := os.MkdirAll(filepath.Join(d.root, "app", "lib"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	args, err := d.BuildArgs("app", []string{"-k", "-mode", "release", "-B=build", "-j", "4", "test", "lib", "prog"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"-k", "-mode=release", "-B=" + filepath.Join(d.root, "app", "build"), "-j=4", "test", filepath.Join(d.root, "app", "lib"), "prog"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("arguments %q, expected %q", args, expected)
+	}
+	args, err = d.BuildArgs("", []string{"flags", "app/main.c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"flags", filepath.Join(d.root, "app", "main.c")}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("arguments %q, expected %q", args, expected)
+	}
+
+	for _, refused := range [][]string{
+		{"-C", "/"},
+		{"-C=/"},
+		{"-dcc", "sh"},
+		{"--dcc=sh"},
+		{"-dcc-arg", "-fplugin=evil.so"},
+		{"-prefix", "/usr"},
+		{"install"},
+		{"run"},
+		{"DCC=sh"},
+		{"-B", "../../elsewhere"},
+		{"-o=/tmp/prog"},
+		{"-sarif", "../../report.sarif"},
+		{"flags", "../../main.c"},
+		{"../.."},
+		{"-mode"},
+	} {
+		if args, err := d.BuildArgs("app", refused); err == nil {
+			t.Errorf("%q allowed as %q, expected an error", refused, args)
+		}
+	}
+}
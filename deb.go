@@ -0,0 +1,177 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+//  dmake package -deb makes a Debian package rather than tarballs.
+//  The files are installed into a staging directory, as for the
+//  binary tarball, a DEBIAN/control file is written describing them,
+//  using the .dmake NAME, VERSION, DESCRIPTION, DEPENDS, MAINTAINER
+//  and SECTION variables, and dpkg-deb builds
+//  <name>_<version>_<arch>.deb. Without a PREFIX files are installed
+//  under /usr.
+//
+const (
+	debPackageFormat = "deb"
+	debDefaultPrefix = "/usr"
+)
+
+//  Debian package names are lower case letters, digits and + - .
+//
+var debNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+
+//  Debian's names for the architectures Go names.
+//
+var debArchitectures = map[string]string{
+	"386":      "i386",
+	"amd64":    "amd64",
+	"arm":      "armhf",
+	"arm64":    "arm64",
+	"mips64le": "mips64el",
+	"mipsle":   "mipsel",
+	"ppc64le":  "ppc64el",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+//  Return the name of the receiver's Debian package, NAME or the
+//  project's name, lower cased with underscores replaced by hyphens.
+//
+func (dmake *Dmake) DebName() string {
+	name := dmake.vars.GetString("NAME")
+	if name == "" {
+		name = dmake.defaultoutput
+	}
+	return strings.ReplaceAll(strings.ToLower(name), "_", "-")
+}
+
+//  Return the Debian architecture of the target.
+//
+func (t *Target) DebArchitecture() (string, error) {
+	if arch, found := debArchitectures[t.arch]; found {
+		return arch, nil
+	}
+	return "", fmt.Errorf("%s: no Debian architecture is known for the target", t.arch)
+}
+
+//  Make a Debian package of the files the receiver installs.
+//
+func (dmake *Dmake) DebPackage(env []string, version string) error {
+	name := dmake.DebName()
+	if !debNameRegexp.MatchString(name) {
+		return fmt.Errorf("%q: not a valid Debian package name, define NAME to use another", name)
+	}
+	arch, err := dmake.Target().DebArchitecture()
+	if err != nil {
+		return err
+	}
+	maintainer := dmake.vars.GetString("MAINTAINER")
+	if maintainer == "" {
+		user, email := GitConfig("user.name", ""), GitConfig("user.email", "")
+		if user == "" || email == "" {
+			return fmt.Errorf("a Debian package requires a MAINTAINER, e.g. MAINTAINER = Name <email>")
+		}
+		maintainer = user + " <" + email + ">"
+	}
+	if dmake.installprefix == "" {
+		dmake.installprefix = debDefaultPrefix
+	}
+	if !filepath.IsAbs(dmake.installprefix) {
+		return fmt.Errorf("%s: a Debian package's PREFIX must be absolute", dmake.installprefix)
+	}
+
+	section := dmake.vars.GetString("SECTION")
+	if section == "" {
+		section = "misc"
+	}
+
+	filename := dmake.BuildPath(name + "_" + version + "_" + arch + ".deb")
+	return dmake.StagedInstall(env, func(stage string) error {
+		control := DebControl(map[string]string{
+			"Package":        name,
+			"Version":        version,
+			"Architecture":   arch,
+			"Maintainer":     maintainer,
+			"Installed-Size": fmt.Sprint((DirectorySize(stage) + 1023) / 1024),
+			"Depends":        strings.Join(strings.Fields(dmake.vars.GetString("DEPENDS")), " "),
+			"Section":        section,
+			"Priority":       "optional",
+			"Description":    dmake.vars.GetString("DESCRIPTION"),
+		})
+		args := []string{"--root-owner-group", "--build", stage, filename}
+		if DryRun("dpkg-deb", args...) {
+			return nil
+		}
+		debian := filepath.Join(stage, "DEBIAN")
+		if err := os.MkdirAll(debian, 0755); err != nil {
+			return err
+		}
+		if err := CreateFile(filepath.Join(debian, "control"), control); err != nil {
+			return err
+		}
+		if err := os.Chmod(stage, 0755); err != nil {
+			return err
+		}
+		logger.Verbosef("RUN: dpkg-deb %s", ShellJoin(args))
+		cmd := exec.Command("dpkg-deb", args...)
+		cmd.Env = env
+		cmd.Stdout, cmd.Stderr = CommandOutput(), os.Stderr
+		if err := RunCommand(cmd, filename); err != nil {
+			return fmt.Errorf("dpkg-deb: %v", err)
+		}
+		logger.Infof("wrote %s", filename)
+		return nil
+	})
+}
+
+//  Return the contents of a DEBIAN/control file, the fields in the
+//  order Debian uses, omitting those without a value. A description
+//  is required, its first line defaults to the package's name.
+//
+func DebControl(fields map[string]string) string {
+	var b strings.Builder
+	for _, name := range []string{"Package", "Version", "Architecture", "Maintainer", "Installed-Size", "Depends", "Section", "Priority"} {
+		if value := fields[name]; value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(fields["Description"]), "\n")
+	if lines[0] == "" {
+		lines[0] = fields["Package"]
+	}
+	fmt.Fprintf(&b, "Description: %s\n", strings.TrimSpace(lines[0]))
+	for _, line := range lines[1:] {
+		if line = strings.TrimSpace(line); line == "" {
+			line = "."
+		}
+		fmt.Fprintf(&b, " %s\n", line)
+	}
+	return b.String()
+}
+
+//  Return the total size of the files below a directory.
+//
+func DirectorySize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDebControl(t *testing.T) {
+	control := DebControl(map[string]string{
+		"Package":      "tool",
+		"Version":      "1.2",
+		"Architecture": "amd64",
+		"Maintainer":   "A Person <a@example.com>",
+		"Description":  "A tool\nthat does things.\n\nMore.",
+	})
+	expected := `Package: tool
+Version: 1.2
+Architecture: amd64
+Maintainer: A Person <a@example.com>
+Description: A tool
+ that does things.
+ .
+ More.
+`
+	if control != expected {
+		t.Errorf("control is\n%s\nexpected\n%s", control, expected)
+	}
+	if control := DebControl(map[string]string{"Package": "tool"}); !strings.HasSuffix(control, "Description: tool\n") {
+		t.Errorf("expected the package name as the default description, got\n%s", control)
+	}
+}
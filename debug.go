@@ -0,0 +1,115 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+//  dmake debug builds the program, in the debug mode unless -mode is
+//  used, and runs it under a debugger with the arguments given after
+//  "--". The debugger is the .dmake DEBUGGER variable, or $DEBUGGER,
+//  otherwise lldb on macOS and gdb elsewhere, or whichever of them is
+//  found. The debug mode always has debug information, if its options
+//  files, e.g. .dcc/CFLAGS.debug, don't include -g the sources are
+//  compiled with -O0 -g.
+//
+const debugModeName = "debug"
+
+//  The options used by the debug mode if its options don't include
+//  any debug information.
+//
+var debugModeOptions = []string{"-O0", "-g"}
+
+//  Return the mode's options with those needed to debug the program,
+//  if they're not already included, when building the debug mode.
+//
+func DebugModeOptions(mode string, options []string) []string {
+	if mode != debugModeName || hasDebugOption(options) {
+		return options
+	}
+	return append(options[:len(options):len(options)], debugModeOptions...)
+}
+
+//  Return the debugger command, DEBUGGER or the platform's usual
+//  debugger.
+//
+func (dmake *Dmake) Debugger() ([]string, error) {
+	if value, found := dmake.vars.GetValue("DEBUGGER"); found && value != "" {
+		return ShellWords(value), nil
+	}
+	if value := os.Getenv("DEBUGGER"); value != "" {
+		return ShellWords(value), nil
+	}
+	names := []string{"gdb", "lldb"}
+	if dmake.Target().os == "darwin" {
+		names = []string{"lldb", "gdb"}
+	}
+	for _, name := range names {
+		if _, err := exec.LookPath(name); err == nil {
+			return []string{name}, nil
+		}
+	}
+	return nil, fmt.Errorf("no debugger found, install %s or define DEBUGGER", strings.Join(names, " or "))
+}
+
+//  Return the command line running a program, with its arguments,
+//  under a debugger. lldb's arguments follow a "--", gdb's --args.
+//
+func DebuggerArgs(debugger []string, program string, args []string) []string {
+	command := debugger[:len(debugger):len(debugger)]
+	if name := strings.TrimSuffix(filepath.Base(debugger[0]), ".exe"); strings.HasPrefix(name, "lldb") {
+		command = append(command, "--")
+	} else {
+		command = append(command, "--args")
+	}
+	command = append(command, program)
+	return append(command, args...)
+}
+
+// dmake debug in cwd
+//
+// Runs the program built by the receiver under a debugger with the
+// arguments given after "--" on the command line. The debugger uses
+// dmake's standard input and output and handles interrupts itself.
+//
+func (dmake *Dmake) DebugAction(env []string) error {
+	if dmake.outputtype != ExeOutputType && dmake.outputtype != AppBundleOutputType {
+		return fmt.Errorf("%s is a %s, not a program", dmake.outputname, dmake.outputtype)
+	}
+	if dmake.Target().cross {
+		return fmt.Errorf("%s is built for %s and can't be debugged here", dmake.outputname, dmake.Target().Name())
+	}
+	if mode := dmake.Mode(); !hasDebugOption(dmake.modeOptions) && mode != debugModeName {
+		logger.Warnf("the %s mode's options don't include -g, %s may not be debuggable", mode, dmake.outputname)
+	}
+	debugger, err := dmake.Debugger()
+	if err != nil {
+		return err
+	}
+	command := DebuggerArgs(debugger, AsCommand(dmake.OutputPath()), runArgs)
+	if DryRun(command[0], command[1:]...) {
+		return nil
+	}
+	logger.Debugf("RUN: %v", command)
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// Interrupting the program is the debugger's business, dmake
+	// mustn't stop it.
+	//
+	signal.Ignore(os.Interrupt)
+	return RunCommand(cmd)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDebugger(t *testing.T) {
+	if options := DebugModeOptions("debug", []string{"-Wall"}); !reflect.DeepEqual(options, []string{"-Wall", "-O0", "-g"}) {
+		t.Errorf("debug mode options %q", options)
+	}
+	if options := DebugModeOptions("debug", []string{"-g3", "-O1"}); !reflect.DeepEqual(options, []string{"-g3", "-O1"}) {
+		t.Errorf("debug mode's own options changed to %q", options)
+	}
+	if options := DebugModeOptions("release", []string{"-O2"}); !reflect.DeepEqual(options, []string{"-O2"}) {
+		t.Errorf("release mode options changed to %q", options)
+	}
+	if args := DebuggerArgs([]string{"gdb", "-q"}, "debug/prog", []string{"-v"}); !reflect.DeepEqual(args, []string{"gdb", "-q", "--args", "debug/prog", "-v"}) {
+		t.Errorf("gdb command %q", args)
+	}
+	if args := DebuggerArgs([]string{"/usr/bin/lldb"}, "debug/prog", []string{"-v"}); !reflect.DeepEqual(args, []string{"/usr/bin/lldb", "--", "debug/prog", "-v"}) {
+		t.Errorf("lldb command %q", args)
+	}
+}
@@ -0,0 +1,113 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+//  Compilation may be distributed across a build cluster using distcc
+//  or icecream's icecc. Distribution is enabled by the -distcc option
+//  or the DISTCC variable which, like CACHE, may name the command, be
+//  "yes" to use whichever is found, or "no". Remote compilers are
+//  only useful if there are enough compilations running to keep them
+//  busy so the number dcc runs at once is raised too.
+//
+var distributedCompilers = []string{"distcc", "icecc"}
+
+//  The environment variable telling dcc how many files to compile at
+//  once.
+//
+const dccJobsEnvVar = "NJOBS"
+
+//  Return the distributed compilation command used when compiling, if
+//  any.
+//
+func (dmake *Dmake) DistributedCompiler() (string, error) {
+	value, found := dmake.vars.GetValue("DISTCC")
+	if !found {
+		if !*distccFlag {
+			return "", nil
+		}
+		value = "yes"
+	}
+	switch strings.ToLower(value) {
+	case "no", "off", "false", "0":
+		return "", nil
+	case "", "yes", "on", "true", "1", "auto":
+		for _, name := range distributedCompilers {
+			if path, err := exec.LookPath(name); err == nil {
+				return path, nil
+			}
+		}
+		return "", nil
+	}
+	path, err := exec.LookPath(value)
+	if err != nil {
+		return "", fmt.Errorf("DISTCC: %s not found", value)
+	}
+	return path, nil
+}
+
+//  Return the number of files to compile at once when distributing
+//  compilation. DISTCC_JOBS defines the number, otherwise distcc
+//  is asked for its recommendation, or four per CPU are used.
+//
+func (dmake *Dmake) DistributedJobs(distributor string) (int, error) {
+	if value, found := dmake.vars.GetValue("DISTCC_JOBS"); found {
+		jobs, err := strconv.Atoi(value)
+		if err != nil || jobs < 1 {
+			return 0, fmt.Errorf("DISTCC_JOBS: %q isn't a number of jobs", value)
+		}
+		return jobs, nil
+	}
+	if strings.TrimSuffix(filepath.Base(distributor), ".exe") == "distcc" {
+		output, err := exec.Command(distributor, "-j").Output()
+		if err == nil {
+			if jobs, err := strconv.Atoi(strings.TrimSpace(string(output))); err == nil && jobs > 0 {
+				return jobs, nil
+			}
+		}
+	}
+	return 4 * runtime.NumCPU(), nil
+}
+
+//  Return the environment used to distribute compilation. $CC and
+//  $CXX, by default the toolchain's compilers, are prefixed with the
+//  distributing command unless they're already using ccache, which is
+//  told to run it via CCACHE_PREFIX.
+//
+func DistributedEnvironment(env []string, distributor string, jobs int, toolchain *Toolchain) []string {
+	if distributor == "" {
+		return env
+	}
+	env = append(env[:len(env):len(env)], dccJobsEnvVar+"="+strconv.Itoa(jobs))
+	name := strings.TrimSuffix(filepath.Base(distributor), ".exe")
+	for _, language := range []Language{CLanguage, CplusplusLanguage} {
+		variable, compiler := toolchain.CompilerVariable(language)
+		if value, found := LookupEnv(env, variable); found && value != "" {
+			compiler = value
+		}
+		first := strings.TrimSuffix(filepath.Base(strings.Fields(compiler)[0]), ".exe")
+		switch first {
+		case name:
+			continue
+		case "ccache":
+			env = DefaultEnv(env, "CCACHE_PREFIX", distributor)
+		default:
+			env = append(env, variable+"="+distributor+" "+compiler)
+		}
+	}
+	return env
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDistributedEnvironment(t *testing.T) {
+	env := DistributedEnvironment([]string{"CC=gcc"}, "/usr/bin/distcc", 12, &gnuToolchain)
+	if cc, _ := LookupEnv(env, "CC"); cc != "/usr/bin/distcc gcc" {
+		t.Errorf("CC is %q", cc)
+	}
+	if jobs, _ := LookupEnv(env, dccJobsEnvVar); jobs != "12" {
+		t.Errorf("%s is %q", dccJobsEnvVar, jobs)
+	}
+	env = DistributedEnvironment(CacheEnvironment(nil, "/usr/bin/ccache", &gnuToolchain), "/usr/bin/distcc", 12, &gnuToolchain)
+	if cc, _ := LookupEnv(env, "CC"); cc != "/usr/bin/ccache cc" {
+		t.Errorf("CC is %q", cc)
+	}
+	if prefix, _ := LookupEnv(env, "CCACHE_PREFIX"); prefix != "/usr/bin/distcc" {
+		t.Errorf("CCACHE_PREFIX is %q", prefix)
+	}
+}
@@ -9,12 +9,20 @@
 package main
 
 import (
+	"bytes"
 	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 )
 
 const (
@@ -25,6 +33,12 @@ const (
 	defaultDepsFileDir = ".dcc.d"
 	defaultObjFileDir  = ".objs"
 
+	// dmake test
+	testsDirectory = ".tests"
+
+	// dmake install and uninstall
+	installManifestFilename = ".dmake-install-manifest"
+
 	// dmake init defaults
 	defaultBuildMode    = "debug"
 	defaultCStandard    = "c11"
@@ -32,17 +46,61 @@ const (
 	defaultReleaseOptim = "-O2"
 	defaultDebugOptim   = "-O0"
 	defaultWarningOpts  = "-Wall -Wextra -pedantic"
+	defaultObjcOpts     = "-fobjc-arc"
 )
 
 type Dmake struct {
-	sourceFiles          []string   // names of the source files to be compiled
-	outputtype           OutputType // type of thing being built
-	outputname           string     // output filename
-	outputnameDefaulted  bool       // true if the user did NOT define outputname
-	defaultoutput        string     // default output filename
-	installprefix        string     // where to install
-	directories          []string   // names of any sub-directories to be compiled
-	writeCompileCommands bool       // output a compile_commands.json
+	sourceFiles          []string              // names of the source files to be compiled
+	testFiles            []string              // names of the test program source files
+	resourceFiles        []string              // names of Windows resource scripts
+	mainFunction         string                // the program entry point, e.g. main or WinMain
+	generated            []*GeneratedSource    // source files generated by other tools
+	protoFiles           []string              // names of the protocol buffer definitions
+	qtModules            []string              // the Qt modules used
+	versionOptions       []string              // compiler options defining the version information
+	headerFiles          []string              // names of the public header files to be installed
+	headersRoot          string                // directory header file names are relative to
+	fileFlags            map[string][]string   // per-source-file compiler options
+	language             Language              // the language of all source files, LANG
+	mode                 string                // the build mode selected by the .dmake file
+	sanitizers           []string              // the sanitizers selected by the .dmake file
+	static               bool                  // link statically, as selected by the .dmake file
+	target               *Target               // the target selected by the .dmake file, if any
+	toolchain            *Toolchain            // the toolchain selected by the .dmake file or environment, if any
+	toolchainDescription *ToolchainDescription // the toolchain file named by the .dmake file, if any
+	msvcRuntime          string                // the MSVC runtime library selected by the .dmake file
+	androidAPI           string                // the minimum Android API level selected by the .dmake file
+	destDir              string                // the staging directory installed files go in, if any
+	installProgram       string                // the program used to install files, if any
+	objsRoot             string                // the objects directory selected by the .dmake file
+	modeOptions          []string              // compiler options for the build mode
+	visibilityOptions    []string              // compiler options for the symbols' visibility
+	packages             []string              // pkg-config packages used
+	packageOptions       []string              // compiler options for the packages
+	packageLibs          []string              // libraries, and linker options, for the packages
+	configLibs           []string              // libraries found by CHECK_LIBS
+	dcc                  string                // dcc command defined by the .dmake file
+	outputtype           OutputType            // type of thing being built
+	outputname           string                // output filename
+	outputnameDefaulted  bool                  // true if the user did NOT define outputname
+	defaultoutput        string                // default output filename
+	installprefix        string                // where to install
+	builddir             string                // where build outputs go, if not the source directory
+	directories          []string              // names of any sub-directories to be compiled
+	dependencies         map[string][]string   // the directories each sub-directory depends upon
+	writeCompileCommands bool                  // output a compile_commands.json
+	targets              []*Dmake              // targets defined by .dmake sections
+	autoExes             bool                  // build an executable for each source file defining main
+	dllDefault           bool                  // without main, build a DLL rather than a static library
+	projects             []string              // workspace projects named on the command line
+	targetNames          []string              // targets named on the command line
+	selected             map[string][]string   // the named targets built in each sub-directory
+	onlyDirectories      bool                  // build the sub-directories but not the directory's own targets
+	pluginDefault        bool                  // without main, build a plugin rather than a static library
+	vars                 Vars                  // variables defined by the .dmake file
+	dmakefileRead        bool                  // the .dmake file has been read
+	dmakefileErr         error                 // the error reading it, if any
+	installed            map[string]bool       // the files listed in the install manifest, once read
 }
 
 //  Create a new Dmake
@@ -68,8 +126,10 @@ func NewDmake(dir string, outputName string, installPrefix string) *Dmake {
 // Do dmake some-action in cwd
 //
 func (dmake *Dmake) Run(action Action, env []string) error {
-	if *debugFlag {
-		log.Print("DEBUG: action=", action.String())
+	logger.Debugf("action=%s", action.String())
+
+	if action == Diagnosing {
+		return dmake.DoctorAction(os.Stdout, env)
 	}
 
 	err := dmake.ReadDmakefile()
@@ -77,30 +137,249 @@ func (dmake *Dmake) Run(action Action, env []string) error {
 		return err
 	}
 
+	if len(dmake.targetNames) > 0 && action != Graphing && action != Listing && action != Flagging {
+		if err = dmake.SelectNamedTargets(); err != nil {
+			return err
+		}
+	}
+
+	if action == Graphing {
+		return dmake.GraphAction(os.Stdout)
+	}
+
+	if action == Listing {
+		return dmake.ListAction(os.Stdout)
+	}
+
+	if action == Explaining {
+		return dmake.ExplainAction(os.Stdout)
+	}
+
+	if action == Flagging {
+		return dmake.FlagsAction(os.Stdout, env)
+	}
+
+	if action == Documenting {
+		return dmake.DocsAction(env)
+	}
+
+	if action == Packaging {
+		return dmake.PackageAction(env)
+	}
+
+	if action == Cleaning && dmake.builddir != "" {
+		if err = dmake.CheckBuildDirectory(); err != nil {
+			return err
+		}
+	}
+
 	if dmake.HaveDirs() {
-		err = dmake.Directories(action, env)
+		dirAction := action
+		if action == Running || action == Debugging {
+			dirAction = Building
+		}
+		err = dmake.Directories(dirAction, env)
 		if err != nil {
 			return err
 		}
 	}
 
-	if len(dmake.sourceFiles) < 1 {
-		dmake.sourceFiles, _, err = SourceFiles()
+	if action == Uninstalling {
+		return dmake.UninstallAction()
+	}
+
+	if action == Exporting {
+		return dmake.ExportAction(env)
+	}
+
+	if len(dmake.targets) > 0 {
+		err = dmake.Targets(action, env)
+	} else if !dmake.onlyDirectories {
+		err = dmake.RunTarget(action, env)
+	}
+
+	if err == nil && BuildsOutputs(action) && !*dryRunFlag && dmake.WritingBuildInfo() {
+		err = dmake.WriteBuildInfo(env)
+	}
+	if action == Cleaning {
+		Remove(buildInfoFilename)
+		if dmake.builddir != "" {
+			Remove(dmake.builddir) // only if it's now empty
+		}
+	}
+	if err == nil && action != Cleaning && !*dryRunFlag && dmake.HaveDirs() && dmake.WritingCompileCommands() {
+		err = dmake.MergeCompileCommands()
+	}
+	return err
+}
+
+//  Perform some action for each of the targets defined by sections
+//  in the .dmake file.
+//
+//  When running, or debugging, all targets are built and then the
+//  single executable target is run.
+//
+func (dmake *Dmake) Targets(action Action, env []string) (result error) {
+	targetAction := action
+	if action == Running || action == Debugging {
+		targetAction = Building
+	}
+	if action == Installing {
+		// The targets share the directory's install manifest.
+		if err := dmake.ReadInstalledFiles(); err != nil {
+			return err
+		}
+		for _, target := range dmake.targets {
+			target.installed = dmake.installed
+		}
+	}
+	for _, target := range dmake.targets {
+		logger.Verbosef("target %q", target.outputname)
+		err := target.RunTarget(targetAction, env)
 		if err != nil {
+			if !*keepGoingFlag {
+				return err
+			}
+			if result == nil {
+				result = err
+			}
+		}
+	}
+	if (action == Running || action == Debugging) && result == nil {
+		var programs []*Dmake
+		for _, target := range dmake.targets {
+			if target.outputtype == ExeOutputType || target.outputtype == AppBundleOutputType {
+				programs = append(programs, target)
+			}
+		}
+		if len(programs) != 1 {
+			return fmt.Errorf("%s requires a single executable target, %d are defined", action, len(programs))
+		}
+		if action == Debugging {
+			return programs[0].DebugAction(env)
+		}
+		return programs[0].RunAction(env)
+	}
+	return
+}
+
+//  Perform some action for the receiver's single output.
+//
+func (dmake *Dmake) RunTarget(action Action, env []string) error {
+	if dmake.outputtype == HeaderOnlyOutputType {
+		return dmake.HeaderOnlyTarget(action, env)
+	}
+
+	ok, err := dmake.Prepare()
+	if !ok || err != nil {
+		return err
+	}
+
+	if action == Cleaning {
+		return dmake.CleanAction()
+	}
+
+	if action == Installing && *noBuildFlag {
+		return dmake.InstallAction(env)
+	}
+
+	if !*dryRunFlag {
+		if err = dmake.Configure(env); err != nil {
 			return err
 		}
 	}
 
+	if err = dmake.RunHook(PreBuildHook, env); err != nil {
+		return err
+	}
+	err = dmake.BuildAction(env)
+	if err != nil {
+		return err
+	}
+	if err = dmake.RunHook(PostBuildHook, env); err != nil {
+		return err
+	}
+	if err = dmake.Sign(env); err != nil {
+		return err
+	}
+
+	switch action {
+	case Installing:
+		err = dmake.InstallAction(env)
+	case Testing:
+		err = dmake.TestAction(env)
+	case Covering:
+		err = dmake.CoverageAction(env)
+	case Tidying:
+		err = dmake.TidyAction(env)
+	case Analyzing:
+		err = dmake.AnalyzeAction(env)
+	case Running:
+		err = dmake.RunAction(env)
+	case Debugging:
+		err = dmake.DebugAction(env)
+	}
+	return err
+}
+
+//  Determine the receiver's source files, options and output type.
+//  Returns false if there is nothing to be built, as for a header-only
+//  library.
+//
+func (dmake *Dmake) Prepare() (bool, error) {
+	var err error
+
+	if dmake.outputtype == HeaderOnlyOutputType {
+		return false, dmake.PrepareHeaderOnly()
+	}
+
+	if len(dmake.sourceFiles) < 1 {
+		dmake.sourceFiles, _, err = dmake.Target().SourceFiles()
+		if err != nil {
+			return false, err
+		}
+		dmake.sourceFiles = Without(dmake.sourceFiles, dmake.testFiles)
+		grammars, err := dmake.GrammarFiles()
+		if err != nil {
+			return false, err
+		}
+		dmake.sourceFiles = append(dmake.sourceFiles, grammars...)
+	}
+	inputs := dmake.protoFiles
+	if len(dmake.qtModules) > 0 {
+		qtInputs, err := QtInputs(dmake.sourceFiles)
+		if err != nil {
+			return false, err
+		}
+		inputs = append(inputs[:len(inputs):len(inputs)], qtInputs...)
+	}
+	dmake.AddGeneratedSources(inputs...)
+
 	if len(dmake.sourceFiles) < 1 {
 		if !dmake.HaveDirs() {
-			return fmt.Errorf("no C, Objective-C++, Objective-C or C++ source files found")
+			return false, fmt.Errorf("no C, Objective-C++, Objective-C or C++ source files found")
 		} else {
-			return nil
+			return false, nil
+		}
+	}
+
+	logger.Debugf("sourceFiles=%q", dmake.sourceFiles)
+
+	dmake.modeOptions, err = dmake.ModeOptions(dmake.LanguageOf(dmake.sourceFiles))
+	if err != nil {
+		return false, err
+	}
+
+	if len(dmake.packages) > 0 && dmake.packageOptions == nil && dmake.packageLibs == nil {
+		dmake.packageOptions, dmake.packageLibs, err = PackageOptions(dmake.packages, dmake.Static())
+		if err != nil {
+			return false, err
 		}
+		dmake.packageOptions = append(dmake.packageOptions, dmake.QtOptions()...)
 	}
 
-	if *debugFlag {
-		log.Printf("DEBUG: sourceFiles=%q", dmake.sourceFiles)
+	if dmake.EmbeddingVersion() && dmake.versionOptions == nil {
+		dmake.versionOptions = dmake.VersionOptions()
 	}
 
 	if dmake.outputtype == UnknownOutputType {
@@ -110,149 +389,1352 @@ func (dmake *Dmake) Run(action Action, env []string) error {
 		}
 	}
 
-	if action == Cleaning {
-		return dmake.CleanAction()
+	if dmake.Target().os == "windows" && dmake.outputtype == ExeOutputType && dmake.mainFunction == "" {
+		dmake.mainFunction = dmake.FindMainFunction()
 	}
 
-	err = dmake.BuildAction(env)
-	if err != nil {
-		return err
+	if dmake.Target().os == "windows" && (dmake.outputtype == ExeOutputType || dmake.outputtype == DllOutputType) {
+		if dmake.resourceFiles, err = ResourceScripts(dmake.sourceFiles); err != nil {
+			return false, err
+		}
 	}
 
-	if action == Installing {
-		err = dmake.InstallAction()
-	}
-	return err
+	return true, nil
 }
 
 func (dmake *Dmake) SetOutputNameFromType() {
 	switch dmake.outputtype {
 	case DllOutputType:
-		dmake.outputname = platform.DllFilename(dmake.outputname)
+		dmake.outputname = dmake.Target().platform.DllFilename(dmake.outputname)
 	case PluginOutputType:
-		dmake.outputname = platform.PluginFilename(dmake.outputname)
+		dmake.outputname = dmake.Target().platform.PluginFilename(dmake.outputname)
 	case ExeOutputType:
-		dmake.outputname = platform.ExeFilename(dmake.outputname)
+		if dmake.Target().os == wasmOS && dmake.WasmHTML() {
+			dmake.outputname = formFilename("", dmake.outputname, wasmHTMLSuffix)
+		} else {
+			dmake.outputname = dmake.Target().platform.ExeFilename(dmake.outputname)
+		}
 	case LibOutputType:
-		dmake.outputname = platform.LibFilename(dmake.outputname)
+		dmake.outputname = dmake.Target().platform.LibFilename(dmake.outputname)
+	case FrameworkOutputType:
+		dmake.outputname = dmake.Target().platform.FrameworkFilename(dmake.outputname)
+	case AppBundleOutputType:
+		dmake.outputname = dmake.Target().platform.AppBundleFilename(dmake.outputname)
 	default:
 		panic("outputtype not set when it should be known by now")
 	}
 }
 
-//  Perform some action across the defined sub-directories
+//  Perform some action across the defined sub-directories. With -k
+//  every directory is processed and the failures returned as a
+//  DirectoryErrors.
 //
-func (dmake *Dmake) Directories(action Action, env []string) (result error) {
-	if *debugFlag {
-		log.Printf("DEBUG: directories %q", dmake.directories)
+func (dmake *Dmake) Directories(action Action, env []string) error {
+	logger.Debugf("directories %q", dmake.directories)
+
+	directories, err := SortDirectories(dmake.directories, dmake.dependencies)
+	if err != nil {
+		return err
 	}
 
-	for _, path := range dmake.directories {
-		if *verboseFlag {
-			log.Printf("entering %q", path)
+	if *jobsFlag > 1 && len(directories) > 1 {
+		return dmake.ParallelDirectories(directories, action, env)
+	}
+
+	progress := StartProgress(len(directories), false)
+	defer progress.Finish()
+
+	var errs DirectoryErrors
+	failed := make(map[string]bool)
+	for _, path := range directories {
+		if dependency := failedDependency(path, dmake.dependencies, failed); dependency != "" {
+			logger.Warnf("%s: skipped, %s failed", path, dependency)
+			failed[path] = true
+			errs = errs.Add(path, action, fmt.Errorf("skipped, %s failed", dependency))
+			continue
 		}
 
+		progress.Step(logger.Directory(path), action)
+		logger.Verbosef("entering %q", path)
+
+		event := Event{Event: DirectoryEnterEvent, Directory: EventDirectory(path), Action: action.String()}
+		EmitEvent(event)
+		started := time.Now()
+
 		savedCwd, err := ChangeDirectory(path)
 		if err != nil {
 			return err
 		}
 
-		err = NewDmake(path, "", dmake.installprefix).Run(action, env)
+		subdir := NewDmake(path, "", dmake.installprefix)
+		if dmake.builddir != "" {
+			subdir.builddir = filepath.Join(dmake.builddir, path)
+		}
+		subdir.targetNames = dmake.selected[path]
+		err = subdir.Run(action, env)
+		event.Event = DirectoryLeaveEvent
+		EmitFinishEvent(event, started, err)
 		if err != nil {
 			if !*keepGoingFlag {
 				return err
 			}
-			if result == nil {
-				result = err
-			}
+			failed[path] = true
+			errs = errs.Add(path, action, err)
 		}
 
-		if *verboseFlag {
-			log.Printf(" leaving %q", path)
-		}
+		savedCwd.Restore()
+		logger.Verbosef(" leaving %q", path)
+		RecordTiming("directory", path, started)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
 
+//  Call a function for the receiver's directory, named dir, and
+//  then, recursively, for each of its sub-directories, with the
+//  current directory changed to the directory. The function is given
+//  the directory's path relative to the first.
+//
+//  Nothing is built, Walk is used by actions reporting on the project.
+//
+func (dmake *Dmake) Walk(dir string, fn func(dir string, dmake *Dmake) error) error {
+	if err := fn(dir, dmake); err != nil {
+		return err
+	}
+	for _, path := range dmake.directories {
+		savedCwd, err := ChangeDirectory(path)
+		if err != nil {
+			return err
+		}
+		subdir := NewDmake(path, "", dmake.installprefix)
+		if dmake.builddir != "" {
+			subdir.builddir = filepath.Join(dmake.builddir, path)
+		}
+		if err = subdir.ReadDmakefile(); err == nil {
+			err = subdir.Walk(filepath.Join(dir, path), fn)
+		}
 		savedCwd.Restore()
+		if err != nil {
+			return err
+		}
 	}
-	return
+	return nil
 }
 
-// Build usng dcc
+//  Return the targets built in the receiver's directory, prepared so
+//  their sources and output are known. A directory with no source
+//  files, only sub-directories, has no targets.
 //
-func (dmake *Dmake) BuildAction(env []string) error {
-	os.MkdirAll(filepath.Dir(dmake.outputname), 0777)
-	os.MkdirAll(objsdir, 0777)
+func (dmake *Dmake) PreparedTargets() ([]*Dmake, error) {
+	targets := dmake.targets
+	if len(targets) == 0 {
+		targets = []*Dmake{dmake}
+	}
+	prepared := make([]*Dmake, 0, len(targets))
+	for _, target := range targets {
+		ok, err := target.Prepare()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			prepared = append(prepared, target)
+		}
+	}
+	return prepared, nil
+}
 
-	dccArgs := make([]string, 0, 5+len(dmake.sourceFiles))
-	if *dccdebugFlag {
-		dccArgs = append(dccArgs, "--debug")
+//  Perform some action across the sub-directories running up to -j
+//  of them concurrently. The directories are in dependency order and
+//  a directory isn't started until those it depends upon complete.
+//
+//  Each directory is processed by a child dmake, the current
+//  directory is process-wide so we can't simply chdir from multiple
+//  goroutines. A child's output is buffered and written out once it
+//  completes so output from different directories doesn't interleave.
+//
+func (dmake *Dmake) ParallelDirectories(directories []string, action Action, env []string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
 	}
-	if *quietFlag {
-		dccArgs = append(dccArgs, "--quiet")
+
+	var (
+		mutex  sync.Mutex
+		result error
+		errs   DirectoryErrors
+	)
+
+	progress := StartProgress(len(directories), true)
+	defer progress.Finish()
+
+	skip := func(path, dependency string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		logger.Warnf("%s: skipped, %s failed", path, dependency)
+		errs = errs.Add(path, action, fmt.Errorf("skipped, %s failed", dependency))
 	}
-	if *writeCompileCommandsFlag || dmake.writeCompileCommands {
-		dccArgs = append(dccArgs, "--write-compile-commands")
+
+	run := func(path string) error {
+		progress.Step(logger.Directory(path), action)
+
+		event := Event{Event: DirectoryEnterEvent, Directory: EventDirectory(path), Action: action.String()}
+		EmitEvent(event)
+		started := time.Now()
+
+		//  With -json the child's standard output is events
+		//  and must be kept apart from its other output.
+		//
+		var output, diagnostics bytes.Buffer
+		args := dmake.SubdirectoryArgs(path, action)
+		cmd := exec.Command(self, args...)
+		cmd.Env = logger.ChildEnvironment(env, path)
+		timingsFile := ""
+		if *timeFlag {
+			if file, err := os.CreateTemp("", "dmake-timings-"); err == nil {
+				timingsFile = file.Name()
+				file.Close()
+				defer os.Remove(timingsFile)
+				cmd.Env = append(cmd.Env, timingsEnvVar+"="+timingsFile)
+			}
+		}
+		annotationsFile := ""
+		if annotations != nil {
+			if file, err := os.CreateTemp("", "dmake-annotations-"); err == nil {
+				annotationsFile = file.Name()
+				file.Close()
+				defer os.Remove(annotationsFile)
+				cmd.Env = append(cmd.Env, annotationsEnvVar+"="+annotationsFile)
+			}
+		}
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, &output, &output
+		if *jsonFlag {
+			cmd.Stderr = &diagnostics
+		}
+		logger.Debugf("RUN: %s %v", self, args)
+		err := RunCommand(cmd)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		logger.Verbosef("entering %q", path)
+		progress.Clear()
+		eventMutex.Lock()
+		os.Stdout.Write(output.Bytes())
+		eventMutex.Unlock()
+		os.Stderr.Write(diagnostics.Bytes())
+		logger.Verbosef(" leaving %q", path)
+		progress.Redraw()
+		event.Event = DirectoryLeaveEvent
+		EmitFinishEvent(event, started, err)
+		RecordTiming("directory", path, started)
+		if timingsFile != "" {
+			if t, err := ReadTimings(timingsFile); err == nil {
+				AddTimings(path, t)
+			}
+		}
+		if annotationsFile != "" {
+			if findings, err := ReadFindings(annotationsFile); err == nil {
+				annotations.AddFindings(findings)
+			}
+		}
+		if err != nil {
+			errs = errs.Add(path, action, err)
+			if result == nil {
+				result = fmt.Errorf("%s: %s", path, err)
+			}
+		}
+		return err
 	}
-	dccArgs = append(dccArgs, dmake.outputtype.DccArgument(), dmake.outputname)
-	dccArgs = append(dccArgs, "--objdir", objsdir)
-	dccArgs = append(dccArgs, dmake.sourceFiles...)
 
-	cmd := exec.Command(dccCommandName, dccArgs...)
-	cmd.Env = env
-	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, os.Stdout, os.Stderr
-	if *debugFlag {
-		log.Printf("RUN: %s %v", dccCommandName, dccArgs)
+	ScheduleDirectories(directories, dmake.dependencies, *jobsFlag, *keepGoingFlag, run, skip)
+	if *keepGoingFlag && len(errs) > 0 {
+		return errs
 	}
-	return cmd.Run()
+	return result
 }
 
-// dmake clean in cwd
+//  Call run for each of the directories, for up to jobs of them at
+//  once. A directory is run once those it depends upon have been and
+//  only then takes one of the jobs, so directories waiting for others
+//  don't stop independent directories running. A directory depending
+//  upon one that failed, or was skipped, isn't run, skip is called
+//  instead. Unless keepGoing is true no more directories are run once
+//  one fails.
 //
-func (dmake *Dmake) CleanAction() error {
-	os.Remove(dmake.outputname)
-	for _, srcfile := range dmake.sourceFiles {
-		doClean := func(path string, deletable string) {
-			os.Remove(path)
-			dir := filepath.Dir(path)
-			if filepath.Base(dir) == deletable {
-				os.RemoveAll(dir)
+func ScheduleDirectories(directories []string, dependencies map[string][]string, jobs int, keepGoing bool, run func(path string) error, skip func(path, dependency string)) {
+	var (
+		mutex  sync.Mutex
+		wg     sync.WaitGroup
+		failed bool
+		slots  = make(chan struct{}, jobs)
+		done   = make(map[string]chan struct{})
+		broken = make(map[string]bool)
+	)
+
+	for _, path := range directories {
+		done[path] = make(chan struct{})
+	}
+
+	stopping := func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return failed && !keepGoing
+	}
+
+	for _, path := range directories {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			defer close(done[path])
+			for _, dependency := range dependencies[path] {
+				if ch, found := done[dependency]; found {
+					<-ch
+				}
+			}
+			mutex.Lock()
+			dependency := failedDependency(path, dependencies, broken)
+			if dependency != "" {
+				broken[path] = true
+			}
+			mutex.Unlock()
+			if dependency != "" {
+				skip(path, dependency)
+				return
 			}
+			if stopping() {
+				return
+			}
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if stopping() {
+				return
+			}
+			if err := run(path); err != nil {
+				mutex.Lock()
+				broken[path] = true
+				failed = true
+				mutex.Unlock()
+			}
+		}(path)
+	}
+
+	wg.Wait()
+}
+
+//  A DirectoryError records the failure of an action in a
+//  sub-directory.
+//
+type DirectoryError struct {
+	path   string // the sub-directory
+	action Action // what was being done
+	err    error  // what went wrong
+}
+
+func (e *DirectoryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.path, e.err)
+}
+
+//  DirectoryErrors collects the failures in sub-directories when
+//  keeping going after errors.
+//
+type DirectoryErrors []*DirectoryError
+
+func (errs DirectoryErrors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	return fmt.Sprintf("%d directories failed", len(errs))
+}
+
+//  Add the failure of an action in a sub-directory. The failures
+//  within a sub-directory's own sub-directories are added
+//  individually with their paths made relative to ours.
+//
+func (errs DirectoryErrors) Add(path string, action Action, err error) DirectoryErrors {
+	if nested, ok := err.(DirectoryErrors); ok {
+		for _, e := range nested {
+			errs = append(errs, &DirectoryError{filepath.Join(path, e.path), e.action, e.err})
 		}
-		ofile := ObjectFilename(srcfile, objsdir)
-		doClean(ofile, objsdir)
-		doClean(DependenciesFilename(ofile, depsdir), depsdir)
+		return errs
 	}
-	return nil
+	return append(errs, &DirectoryError{path, action, err})
 }
 
-// dmake install in cwd
+//  Write a table summarizing the failures.
 //
-func (dmake *Dmake) InstallAction() error {
-	path := dmake.installprefix
-	if path == "" {
-		path = "."
+func (errs DirectoryErrors) Summarize(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIRECTORY\tACTION\tERROR")
+	for _, e := range errs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.path, e.action, e.err)
 	}
-	var (
-		dest string
-		mode os.FileMode
-	)
-	if dmake.outputtype == ExeOutputType {
-		dest = filepath.Join(path, "bin")
-		mode = os.FileMode(0555)
-	} else {
-		dest = filepath.Join(path, "lib")
-		mode = os.FileMode(0444)
+	tw.Flush()
+}
+
+//  Return the command line arguments used to run a child dmake in
+//  the named sub-directory. The child is given the same flags as
+//  we were, other than those that don't apply to sub-directories,
+//  and is limited to building one directory at a time so nested
+//  DIRS don't multiply the number of concurrent builds.
+//
+func (dmake *Dmake) SubdirectoryArgs(path string, action Action) []string {
+	args := []string{"-C", path, "-j", "1"}
+	if dmake.installprefix != "" {
+		args = append(args, "-prefix", dmake.installprefix)
+	}
+	if dmake.builddir != "" {
+		args = append(args, "-B", filepath.Join(dmake.builddir, path))
 	}
-	return platform.installfile(dmake.outputname, filepath.Join(dest, dmake.outputname), mode)
+	if crossCompiling {
+		args = append(args, "-target", TargetName())
+	}
+	if toolchainDescription != nil {
+		args = append(args, "-toolchain", AbsolutePath(toolchainDescription.path))
+	}
+	if buildMode != "" {
+		args = append(args, "-mode", buildMode)
+	}
+	if len(sanitizers) > 0 {
+		args = append(args, "-sanitize", strings.Join(sanitizers, ","))
+	}
+	for _, arg := range dccArgsFlag {
+		args = append(args, "-dcc-arg", arg)
+	}
+	for _, name := range commandLineVars.Names() {
+		args = append(args, name+"="+commandLineVars.GetString(name))
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "B", "builddir", "C", "E", "dcc-arg", "j", "keep-env", "mode", "o", "prefix", "sanitize", "target", "toolchain":
+		default:
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	args = append(args, action.String())
+	if action == Exporting {
+		args = append(args, exportFormat)
+	}
+	args = append(args, dmake.selected[path]...)
+	return args
+}
+
+//  Return the directories ordered so each comes after the
+//  directories it depends upon. Otherwise the original order is kept.
+//  Dependencies upon directories not in the list are ignored.
+//
+func SortDirectories(directories []string, dependencies map[string][]string) ([]string, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	for _, path := range directories {
+		state[path] = unvisited
+	}
+
+	sorted := make([]string, 0, len(directories))
+	var visit func(path string, chain []string) error
+	visit = func(path string, chain []string) error {
+		switch state[path] {
+		case visiting:
+			return fmt.Errorf("circular directory dependency: %s", strings.Join(append(chain, path), " -> "))
+		case visited:
+			return nil
+		}
+		state[path] = visiting
+		for _, dependency := range dependencies[path] {
+			if _, found := state[dependency]; !found {
+				continue
+			}
+			if err := visit(dependency, append(chain, path)); err != nil {
+				return err
+			}
+		}
+		state[path] = visited
+		sorted = append(sorted, path)
+		return nil
+	}
+
+	for _, path := range directories {
+		if err := visit(path, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+//  Return the name of a directory, upon which the named directory
+//  depends, that has failed, or an empty string if there are none.
+//
+func failedDependency(path string, dependencies map[string][]string, failed map[string]bool) string {
+	for _, dependency := range dependencies[path] {
+		if failed[dependency] {
+			return dependency
+		}
+	}
+	return ""
+}
+
+// Build usng dcc
+//
+func (dmake *Dmake) BuildAction(env []string) error {
+	if dmake.IsBundle() && dmake.Target().os != "darwin" && dmake.Target().os != "ios" {
+		return fmt.Errorf("%s: %s outputs can only be built for macOS", dmake.Name(), dmake.outputtype)
+	}
+	if dmake.Target().os == androidOS {
+		if err := dmake.CheckAndroidTarget(env); err != nil {
+			return err
+		}
+	}
+
+	objsdir := dmake.ObjsDir()
+	if !*dryRunFlag {
+		os.MkdirAll(filepath.Dir(dmake.OutputPath()), 0777)
+		os.MkdirAll(objsdir, 0777)
+	}
+
+	if err := dmake.GenerateSources(env); err != nil {
+		return err
+	}
+
+	//  A versioned shared library is created using its full
+	//  name and linked to by its soname and unversioned name.
+	//
+	output := dmake.OutputPath()
+	version := dmake.LibraryVersion()
+	var linkOptions []string
+	if version != "" {
+		if !libraryVersionRegexp.MatchString(version) {
+			return fmt.Errorf("VERSION=%s: a shared library's version must be numbers separated by dots, e.g. 1.2.3", version)
+		}
+		var soname string
+		output, soname = dmake.VersionedOutputPaths(version)
+		installdir := ""
+		if dmake.installprefix != "" {
+			if prefix, err := filepath.Abs(dmake.installprefix); err == nil {
+				installdir = dmake.LibDir(prefix)
+			}
+		}
+		linkOptions = dmake.Target().SharedLibraryVersionOptions(filepath.Base(soname), version, installdir)
+	}
+	if dmake.outputtype == DllOutputType && version == "" && (dmake.Target().os == "darwin" || dmake.Target().os == "ios") {
+		//  The linker names a dylib by its output path, the
+		//  temporary one it's linked as, unless told otherwise.
+		//
+		linkOptions = append(linkOptions, "-Wl,-install_name,"+output)
+	}
+	if dmake.outputtype == ExeOutputType {
+		subsystemOptions, err := dmake.SubsystemOptions()
+		if err != nil {
+			return err
+		}
+		linkOptions = append(linkOptions, subsystemOptions...)
+	}
+	if dmake.outputtype == FrameworkOutputType {
+		name := filepath.Base(dmake.BundlePath())
+		linkOptions = []string{"-Wl,-install_name,@rpath/" + filepath.Join(name, "Versions", frameworkVersion, dmake.Name())}
+	}
+	exportOptions, err := dmake.ExportOptions(output)
+	if err != nil {
+		return err
+	}
+	linkOptions = append(linkOptions, exportOptions...)
+
+	args := make([]string, 0, 4+len(linkOptions)+len(dmake.sourceFiles))
+	args = append(args, dmake.outputtype.DccArgument(), output)
+	args = append(args, "--objdir", objsdir)
+	args = append(args, linkOptions...)
+	for _, path := range dmake.sourceFiles {
+		flags, found := dmake.fileFlags[path]
+		if !found {
+			args = append(args, path)
+			continue
+		}
+		//  Files with their own options are compiled separately
+		//  and their object file used in place of the source.
+		//
+		compileArgs := append([]string{"-c"}, flags...)
+		compileArgs = append(compileArgs, "--objdir", objsdir, path)
+		if err := dmake.RunDcc(env, compileArgs...); err != nil {
+			return err
+		}
+		args = append(args, dmake.Target().ObjectFilename(path, objsdir))
+	}
+	for _, path := range dmake.resourceFiles {
+		object, err := dmake.CompileResource(env, path)
+		if err != nil {
+			return err
+		}
+		args = append(args, object)
+	}
+	if err := dmake.RunDcc(env, args...); err != nil {
+		return err
+	}
+	if dmake.IsBundle() {
+		return dmake.FinishBundle()
+	}
+	if version == "" {
+		return nil
+	}
+	_, soname := dmake.VersionedOutputPaths(version)
+	if err := Symlink(filepath.Base(output), soname); err != nil {
+		return err
+	}
+	return Symlink(filepath.Base(soname), dmake.OutputPath())
+}
+
+//  Return the linker options selecting the Windows subsystem, console
+//  or GUI, a program uses. Programs defining WinMain are GUI programs
+//  unless the WINDOWS_SUBSYSTEM variable says otherwise. Programs with
+//  a wide character entry point, wmain or wWinMain, need -municode.
+//
+func (dmake *Dmake) SubsystemOptions() ([]string, error) {
+	if dmake.Target().os != "windows" {
+		return nil, nil
+	}
+	subsystem := "console"
+	if strings.HasSuffix(dmake.mainFunction, "WinMain") {
+		subsystem = "gui"
+	}
+	if value, found := dmake.vars.GetValue("WINDOWS_SUBSYSTEM"); found {
+		subsystem = value
+	}
+	var options []string
+	switch subsystem {
+	case "console":
+	case "gui":
+		options = append(options, "-mwindows")
+	default:
+		return nil, fmt.Errorf("WINDOWS_SUBSYSTEM=%s: use one of console or gui", subsystem)
+	}
+	if dmake.mainFunction == "wmain" || dmake.mainFunction == "wWinMain" {
+		options = append(options, "-municode")
+	}
+	return options, nil
+}
+
+//  Version numbers are numbers separated by dots.
+//
+var libraryVersionRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+
+//  Return the version of the shared library built by the receiver,
+//  defined by the VERSION variable, or an empty string if it doesn't
+//  build a versioned shared library. Windows DLLs aren't versioned.
+//
+func (dmake *Dmake) LibraryVersion() string {
+	if dmake.outputtype != DllOutputType || dmake.Target().os == "windows" {
+		return ""
+	}
+	return dmake.vars.GetString("VERSION")
+}
+
+//  Return the filenames of a versioned shared library, the library
+//  itself and its soname, e.g. libfoo.so.1.2.3 and libfoo.so.1.
+//
+func (dmake *Dmake) VersionedOutputPaths(version string) (string, string) {
+	output := dmake.OutputPath()
+	major := strings.SplitN(version, ".", 2)[0]
+	return dmake.Target().platform.VersionedDllFilename(output, version), dmake.Target().platform.VersionedDllFilename(output, major)
+}
+
+// Run dcc with the given arguments preceded by any options
+// implied by dmake's own flags and variables.
+//
+func (dmake *Dmake) RunDcc(env []string, args ...string) error {
+	dccArgs := make([]string, 0, 3+len(args))
+	if *dccdebugFlag {
+		dccArgs = append(dccArgs, "--debug")
+	}
+	if *quietFlag {
+		dccArgs = append(dccArgs, "--quiet")
+	}
+	if dmake.WritingCompileCommands() {
+		dccArgs = append(dccArgs, "--write-compile-commands")
+	}
+	dccArgs = append(dccArgs, dmake.modeOptions...)
+	dccArgs = append(dccArgs, dmake.visibilityOptions...)
+	dccArgs = append(dccArgs, dmake.SanitizerOptions()...)
+	dccArgs = append(dccArgs, dmake.ReproducibleOptions()...)
+	dccArgs = append(dccArgs, CoverageOptions()...)
+	dccArgs = append(dccArgs, dmake.packageOptions...)
+	dccArgs = append(dccArgs, dmake.GeneratedOptions()...)
+	dccArgs = append(dccArgs, dmake.versionOptions...)
+	dccArgs = append(dccArgs, dmake.LanguageOptions(dmake.Language())...)
+	dccArgs = append(dccArgs, dmake.ToolchainDescription().LanguageOptions(dmake.Language())...)
+	linking := !Contains(args, "-c")
+	if linking {
+		dccArgs = append(dccArgs, dmake.ToolchainDescription().LinkerOptions()...)
+		dccArgs = append(dccArgs, dmake.LinkerOptions()...)
+		dccArgs = append(dccArgs, dmake.StaticOptions()...)
+	}
+	dccArgs = append(dccArgs, dccArgsFlag...)
+	dccArgs = append(dccArgs, args...)
+	if linking {
+		libs := append(dmake.Libraries(), dmake.configLibs...)
+		libs = append(libs, dmake.packageLibs...)
+		libs = append(libs, dmake.ToolchainDescription().Libraries()...)
+		dccArgs = append(dccArgs, dmake.StaticLibraries(dmake.LinkerOptions(), libs)...)
+	}
+
+	cache, err := dmake.CompilerCache()
+	if err != nil {
+		return err
+	}
+	if cache != "" && *verboseFlag {
+		logger.Infof("compiling using %s", cache)
+	}
+	distributor, err := dmake.DistributedCompiler()
+	if err != nil {
+		return err
+	}
+	jobs := 0
+	if distributor != "" {
+		if jobs, err = dmake.DistributedJobs(distributor); err != nil {
+			return err
+		}
+		logger.Verbosef("distributing compilation using %s, %d jobs", distributor, jobs)
+	}
+
+	dcc := dmake.DccCommand()
+	dccEnv := CacheEnvironment(dmake.Target().ReproducibleEnvironment(dmake.TargetEnvironment(env)), cache, dmake.Toolchain())
+	dccEnv = append(DistributedEnvironment(dccEnv, distributor, jobs, dmake.Toolchain()), "DCCDEPS="+dmake.DepsDir())
+
+	if DryRun(dcc, dccArgs...) {
+		return nil
+	}
+
+	EmitEvent(Event{Event: DccExecEvent, Command: append([]string{dcc}, dccArgs...)})
+	defer RecordTiming("dcc", dccTimingName(args), time.Now())
+
+	outputs := dccOutputs(args)
+	if len(outputs) == 0 {
+		return dmake.runDcc(dcc, dccEnv, dccArgs, outputs)
+	}
+	temporary, err := PrepareTemporaryOutput(outputs[0])
+	if err != nil {
+		return err
+	}
+	err = dmake.runDcc(dcc, dccEnv, replaceDccOutput(dccArgs, temporary), []string{temporary})
+	return FinishTemporaryOutput(outputs[0], temporary, err)
+}
+
+//  Run dcc, or the built-in compiler driver, to create some outputs.
+//
+func (dmake *Dmake) runDcc(dcc string, dccEnv, dccArgs, outputs []string) error {
+	//  Without dcc we can still build simple things ourselves, and
+	//  we drive the toolchains dcc doesn't.
+	//
+	if dmake.UsingBuiltinDcc(dcc) {
+		if dmake.Toolchain().msvc {
+			logger.Verbosef("using the built-in compiler driver for the %s toolchain", dmake.Toolchain().name)
+		} else {
+			logger.Verbosef("dcc not found, using the built-in compiler driver")
+		}
+		for _, path := range outputs {
+			defer WritingFile(path)()
+		}
+		return dmake.BuiltinDcc(dccEnv, dccArgs)
+	}
+
+	cmd := exec.Command(dcc, dccArgs...)
+	cmd.Env = dccEnv
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, annotations.Writer(CommandOutput()), annotations.Writer(os.Stderr)
+	logger.Debugf("RUN: %s %v", dcc, dccArgs)
+	return RunCommand(cmd, outputs...)
+}
+
+//  Return true if the built-in compiler driver is used rather than
+//  dcc to build the receiver's outputs.
+//
+func (dmake *Dmake) UsingBuiltinDcc(dcc string) bool {
+	_, err := exec.LookPath(dcc)
+	return dmake.Toolchain().msvc || err != nil && dcc == dccCommandName
+}
+
+// Return the output file named by dcc arguments, if any.
+//
+func dccOutputs(args []string) []string {
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "--exe", "--lib", "--dll", "--plugin":
+			return []string{args[i+1]}
+		}
+	}
+	return nil
+}
+
+// Return the dcc arguments with the output they name replaced.
+//
+func replaceDccOutput(args []string, output string) []string {
+	result := append([]string(nil), args...)
+	for i := 0; i+1 < len(result); i++ {
+		switch result[i] {
+		case "--exe", "--lib", "--dll", "--plugin":
+			result[i+1] = output
+			return result
+		}
+	}
+	return result
+}
+
+//  Return the compiler options for a language defined by the .dmake
+//  variable named for the language's dcc options file, e.g. CXXFLAGS.
+//  They're used in addition to those in the options file.
+//
+func (dmake *Dmake) LanguageOptions(language Language) []string {
+	name, found := compilerOptionsFilename[language]
+	if !found {
+		return nil
+	}
+	return strings.Fields(dmake.vars.GetString(name))
+}
+
+//  Return the language of the receiver's source files, those of a
+//  header-only library being its headers.
+//
+func (dmake *Dmake) Language() Language {
+	if dmake.outputtype == HeaderOnlyOutputType {
+		return dmake.HeaderLanguage()
+	}
+	return dmake.LanguageOf(dmake.sourceFiles)
+}
+
+//  Return the language all of the receiver's source files are, given
+//  by -lang or its .dmake file's LANG variable, if any.
+//
+func (dmake *Dmake) ForcedLanguage() Language {
+	if langflag != UnknownLanguage {
+		return langflag
+	}
+	return dmake.language
+}
+
+//  Return the language used by a set of the receiver's source files.
+//
+func (dmake *Dmake) LanguageOf(paths []string) Language {
+	if language := dmake.ForcedLanguage(); language != UnknownLanguage {
+		return language
+	}
+	return LanguageOf(paths)
+}
+
+//  Return the language whose compiler links the receiver's output.
+//
+func (dmake *Dmake) LinkerLanguage() Language {
+	switch dmake.ForcedLanguage() {
+	case UnknownLanguage:
+		return LinkerLanguage(dmake.sourceFiles)
+	case CplusplusLanguage, ObjcplusplusLanguage:
+		return CplusplusLanguage
+	default:
+		return CLanguage
+	}
+}
+
+//  Return the linker options defined by the .dmake LDFLAGS variable.
+//
+func (dmake *Dmake) LinkerOptions() []string {
+	return strings.Fields(dmake.vars.GetString("LDFLAGS"))
+}
+
+//  Return the libraries defined by the .dmake LIBS variable.
+//
+func (dmake *Dmake) Libraries() []string {
+	return strings.Fields(dmake.vars.GetString("LIBS"))
+}
+
+// Return the name used to time a dcc invocation, the output it
+// creates or, when compiling a single file, the source file.
+//
+func dccTimingName(args []string) string {
+	for i, arg := range args {
+		switch arg {
+		case "--exe", "--lib", "--dll", "--plugin":
+			if i+1 < len(args) {
+				return args[i+1]
+			}
+		}
+	}
+	if len(args) > 0 {
+		return args[len(args)-1]
+	}
+	return ""
+}
+
+// Return the name of the dcc command to run. The -dcc flag takes
+// precedence over the DCC environment variable which takes
+// precedence over the .dmake file's DCC variable.
+//
+func (dmake *Dmake) DccCommand() string {
+	if *dccFlag != "" {
+		return *dccFlag
+	}
+	if dcc := os.Getenv("DCC"); dcc != "" {
+		return dcc
+	}
+	if dmake.dcc != "" {
+		return dmake.dcc
+	}
+	return dccCommandName
+}
+
+// dmake test in cwd
+//
+// Each test source file is compiled to its own executable in the
+// tests directory which is then run. A test passes if its program
+// exits with a zero status and, when run under memcheck, memcheck
+// found no memory errors.
+//
+func (dmake *Dmake) TestAction(env []string) error {
+	if len(dmake.testFiles) < 1 {
+		logger.Warnf("no tests defined, TESTS is not set")
+		return nil
+	}
+	memcheck := dmake.MemcheckCommand()
+	var suppressions []string
+	if memcheck != nil {
+		var err error
+		if suppressions, err = dmake.MemcheckSuppressions(); err != nil {
+			return err
+		}
+		if _, err := exec.LookPath(memcheck[0]); err != nil && !dmake.Target().cross && !*dryRunFlag {
+			return fmt.Errorf("%s not found, running tests under memcheck requires valgrind", memcheck[0])
+		}
+	}
+	testsdir := dmake.BuildPath(testsDirectory)
+	if !*dryRunFlag {
+		os.MkdirAll(testsdir, 0777)
+	}
+	failed, leaking := 0, 0
+	for _, path := range dmake.testFiles {
+		exe := dmake.Target().platform.ExeFilename(filepath.Join(testsdir, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))))
+		err := dmake.RunDcc(env, ExeOutputType.DccArgument(), exe, "--objdir", dmake.ObjsDir(), path)
+		if err == nil && dmake.Target().cross {
+			logger.Infof("BUILT %s (not run when building for %s)", path, dmake.Target().Name())
+			continue
+		}
+		command := []string{AsCommand(exe)}
+		report := ""
+		if memcheck != nil {
+			report = MemcheckReportFilename(exe)
+			command = MemcheckArgs(memcheck, report, suppressions, AsCommand(exe))
+		}
+		if err == nil && DryRun(command[0], command[1:]...) {
+			continue
+		}
+		if err == nil {
+			cmd := exec.Command(command[0], command[1:]...)
+			cmd.Env = env
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, CommandOutput(), os.Stderr
+			logger.Debugf("RUN: %v", command)
+			err = RunCommand(cmd)
+			if report != "" {
+				if result, rerr := ReadMemcheckReport(report); rerr != nil {
+					logger.Warnf("%s: %v", report, rerr)
+				} else if result.Failed() {
+					leaking++
+					if err != nil {
+						err = fmt.Errorf("%v, %s, see %s", err, result, report)
+					} else {
+						err = fmt.Errorf("%s, see %s", result, report)
+					}
+				}
+			}
+		}
+		if err != nil {
+			logger.Warnf("FAIL %s (%s)", path, err)
+			failed++
+		} else {
+			logger.Infof("PASS %s", path)
+		}
+	}
+	if *dryRunFlag {
+		return nil
+	}
+	logger.Infof("%d tests, %d passed, %d failed", len(dmake.testFiles), len(dmake.testFiles)-failed, failed)
+	if memcheck != nil && leaking > 0 {
+		logger.Infof("%d tests had memory errors", leaking)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, len(dmake.testFiles))
+	}
+	return nil
+}
+
+// dmake run in cwd
+//
+// Runs the program built by the receiver with the arguments given
+// after "--" on the command line. The program uses dmake's standard
+// input and output.
+//
+func (dmake *Dmake) RunAction(env []string) error {
+	if dmake.outputtype != ExeOutputType && dmake.outputtype != AppBundleOutputType {
+		return fmt.Errorf("%s is a %s, not a program", dmake.outputname, dmake.outputtype)
+	}
+	if dmake.Target().cross {
+		return fmt.Errorf("%s is built for %s and can't be run here", dmake.outputname, dmake.Target().Name())
+	}
+	program := AsCommand(dmake.OutputPath())
+	if DryRun(program, runArgs...) {
+		return nil
+	}
+	logger.Debugf("RUN: %s %v", program, runArgs)
+	cmd := exec.Command(program, runArgs...)
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, CommandOutput(), os.Stderr
+	return RunCommand(cmd)
+}
+
+// dmake clean in cwd
+//
+// Removes the output, objects and other files built for the current
+// mode and target, then those built for any other modes and targets.
+// Run removes the build directory afterwards if that leaves it empty.
+//
+func (dmake *Dmake) CleanAction() error {
+	if dmake.IsBundle() {
+		RemoveAll(dmake.BundlePath())
+	} else {
+		Remove(dmake.OutputPath())
+	}
+	for _, path := range dmake.Target().WasmCompanions(dmake.OutputPath()) {
+		Remove(path)
+	}
+	RemoveAll(TemporaryOutputDirectory(dmake.OutputPath()))
+	if dmake.Toolchain().msvc {
+		base := strings.TrimSuffix(dmake.OutputPath(), filepath.Ext(dmake.OutputPath()))
+		Remove(base + ".pdb")
+		if dmake.outputtype == DllOutputType || dmake.outputtype == PluginOutputType {
+			Remove(base + ".lib")
+			Remove(base + ".exp")
+		}
+	}
+	if version := dmake.LibraryVersion(); version != "" {
+		real, soname := dmake.VersionedOutputPaths(version)
+		Remove(real)
+		Remove(soname)
+	}
+	if dmake.Target().os == androidOS {
+		Remove(dmake.BuildPath(dmake.AndroidOutputDirectory(dmake.ModeDirectory())))
+		Remove(dmake.BuildPath(filepath.Join(dmake.ModeDirectory(), androidLibsDirectory)))
+	}
+	if dir := dmake.ModeDirectory(); dir != "" {
+		Remove(dmake.BuildPath(dir))
+	}
+	if len(dmake.testFiles) > 0 {
+		RemoveAll(dmake.BuildPath(testsDirectory))
+		if reportdir := dmake.BuildPath(coverageDirectory); IsCoverageReport(reportdir) {
+			RemoveAll(reportdir)
+		}
+	}
+	if IsDoxygenOutput(docsDirectory) {
+		RemoveAll(filepath.Join(docsDirectory, "html"))
+	}
+	if dmake.HaveChecks() {
+		Remove(dmake.ConfigHeader())
+		Remove(dmake.ConfigCommandPath())
+	}
+	if len(dmake.generated) > 0 {
+		RemoveAll(dmake.GenDir())
+	}
+	for _, path := range dmake.resourceFiles {
+		Remove(dmake.Target().ResourceObjectFilename(path, dmake.ObjsDir(), dmake.ResourceCompiler(os.Environ())[0]))
+	}
+	dmake.CleanObjects(dmake.sourceFiles)
+	dmake.CleanObjects(dmake.testFiles)
+	dmake.CleanVariants()
+	return nil
+}
+
+//  Remove the object and dependency files compiled from some source
+//  files, and the directories holding them.
+//
+func (dmake *Dmake) CleanObjects(srcfiles []string) {
+	objsdir, depsdir := dmake.BuildDirectory(dmake.ObjsRoot()), dmake.BuildDirectory(depsRoot)
+	doClean := func(path string, deletable string) {
+		Remove(path)
+		dir := filepath.Dir(path)
+		if dir == deletable || strings.HasSuffix(dir, string(filepath.Separator)+deletable) {
+			RemoveAll(dir)
+			RemoveEmptyParents(dir, strings.Count(deletable, string(filepath.Separator)))
+		}
+	}
+	for _, srcfile := range srcfiles {
+		ofile := dmake.Target().ObjectFilename(srcfile, dmake.ObjsDir())
+		doClean(ofile, objsdir)
+		doClean(DependenciesFilename(ofile, dmake.ObjsDir(), dmake.DepsDir()), depsdir)
+	}
+}
+
+//  Return an error if the receiver's build directory is, or contains,
+//  its source directory or any of its sub-directories. Cleaning only
+//  removes the files dmake creates but a build directory that holds
+//  the sources is surely a mistake.
+//
+func (dmake *Dmake) CheckBuildDirectory() error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	for _, dir := range append([]string{"."}, dmake.directories...) {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(cwd, dir)
+		}
+		if rel, err := filepath.Rel(dmake.builddir, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("%s: the build directory contains the source directory %s", dmake.builddir, dir)
+		}
+	}
+	return nil
+}
+
+//  Remove the files built for other modes and targets, so cleaning
+//  after a release or cross-compiled build removes them too. They're
+//  found by looking for their object and dependency directories.
+//
+func (dmake *Dmake) CleanVariants() {
+	current := BuildVariant{mode: dmake.ModeDirectory(), goos: dmake.Target().os, goarch: dmake.Target().arch}
+	var variants []BuildVariant
+	dirs := []string{"."}
+	for _, path := range dmake.sourceFiles {
+		if dir := filepath.Dir(path); !Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, root := range []string{dmake.ObjsRoot(), depsRoot} {
+		if filepath.Clean(root) == "." {
+			continue
+		}
+		roots := []string{dmake.BuildPath(root)}
+		if !filepath.IsAbs(roots[0]) {
+			roots = roots[:0]
+			for _, dir := range dirs {
+				roots = append(roots, filepath.Join(dir, root))
+			}
+		}
+		for _, root := range roots {
+			for _, v := range BuildVariants(root) {
+				if v == current {
+					continue
+				}
+				dir := v.Directory(root)
+				RemoveAll(dir)
+				RemoveEmptyParents(dir, strings.Count(v.Directory(""), string(filepath.Separator))+1)
+				if !containsVariant(variants, v) {
+					variants = append(variants, v)
+				}
+			}
+		}
+	}
+	var modes []string
+	for _, v := range variants {
+		Remove(dmake.VariantOutputPath(v))
+		if v.mode != "" && v.mode != current.mode && !Contains(modes, v.mode) {
+			modes = append(modes, v.mode)
+		}
+	}
+	for _, mode := range modes {
+		Remove(dmake.BuildPath(mode))
+	}
+}
+
+func containsVariant(variants []BuildVariant, v BuildVariant) bool {
+	for _, variant := range variants {
+		if variant == v {
+			return true
+		}
+	}
+	return false
+}
+
+//  Return the pathname of the receiver's output when built for a
+//  variant. Outputs named by default follow the variant's platform's
+//  conventions, e.g. foo.exe for Windows.
+//
+func (dmake *Dmake) VariantOutputPath(v BuildVariant) string {
+	name := dmake.outputname
+	if dmake.outputnameDefaulted && dmake.outputtype != UnknownOutputType {
+		name = filepath.Join(filepath.Dir(name), PlatformFor(v.goos).FilenameForType(dmake.outputtype, dmake.Name()))
+	}
+	if v.mode != "" && !filepath.IsAbs(name) {
+		name = filepath.Join(v.mode, name)
+	}
+	return dmake.BuildPath(name)
+}
+
+// dmake install in cwd
+//
+func (dmake *Dmake) InstallAction(env []string) error {
+	path := dmake.installprefix
+	if path == "" {
+		path = "."
+	}
+	if dmake.IsBundle() {
+		return dmake.InstallBundle(path)
+	}
+	var (
+		dest string
+		mode os.FileMode
+	)
+	if dmake.outputtype == ExeOutputType {
+		dest = dmake.BinDir(path)
+		mode = os.FileMode(0555)
+	} else {
+		dest = dmake.LibDir(path)
+		mode = os.FileMode(0444)
+	}
+	if version := dmake.LibraryVersion(); version != "" {
+		real, soname := dmake.VersionedOutputPaths(version)
+		if err := dmake.InstallBinary(env, real, dest, mode, path); err != nil {
+			return err
+		}
+		if err := dmake.InstallSymlink(filepath.Base(real), dest, filepath.Base(soname)); err != nil {
+			return err
+		}
+		if err := dmake.InstallSymlink(filepath.Base(soname), dest, filepath.Base(dmake.OutputPath())); err != nil {
+			return err
+		}
+	} else if err := dmake.InstallBinary(env, dmake.OutputPath(), dest, mode, path); err != nil {
+		return err
+	}
+	if err := dmake.InstallWasmCompanions(dmake.OutputPath(), dest); err != nil {
+		return err
+	}
+	if err := dmake.InstallHeaders(path); err != nil {
+		return err
+	}
+	if err := dmake.InstallManPages(path); err != nil {
+		return err
+	}
+	if err := dmake.InstallExtraFiles(path); err != nil {
+		return err
+	}
+	if _, found := dmake.vars.Get("PKGCONFIG"); found && dmake.IsLibrary() {
+		return dmake.InstallPkgConfig(path)
+	}
+	return nil
+}
+
+// dmake uninstall in cwd
+//
+// Removes the files listed in the install manifest, in the build
+// directory if one is being used, then the manifest itself. A directory with sub-directories has nothing of
+// its own to uninstall unless it has a manifest.
+//
+func (dmake *Dmake) UninstallAction() error {
+	manifest := dmake.InstallManifestPath()
+	paths, err := ReadInstallManifest(manifest)
+	if os.IsNotExist(err) {
+		if !dmake.HaveDirs() {
+			logger.Infof("nothing to uninstall, no install manifest")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		logger.Verbosef("removing %q", path)
+		if err = Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	dmake.installed = nil
+	return Remove(manifest)
+}
+
+//  Install the receiver's public header files under
+//  <includedir>/<name>. Header files keep their location relative
+//  to the headers root directory so sub-directories are preserved.
+//
+func (dmake *Dmake) InstallHeaders(prefix string) error {
+	if len(dmake.headerFiles) < 1 {
+		return nil
+	}
+	root := dmake.headersRoot
+	if root == "" {
+		root = "."
+	}
+	dest := filepath.Join(dmake.IncludeDir(prefix), dmake.Name())
+	for _, path := range dmake.headerFiles {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("%s: header file is not below HEADERS_ROOT %q", path, root)
+		}
+		if err = dmake.InstallFile(path, filepath.Join(dest, filepath.Dir(rel)), os.FileMode(0444)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//  Return the pathname of a file or directory created by the build,
+//  located in the build directory when one is being used.
+//
+func (dmake *Dmake) BuildPath(path string) string {
+	if dmake.builddir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dmake.builddir, path)
+}
+
+//  Return the pathname of the receiver's output file. When a build
+//  mode or sanitizers are selected outputs go in a directory named for
+//  them, and Android outputs in a directory for the ABI.
+//
+func (dmake *Dmake) OutputPath() string {
+	dir := dmake.ModeDirectory()
+	if dmake.Target().os == androidOS {
+		dir = dmake.AndroidOutputDirectory(dir)
+	}
+	if dir != "" && !filepath.IsAbs(dmake.outputname) {
+		return dmake.BuildPath(filepath.Join(dir, dmake.outputname))
+	}
+	return dmake.BuildPath(dmake.outputname)
+}
+
+//  Return the name of the directory used for object files.
+//
+func (dmake *Dmake) ObjsDir() string {
+	return dmake.BuildPath(dmake.BuildDirectory(dmake.ObjsRoot()))
+}
+
+//  Return the name of the directory used for dependency files.
+//
+func (dmake *Dmake) DepsDir() string {
+	return dmake.BuildPath(dmake.BuildDirectory(depsRoot))
+}
+
+//  Return the receiver's name, the name of the output without any
+//  platform-specific prefix or suffix.
+//
+func (dmake *Dmake) Name() string {
+	if dmake.IsLibrary() {
+		return dmake.Target().platform.LibraryName(dmake.outputname)
+	}
+	return strings.TrimSuffix(filepath.Base(dmake.outputname), dmake.Target().platform.exesuffix)
+}
+
+//  Return true if the receiver builds a library of some form.
+//
+func (dmake *Dmake) IsLibrary() bool {
+	return dmake.outputtype == LibOutputType || dmake.outputtype == DllOutputType
 }
 
 // dmake init [<name> <options>...]
 //
 // options :=
-//            exe | lib | dll
+//            exe | lib | dll | plugin
 // 	    | c | c++ | objc | objc++
-//          | c99 | c11
-//          | c++11 | c++14 | c++17 | c++20
+//          | c89 ... c23 | gnu89 ... gnu23
+//          | c++98 ... c++26 | gnu++98 ... gnu++26
 //          | debug | release
+//          | tests
+//          | -i
+//          | -template <name>
+//          | -gitignore | -git
+//          | -from { cmake | make }
 //
 // Creates:
 //
@@ -262,9 +1744,24 @@ func (dmake *Dmake) InstallAction() error {
 //	.dmake (only if required)
 //	Makefile
 //
-func (dmake *Dmake) InitAction(args []string, cwd string) error {
+// With -i the options are asked for interactively, along with a
+// license, the headers to install, whether to create tests and
+// starter sources. The questions are written to out and the answers
+// read from in.
+//
+// In a directory without source files starter sources are created,
+// a program unless a library is asked for.
+//
+func (dmake *Dmake) InitAction(args []string, cwd string, in io.Reader, out io.Writer) error {
 
-	var err error
+	templateName, args, err := TakeOption(args, "-template")
+	if err != nil {
+		return err
+	}
+	from, args, err := TakeOption(args, "-from")
+	if err != nil {
+		return err
+	}
 
 	//  Don't do anything if there is already something called .dcc
 	//
@@ -276,9 +1773,10 @@ func (dmake *Dmake) InitAction(args []string, cwd string) error {
 	if _, err = os.Stat(".dmake"); err == nil {
 		return errors.New("a .dmake file already exists, not continuing")
 	}
-	//  Don't do anything if there is already something called Makefile
+	//  Don't do anything if there is already something called Makefile,
+	//  unless it's the makefile being imported.
 	//
-	if _, err = os.Stat("Makefile"); err == nil {
+	if _, err = os.Stat("Makefile"); err == nil && from != "make" {
 		return errors.New("a Makefile already exists, not continuing")
 	}
 
@@ -291,21 +1789,58 @@ func (dmake *Dmake) InitAction(args []string, cwd string) error {
 	)
 
 	alreadyHave := func(what, value, arg string) {
-		log.Fatalf("%s: %s already specified as %s", arg, what, value)
+		logger.Fatalf("%s: %s already specified as %s", arg, what, value)
 	}
 
-	_, language, err = SourceFiles()
+	sources, language, err := dmake.Target().SourceFiles()
 	if err != nil {
 		return err
 	}
 
+	imported := &ImportedProject{}
+	if from != "" {
+		if imported, err = ImportProject(from); err != nil {
+			return err
+		}
+		if language == UnknownLanguage {
+			language = LanguageOf(imported.sources)
+		}
+	}
+
+	var templateDir string
+	var templateFiles []string
+	if templateName != "" {
+		if templateDir, err = TemplateDirectory(templateName); err != nil {
+			return err
+		}
+		templateFiles = TemplateFiles(templateDir)
+		if len(templateFiles) == 0 {
+			return fmt.Errorf("%s: template %s not found or empty", templateDir, templateName)
+		}
+		if language == UnknownLanguage {
+			language = LanguageOf(templateFiles)
+		}
+	}
+
+	var extras InitExtras
+	interactive := Contains(args, "-i")
+	if interactive {
+		if len(args) != 1 {
+			return errors.New("-i cannot be used with other init options")
+		}
+		if args, extras, err = dmake.InitInteractively(in, out); err != nil {
+			return err
+		}
+	}
+
 	for _, arg := range args {
 		switch arg {
 		case "c", "c++", "objc", "objc++":
 			if language != UnknownLanguage && language.String() != arg {
-				log.Fatal(arg + " is not the language used by source files, " + language.String())
+				logger.Fatal(arg + " is not the language used by source files, " + language.String())
 			}
-		case "exe", "lib", "dll":
+			language.Set(arg)
+		case "exe", "lib", "dll", "plugin":
 			if projectType != "" {
 				alreadyHave("project type", projectType, arg)
 			}
@@ -315,27 +1850,68 @@ func (dmake *Dmake) InitAction(args []string, cwd string) error {
 				alreadyHave("build mode", buildMode, arg)
 			}
 			buildMode = arg
-		case "c99", "c11":
-			if language == CplusplusLanguage {
-				log.Fatal("C standard specified but this is a C++ project")
-			}
-			if languageStd != "" {
-				alreadyHave("language standard", languageStd, arg)
-			}
-			languageStd = arg
-		case "c++11", "c++14", "c++17", "c++20":
-			if language == CLanguage {
-				log.Fatal("C++ standard specified but this is a C++ project")
-			}
-			if languageStd != "" {
-				alreadyHave("language standard", languageStd, arg)
-			}
-			languageStd = arg
+		case "tests":
+			extras.tests = true
+		case "-gitignore", "--gitignore":
+			extras.gitignore = true
+		case "-git", "--git":
+			extras.git = true
 		default:
-			if outputName != "" {
-				alreadyHave("output filename", outputName, arg)
+			switch {
+			case Contains(cStandards, arg):
+				if language == CplusplusLanguage || language == ObjcplusplusLanguage {
+					logger.Fatal("C standard specified but the project's language is " + language.String())
+				}
+				if languageStd != "" {
+					alreadyHave("language standard", languageStd, arg)
+				}
+				languageStd = arg
+			case Contains(cxxStandards, arg):
+				if language == CLanguage || language == ObjcLanguage {
+					logger.Fatal("C++ standard specified but the project's language is " + language.String())
+				}
+				if languageStd != "" {
+					alreadyHave("language standard", languageStd, arg)
+				}
+				languageStd = arg
+			default:
+				if outputName != "" {
+					alreadyHave("output filename", outputName, arg)
+				}
+				outputName = arg
+			}
+		}
+	}
+
+	//  An empty directory gets starter sources, a program unless a
+	//  library was asked for, so dmake builds something straight
+	//  away. C++ is used unless a C standard was given.
+	//
+	if !interactive && from == "" && len(sources) == 0 && !HaveSourceFiles(templateFiles) {
+		extras.sources = true
+		if language == UnknownLanguage {
+			language = CplusplusLanguage
+			if Contains(cStandards, languageStd) {
+				language = CLanguage
 			}
-			outputName = arg
+		}
+		if projectType == "" {
+			projectType = "exe"
+		}
+	}
+
+	if projectType == "" {
+		projectType = imported.projectType
+	}
+	if outputName == "" {
+		outputName = imported.name
+	}
+	if languageStd == "" {
+		languageStd = imported.std
+	}
+	if languageStd != "" && language != UnknownLanguage {
+		if languageStd, err = CheckLanguageStandard(dmake.TargetEnvironment(os.Environ()), dmake.Toolchain(), language, languageStd); err != nil {
+			return err
 		}
 	}
 
@@ -346,44 +1922,83 @@ func (dmake *Dmake) InitAction(args []string, cwd string) error {
 		buildMode = defaultBuildMode
 	}
 	if languageStd == "" {
-		if language == CLanguage {
+		if language == CLanguage || language == ObjcLanguage {
 			languageStd = defaultCStandard
-		} else if language == CplusplusLanguage {
+		} else if language == CplusplusLanguage || language == ObjcplusplusLanguage {
 			languageStd = defaultCxxStandard
 		}
 	}
 
+	//  A template's files are copied first. Any options files,
+	//  .dmake or Makefile it has replace those init would create.
+	//
+	if templateDir != "" {
+		templateType := projectType
+		if templateType == "" {
+			templateType = dmake.DetermineOutputType().String()
+			for _, path := range templateFiles {
+				if DefinesMain(path) {
+					templateType = "exe"
+				}
+			}
+		}
+		vars := TemplateVars(templateType, language, languageStd, outputName)
+		if err := CopyTemplate(templateDir, vars); err != nil {
+			return err
+		}
+	}
+	fromTemplate := func(path string) bool {
+		if templateDir == "" {
+			return false
+		}
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
 	if err := os.Mkdir(".dcc", 0777); err != nil && !os.IsExist(err) {
-		log.Fatal(err)
+		logger.Fatal(err)
 	}
 
-	//  Create the dcc options file, CFLAGS or CXXFLAGS.
+	//  Create the dcc options file, CFLAGS, CXXFLAGS, OBJCFLAGS or
+	//  OBJCXXFLAGS.
 	//
 	optionsFilename := ".dcc/CFLAGS"
-	if language == CplusplusLanguage {
-		optionsFilename = ".dcc/CXXFLAGS"
+	if name, found := compilerOptionsFilename[language]; found {
+		optionsFilename = ".dcc/" + name
 	}
+	objc := language == ObjcLanguage || language == ObjcplusplusLanguage
 
-	file, err := os.Create(optionsFilename)
-	if err != nil {
-		log.Fatal(err)
-	}
-	if languageStd != "" {
-		fmt.Fprintf(file, "-std=%s\n", languageStd)
-	}
-	fmt.Fprintln(file, defaultWarningOpts)
-	fmt.Fprintln(file, "-g")
-	if buildMode == "release" {
-		fmt.Fprintln(file, "-DNDEBUG")
-		fmt.Fprintln(file, defaultReleaseOptim)
-	} else { // if buildMode == "debug"
-		fmt.Fprintln(file, "-DDEBUG")
-		fmt.Fprintln(file, defaultDebugOptim)
-	}
+	if !fromTemplate(optionsFilename) {
+		file, err := os.Create(optionsFilename)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if languageStd != "" {
+			fmt.Fprintf(file, "-std=%s\n", languageStd)
+		}
+		fmt.Fprintln(file, defaultWarningOpts)
+		if objc {
+			fmt.Fprintln(file, defaultObjcOpts)
+			if options := ObjcOptions(); options != "" {
+				fmt.Fprintln(file, options)
+			}
+		}
+		fmt.Fprintln(file, "-g")
+		if buildMode == "release" {
+			fmt.Fprintln(file, "-DNDEBUG")
+			fmt.Fprintln(file, defaultReleaseOptim)
+		} else { // if buildMode == "debug"
+			fmt.Fprintln(file, "-DDEBUG")
+			fmt.Fprintln(file, defaultDebugOptim)
+		}
+		for _, option := range imported.cflags {
+			fmt.Fprintln(file, option)
+		}
 
-	if err := file.Close(); err != nil {
-		os.Remove(optionsFilename)
-		log.Fatal(err)
+		if err := file.Close(); err != nil {
+			os.Remove(optionsFilename)
+			logger.Fatal(err)
+		}
 	}
 
 	const readByDccComment = "# This file is read by dcc\n#\n\n"
@@ -392,7 +2007,13 @@ func (dmake *Dmake) InitAction(args []string, cwd string) error {
 
 	switch projectType {
 	case "":
-		switch dmake.DetermineOutputType() {
+		outputType := dmake.DetermineOutputType()
+		for _, path := range sources {
+			if DefinesMain(path) {
+				outputType = ExeOutputType
+			}
+		}
+		switch outputType {
 		case ExeOutputType:
 			typeVarName = "EXE"
 		case DllOutputType:
@@ -402,17 +2023,38 @@ func (dmake *Dmake) InitAction(args []string, cwd string) error {
 		case LibOutputType:
 			typeVarName = "LIB"
 		}
-	case "dll":
-		typeVarName = "DLL"
-		CreateFile(".dcc/LDFLAGS", readByDccComment)
+	case "dll", "plugin":
+		typeVarName = strings.ToUpper(projectType)
+		if !fromTemplate(".dcc/LDFLAGS") {
+			ldflags := readByDccComment
+			if projectType == "plugin" {
+				ldflags += OptionsLines(PluginLinkOptions())
+			}
+			CreateFile(".dcc/LDFLAGS", ldflags+OptionsLines(imported.ldflags))
+		}
+		if (objc || len(imported.libs) > 0) && !fromTemplate(".dcc/LIBS") {
+			libs := readByDccComment
+			if objc {
+				libs += ObjcLibs()
+			}
+			CreateFile(".dcc/LIBS", libs+OptionsLines(imported.libs))
+		}
 	case "exe":
 		typeVarName = "EXE"
-		CreateFile(".dcc/LDFLAGS", readByDccComment)
-		CreateFile(".dcc/LIBS", readByDccComment)
+		if !fromTemplate(".dcc/LDFLAGS") {
+			CreateFile(".dcc/LDFLAGS", readByDccComment+OptionsLines(imported.ldflags))
+		}
+		if !fromTemplate(".dcc/LIBS") {
+			libs := readByDccComment
+			if objc {
+				libs += ObjcLibs()
+			}
+			CreateFile(".dcc/LIBS", libs+OptionsLines(imported.libs))
+		}
 	case "lib":
 		typeVarName = "LIB"
 	default:
-		log.Fatal(projectType + ": unsupported project type")
+		logger.Fatal(projectType + ": unsupported project type")
 	}
 
 	//  Do we need to create a .dmake file?
@@ -428,41 +2070,97 @@ func (dmake *Dmake) InitAction(args []string, cwd string) error {
 	//  If the user didn't tell us that we have to figure it out
 	//  from the source files, if they exist.
 	//
-	if outputName != dmake.defaultoutput {
+	var dmakeLines []string
+	//  A plugin's type can't be determined from its sources, without
+	//  a main function dmake builds a static library, so it's always
+	//  defined.
+	//
+	if outputName != dmake.defaultoutput || projectType == "plugin" {
+		dmakeLines = append(dmakeLines, fmt.Sprintf("%s = %s", typeVarName, outputName))
+	}
+	if from != "" && !SameFiles(imported.sources, sources) {
+		dmakeLines = append(dmakeLines, "SRCS = "+strings.Join(imported.sources, " "))
+	}
+	if extras.headers != "" {
+		dmakeLines = append(dmakeLines, "HEADERS = "+extras.headers)
+	}
+
+	//  Create anything else asked for. Starter sources are created
+	//  first so tests can use them.
+	//
+	if projectType == "" {
+		projectType = strings.ToLower(typeVarName)
+	}
+	if extras.sources {
+		if err := CreateStarterSources(projectType, language, outputName); err != nil {
+			return err
+		}
+	}
+	if extras.tests {
+		pattern, err := CreateStarterTests(projectType, language, outputName)
+		if err != nil {
+			return err
+		}
+		dmakeLines = append(dmakeLines, "TESTS = "+pattern)
+	}
+	if err := CreateLicense(extras.license, extras.holder); err != nil {
+		return err
+	}
+	if extras.gitignore || extras.git {
+		if err := CreateGitIgnore(projectType, outputName); err != nil {
+			return err
+		}
+	}
+
+	if len(dmakeLines) > 0 && !fromTemplate(".dmake") {
 		file, err := os.Create(".dmake")
 		if err != nil {
-			log.Fatal(err)
+			logger.Fatal(err)
 		}
-		fmt.Fprintf(file, "%s = %s\n", typeVarName, outputName)
+		fmt.Fprintln(file, strings.Join(dmakeLines, "\n"))
 		if err := file.Close(); err != nil {
 			os.Remove(".dmake")
-			log.Fatal(err)
+			logger.Fatal(err)
 		}
 	}
 
-	// Output the Makefile
-	//
-	makefile, err := os.Create("Makefile")
-	if err != nil {
-		log.Fatal(err)
+	if from == "make" {
+		logger.Infof("the existing makefile is kept, dmake can be run directly")
+	} else if !fromTemplate("Makefile") {
+		if err := CreateInitMakefile(); err != nil {
+			return err
+		}
 	}
 
-	installDir := "$(prefix/lib"
-	if projectType == "exe" {
-		installDir = "$(prefix)/bin"
+	if extras.git {
+		return InitGitRepository()
+	}
+	return nil
+}
+
+//  Output the Makefile created by dmake init. Its install target has
+//  dmake install what it built, so the output is installed as dmake
+//  installs it, along with any libraries' headers, manual pages and
+//  other files.
+//
+func CreateInitMakefile() error {
+	makefile, err := os.Create("Makefile")
+	if err != nil {
+		logger.Fatal(err)
 	}
 
-	fmt.Fprintf(makefile, `.PHONY: all clean install
+	fmt.Fprint(makefile, `.PHONY: all clean install
 prefix?=/usr/local
+bindir?=$(prefix)/bin
+libdir?=$(prefix)/lib
+includedir?=$(prefix)/include
+mandir?=$(prefix)/share/man
 quiet?=@
 sudo?=
 all:; $(quiet) dmake
 clean:; $(quiet) dmake clean
-install: all; $(quiet) $(sudo) install -c %s %s
-`,
-		outputName,
-		installDir,
-	)
+install: all; $(quiet) $(sudo) dmake -no-build -prefix $(prefix) -bindir $(bindir) -libdir $(libdir) -includedir $(includedir) -mandir $(mandir) install
+`)
 
 	err = makefile.Close()
 	if err != nil {
@@ -475,59 +2173,268 @@ install: all; $(quiet) $(sudo) install -c %s %s
 //
 func (dmake *Dmake) DetermineOutputType() OutputType {
 	outputtype := UnknownOutputType
-	for _, path := range dmake.sourceFiles {
-		if DefinesMain(path) {
-			outputtype = ExeOutputType
-			break
-		}
+	if dmake.mainFunction = dmake.FindMainFunction(); dmake.mainFunction != "" {
+		outputtype = ExeOutputType
 	}
 	if outputtype == UnknownOutputType {
-		if *dllFlag {
+		if *dllFlag || dmake.dllDefault && !*pluginFlag {
 			outputtype = DllOutputType
-		} else if *pluginFlag {
+		} else if *pluginFlag || dmake.pluginDefault {
 			outputtype = PluginOutputType
 		} else {
 			outputtype = LibOutputType
 		}
 	}
-	if *debugFlag {
-		log.Printf("DEBUG: module type %q", outputtype)
-	}
+	logger.Debugf("module type %q", outputtype)
 	return outputtype
 }
 
 //  Read a .dmake file and set up the receiver from the variables
 //  defined in that file.
 //
-func (dmake *Dmake) ReadDmakefile() (err error) {
+//  Each section in the file defines a target. A target starts with
+//  the receiver's settings and uses the section's name as its default
+//  output name.
+//
+//  The file is only read once, its $(shell) commands run once, however
+//  often it's asked for.
+//
+func (dmake *Dmake) ReadDmakefile() error {
+	if !dmake.dmakefileRead {
+		dmake.dmakefileRead = true
+		dmake.dmakefileErr = dmake.readDmakefile()
+	}
+	return dmake.dmakefileErr
+}
+
+func (dmake *Dmake) readDmakefile() (err error) {
+	dmake.targets = nil
 	vars := make(Vars)
-	err = vars.ReadFromFile(dmakeFileFilename)
-	if err == nil {
-		err = dmake.InitFromVars(vars)
-	} else if os.IsNotExist(err) {
-		err = nil
+	sections, err := vars.ReadFromFile(dmakeFileFilename)
+	if os.IsNotExist(err) {
+		if len(commandLineVars) == 0 && len(workspaceVars) == 0 {
+			if err = dmake.AddWorkspaceProjects(dmake.projects); err != nil {
+				return err
+			}
+			return dmake.AddExeTargets()
+		}
+		vars, sections, err = make(Vars), nil, nil
+		vars.SetPredefined()
 	}
-	return
+	if err != nil {
+		return err
+	}
+	if err = dmake.InitFromVars(vars); err != nil {
+		return err
+	}
+	if err = dmake.AddWorkspaceProjects(dmake.projects); err != nil {
+		return err
+	}
+	for _, section := range sections {
+		target := &Dmake{
+			installprefix:        dmake.installprefix,
+			builddir:             dmake.builddir,
+			defaultoutput:        section.name,
+			outputname:           section.name,
+			outputnameDefaulted:  true,
+			writeCompileCommands: dmake.writeCompileCommands,
+		}
+		if err = target.InitFromVars(section.vars); err != nil {
+			return AddDetail(err, "section %q", section.name)
+		}
+		dmake.targets = append(dmake.targets, target)
+	}
+	return dmake.AddExeTargets()
+}
+
+//  When building an executable per main function, AUTOEXES, define
+//  a target for each of the source files defining main. A target
+//  builds an executable, named for the file, from that file and all
+//  the source files that don't define main. The targets share the
+//  object files directory so the common sources are compiled once.
+//
+func (dmake *Dmake) AddExeTargets() error {
+	if !dmake.autoExes {
+		return nil
+	}
+	if len(dmake.targets) > 0 {
+		return fmt.Errorf("AUTOEXES cannot be used with sections")
+	}
+	if dmake.outputtype != UnknownOutputType && dmake.outputtype != ExeOutputType {
+		return fmt.Errorf("AUTOEXES conflicts with %s", dmake.outputtype.String())
+	}
+	sourceFiles := dmake.sourceFiles
+	if len(sourceFiles) < 1 {
+		var err error
+		if sourceFiles, _, err = dmake.Target().SourceFiles(); err != nil {
+			return err
+		}
+		sourceFiles = Without(sourceFiles, dmake.testFiles)
+	}
+	if len(sourceFiles) < 1 {
+		return nil
+	}
+
+	cache := ReadMainCache(filepath.Join(dmake.ObjsDir(), mainCacheFilename))
+	var mains, common []string
+	mainFunctions := make(map[string]string)
+	for _, path := range sourceFiles {
+		if name := cache.MainFunction(path); name != "" {
+			mains = append(mains, path)
+			mainFunctions[path] = name
+		} else {
+			common = append(common, path)
+		}
+	}
+	if err := cache.Write(); err != nil {
+		logger.Debugf("%v", err)
+	}
+	if len(mains) < 1 {
+		return fmt.Errorf("AUTOEXES: no source files define main")
+	}
+
+	for _, path := range mains {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		target := *dmake
+		target.sourceFiles = append([]string{path}, common...)
+		target.mainFunction = mainFunctions[path]
+		target.outputtype = ExeOutputType
+		target.defaultoutput = name
+		target.outputname = dmake.Target().platform.ExeFilename(name)
+		target.outputnameDefaulted = false
+		target.directories = nil
+		target.dependencies = nil
+		target.targets = nil
+		target.autoExes = false
+		dmake.targets = append(dmake.targets, &target)
+	}
+	return nil
 }
 
 //  Set up the receiver from a Vars. Specifically,
 //
 //	SRCS	glob pattern matching source files
+//	TESTS	glob pattern matching test program source files
 //	DLL	output a dynamic lib with the defined name
+//	FRAMEWORK	output a macOS framework with the defined name
+//	APP	output a macOS application bundle with the defined name
+//	HEADERS_ONLY	output a header-only library with the defined name, INTERFACE is a synonym
+//	COMPILE_HEADERS	compile each of a header-only library's headers when building it
+//	BUNDLE_ID	the identifier in a framework or application's Info.plist
+//	RESOURCES	glob pattern matching files copied into a bundle's resources
+//	WINDOWS_SUBSYSTEM	console or gui, the subsystem of a Windows program
 //	LIB	output a static lib with the defined name
 //	EXE	output an executable with the defined name
+//	AUTOEXES	output an executable for each source file defining main
+//	PKGS	pkg-config packages used by the sources
+//	PROTOS	glob pattern matching protocol buffer definitions, .proto files
+//	PROTOC_PLUGINS	protoc plugins, name[=path], generating additional code
+//	PROTOCFLAGS	options passed to protoc
+//	GIT_VERSION	define DMAKE_VERSION and DMAKE_BUILD_DATE when compiling
+//	CFLAGS	C compiler options, similarly CXXFLAGS, OBJCFLAGS and OBJCXXFLAGS
+//	LDFLAGS	linker options
+//	EXPORTS	file listing the symbols a shared library or plugin exports
+//	VISIBILITY	hidden to compile with -fvisibility=hidden
+//	LIBS	libraries linked with the output
+//	PREBUILD	shell command run before building
+//	POSTBUILD	shell command run after building
+//	QT	the Qt modules used, e.g. widgets network
+//	QT_VERSION	the Qt major version, 5 by default
+//	YFLAGS	options passed to yacc
+//	LFLAGS	options passed to lex
+//	CHECK_HEADERS	header files to check for when writing config.h
+//	CHECK_FUNCS	functions to check for when writing config.h
+//	CHECK_LIBS	libraries to check for when writing config.h
+//	CONFIG_HEADER	the name of the config.h file
 //	DIRS	sub-directories to be built
+//	DEPENDS(dir)	the sub-directories a sub-directory depends upon
 //	PREFIX	installation prefix
+//	TARGET	os/arch, or profile e.g. mingw, to build for, if not given by -target
+//	TOOLCHAIN_FILE	the toolchain file describing the tools used, if not given by -toolchain
+//	WASM_HTML	build WebAssembly programs as web pages
+//	ANDROID_API	the minimum Android API level built for, 21 by default
+//	MODE	the build mode, if not given by -mode
+//	SANITIZE	the sanitizers used, e.g. address,undefined, if not given by -sanitize
+//	STATIC	on to link statically, if not given by -static
+//	TOOLCHAIN	the toolchain used, gnu, msvc or clang-cl
+//	MSVC_RUNTIME	the MSVC runtime library, MD, MT, MDd or MTd
+//	GCOV	the gcov command used to report coverage
+//	CLANG_TIDY	the clang-tidy command used by dmake tidy
+//	TIDY_CHECKS	the checks clang-tidy performs, e.g. bugprone-*,-bugprone-easily-swappable-parameters
+//	TIDY_WERROR	have clang-tidy's warnings fail the build, as per -Werror
+//	ANALYZER	the static analyzer used by dmake analyze, cppcheck or clang
+//	ANALYZER_FLAGS	options passed to the static analyzer
+//	DOXYGEN	the doxygen command used by dmake docs
+//	DEBUGGER	the debugger used by dmake debug, e.g. gdb or lldb
+//	MEMCHECK	run tests under valgrind, the command and options used, if any
+//	MEMCHECK_SUPPRESSIONS	glob pattern matching valgrind suppressions files
+//	DESTDIR	a staging directory prefixed to the names of installed files
+//	INSTALL	a program used to install files, e.g. /usr/bin/install
+//	NAME	the name of the Debian package made by dmake package -deb
+//	DEPENDS	the packages a Debian package depends upon
+//	MAINTAINER	a Debian package's maintainer, by default from git's user.name and user.email
+//	SECTION	a Debian package's section, misc by default
+//	PKG_ID	the identifier of a macOS installer package, BUNDLE_ID by default
+//	STRIP	strip installed programs and shared libraries, yes, no or the strip command
+//	SPLIT_DEBUG	split debug information into separate files when stripping
+//	DEBUG_DIR	where split debug files are installed, prefix/lib/debug by default
+//	CODESIGN_IDENTITY	the identity macOS outputs are signed with, if not given by -sign
+//	CODESIGN_RUNTIME	no to sign without the hardened runtime
+//	CODESIGN_ENTITLEMENTS	the entitlements file used when signing
+//	CODESIGN_FLAGS	other options passed to codesign
+//	LANG	the language of all source files, if not given by -lang
+//	DLL_DEFAULT	without a main function build a DLL, as per -dll
+//	PLUGIN_DEFAULT	without a main function build a plugin, as per -plugin
+//	OBJDIR	the directory under which object files are placed, .objs by default
+//	DCC	the dcc command to use
 //	WRITE_COMPILE_COMMANDS have dcc output a compile_commands.json file
+//	BUILD_INFO	write a build-info.json describing the outputs, as per -build-info
+//	HEADERS	glob pattern matching public header files to be installed
+//	HEADERS_ROOT	the directory installed header file names are relative to
+//	PKGCONFIG	install a pkg-config file along with a library
+//	VERSION	the version number used in pkg-config files
+//	DESCRIPTION	the description used in pkg-config files and Debian packages
+//	BINDIR	where programs are installed, prefix/bin by default
+//	LIBDIR	where libraries are installed, prefix/lib by default
+//	INCLUDEDIR	where header files are installed, prefix/include by default
+//	MANDIR	where manual pages are installed, prefix/share/man by default
+//	MANPAGES	the manual pages installed, e.g. prog.1
+//	INSTALL_FILES	additional files installed, file=dir[:mode], e.g. foo.conf=etc
+//	INCDIR	the header directory used in pkg-config files, INCLUDEDIR by default
+//
+//  Variables with a suffix naming the target operating system or
+//  architecture, e.g. SRCS_windows, are appended to the unsuffixed
+//  variable.
+//
+//  Variables named for one of the compiler option files and
+//  qualified by a glob pattern, e.g. CFLAGS(legacy.c), define extra
+//  compiler options for the matching source files.
 //
 func (dmake *Dmake) InitFromVars(vars Vars) error {
+	dmake.vars = vars
+
 	var patterns string
 	var found bool
 	var err error
 
+	if path, found := vars.GetValue("TOOLCHAIN_FILE"); found && *toolchainFlag == "" {
+		if dmake.toolchainDescription, err = ReadToolchainFile(path, dmake.Target()); err != nil {
+			return err
+		}
+		dmake.target = dmake.toolchainDescription.target
+	}
+
+	if name, found := vars.GetValue("TARGET"); found && *targetFlag == "" {
+		if dmake.target, err = NewTarget(name); err != nil {
+			return AddDetail(err, "TARGET")
+		}
+	}
+
+	vars.MergePlatformVars(dmake.Target())
+
 	patterns, found = vars.GetValue("SRCS")
 	if found {
-		dmake.sourceFiles, err = ExpandGlobs(patterns)
+		dmake.sourceFiles, err = dmake.Target().ExpandGlobs(patterns)
 		if err != nil {
 			return err
 		}
@@ -536,6 +2443,121 @@ func (dmake *Dmake) InitFromVars(vars Vars) error {
 		}
 	}
 
+	if patterns, found := vars.GetValue("TESTS"); found {
+		dmake.testFiles, err = dmake.Target().ExpandGlobs(patterns)
+		if err != nil {
+			return err
+		}
+		if len(dmake.testFiles) < 1 {
+			return fmt.Errorf("TESTS=%s matches no source files", patterns)
+		}
+	}
+
+	if patterns, found := vars.GetValue("PROTOS"); found {
+		dmake.protoFiles, err = dmake.Target().ExpandGlobs(patterns)
+		if err != nil {
+			return err
+		}
+		if len(dmake.protoFiles) < 1 {
+			return fmt.Errorf("PROTOS=%s matches no files", patterns)
+		}
+	}
+
+	if patterns, found := vars.GetValue("HEADERS"); found {
+		dmake.headerFiles, err = dmake.Target().ExpandGlobs(patterns)
+		if err != nil {
+			return err
+		}
+		if len(dmake.headerFiles) < 1 {
+			return fmt.Errorf("HEADERS=%s matches no files", patterns)
+		}
+	}
+	dmake.headersRoot, _ = vars.GetValue("HEADERS_ROOT")
+
+	if dmake.fileFlags, err = FileFlags(vars, dmake.Target()); err != nil {
+		return err
+	}
+
+	if lang, found := vars.GetValue("LANG"); found {
+		if err = dmake.language.Set(lang); err != nil {
+			return AddDetail(err, "LANG")
+		}
+	}
+
+	_, dmake.dllDefault = vars.Get("DLL_DEFAULT")
+	_, dmake.pluginDefault = vars.Get("PLUGIN_DEFAULT")
+	if dmake.dllDefault && dmake.pluginDefault {
+		return fmt.Errorf("DLL_DEFAULT and PLUGIN_DEFAULT cannot both be defined")
+	}
+
+	if root, found := vars.GetValue("OBJDIR"); found {
+		dmake.objsRoot = root
+	}
+
+	if mode, found := vars.GetValue("MODE"); found {
+		if err = CheckMode(mode); err != nil {
+			return AddDetail(err, "MODE")
+		}
+		dmake.mode = mode
+	}
+
+	if value, found := vars.GetValue("SANITIZE"); found {
+		if dmake.sanitizers, err = ParseSanitizers(value); err != nil {
+			return AddDetail(err, "SANITIZE")
+		}
+	}
+
+	if value, found := vars.GetValue("STATIC"); found {
+		if dmake.static, err = ParseStaticValue(value); err != nil {
+			return err
+		}
+	}
+
+	if name, found := vars.GetValue("TOOLCHAIN"); found {
+		dmake.toolchain, err = FindToolchain(name, dmake.Target())
+	} else if name := os.Getenv("TOOLCHAIN"); name != "" {
+		dmake.toolchain, err = FindToolchain(name, dmake.Target())
+	} else if dmake.toolchainDescription != nil {
+		dmake.toolchain = dmake.toolchainDescription.toolchain
+	} else if toolchainDescription == nil {
+		dmake.toolchain = DefaultToolchain(os.Environ(), dmake.Target())
+	}
+	if err != nil {
+		return err
+	}
+
+	dmake.androidAPI = vars.GetString("ANDROID_API")
+
+	dmake.msvcRuntime = vars.GetString("MSVC_RUNTIME")
+	if _, err = dmake.MsvcRuntime(); err != nil {
+		return err
+	}
+
+	if dmake.visibilityOptions, err = VisibilityOptions(vars.GetString("VISIBILITY")); err != nil {
+		return err
+	}
+
+	dmake.dcc, _ = vars.GetValue("DCC")
+
+	dmake.packages = strings.Fields(vars.GetString("PKGS"))
+
+	if modules, found := vars.GetValue("QT"); found {
+		dmake.qtModules = strings.Fields(modules)
+		dmake.packages = append(dmake.packages, QtPackages(dmake.qtModules, dmake.QtVersion())...)
+	}
+
+	if path, found := vars.GetValue("DESTDIR"); found {
+		dmake.destDir = path
+	} else {
+		dmake.destDir = os.Getenv("DESTDIR")
+	}
+
+	if program, found := vars.GetValue("INSTALL"); found {
+		dmake.installProgram = program
+	} else {
+		dmake.installProgram = os.Getenv("INSTALL")
+	}
+
 	if path, found := vars.GetValue("PREFIX"); found {
 		if dmake.installprefix == "" {
 			dmake.installprefix = path
@@ -545,7 +2567,7 @@ func (dmake *Dmake) InitFromVars(vars Vars) error {
 	var directories string
 	directories, found = vars.GetValue("DIRS")
 	if found {
-		dmake.directories, err = ExpandGlobs(directories)
+		dmake.directories, err = dmake.Target().ExpandGlobs(directories)
 		if err != nil {
 			return err
 		}
@@ -554,8 +2576,16 @@ func (dmake *Dmake) InitFromVars(vars Vars) error {
 		}
 	}
 
+	if dmake.dependencies, err = DirectoryDependencies(vars, dmake.directories); err != nil {
+		return err
+	}
+
 	_, dmake.writeCompileCommands = vars.Get("WRITE_COMPILE_COMMANDS")
 
+	if _, found := vars.Get("AUTOEXES"); found {
+		dmake.autoExes = true
+	}
+
 	checkVar := func(name string, outputtype OutputType, fn func(string) string) error {
 		if name, exists := vars.GetValue(name); exists {
 			if dmake.outputtype != UnknownOutputType && dmake.outputtype != outputtype {
@@ -566,21 +2596,95 @@ func (dmake *Dmake) InitFromVars(vars Vars) error {
 		}
 		return nil
 	}
-	if err = checkVar("DLL", DllOutputType, platform.DllFilename); err != nil {
+	if err = checkVar("DLL", DllOutputType, dmake.Target().platform.DllFilename); err != nil {
+		return err
+	}
+	if err = checkVar("PLUGIN", PluginOutputType, dmake.Target().platform.PluginFilename); err != nil {
+		return err
+	}
+	if err = checkVar("EXE", ExeOutputType, dmake.Target().platform.ExeFilename); err != nil {
+		return err
+	}
+	if err = checkVar("LIB", LibOutputType, dmake.Target().platform.LibFilename); err != nil {
+		return err
+	}
+	if err = checkVar("FRAMEWORK", FrameworkOutputType, dmake.Target().platform.FrameworkFilename); err != nil {
 		return err
 	}
-	if err = checkVar("PLUGIN", PluginOutputType, platform.PluginFilename); err != nil {
+	if err = checkVar("APP", AppBundleOutputType, dmake.Target().platform.AppBundleFilename); err != nil {
 		return err
 	}
-	if err = checkVar("EXE", ExeOutputType, platform.ExeFilename); err != nil {
+	if err = checkVar("HEADERS_ONLY", HeaderOnlyOutputType, filepath.Clean); err != nil {
 		return err
 	}
-	if err = checkVar("LIB", LibOutputType, platform.LibFilename); err != nil {
+	if err = checkVar("INTERFACE", HeaderOnlyOutputType, filepath.Clean); err != nil {
 		return err
 	}
 	return nil
 }
 
+//  Return the per-file compiler options defined by a Vars, as a map
+//  of source file names to options.
+//
+func FileFlags(vars Vars, target *Target) (map[string][]string, error) {
+	var keys []string
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fileFlags := make(map[string][]string)
+	for _, key := range keys {
+		open := strings.Index(key, "(")
+		if open < 1 || !strings.HasSuffix(key, ")") {
+			continue
+		}
+		switch key[:open] {
+		case "CFLAGS", "CXXFLAGS", "OBJCFLAGS", "OBJCXXFLAGS":
+		default:
+			continue
+		}
+		pattern := key[open+1 : len(key)-1]
+		paths, err := target.ExpandGlobs(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) < 1 {
+			return nil, fmt.Errorf("%s matches no source files", key)
+		}
+		for _, path := range paths {
+			fileFlags[path] = append(fileFlags[path], strings.Fields(vars.GetString(key))...)
+		}
+	}
+	return fileFlags, nil
+}
+
+//  Return the sub-directory dependencies defined by a Vars, as a map
+//  of directory names to the names of the directories they depend
+//  upon. Dependencies are defined by variables such as
+//  DEPENDS(app) = lib and must name directories listed in DIRS.
+//
+func DirectoryDependencies(vars Vars, directories []string) (map[string][]string, error) {
+	dependencies := make(map[string][]string)
+	for key, v := range vars {
+		if !strings.HasPrefix(key, "DEPENDS(") || !strings.HasSuffix(key, ")") {
+			continue
+		}
+		path := filepath.Clean(key[len("DEPENDS(") : len(key)-1])
+		if !Contains(directories, path) {
+			return nil, fmt.Errorf("%s: %q is not one of the DIRS", key, path)
+		}
+		for _, dependency := range strings.Fields(v.value) {
+			dependency = filepath.Clean(dependency)
+			if !Contains(directories, dependency) {
+				return nil, fmt.Errorf("%s: %q is not one of the DIRS", key, dependency)
+			}
+			dependencies[path] = append(dependencies[path], dependency)
+		}
+	}
+	return dependencies, nil
+}
+
 //  Add a directory to the receiver's list of directories to be dmake'd.
 //
 func (dmake *Dmake) AddDirectory(paths ...string) {
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSortDirectories(t *testing.T) {
+	check := func(directories []string, dependencies map[string][]string, expected ...string) {
+		sorted, err := SortDirectories(directories, dependencies)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(sorted, expected) {
+			t.Fatalf("%q sorted to %q, expected %q", directories, sorted, expected)
+		}
+	}
+
+	check([]string{"lib", "app", "tools"}, nil, "lib", "app", "tools")
+	check([]string{"app", "tools", "lib"}, map[string][]string{"app": {"lib"}}, "lib", "app", "tools")
+	check([]string{"app", "tools", "lib"}, map[string][]string{"app": {"tools"}, "tools": {"lib"}}, "lib", "tools", "app")
+	check([]string{"app"}, map[string][]string{"app": {"lib"}}, "app")
+
+	_, err := SortDirectories([]string{"a", "b"}, map[string][]string{"a": {"b"}, "b": {"a"}})
+	if err == nil {
+		t.Fatal("circular dependency not detected")
+	}
+}
+
+func TestScheduleDirectories(t *testing.T) {
+	// c depends upon b, which depends upon a, and d is independent. a
+	// only finishes once d has started so the test deadlocks if b,
+	// waiting for a, holds one of the two jobs.
+	directories := []string{"a", "b", "c", "d"}
+	dependencies := map[string][]string{"b": {"a"}, "c": {"b"}}
+	var mutex sync.Mutex
+	var order []string
+	dStarted := make(chan struct{})
+	run := func(path string) error {
+		mutex.Lock()
+		order = append(order, path)
+		mutex.Unlock()
+		switch path {
+		case "a":
+			select {
+			case <-dStarted:
+			case <-time.After(5 * time.Second):
+				return errors.New("d didn't start while a was running")
+			}
+		case "d":
+			close(dStarted)
+		}
+		return nil
+	}
+	skip := func(path, dependency string) {
+		t.Errorf("%s skipped, %s failed", path, dependency)
+	}
+	ScheduleDirectories(directories, dependencies, 2, false, run, skip)
+	position := make(map[string]int)
+	for i, path := range order {
+		position[path] = i
+	}
+	if len(order) != 4 || position["a"] > position["b"] || position["b"] > position["c"] {
+		t.Errorf("directories run in the order %q", order)
+	}
+
+	// When a fails b and c are skipped, naming the directory that
+	// failed, and with keep going d is still run.
+	order = nil
+	var skipped []string
+	run = func(path string) error {
+		mutex.Lock()
+		order = append(order, path)
+		mutex.Unlock()
+		if path == "a" {
+			return errors.New("failed")
+		}
+		return nil
+	}
+	skip = func(path, dependency string) {
+		mutex.Lock()
+		skipped = append(skipped, path+":"+dependency)
+		mutex.Unlock()
+	}
+	ScheduleDirectories(directories, dependencies, 2, true, run, skip)
+	sort.Strings(order)
+	if !reflect.DeepEqual(order, []string{"a", "d"}) {
+		t.Errorf("run %q after a failed, expected a and d", order)
+	}
+	if !reflect.DeepEqual(skipped, []string{"b:a", "c:b"}) {
+		t.Errorf("skipped %q", skipped)
+	}
+
+	// Without keep going nothing depending upon a failure runs, with
+	// one job nothing else starts after it.
+	order, skipped = nil, nil
+	ScheduleDirectories([]string{"a", "d"}, nil, 1, false, run, skip)
+	if !reflect.DeepEqual(order, []string{"a"}) && !reflect.DeepEqual(order, []string{"d", "a"}) {
+		t.Errorf("run %q, expected nothing after a failed", order)
+	}
+}
+
+func TestCheckBuildDirectory(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dmake := &Dmake{directories: []string{"lib"}}
+	for _, dir := range []string{cwd, filepath.Dir(cwd), filepath.Join(cwd, "lib")} {
+		dmake.builddir = dir
+		if dmake.CheckBuildDirectory() == nil {
+			t.Errorf("build directory %s contains sources, expected an error", dir)
+		}
+	}
+	for _, dir := range []string{filepath.Join(cwd, "build"), filepath.Join(cwd, "lib", "build"), t.TempDir()} {
+		dmake.builddir = dir
+		if err := dmake.CheckBuildDirectory(); err != nil {
+			t.Errorf("build directory %s: %v", dir, err)
+		}
+	}
+}
+
+func TestReadDmakefileOnce(t *testing.T) {
+	inTempProject(t, map[string]string{
+		dmakeFileFilename: "VERSION = $(shell echo x >> shell.log; echo 1.0)\n",
+	})
+	dmake := NewDmake(".", "", "")
+	for i := 0; i < 2; i++ {
+		if err := dmake.ReadDmakefile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, _ := os.ReadFile("shell.log"); string(data) != "x\n" {
+		t.Errorf("$(shell) ran %d times", strings.Count(string(data), "x"))
+	}
+}
+
+func TestCleanRemovesEmptyBuildDirectory(t *testing.T) {
+	// The root only has sub-directories so it has no target of its
+	// own to clean but its build directory is still removed.
+	dir := inTempProject(t, map[string]string{
+		dmakeFileFilename: "DIRS = lib\n",
+		"lib/lib.c":       "int f(void) { return 0; }\n",
+	})
+	builddir := filepath.Join(dir, "build")
+	if err := os.MkdirAll(filepath.Join(builddir, "lib"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	dmake := NewDmake(dir, "", "")
+	dmake.builddir = builddir
+	if err := dmake.Run(Cleaning, os.Environ()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(builddir); !os.IsNotExist(err) {
+		t.Errorf("build directory %s remains after cleaning", builddir)
+	}
+}
+
+func TestUninstallWithoutManifest(t *testing.T) {
+	var b strings.Builder
+	saved := logger
+	defer func() { logger = saved }()
+	logger = &Logger{w: &b, level: InfoLevel}
+
+	inTempProject(t, nil)
+	if err := (&Dmake{directories: []string{"lib"}}).UninstallAction(); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.String(); s != "" {
+		t.Errorf("uninstalling in a directory with only sub-directories logged %q", s)
+	}
+	if err := (&Dmake{}).UninstallAction(); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.String(); !strings.Contains(s, "nothing to uninstall") {
+		t.Errorf("uninstalling without a manifest logged %q", s)
+	}
+}
+
+//  A dcc that "compiles" a test program by copying its source, a
+//  shell script, to the executable.
+//
+const fakeTestDcc = `while [ $# -gt 1 ]; do
+	[ "$1" = --exe ] && exe=$2
+	shift
+done
+cp "$1" "$exe" && chmod +x "$exe"
+`
+
+func TestTestAction(t *testing.T) {
+	t.Setenv("DCC", fakeTool(t, "dcc", fakeTestDcc))
+	dir := inTempProject(t, map[string]string{
+		".dmake":       "LIB = x\nTESTS = tests/*.c\n",
+		"x.c":          "int x;\n",
+		"tests/pass.c": "#!/bin/sh\nexit 0\n",
+		"tests/fail.c": "#!/bin/sh\nexit 1\n",
+	})
+	var b strings.Builder
+	saved := logger
+	defer func() { logger = saved }()
+	logger = &Logger{w: &b, level: InfoLevel}
+
+	dmake := NewDmake(dir, "", "")
+	if err := dmake.ReadDmakefile(); err != nil {
+		t.Fatal(err)
+	}
+	err := dmake.TestAction(os.Environ())
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 tests failed") {
+		t.Errorf("expected a failing test to fail the action, got %v", err)
+	}
+	for _, s := range []string{"FAIL tests/fail.c", "PASS tests/pass.c", "2 tests, 1 passed, 1 failed"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("output %q doesn't contain %q", b.String(), s)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(testsDirectory, "pass")); err != nil {
+		t.Error(err)
+	}
+
+	if err := os.Remove(filepath.Join("tests", "fail.c")); err != nil {
+		t.Fatal(err)
+	}
+	dmake = NewDmake(dir, "", "")
+	if err := dmake.ReadDmakefile(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dmake.TestAction(os.Environ()); err != nil {
+		t.Errorf("passing tests failed: %v", err)
+	}
+}
+
+func TestRunAction(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("runs a shell script as the program")
+	}
+	inTempProject(t, map[string]string{"prog": "#!/bin/sh\nprintf '%s|' \"$@\" > args.log\nexit 3\n"})
+	if err := os.Chmod("prog", 0777); err != nil {
+		t.Fatal(err)
+	}
+	saved := runArgs
+	defer func() { runArgs = saved }()
+	runArgs = []string{"-v", "two words"}
+
+	dmake := &Dmake{outputtype: ExeOutputType, outputname: "prog"}
+	err := dmake.RunAction(os.Environ())
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Fatalf("expected the program's exit status, got %v", err)
+	}
+	if status := ExitStatus(Running, err); status != 3 {
+		t.Errorf("exit status %d, expected the program's, 3", status)
+	}
+	if status := ExitStatus(Building, err); status != 1 {
+		t.Errorf("exit status %d building, expected 1", status)
+	}
+	if args, _ := os.ReadFile("args.log"); string(args) != "-v|two words|" {
+		t.Errorf("program run with arguments %q", args)
+	}
+}
+
+func TestDirectoryErrors(t *testing.T) {
+	dir := inTempProject(t, map[string]string{
+		".dmake":   "DIRS = a b c\n",
+		"a/.dmake": "TARGET = plan9/amd64\n",
+		"b/.dmake": "TARGET = plan9/amd64\n",
+		"c/.dmake": "LIB = c\n",
+		"c/c.c":    "int c;\n",
+	})
+	savedKeepGoing, savedJobs, savedLogger := *keepGoingFlag, *jobsFlag, logger
+	defer func() { *keepGoingFlag, *jobsFlag, logger = savedKeepGoing, savedJobs, savedLogger }()
+	*keepGoingFlag, *jobsFlag = true, 1
+	logger = &Logger{w: &strings.Builder{}, level: InfoLevel}
+
+	dmake := NewDmake(dir, "", "")
+	if err := dmake.ReadDmakefile(); err != nil {
+		t.Fatal(err)
+	}
+	err := dmake.Run(Cleaning, os.Environ())
+	errs, ok := err.(DirectoryErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected two directories to fail, got %v", err)
+	}
+	var b strings.Builder
+	errs.Summarize(&b)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "DIRECTORY") || !strings.HasPrefix(lines[1], "a ") || !strings.HasPrefix(lines[2], "b ") {
+		t.Errorf("summary\n%s", b.String())
+	}
+	if !strings.Contains(lines[1], Cleaning.String()) || !strings.Contains(lines[1], "plan9") {
+		t.Errorf("summary line %q doesn't give the action and error", lines[1])
+	}
+	if status := ExitStatus(Cleaning, err); status != 2 {
+		t.Errorf("exit status %d, expected 2", status)
+	}
+}
+
+func TestInstallVersionedLibrary(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("DLLs aren't versioned")
+	}
+	t.Setenv("INSTALL", "")
+	t.Setenv("DESTDIR", "")
+	dir := inTempProject(t, map[string]string{".dmake": "DLL = x\nVERSION = 1.2.3\n", "x.c": "int x;\n"})
+	prefix := filepath.Join(dir, "usr")
+	dmake := NewDmake(dir, "", prefix)
+	if err := dmake.ReadDmakefile(); err != nil {
+		t.Fatal(err)
+	}
+	real, soname := dmake.VersionedOutputPaths(dmake.LibraryVersion())
+	if runtime.GOOS == "linux" && (real != "libx.so.1.2.3" || soname != "libx.so.1") {
+		t.Errorf("versioned library %q, soname %q", real, soname)
+	}
+	writeFiles(t, ".", map[string]string{real: "library"})
+	if err := dmake.InstallAction(os.Environ()); err != nil {
+		t.Fatal(err)
+	}
+	libdir := dmake.LibDir(prefix)
+	for link, target := range map[string]string{filepath.Base(dmake.OutputPath()): soname, soname: real} {
+		if s, err := os.Readlink(filepath.Join(libdir, link)); err != nil {
+			t.Error(err)
+		} else if s != target {
+			t.Errorf("%s links to %q, expected %q", link, s, target)
+		}
+	}
+	if info, err := os.Lstat(filepath.Join(libdir, real)); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("%s isn't installed as a file", real)
+	}
+
+	if err := NewDmake(dir, "", prefix).UninstallAction(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{filepath.Base(dmake.OutputPath()), soname, real} {
+		if _, err := os.Lstat(filepath.Join(libdir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s wasn't uninstalled", name)
+		}
+	}
+}
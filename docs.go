@@ -0,0 +1,189 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//  dmake docs runs doxygen to document the project, writing the HTML
+//  to docs/html. Without a Doxyfile dmake writes a minimal one naming
+//  the project, its version and the directories of its sources,
+//  headers and sub-directories. An existing Doxyfile is used as is.
+//  With -serve the HTML is then served locally.
+//
+const (
+	doxyfileFilename    = "Doxyfile"
+	docsDirectory       = "docs"
+	defaultDoxygen      = "doxygen"
+	defaultDocsAddress  = "localhost:8000"
+	doxygenHTMLFilename = "doxygen.css" // found in doxygen's HTML output
+)
+
+//  The files and directories excluded from the documentation, dmake's
+//  own.
+//
+var docsExcludePatterns = []string{
+	"*/.objs/*", "*/.dcc.d/*", "*/.tests/*", "*/.gen/*", "*/docs/*", "*/coverage/*",
+}
+
+// dmake docs in cwd
+//
+// Writes a Doxyfile if there isn't one, runs doxygen and, if
+// requested, serves the HTML it generates.
+//
+func (dmake *Dmake) DocsAction(env []string) error {
+	if _, err := os.Stat(doxyfileFilename); os.IsNotExist(err) {
+		inputs, err := dmake.DocsInputs()
+		if err != nil {
+			return err
+		}
+		if !*dryRunFlag {
+			if err := CreateFile(doxyfileFilename, dmake.Doxyfile(inputs)); err != nil {
+				return err
+			}
+			logger.Infof("wrote %s", doxyfileFilename)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	doxygen := strings.Fields(Getenv("DOXYGEN", defaultDoxygen))
+	if value, found := dmake.vars.GetValue("DOXYGEN"); found && value != "" {
+		doxygen = strings.Fields(value)
+	}
+	args := append(doxygen[1:len(doxygen):len(doxygen)], doxyfileFilename)
+	if DryRun(doxygen[0], args...) {
+		return nil
+	}
+	logger.Verbosef("RUN: %s %s", doxygen[0], ShellJoin(args))
+	cmd := exec.Command(doxygen[0], args...)
+	cmd.Env = env
+	cmd.Stdout, cmd.Stderr = CommandOutput(), os.Stderr
+	if err := RunCommand(cmd); err != nil {
+		return fmt.Errorf("%s: %v", doxygen[0], err)
+	}
+
+	html := filepath.Join(docsDirectory, "html")
+	if docsServeAddress == "" {
+		logger.Infof("documentation written to %s", html)
+		return nil
+	}
+	logger.Infof("serving %s at http://%s/, interrupt to stop", html, docsServeAddress)
+	return http.ListenAndServe(docsServeAddress, http.FileServer(http.Dir(html)))
+}
+
+//  Return the files and directories doxygen documents, any README.md,
+//  the directories of the source and public header files and the
+//  sub-directories.
+//
+func (dmake *Dmake) DocsInputs() ([]string, error) {
+	candidates := dmake.targets
+	if len(candidates) == 0 {
+		candidates = []*Dmake{dmake}
+	}
+	var paths []string
+	for _, candidate := range candidates {
+		if _, err := candidate.Prepare(); err != nil {
+			return nil, err
+		}
+		for _, path := range append(candidate.sourceFiles, candidate.headerFiles...) {
+			if candidate.OriginalSource(path) == path {
+				paths = append(paths, filepath.Dir(path))
+			}
+		}
+	}
+	paths = append(paths, dmake.directories...)
+	var inputs []string
+	if _, err := os.Stat("README.md"); err == nil {
+		inputs = append(inputs, "README.md")
+	}
+	return append(inputs, OutermostDirectories(paths)...), nil
+}
+
+//  Return the directories that aren't within another of the
+//  directories, in their original order.
+//
+func OutermostDirectories(paths []string) []string {
+	var dirs []string
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		if !Contains(dirs, path) {
+			dirs = append(dirs, path)
+		}
+	}
+	within := func(path, dir string) bool {
+		if path == dir {
+			return false
+		}
+		rel, err := filepath.Rel(dir, path)
+		return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	}
+	var outermost []string
+	for _, path := range dirs {
+		inner := false
+		for _, dir := range dirs {
+			if within(path, dir) {
+				inner = true
+				break
+			}
+		}
+		if !inner {
+			outermost = append(outermost, path)
+		}
+	}
+	return outermost
+}
+
+//  Return the contents of a minimal Doxyfile documenting the inputs.
+//
+func (dmake *Dmake) Doxyfile(inputs []string) string {
+	version := dmake.vars.GetString("VERSION")
+	if version == "" {
+		version = GitVersion()
+	}
+	quote := func(s string) string {
+		if s == "" || strings.ContainsAny(s, " \t\"") {
+			return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+		}
+		return s
+	}
+	var quoted []string
+	for _, path := range inputs {
+		quoted = append(quoted, quote(filepath.ToSlash(path)))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Doxyfile written by dmake, see doxygen -g for all settings\n\n")
+	fmt.Fprintf(&b, "PROJECT_NAME           = %s\n", quote(dmake.defaultoutput))
+	fmt.Fprintf(&b, "PROJECT_NUMBER         = %s\n", quote(version))
+	fmt.Fprintf(&b, "OUTPUT_DIRECTORY       = %s\n", docsDirectory)
+	fmt.Fprintf(&b, "INPUT                  = %s\n", strings.Join(quoted, " "))
+	fmt.Fprintf(&b, "RECURSIVE              = YES\n")
+	fmt.Fprintf(&b, "EXCLUDE_PATTERNS       = %s\n", strings.Join(docsExcludePatterns, " "))
+	if Contains(inputs, "README.md") {
+		fmt.Fprintf(&b, "USE_MDFILE_AS_MAINPAGE = README.md\n")
+	}
+	fmt.Fprintf(&b, "EXTRACT_ALL            = YES\n")
+	fmt.Fprintf(&b, "QUIET                  = YES\n")
+	fmt.Fprintf(&b, "GENERATE_HTML          = YES\n")
+	fmt.Fprintf(&b, "GENERATE_LATEX         = NO\n")
+	return b.String()
+}
+
+//  Return true if a directory holds doxygen's HTML output.
+//
+func IsDoxygenOutput(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "html", doxygenHTMLFilename))
+	return err == nil
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOutermostDirectories(t *testing.T) {
+	paths := []string{"src", "src/util", "lib/", "include", "src", "libs"}
+	expected := []string{"src", "lib", "include", "libs"}
+	if dirs := OutermostDirectories(paths); !reflect.DeepEqual(dirs, expected) {
+		t.Errorf("OutermostDirectories(%q) = %q, expected %q", paths, dirs, expected)
+	}
+	if dirs := OutermostDirectories([]string{"src", ".", "../other"}); !reflect.DeepEqual(dirs, []string{".", "../other"}) {
+		t.Errorf("expected . and ../other, got %q", dirs)
+	}
+}
@@ -0,0 +1,219 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//  The doctor action checks the environment dmake builds in, the
+//  tools it runs and the files it reads and writes, and reports what
+//  is wrong and how it might be fixed. Problems that stop dmake
+//  building are errors, others are warnings.
+//
+type doctor struct {
+	w        io.Writer
+	errors   int
+	warnings int
+}
+
+func (d *doctor) ok(format string, args ...interface{}) {
+	fmt.Fprintf(d.w, "ok       %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) warn(format string, args ...interface{}) {
+	d.warnings++
+	fmt.Fprintf(d.w, "warning  %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) fail(format string, args ...interface{}) {
+	d.errors++
+	fmt.Fprintf(d.w, "error    %s\n", fmt.Sprintf(format, args...))
+}
+
+//  Diagnose problems building in the current directory. Returns an
+//  error if any errors were found.
+//
+func (dmake *Dmake) DoctorAction(w io.Writer, env []string) error {
+	d := &doctor{w: w}
+
+	if err := dmake.ReadDmakefile(); err != nil {
+		if message := err.Error(); strings.HasPrefix(message, dmakeFileFilename) {
+			d.fail("%s", message)
+		} else {
+			d.fail("%s: %s", dmakeFileFilename, message)
+		}
+	} else if _, err := os.Stat(dmakeFileFilename); err == nil {
+		d.ok("%s: read", dmakeFileFilename)
+	}
+	d.checkOptionsFiles()
+
+	dcc := dmake.DccCommand()
+	if path, err := exec.LookPath(dcc); err == nil {
+		d.ok("dcc: %s", path)
+	} else if dcc == dccCommandName {
+		d.warn("dcc: not found on $PATH, the built-in compiler driver will be used. Install dcc using \"go install github.com/atrn/dcc@latest\"")
+	} else {
+		d.fail("dcc: %s not found, check the -dcc option, $DCC or the .dmake DCC variable", dcc)
+	}
+
+	sources, _, _ := dmake.Target().SourceFiles()
+	language := LanguageOf(sources)
+	env = dmake.TargetEnvironment(env)
+	for _, l := range []Language{CLanguage, CplusplusLanguage} {
+		variable, compiler := dmake.Toolchain().CompilerVariable(l)
+		if value, found := LookupEnv(env, variable); found && value != "" {
+			compiler = value
+		}
+		needed := CompilerVariableFor(language) == variable
+		d.checkCompiler(variable, compiler, needed)
+	}
+
+	if cache, err := dmake.CompilerCache(); err != nil {
+		d.fail("%v, install it or remove CACHE", err)
+	} else if cache != "" {
+		d.ok("cache: %s", cache)
+	}
+	if distributor, err := dmake.DistributedCompiler(); err != nil {
+		d.fail("%v, install it or remove DISTCC", err)
+	} else if distributor != "" {
+		d.ok("distcc: %s", distributor)
+	}
+
+	if len(dmake.packages) > 0 {
+		d.checkPackages(dmake.packages)
+	}
+
+	if program := strings.Fields(dmake.installProgram); len(program) > 0 {
+		if path, err := exec.LookPath(program[0]); err == nil {
+			d.ok("install: %s", path)
+		} else {
+			d.fail("install: %s not found, install it or remove INSTALL", program[0])
+		}
+	}
+
+	objsdir := dmake.ObjsDir()
+	if dir, err := writableDirectory(objsdir); err != nil {
+		d.fail("objects directory: %s is not writable, %v", dir, err)
+	} else {
+		d.ok("objects directory: %s is writable", objsdir)
+	}
+	if prefix := dmake.installprefix; prefix != "" {
+		if dir, err := writableDirectory(prefix); err != nil {
+			d.warn("prefix: %s is not writable, installing will need more privileges or a different -prefix", dir)
+		} else {
+			d.ok("prefix: %s is writable", prefix)
+		}
+	}
+
+	fmt.Fprintf(w, "%d errors, %d warnings\n", d.errors, d.warnings)
+	if d.errors > 0 {
+		return fmt.Errorf("%d problems found", d.errors)
+	}
+	return nil
+}
+
+//  Return the name of the environment variable defining the compiler
+//  needed for a language, or "" if it's not known.
+//
+func CompilerVariableFor(language Language) string {
+	if language == UnknownLanguage {
+		return ""
+	}
+	variable, _ := toolchain.CompilerVariable(language)
+	return variable
+}
+
+func (d *doctor) checkOptionsFiles() {
+	entries, err := os.ReadDir(dccOptionsDirectory)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			d.fail("%s: %v", dccOptionsDirectory, err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dccOptionsDirectory, entry.Name())
+		if _, err := ReadOptionsFile(path); err != nil {
+			d.fail("%s: %v", path, err)
+		} else {
+			d.ok("%s: read", path)
+		}
+	}
+}
+
+//  Check a compiler is found and runs. A compiler that isn't needed to
+//  build the current directory only warrants a warning.
+//
+func (d *doctor) checkCompiler(variable, compiler string, needed bool) {
+	problem := d.warn
+	if needed {
+		problem = d.fail
+	}
+	words := strings.Fields(compiler)
+	path, err := exec.LookPath(words[0])
+	if err != nil {
+		problem("%s: %s not found, install a compiler or define $%s", variable, words[0], variable)
+		return
+	}
+	output, err := exec.Command(path, append(words[1:], "--version")...).CombinedOutput()
+	if err != nil {
+		problem("%s: %s doesn't run, %v", variable, path, err)
+		return
+	}
+	version := strings.SplitN(strings.TrimSpace(string(output)), "\n", 2)[0]
+	d.ok("%s: %s, %s", variable, path, version)
+}
+
+func (d *doctor) checkPackages(packages []string) {
+	pkgconfig := Getenv("PKG_CONFIG", "pkg-config")
+	if _, err := exec.LookPath(pkgconfig); err != nil {
+		d.fail("pkg-config: %s not found, it's needed for PKGS", pkgconfig)
+		return
+	}
+	for _, pkg := range packages {
+		if err := exec.Command(pkgconfig, "--exists", pkg).Run(); err != nil {
+			d.fail("package %s: not found by %s, install it or add its directory to $PKG_CONFIG_PATH", pkg, pkgconfig)
+		} else {
+			d.ok("package %s: found", pkg)
+		}
+	}
+}
+
+//  Check a directory, or if it doesn't exist yet the closest parent
+//  that does, can be written by creating a file in it. Returns the
+//  directory checked.
+//
+func writableDirectory(dir string) (string, error) {
+	dir = filepath.Clean(dir)
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	f, err := os.CreateTemp(dir, ".dmake-doctor")
+	if err != nil {
+		return dir, err
+	}
+	f.Close()
+	return dir, os.Remove(f.Name())
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDoctorWithoutDcc(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses shell scripts as the compilers")
+	}
+	inTempProject(t, map[string]string{"main.c": "int main() { return 0; }\n"})
+	bin := t.TempDir()
+	writeFiles(t, bin, map[string]string{"cc": "#!/bin/sh\necho cc 1.0\n"})
+	os.Chmod(filepath.Join(bin, "cc"), 0777)
+	t.Setenv("PATH", bin)
+	t.Setenv("DCC", "")
+	env := []string{"CC=cc", "CXX=c++"}
+
+	var b strings.Builder
+	if err := NewDmake("prog", "", "").DoctorAction(&b, env); err != nil {
+		t.Fatal(err)
+	}
+	expected := `warning  dcc: not found on $PATH, the built-in compiler driver will be used. Install dcc using "go install github.com/atrn/dcc@latest"
+ok       CC: ` + filepath.Join(bin, "cc") + `, cc 1.0
+warning  CXX: c++ not found, install a compiler or define $CXX
+ok       objects directory: ` + (&Dmake{}).ObjsDir() + ` is writable
+0 errors, 2 warnings
+`
+	if s := b.String(); s != expected {
+		t.Errorf("report\n%s\nexpected\n%s", s, expected)
+	}
+
+	// A dcc named by the .dmake file must exist, as must the compiler
+	// for the directory's sources.
+	os.Remove("main.c")
+	writeFiles(t, ".", map[string]string{dmakeFileFilename: "DCC = nosuch-dcc\n", "main.cpp": ""})
+	b.Reset()
+	err := NewDmake("prog", "", "").DoctorAction(&b, env)
+	if err == nil || err.Error() != "2 problems found" {
+		t.Errorf("doctor returned %v", err)
+	}
+	for _, s := range []string{
+		"error    dcc: nosuch-dcc not found, check the -dcc option, $DCC or the .dmake DCC variable\n",
+		"error    CXX: c++ not found, install a compiler or define $CXX\n",
+		"2 errors, 0 warnings\n",
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("report doesn't contain %q\n%s", s, b.String())
+		}
+	}
+}
@@ -20,6 +20,21 @@ const (
 	Cleaning
 	Initing
 	Installing
+	Testing
+	Uninstalling
+	Running
+	Exporting
+	Graphing
+	Listing
+	Diagnosing
+	Covering
+	Tidying
+	Analyzing
+	Documenting
+	Packaging
+	Explaining
+	Flagging
+	Debugging
 )
 
 func (a Action) String() string {
@@ -34,6 +49,36 @@ func (a Action) String() string {
 		return "init"
 	case Installing:
 		return "install"
+	case Testing:
+		return "test"
+	case Uninstalling:
+		return "uninstall"
+	case Running:
+		return "run"
+	case Exporting:
+		return "export"
+	case Graphing:
+		return "graph"
+	case Listing:
+		return "list"
+	case Diagnosing:
+		return "doctor"
+	case Covering:
+		return "coverage"
+	case Tidying:
+		return "tidy"
+	case Analyzing:
+		return "analyze"
+	case Documenting:
+		return "docs"
+	case Packaging:
+		return "package"
+	case Explaining:
+		return "explain"
+	case Flagging:
+		return "flags"
+	case Debugging:
+		return "debug"
 	}
 	panic("unknown Action")
 }
@@ -93,6 +138,9 @@ const (
 	PluginOutputType
 	ExeOutputType
 	LibOutputType
+	FrameworkOutputType
+	AppBundleOutputType
+	HeaderOnlyOutputType
 )
 
 func (f OutputType) String() string {
@@ -107,6 +155,12 @@ func (f OutputType) String() string {
 		return "exe"
 	case LibOutputType:
 		return "lib"
+	case FrameworkOutputType:
+		return "framework"
+	case AppBundleOutputType:
+		return "app"
+	case HeaderOnlyOutputType:
+		return "headers"
 	default:
 		panic("unexpected OutputType")
 	}
@@ -114,11 +168,11 @@ func (f OutputType) String() string {
 
 func (f OutputType) DccArgument() string {
 	switch f {
-	case DllOutputType:
+	case DllOutputType, FrameworkOutputType:
 		return "--dll"
 	case PluginOutputType:
 		return "--plugin"
-	case ExeOutputType:
+	case ExeOutputType, AppBundleOutputType:
 		return "--exe"
 	case LibOutputType:
 		return "--lib"
@@ -136,14 +190,7 @@ const (
 	OpEq
 	OpPlusEq
 	OpMinusEq
-)
-
-var (
-	operators = []string{
-		"=",
-		"+=",
-		"-=",
-	}
+	OpQuestionEq
 )
 
 func (op Op) String() string {
@@ -154,6 +201,8 @@ func (op Op) String() string {
 		return "+="
 	case OpMinusEq:
 		return "-="
+	case OpQuestionEq:
+		return "?="
 	default:
 		panic("unexpected Op")
 	}
@@ -169,5 +218,8 @@ func OpFromString(s string) Op {
 	if s == "-=" {
 		return OpMinusEq
 	}
+	if s == "?=" {
+		return OpQuestionEq
+	}
 	panic(fmt.Errorf("%q is not an operator", s))
 }
@@ -0,0 +1,149 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//  Builds inherit dmake's environment. The -E option removes all but
+//  the variables commands need to run, PATH, HOME and the like, and
+//  those named by -keep-env, so a build doesn't depend on whatever a
+//  developer has in their environment. With -E the variables defined
+//  in a .env file in the workspace root, or the directory dmake is run
+//  in when it's not in a workspace, are then added, pinning the
+//  environment the project builds with. A project that always wants
+//  this sets E in its .dmake.conf. NAME=VALUE arguments take
+//  precedence over both.
+//
+const dotEnvFilename = ".env"
+
+//  The variables kept by -E.
+//
+var keptEnvironment = []string{
+	"HOME",
+	"LOGNAME",
+	"PATH",
+	"TEMP",
+	"TERM",
+	"TMP",
+	"TMPDIR",
+	"USER",
+	timingsEnvVar,
+	annotationsEnvVar,
+	sourceDateEpochEnvVar,
+	sourceRootEnvVar,
+	daemonEnvVar,
+
+	// Windows programs need these to run.
+	"APPDATA",
+	"ComSpec",
+	"LOCALAPPDATA",
+	"PATHEXT",
+	"SystemDrive",
+	"SystemRoot",
+	"USERPROFILE",
+	"windir",
+}
+
+//  Set up dmake's environment, as used by the commands it runs, for
+//  the project in the root directory.
+//
+func ControlEnvironment(root string) error {
+	if !*cleanEnvFlag {
+		return nil
+	}
+	keep := keptEnvironment
+	if *keepEnvFlag != "" {
+		keep = append(keep[:len(keep):len(keep)], strings.Split(*keepEnvFlag, ",")...)
+	}
+	CleanEnvironment(keep)
+	file, err := os.Open(filepath.Join(root, dotEnvFilename))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	definitions, err := ParseDotEnv(file, file.Name())
+	if err != nil {
+		return err
+	}
+	for _, definition := range definitions {
+		if err := os.Setenv(definition[0], definition[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//  Remove all but the named variables from the environment.
+//
+func CleanEnvironment(keep []string) {
+	saved := make(map[string]string)
+	for _, name := range keep {
+		if value, found := os.LookupEnv(strings.TrimSpace(name)); found {
+			saved[strings.TrimSpace(name)] = value
+		}
+	}
+	os.Clearenv()
+	for name, value := range saved {
+		os.Setenv(name, value)
+	}
+}
+
+//  Return the variables defined by a .env file, in order. Each line
+//  is NAME=VALUE, optionally preceded by "export". Values may be
+//  quoted, $NAME and ${NAME} are expanded in values not in single
+//  quotes, using the environment and earlier definitions. Blank lines
+//  and lines starting with # are ignored.
+//
+func ParseDotEnv(r io.Reader, filename string) ([][2]string, error) {
+	var definitions [][2]string
+	defined := make(map[string]string)
+	lookup := func(name string) string {
+		if value, found := defined[name]; found {
+			return value
+		}
+		return os.Getenv(name)
+	}
+	input := bufio.NewScanner(r)
+	for lineNumber := 1; input.Scan(); lineNumber++ {
+		line := strings.TrimSpace(input.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		eq := strings.Index(line, "=")
+		if eq < 1 {
+			return nil, fmt.Errorf("%s:%d: expected NAME=VALUE", filename, lineNumber)
+		}
+		name, value := strings.TrimSpace(line[:eq]), strings.TrimSpace(line[eq+1:])
+		if strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%s:%d: %q: invalid variable name", filename, lineNumber, name)
+		}
+		if n := len(value); n >= 2 && value[0] == '\'' && value[n-1] == '\'' {
+			value = value[1 : n-1]
+		} else {
+			if n >= 2 && value[0] == '"' && value[n-1] == '"' {
+				value = value[1 : n-1]
+			}
+			value = os.Expand(value, lookup)
+		}
+		defined[name] = value
+		definitions = append(definitions, [2]string{name, value})
+	}
+	return definitions, input.Err()
+}
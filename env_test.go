@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	t.Setenv("DMAKE_TEST_HOME", "/home/x")
+	input := `# comment
+CC=clang
+export PATH="$DMAKE_TEST_HOME/bin:${CC}"
+
+LITERAL='$CC'
+`
+	definitions, err := ParseDotEnv(strings.NewReader(input), ".env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][2]string{
+		{"CC", "clang"},
+		{"PATH", "/home/x/bin:clang"},
+		{"LITERAL", "$CC"},
+	}
+	if !reflect.DeepEqual(definitions, expected) {
+		t.Errorf("definitions %q, expected %q", definitions, expected)
+	}
+	if _, err := ParseDotEnv(strings.NewReader("CC clang\n"), ".env"); err == nil || !strings.HasPrefix(err.Error(), ".env:1:") {
+		t.Errorf("expected an error naming the line, got %v", err)
+	}
+
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, dotEnvFilename), []byte("DMAKE_TEST_PINNED=1\n"), 0666)
+	if err := ControlEnvironment(root); err != nil {
+		t.Fatal(err)
+	}
+	if value, found := os.LookupEnv("DMAKE_TEST_PINNED"); found {
+		os.Unsetenv("DMAKE_TEST_PINNED")
+		t.Errorf("without -E .env was read, DMAKE_TEST_PINNED=%s", value)
+	}
+}
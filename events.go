@@ -0,0 +1,121 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//  With -json dmake writes an Event, as a single line of JSON, to
+//  its standard output as things happen so other programs can follow
+//  a build. The output of the commands dmake runs goes to the
+//  standard error instead.
+//
+type Event struct {
+	Time      time.Time          `json:"time"`
+	Event     string             `json:"event"`
+	Directory string             `json:"directory,omitempty"`
+	Action    string             `json:"action,omitempty"`
+	Command   []string           `json:"command,omitempty"`
+	Status    string             `json:"status,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Duration  float64            `json:"duration,omitempty"` // seconds
+	Target    *TargetDescription `json:"target,omitempty"`
+	Flags     *CompileFlags      `json:"flags,omitempty"`
+}
+
+//  With -json "dmake list" writes a target Event describing each
+//  target. File names are relative to the event's directory.
+//
+type TargetDescription struct {
+	Type     string              `json:"type"`
+	Output   string              `json:"output"`
+	Language string              `json:"language"`
+	Sources  []SourceDescription `json:"sources"`
+}
+
+//  A source file compiled to build a target, and the compiler options
+//  used.
+//
+type SourceDescription struct {
+	Path     string   `json:"path"`
+	Language string   `json:"language"`
+	Options  []string `json:"options"`
+}
+
+//  The kinds of Event.
+//
+const (
+	BuildStartEvent     = "build-start"
+	BuildFinishEvent    = "build-finish"
+	DirectoryEnterEvent = "directory-enter"
+	DirectoryLeaveEvent = "directory-leave"
+	DccExecEvent        = "dcc-exec"
+	TargetEvent         = "target"
+	FlagsEvent          = "flags"
+)
+
+var (
+	eventMutex  sync.Mutex
+	eventOutput io.Writer = os.Stdout // where events are written
+)
+
+//  Write an event if -json was given. The event's time is set and,
+//  if no directory is given, the event's directory is the current
+//  directory.
+//
+func EmitEvent(event Event) {
+	if !*jsonFlag {
+		return
+	}
+	event.Time = time.Now()
+	if event.Directory == "" {
+		event.Directory, _ = os.Getwd()
+	}
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	json.NewEncoder(eventOutput).Encode(event)
+}
+
+//  Write an event marking the end of something that started at a
+//  given time and either succeeded or failed with an error.
+//
+func EmitFinishEvent(event Event, started time.Time, err error) {
+	event.Duration = time.Since(started).Seconds()
+	event.Status = "ok"
+	if err != nil {
+		event.Status = "failed"
+		event.Error = err.Error()
+	}
+	EmitEvent(event)
+}
+
+//  Return the absolute form of a directory name for an event.
+//
+func EventDirectory(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+//  Return where the output of the commands run by dmake goes,
+//  standard error when standard output is used for events.
+//
+func CommandOutput() io.Writer {
+	if *jsonFlag {
+		return os.Stderr
+	}
+	return os.Stdout
+}
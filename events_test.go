@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//  Capture the events written during a test, as if -json was given.
+//
+func captureEvents(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var b bytes.Buffer
+	savedFlag, savedOutput := *jsonFlag, eventOutput
+	t.Cleanup(func() { *jsonFlag, eventOutput = savedFlag, savedOutput })
+	*jsonFlag, eventOutput = true, &b
+	return &b
+}
+
+//  Decode an event stream.
+//
+func decodeEvents(t *testing.T, r io.Reader) []Event {
+	t.Helper()
+	var events []Event
+	decoder := json.NewDecoder(r)
+	for {
+		var event Event
+		err := decoder.Decode(&event)
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	dir := inTempProject(t, map[string]string{
+		dmakeFileFilename: "DIRS = lib\n",
+		"lib/lib.c":       "int f(void) { return 0; }\n",
+	})
+	dir, _ = filepath.EvalSymlinks(dir)
+	b := captureEvents(t)
+	if err := NewDmake("project", "", "").Run(Cleaning, os.Environ()); err != nil {
+		t.Fatal(err)
+	}
+	events := decodeEvents(t, b)
+	if len(events) != 2 {
+		t.Fatalf("%d events, expected 2: %+v", len(events), events)
+	}
+	lib := filepath.Join(dir, "lib")
+	enter, leave := events[0], events[1]
+	if enter.Event != DirectoryEnterEvent || enter.Directory != lib || enter.Action != Cleaning.String() || enter.Time.IsZero() {
+		t.Errorf("enter event %+v", enter)
+	}
+	if leave.Event != DirectoryLeaveEvent || leave.Directory != lib || leave.Status != "ok" || leave.Error != "" {
+		t.Errorf("leave event %+v", leave)
+	}
+
+	b.Reset()
+	dmake := NewDmake("project", "", "")
+	if err := dmake.ReadDmakefile(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dmake.ListAction(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	events = decodeEvents(t, b)
+	if len(events) != 1 {
+		t.Fatalf("%d events, expected 1: %+v", len(events), events)
+	}
+	target := events[0]
+	if target.Event != TargetEvent || target.Directory != lib || target.Target == nil {
+		t.Fatalf("target event %+v", target)
+	}
+	if description := target.Target; description.Type != "lib" || description.Output != "lib.a" || description.Language != "c" ||
+		len(description.Sources) != 1 || description.Sources[0].Path != "lib.c" || description.Sources[0].Options == nil {
+		t.Errorf("target %+v", description)
+	}
+}
@@ -0,0 +1,250 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dmake explain in cwd
+//
+// Reports whether each target in the receiver's directory, and its
+// sub-directories, is up to date and, if it's not, why it would be
+// rebuilt. Like dcc it compares modification times, an object is out
+// of date if it's older than its source file, the headers it included
+// when last compiled or the compiler options file for its language,
+// and an output if it's older than its objects, libraries or linker
+// options files. Libraries given by -l options are found in the -L
+// directories and those holding the outputs of the directories a
+// directory depends upon. Nothing is built.
+//
+func (dmake *Dmake) ExplainAction(w io.Writer) error {
+	libdirs := make(map[string][]string) // by directory, its dependencies' output directories
+	return dmake.Walk(".", func(dir string, d *Dmake) error {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		for path := range d.dependencies {
+			if libdirs[filepath.Join(cwd, path)], err = d.DependencyOutputDirectories(path); err != nil {
+				return AddDetail(err, "%s", filepath.Join(dir, path))
+			}
+		}
+		targets, err := d.PreparedTargets()
+		if err != nil {
+			return AddDetail(err, "%s", dir)
+		}
+		for _, target := range targets {
+			output := filepath.ToSlash(filepath.Join(dir, target.OutputPath()))
+			reasons, err := target.Explain(libdirs[cwd])
+			if err != nil {
+				return AddDetail(err, "%s", output)
+			}
+			if len(reasons) == 0 {
+				fmt.Fprintf(w, "%s is up to date\n", output)
+				continue
+			}
+			fmt.Fprintf(w, "%s is out of date\n", output)
+			for _, reason := range reasons {
+				fmt.Fprintf(w, "    %s\n", reason)
+			}
+		}
+		return nil
+	})
+}
+
+//  Return the directories holding the outputs of the sub-directories
+//  one of the receiver's sub-directories depends upon.
+//
+func (dmake *Dmake) DependencyOutputDirectories(path string) ([]string, error) {
+	var dirs []string
+	for _, dependency := range dmake.dependencies[path] {
+		savedCwd, err := ChangeDirectory(dependency)
+		if err != nil {
+			return nil, err
+		}
+		subdir := NewDmake(dependency, "", dmake.installprefix)
+		if dmake.builddir != "" {
+			subdir.builddir = filepath.Join(dmake.builddir, dependency)
+		}
+		var targets []*Dmake
+		if err = subdir.ReadDmakefile(); err == nil {
+			targets, err = subdir.PreparedTargets()
+		}
+		for _, target := range targets {
+			if dir, err := filepath.Abs(filepath.Dir(target.OutputPath())); err == nil && !Contains(dirs, dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+		savedCwd.Restore()
+		if err != nil {
+			return nil, AddDetail(err, "%s", dependency)
+		}
+	}
+	return dirs, nil
+}
+
+//  Return the reasons the receiver's output would be rebuilt, none if
+//  it's up to date. Libraries given by -l options are looked for in
+//  the -L directories and then libdirs. The receiver must have been
+//  prepared.
+//
+func (dmake *Dmake) Explain(libdirs []string) ([]string, error) {
+	target, err := dmake.ExportTarget()
+	if err != nil {
+		return nil, err
+	}
+	var reasons []string
+	var inputs []string
+	for _, source := range target.sources {
+		optionsFile := filepath.Join(dccOptionsDirectory, compilerOptionsFilename[source.language])
+		deps := append(ReadDepsFile(strings.TrimSuffix(source.object, filepath.Ext(source.object))+".d"),
+			ReadDependencies(dmake.DccDependenciesFilename(source.path, source.object))...)
+		if explained := ExplainFile(source.object, source.path, append(ExistingFiles(optionsFile), deps...)); len(explained) > 0 {
+			reasons = append(reasons, explained...)
+		} else {
+			inputs = append(inputs, source.object)
+		}
+	}
+	for _, lib := range target.libs {
+		if !strings.HasPrefix(lib, "-") {
+			inputs = append(inputs, lib)
+		}
+	}
+	inputs = append(inputs, FindLibraries(target, libdirs, dmake.Static())...)
+	inputs = append(inputs, ExistingFiles(filepath.Join(dccOptionsDirectory, "LDFLAGS"), filepath.Join(dccOptionsDirectory, "LIBS"))...)
+	if len(reasons) > 0 {
+		if _, err := os.Stat(target.output); err == nil {
+			reasons = append(reasons, fmt.Sprintf("%s: rebuilt as sources are recompiled", target.output))
+		}
+	}
+	reasons = append(reasons, ExplainFile(target.output, "", inputs)...)
+	return reasons, nil
+}
+
+//  Return the files of the libraries a target links using -l options
+//  found, as the linker would, in its -L directories and then the
+//  others given. In each directory a shared library is preferred
+//  unless linking statically. Those not found, e.g. the system's,
+//  aren't returned.
+//
+func FindLibraries(target *ExportTarget, others []string, static bool) []string {
+	var dirs []string
+	var candidates [][]string // the filenames each library may have
+	platform := target.platform.platform
+	options := append(target.ldflags[:len(target.ldflags):len(target.ldflags)], target.libs...)
+	for i := 0; i < len(options); i++ {
+		switch option := options[i]; {
+		case option == "-L" && i+1 < len(options):
+			i++
+			dirs = append(dirs, options[i])
+		case strings.HasPrefix(option, "-L"):
+			dirs = append(dirs, option[2:])
+		case strings.HasPrefix(option, "-l:"):
+			candidates = append(candidates, []string{option[3:]})
+		case strings.HasPrefix(option, "-l") && len(option) > 2:
+			if static {
+				candidates = append(candidates, []string{platform.LibFilename(option[2:])})
+			} else {
+				candidates = append(candidates, []string{platform.DllFilename(option[2:]), platform.LibFilename(option[2:])})
+			}
+		}
+	}
+	dirs = append(dirs, others...)
+	var files []string
+	for _, filenames := range candidates {
+		if path := findLibrary(dirs, filenames); path != "" {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+//  Return the first of the filenames found in the first directory
+//  holding any of them, or "" if none is found.
+//
+func findLibrary(dirs, filenames []string) string {
+	for _, dir := range dirs {
+		for _, filename := range filenames {
+			path := filepath.Join(dir, filename)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+//  Return the name of the file dcc lists a source file's dependencies
+//  in.
+//
+func (dmake *Dmake) DccDependenciesFilename(source, object string) string {
+	dir := dmake.DepsDir()
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(source), dir)
+	}
+	return filepath.Join(dir, filepath.Base(object))
+}
+
+//  Return the reasons a file built from a source file, and other
+//  inputs, is out of date. The reasons are for the source file, if
+//  given, otherwise for the file.
+//
+func ExplainFile(path, source string, inputs []string) []string {
+	subject := path
+	if source != "" {
+		subject = source
+		inputs = append([]string{source}, inputs...)
+	}
+	info, err := os.Stat(path)
+	if err != nil && source == "" {
+		return []string{fmt.Sprintf("%s doesn't exist", path)}
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %s doesn't exist", subject, path)}
+	}
+	var reasons []string
+	seen := make(map[string]bool)
+	for _, input := range inputs {
+		if seen[input] {
+			continue
+		}
+		seen[input] = true
+		inputInfo, err := os.Stat(input)
+		switch {
+		case err != nil:
+			reasons = append(reasons, fmt.Sprintf("%s: %s no longer exists", subject, input))
+		case inputInfo.ModTime().After(info.ModTime()):
+			if input == source {
+				reasons = append(reasons, fmt.Sprintf("%s: changed since %s was built", subject, path))
+			} else {
+				reasons = append(reasons, fmt.Sprintf("%s: %s is newer than %s", subject, input, path))
+			}
+		}
+	}
+	return reasons
+}
+
+//  Return the files listed in a dependency file, either make-style,
+//  as written by the compiler, or one per line.
+//
+func ReadDependencies(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	if strings.Contains(string(data), ": ") {
+		return ReadDepsFile(path)
+	}
+	return strings.Fields(string(data))
+}
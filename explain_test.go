@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplainFile(t *testing.T) {
+	dir := t.TempDir()
+	source, header, object := filepath.Join(dir, "f.c"), filepath.Join(dir, "f.h"), filepath.Join(dir, "f.o")
+	if reasons := ExplainFile(object, source, nil); len(reasons) != 1 || !strings.HasSuffix(reasons[0], "f.o doesn't exist") {
+		t.Errorf("missing object explained as %q", reasons)
+	}
+	then := time.Now().Add(-time.Hour)
+	for _, path := range []string{source, header, object} {
+		if err := os.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, then, then); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reasons := ExplainFile(object, source, []string{header}); len(reasons) != 0 {
+		t.Errorf("up to date object explained as %q", reasons)
+	}
+	os.Chtimes(header, time.Now(), time.Now())
+	missing := filepath.Join(dir, "gone.h")
+	reasons := ExplainFile(object, source, []string{header, missing, header})
+	expected := []string{
+		source + ": " + header + " is newer than " + object,
+		source + ": " + missing + " no longer exists",
+	}
+	if !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("out of date object explained as %q", reasons)
+	}
+
+	deps := filepath.Join(dir, "f.deps")
+	os.WriteFile(deps, []byte("f.c\nf.h\n"), 0666)
+	if files := ReadDependencies(deps); !reflect.DeepEqual(files, []string{"f.c", "f.h"}) {
+		t.Errorf("dependencies %q", files)
+	}
+	os.WriteFile(deps, []byte("f.o: f.c \\\n f.h\n"), 0666)
+	if files := ReadDependencies(deps); !reflect.DeepEqual(files, []string{"f.c", "f.h"}) {
+		t.Errorf("make-style dependencies %q", files)
+	}
+}
+
+func TestFindLibraries(t *testing.T) {
+	dir := t.TempDir()
+	vendor, deps := filepath.Join(dir, "vendor"), filepath.Join(dir, "deps")
+	platform := DefaultTarget().platform
+	writeFiles(t, dir, map[string]string{
+		"vendor/" + platform.LibFilename("z"):      "",
+		"deps/" + platform.DllFilename("util"):     "",
+		"deps/" + platform.LibFilename("util"):     "",
+		"deps/" + platform.LibFilename("vendor"):   "",
+		"vendor/" + platform.LibFilename("vendor"): "",
+	})
+	target := &ExportTarget{platform: DefaultTarget(), ldflags: []string{"-L" + vendor}, libs: []string{"-lz", "-lutil", "-lvendor", "-lm"}}
+	expected := []string{
+		filepath.Join(vendor, platform.LibFilename("z")),
+		filepath.Join(deps, platform.DllFilename("util")),
+		filepath.Join(vendor, platform.LibFilename("vendor")),
+	}
+	if files := FindLibraries(target, []string{deps}, false); !reflect.DeepEqual(files, expected) {
+		t.Errorf("libraries %q, expected %q", files, expected)
+	}
+	expected[1] = filepath.Join(deps, platform.LibFilename("util"))
+	if files := FindLibraries(target, []string{deps}, true); !reflect.DeepEqual(files, expected) {
+		t.Errorf("static libraries %q, expected %q", files, expected)
+	}
+}
+
+func TestExplainLibraries(t *testing.T) {
+	dir := inTempProject(t, map[string]string{
+		dmakeFileFilename:           "DIRS = util app\nDEPENDS(app) = util\n",
+		"util/" + dmakeFileFilename: "LIB = util\n",
+		"util/util.c":               "int util(void) { return 0; }\n",
+		"app/" + dmakeFileFilename:  "EXE = prog\nLIBS = -lutil\n",
+		"app/main.c":                "int main(void) { return 0; }\n",
+	})
+	dmake := NewDmake(dir, "", "")
+	if err := dmake.ReadDmakefile(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the objects and outputs, as if built when the sources
+	// last changed.
+	//
+	then := time.Now().Add(-time.Hour)
+	outputs := make(map[string]string)
+	err := dmake.Walk(".", func(subdir string, d *Dmake) error {
+		targets, err := d.PreparedTargets()
+		if err != nil {
+			return err
+		}
+		for _, target := range targets {
+			export, err := target.ExportTarget()
+			if err != nil {
+				return err
+			}
+			files := []string{target.OutputPath()}
+			for _, source := range export.sources {
+				files = append(files, source.path, source.object)
+			}
+			for _, path := range files {
+				os.MkdirAll(filepath.Dir(path), 0777)
+				if _, err := os.Stat(path); err != nil {
+					os.WriteFile(path, nil, 0666)
+				}
+				os.Chtimes(path, then, then)
+			}
+			outputs[subdir] = filepath.Join(dir, subdir, target.OutputPath())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	explain := func() string {
+		var b strings.Builder
+		if err := dmake.ExplainAction(&b); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+	if report := explain(); strings.Contains(report, "out of date") {
+		t.Errorf("explained as out of date:\n%s", report)
+	}
+
+	os.Chtimes(outputs["util"], time.Now(), time.Now())
+	report := explain()
+	if !strings.Contains(report, outputs["util"]+" is newer than") {
+		t.Errorf("rebuilding the library doesn't relink the program:\n%s", report)
+	}
+}
@@ -0,0 +1,182 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+//  The build file formats supported by dmake export.
+//
+var exportFormats = []string{"cmake", "make", "ninja"}
+
+//  An ExportTarget describes how to build one of dmake's targets
+//  in terms other build tools can use, the individual compile and
+//  link steps dcc would perform.
+//
+type ExportTarget struct {
+	name            string                // name of the thing being built
+	outputtype      OutputType            // type of thing being built
+	output          string                // output filename
+	sources         []ExportSource        // source files to be compiled
+	languageOptions map[Language][]string // compiler options for each language
+	ldflags         []string              // linker options
+	libs            []string              // libraries
+	linker          Language              // language whose compiler links the output
+	platform        *Target               // the target it's built for
+}
+
+//  An ExportSource is a source file to be compiled.
+//
+type ExportSource struct {
+	path        string   // source filename
+	object      string   // object filename
+	language    Language // language of the source file
+	options     []string // all compiler options used for the file
+	fileOptions []string // options specific to this file
+}
+
+//  The tools used by exported builds, as defined by the environment
+//  or their defaults.
+//
+type ExportTools struct {
+	cc  string
+	cxx string
+	ar  string
+}
+
+//  Return an ExportTarget describing how to build the receiver. The
+//  receiver must have been prepared.
+//
+func (dmake *Dmake) ExportTarget() (*ExportTarget, error) {
+	target := &ExportTarget{
+		name:            dmake.Name(),
+		outputtype:      dmake.outputtype,
+		output:          dmake.OutputPath(),
+		languageOptions: make(map[Language][]string),
+		linker:          dmake.LinkerLanguage(),
+		platform:        dmake.Target(),
+	}
+
+	readOptions := func(name string) ([]string, error) {
+		options, err := ReadOptionsFile(filepath.Join(dccOptionsDirectory, name))
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return options, err
+	}
+
+	var err error
+	if target.ldflags, err = readOptions("LDFLAGS"); err != nil {
+		return nil, err
+	}
+	target.ldflags = append(target.ldflags, dmake.ToolchainDescription().SysrootOptions()...)
+	target.ldflags = append(target.ldflags, dmake.ToolchainDescription().LinkerOptions()...)
+	target.ldflags = append(target.ldflags, dmake.LinkerOptions()...)
+	target.ldflags = append(target.ldflags, dmake.Target().LinkTypeOptions(dmake.outputtype)...)
+	target.ldflags = append(target.ldflags, dmake.SanitizerOptions()...)
+	target.ldflags = append(target.ldflags, dmake.StaticOptions()...)
+	if target.libs, err = readOptions("LIBS"); err != nil {
+		return nil, err
+	}
+	target.libs = append(target.libs, dmake.Libraries()...)
+	target.libs = append(target.libs, dmake.configLibs...)
+	target.libs = append(target.libs, dmake.packageLibs...)
+	target.libs = append(target.libs, dmake.ToolchainDescription().Libraries()...)
+	target.libs = dmake.StaticLibraries(target.ldflags, target.libs)
+
+	for _, path := range dmake.sourceFiles {
+		language := dmake.LanguageOf([]string{path})
+		options, found := target.languageOptions[language]
+		if !found {
+			if options, err = readOptions(compilerOptionsFilename[language]); err != nil {
+				return nil, err
+			}
+			options = append(options, dmake.LanguageOptions(language)...)
+			options = append(options, dmake.ToolchainDescription().LanguageOptions(language)...)
+			options = append(options, dmake.modeOptions...)
+			options = append(options, dmake.visibilityOptions...)
+			options = append(options, dmake.SanitizerOptions()...)
+			options = append(options, dmake.packageOptions...)
+			options = append(options, dccArgsFlag...)
+			options = append(options, dmake.Target().CompileTypeOptions(dmake.outputtype)...)
+			target.languageOptions[language] = options
+		}
+		fileOptions := dmake.fileFlags[path]
+		target.sources = append(target.sources, ExportSource{
+			path:        path,
+			object:      dmake.Target().ObjectFilename(path, dmake.ObjsDir()),
+			language:    language,
+			options:     append(options[:len(options):len(options)], fileOptions...),
+			fileOptions: fileOptions,
+		})
+	}
+
+	return target, nil
+}
+
+// dmake export <format> in cwd
+//
+// Writes a build file for another build tool describing how to build
+// the receiver's targets. Sub-directories are exported separately and
+// built by invoking the tool in each directory.
+//
+func (dmake *Dmake) ExportAction(env []string) error {
+	candidates := dmake.targets
+	if len(candidates) == 0 {
+		candidates = []*Dmake{dmake}
+	}
+	var targets []*ExportTarget
+	for _, candidate := range candidates {
+		ok, err := candidate.Prepare()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if candidate.IsBundle() {
+			return fmt.Errorf("%s: %s outputs can't be exported", candidate.Name(), candidate.outputtype)
+		}
+		target, err := candidate.ExportTarget()
+		if err != nil {
+			return err
+		}
+		targets = append(targets, target)
+	}
+
+	env = dmake.TargetEnvironment(env)
+	ccName, ccDefault := dmake.Toolchain().CompilerVariable(CLanguage)
+	cxxName, cxxDefault := dmake.Toolchain().CompilerVariable(CplusplusLanguage)
+	tools := ExportTools{
+		cc:  exportTool(env, ccName, ccDefault),
+		cxx: exportTool(env, cxxName, cxxDefault),
+		ar:  exportTool(env, "AR", "ar"),
+	}
+
+	switch exportFormat {
+	case "cmake":
+		return WriteCMakeLists(cmakeListsFilename, dmake.defaultoutput, targets, dmake.directories)
+	case "make":
+		return WriteMakefile(exportMakefileFilename, targets, dmake.directories, tools)
+	case "ninja":
+		return WriteNinjaFile(ninjaFilename, targets, dmake.directories, tools)
+	default:
+		return fmt.Errorf("%q: unsupported export format", exportFormat)
+	}
+}
+
+func exportTool(env []string, name, defaultValue string) string {
+	if value, found := LookupEnv(env, name); found && value != "" {
+		return value
+	}
+	return defaultValue
+}
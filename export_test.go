@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//  Export a project, a program using a library built in a
+//  sub-directory, in some format and return the contents of the
+//  files written, named relative to the project, with the object
+//  directory replaced by $OBJS.
+//
+func exportProject(t *testing.T, format string, filenames ...string) map[string]string {
+	t.Helper()
+	inTempProject(t, map[string]string{
+		dmakeFileFilename: "DIRS = lib\nCFLAGS = -Wall -Iinclude\nLIBS = -Llib -llib -lm\n",
+		"main.c":          "int main() { return 0; }\n",
+		"lib/lib.c":       "int f(void) { return 0; }\n",
+	})
+	saved := exportFormat
+	defer func() { exportFormat = saved }()
+	exportFormat = format
+	if err := NewDmake("app", "", "").Run(Exporting, nil); err != nil {
+		t.Fatal(err)
+	}
+	objsdir := filepath.ToSlash((&Dmake{}).ObjsDir())
+	files := make(map[string]string)
+	for _, filename := range filenames {
+		for _, path := range []string{filename, filepath.Join("lib", filename)} {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[filepath.ToSlash(path)] = strings.ReplaceAll(string(data), objsdir, "$OBJS")
+		}
+	}
+	return files
+}
+
+//  Compare exported files with their expected contents.
+//
+func checkExported(t *testing.T, files map[string]string, expected map[string]string) {
+	t.Helper()
+	for path, contents := range expected {
+		if files[path] != contents {
+			t.Errorf("%s is\n%s\nexpected\n%s", path, files[path], contents)
+		}
+	}
+}
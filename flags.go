@@ -0,0 +1,134 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//  dmake flags prints the command used to compile each of the source
+//  files it's given, the compiler, its language's options, from the
+//  .dcc options file, the .dmake file and the mode, and the file's own
+//  options, for tools that want to compile a single file, such as
+//  language servers, when a compile_commands.json is overkill. The
+//  command is run in the directory of the target compiling the file,
+//  e.g.
+//
+//	cd lib && cc -std=c11 -Wall -O2 -c util.c -o .objs/linux-amd64/util.o
+//
+//  With -json a flags event describes each file.
+//
+type CompileFlags struct {
+	File      string   `json:"file"`      // absolute
+	Directory string   `json:"directory"` // absolute, where the command is run
+	Language  string   `json:"language"`
+	Options   []string `json:"options"`
+	Command   []string `json:"command"`
+}
+
+//  The source files whose flags are printed by "dmake flags".
+//
+var flagsFiles []string
+
+// dmake flags in cwd
+//
+// Finds the target compiling each file in the receiver's directory
+// and its sub-directories.
+//
+func (dmake *Dmake) FlagsAction(w io.Writer, env []string) error {
+	found := make(map[string]*CompileFlags)
+	var paths []string
+	for _, file := range flagsFiles {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+	}
+	err := dmake.Walk(".", func(dir string, d *Dmake) error {
+		targets, err := d.PreparedTargets()
+		if err != nil {
+			return AddDetail(err, "%s", dir)
+		}
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		for _, target := range targets {
+			export, err := target.ExportTarget()
+			if err != nil {
+				return AddDetail(err, "%s", dir)
+			}
+			for _, source := range export.sources {
+				path := filepath.Join(wd, source.path)
+				if Contains(paths, path) && found[path] == nil {
+					found[path] = target.SourceFlags(d.TargetEnvironment(env), source)
+					found[path].File = path
+					found[path].Directory = wd
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	for i, path := range paths {
+		flags := found[path]
+		if flags == nil {
+			return fmt.Errorf("%s: not compiled by any target", flagsFiles[i])
+		}
+		if *jsonFlag {
+			EmitEvent(Event{Event: FlagsEvent, Directory: flags.Directory, Flags: flags})
+			continue
+		}
+		command := ShellJoin(flags.Command)
+		if flags.Directory != cwd {
+			dir, err := filepath.Rel(cwd, flags.Directory)
+			if err != nil || strings.HasPrefix(dir, "..") {
+				dir = flags.Directory
+			}
+			command = "cd " + ShellJoin([]string{dir}) + " && " + command
+		}
+		fmt.Fprintln(w, command)
+	}
+	return nil
+}
+
+//  Return the flags used to compile one of the receiver's source
+//  files, the command is run in the receiver's directory.
+//
+func (dmake *Dmake) SourceFlags(env []string, source ExportSource) *CompileFlags {
+	flags := &CompileFlags{Language: source.language.String(), Options: source.options}
+	if flags.Options == nil {
+		flags.Options = []string{}
+	}
+	name, defaultValue := dmake.Toolchain().CompilerVariable(source.language)
+	compiler := ShellWords(exportTool(env, name, defaultValue))
+	options := append(source.options[:len(source.options):len(source.options)], dmake.ReproducibleOptions()...)
+	if dmake.Toolchain().msvc {
+		crt, err := dmake.MsvcRuntime()
+		if err != nil {
+			logger.Warnf("%v", err)
+		}
+		flags.Command = append(compiler, MsvcCompileArgs(options, crt, source.language, source.path, source.object)...)
+		return flags
+	}
+	flags.Command = append(compiler, options...)
+	flags.Command = append(flags.Command, "-c", source.path, "-o", source.object)
+	return flags
+}
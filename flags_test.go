@@ -0,0 +1,18 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSourceFlags(t *testing.T) {
+	source := ExportSource{path: "f.c", object: ".objs/f.o", language: CLanguage, options: []string{"-O2", "-DX=1"}}
+	flags := (&Dmake{}).SourceFlags([]string{"CC=ccache gcc"}, source)
+	expected := []string{"ccache", "gcc", "-O2", "-DX=1", "-c", "f.c", "-o", ".objs/f.o"}
+	if !reflect.DeepEqual(flags.Command, expected) || flags.Language != "c" {
+		t.Errorf("command %q, language %s", flags.Command, flags.Language)
+	}
+	if flags := (&Dmake{}).SourceFlags(nil, ExportSource{path: "f.c", language: CLanguage}); flags.Options == nil {
+		t.Errorf("no options as null")
+	}
+}
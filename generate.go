@@ -0,0 +1,253 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//  Some source files are generated by other tools, parsers by yacc,
+//  lexical analysers by lex and protocol buffer code by protoc.
+//  Generated files are written to their own directory and compiled
+//  along with the other sources.
+//
+const (
+	defaultGenDir = ".gen"
+	defaultLex    = "flex"
+	defaultYacc   = "bison"
+	defaultProtoc = "protoc"
+)
+
+//  A GeneratedSource describes the files generated from an input
+//  file and the command used to generate them.
+//
+type GeneratedSource struct {
+	input   string                      // the file the outputs are generated from
+	outputs []string                    // the generated files, sources and headers
+	command func(env []string) []string // returns the generating command
+}
+
+//  Return the generated files that are compiled.
+//
+func (g *GeneratedSource) Sources() []string {
+	var sources []string
+	for _, path := range g.outputs {
+		if LanguageOf([]string{path}) != UnknownLanguage {
+			sources = append(sources, path)
+		}
+	}
+	return sources
+}
+
+//  Return the name of the directory used for generated files.
+//
+func (dmake *Dmake) GenDir() string {
+	return dmake.BuildPath(defaultGenDir)
+}
+
+//  Return the yacc and lex grammars in the current directory.
+//
+func (dmake *Dmake) GrammarFiles() ([]string, error) {
+	var grammars []string
+	for _, pattern := range []string{"*.y", "*.yy", "*.l", "*.ll"} {
+		paths, _, err := dmake.Target().Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		grammars = append(grammars, paths...)
+	}
+	return grammars, nil
+}
+
+//  Replace any source files that are inputs to a code generator with
+//  the files generated from them, and add the files generated from
+//  any other inputs. The generated files are recorded so they can be
+//  created before building and removed when cleaning.
+//
+func (dmake *Dmake) AddGeneratedSources(inputs ...string) {
+	var sourceFiles []string
+	paths := append(dmake.sourceFiles[:len(dmake.sourceFiles):len(dmake.sourceFiles)], inputs...)
+	for _, path := range paths {
+		if dmake.isGeneratorInput(path) {
+			continue
+		}
+		g := dmake.generatorFor(path)
+		if g == nil {
+			sourceFiles = append(sourceFiles, path)
+			continue
+		}
+		dmake.generated = append(dmake.generated, g)
+		sourceFiles = append(sourceFiles, g.Sources()...)
+	}
+	dmake.sourceFiles = sourceFiles
+}
+
+func (dmake *Dmake) isGeneratorInput(path string) bool {
+	for _, g := range dmake.generated {
+		if g.input == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (dmake *Dmake) generatorFor(path string) *GeneratedSource {
+	ext := filepath.Ext(path)
+	base := filepath.Join(dmake.GenDir(), strings.TrimSuffix(filepath.Base(path), ext))
+	suffix := ".c"
+	if ext == ".yy" || ext == ".ll" {
+		suffix = ".cc"
+	}
+	switch ext {
+	case ".y", ".yy":
+		source := base + ".tab" + suffix
+		header := base + ".tab.h"
+		return &GeneratedSource{
+			input:   path,
+			outputs: []string{source, header},
+			command: func(env []string) []string {
+				args := dmake.generatorCommand(env, "YACC", defaultYacc, "YFLAGS")
+				return append(args, "-d", "-o", source, path)
+			},
+		}
+	case ".l", ".ll":
+		source := base + ".yy" + suffix
+		return &GeneratedSource{
+			input:   path,
+			outputs: []string{source},
+			command: func(env []string) []string {
+				args := dmake.generatorCommand(env, "LEX", defaultLex, "LFLAGS")
+				return append(args, "-o", source, path)
+			},
+		}
+	case ".proto":
+		outputs := []string{base + ".pb.cc", base + ".pb.h"}
+		plugins := ProtocPlugins(dmake.vars.GetString("PROTOC_PLUGINS"))
+		for _, plugin := range plugins {
+			outputs = append(outputs, base+"."+plugin.name+".pb.cc", base+"."+plugin.name+".pb.h")
+		}
+		return &GeneratedSource{
+			input:   path,
+			outputs: outputs,
+			command: func(env []string) []string {
+				gendir := dmake.GenDir()
+				args := dmake.generatorCommand(env, "PROTOC", defaultProtoc, "PROTOCFLAGS")
+				args = append(args, "--proto_path="+filepath.Dir(path), "--cpp_out="+gendir)
+				for _, plugin := range plugins {
+					if plugin.path != "" {
+						args = append(args, "--plugin=protoc-gen-"+plugin.name+"="+plugin.path)
+					}
+					args = append(args, "--"+plugin.name+"_out="+gendir)
+				}
+				return append(args, path)
+			},
+		}
+	}
+	if len(dmake.qtModules) > 0 {
+		return dmake.qtGeneratorFor(path)
+	}
+	return nil
+}
+
+//  A protoc plugin generating code in addition to protoc's own.
+//
+type ProtocPlugin struct {
+	name string // the plugin's name, e.g. grpc
+	path string // the plugin program, if not protoc-gen-<name> on $PATH
+}
+
+//  Return the protoc plugins defined by the PROTOC_PLUGINS variable,
+//  a list of names each optionally followed by "=" and the plugin's
+//  path, e.g. "grpc=/usr/local/bin/grpc_cpp_plugin". A plugin named
+//  "grpc" generates foo.grpc.pb.cc and foo.grpc.pb.h from foo.proto.
+//
+func ProtocPlugins(s string) []ProtocPlugin {
+	var plugins []ProtocPlugin
+	for _, field := range strings.Fields(s) {
+		plugin := ProtocPlugin{name: field}
+		if eq := strings.Index(field, "="); eq != -1 {
+			plugin.name, plugin.path = field[:eq], field[eq+1:]
+		}
+		plugins = append(plugins, plugin)
+	}
+	return plugins
+}
+
+//  Return a code generator's command, defined by an environment
+//  variable, and any options for it defined by the .dmake file.
+//
+func (dmake *Dmake) generatorCommand(env []string, name, defaultCommand, flagsVar string) []string {
+	command := []string{defaultCommand}
+	if value, found := LookupEnv(env, name); found && value != "" {
+		command = strings.Fields(value)
+	}
+	return append(command, strings.Fields(dmake.vars.GetString(flagsVar))...)
+}
+
+//  Return the input file a source file was generated from or, if it
+//  isn't generated, the source file itself.
+//
+func (dmake *Dmake) OriginalSource(path string) string {
+	for _, g := range dmake.generated {
+		if Contains(g.outputs, path) {
+			return g.input
+		}
+	}
+	return path
+}
+
+//  Return the compiler options needed by generated sources, they
+//  include headers from the generated files directory and from the
+//  directories of their inputs.
+//
+func (dmake *Dmake) GeneratedOptions() []string {
+	if len(dmake.generated) == 0 {
+		return nil
+	}
+	options := []string{"-I" + dmake.GenDir()}
+	for _, g := range dmake.generated {
+		if option := "-I" + filepath.Dir(g.input); !Contains(options, option) {
+			options = append(options, option)
+		}
+	}
+	return options
+}
+
+//  Run the code generators whose outputs are out of date.
+//
+func (dmake *Dmake) GenerateSources(env []string) error {
+	for _, g := range dmake.generated {
+		upToDate := true
+		for _, path := range g.outputs {
+			upToDate = upToDate && IsUpToDate(path, []string{g.input})
+		}
+		if upToDate {
+			continue
+		}
+		command := g.command(env)
+		if DryRun(command[0], command[1:]...) {
+			continue
+		}
+		if err := os.MkdirAll(dmake.GenDir(), 0777); err != nil {
+			return err
+		}
+		logger.Verbosef("generating %s", strings.Join(g.outputs, " "))
+		logger.Debugf("RUN: %s %v", command[0], command[1:])
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Env = env
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, CommandOutput(), os.Stderr
+		if err := RunCommand(cmd, g.outputs...); err != nil {
+			return AddDetail(err, "%s", strings.Join(command, " "))
+		}
+	}
+	return nil
+}
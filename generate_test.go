@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//  A fake code generator that logs its arguments and creates the file
+//  named by -o along with a header of the same name.
+//
+const fakeGeneratorScript = `echo "$@" >> generate.log
+while [ $# -gt 0 ]; do
+  if [ "$1" = -o ]; then shift; : > "$1"; : > "${1%.*}.h"; fi
+  shift
+done
+`
+
+func TestGrammars(t *testing.T) {
+	inTempProject(t, map[string]string{
+		"main.c":    "",
+		"parse.y":   "",
+		"scan.l":    "",
+		"expr.yy":   "",
+		"tokens.ll": "",
+	})
+	dmake := &Dmake{vars: make(Vars), sourceFiles: []string{"main.c"}}
+	dmake.vars.SetValue("YFLAGS", "-Wall")
+	grammars, err := dmake.GrammarFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(grammars, []string{"parse.y", "expr.yy", "scan.l", "tokens.ll"}) {
+		t.Fatalf("grammars %q", grammars)
+	}
+	dmake.AddGeneratedSources(grammars...)
+	gen := dmake.GenDir()
+	expected := []string{
+		"main.c",
+		filepath.Join(gen, "parse.tab.c"),
+		filepath.Join(gen, "expr.tab.cc"),
+		filepath.Join(gen, "scan.yy.c"),
+		filepath.Join(gen, "tokens.yy.cc"),
+	}
+	if !reflect.DeepEqual(dmake.sourceFiles, expected) {
+		t.Errorf("sources %q, expected %q", dmake.sourceFiles, expected)
+	}
+	if source := dmake.OriginalSource(filepath.Join(gen, "parse.tab.c")); source != "parse.y" {
+		t.Errorf("parse.tab.c generated from %q", source)
+	}
+	if options := dmake.GeneratedOptions(); !reflect.DeepEqual(options, []string{"-I" + gen, "-I."}) {
+		t.Errorf("generated sources' options %q", options)
+	}
+
+	// Adding the same inputs again, as preparing again does, changes
+	// nothing.
+	dmake.AddGeneratedSources(grammars...)
+	if !reflect.DeepEqual(dmake.sourceFiles, expected) || len(dmake.generated) != 4 {
+		t.Errorf("sources %q after adding again", dmake.sourceFiles)
+	}
+
+	yacc := fakeTool(t, "yacc", fakeGeneratorScript)
+	lex := fakeTool(t, "lex", fakeGeneratorScript)
+	env := []string{"YACC=" + yacc, "LEX=" + lex + " -8", "PATH=" + os.Getenv("PATH")}
+	if err := dmake.GenerateSources(env); err != nil {
+		t.Fatal(err)
+	}
+	log, _ := os.ReadFile("generate.log")
+	lines := strings.Split(strings.TrimSpace(string(log)), "\n")
+	if len(lines) != 4 ||
+		lines[0] != "-Wall -d -o "+filepath.Join(gen, "parse.tab.c")+" parse.y" ||
+		lines[2] != "-8 -o "+filepath.Join(gen, "scan.yy.c")+" scan.l" {
+		t.Fatalf("generators run as\n%s", log)
+	}
+
+	// Only those generated files older than their inputs are
+	// generated again.
+	if err := dmake.GenerateSources(env); err != nil {
+		t.Fatal(err)
+	}
+	if log2, _ := os.ReadFile("generate.log"); string(log2) != string(log) {
+		t.Errorf("up to date sources generated again\n%s", log2)
+	}
+	os.Remove(filepath.Join(gen, "scan.yy.c"))
+	if err := dmake.GenerateSources(env); err != nil {
+		t.Fatal(err)
+	}
+	log, _ = os.ReadFile("generate.log")
+	if lines = strings.Split(strings.TrimSpace(string(log)), "\n"); len(lines) != 5 || !strings.HasSuffix(lines[4], " scan.l") {
+		t.Errorf("generators run as\n%s", log)
+	}
+}
+
+func TestProtocPlugins(t *testing.T) {
+	plugins := ProtocPlugins(" grpc=/opt/bin/grpc_cpp_plugin  mock ")
+	if !reflect.DeepEqual(plugins, []ProtocPlugin{{"grpc", "/opt/bin/grpc_cpp_plugin"}, {"mock", ""}}) {
+		t.Errorf("plugins %+v", plugins)
+	}
+}
+
+func TestProtos(t *testing.T) {
+	inTempProject(t, map[string]string{"main.cc": "", "proto/msg.proto": ""})
+	input := filepath.Join("proto", "msg.proto")
+	dmake := &Dmake{vars: make(Vars), sourceFiles: []string{"main.cc"}, protoFiles: []string{input}}
+	dmake.vars.SetValue("PROTOC_PLUGINS", "grpc=/opt/bin/grpc_cpp_plugin")
+	dmake.vars.SetValue("PROTOCFLAGS", "-Iproto/include")
+	dmake.AddGeneratedSources(dmake.protoFiles...)
+	gen := dmake.GenDir()
+	if expected := []string{"main.cc", filepath.Join(gen, "msg.pb.cc"), filepath.Join(gen, "msg.grpc.pb.cc")}; !reflect.DeepEqual(dmake.sourceFiles, expected) {
+		t.Errorf("sources %q, expected %q", dmake.sourceFiles, expected)
+	}
+	if options := dmake.GeneratedOptions(); !reflect.DeepEqual(options, []string{"-I" + gen, "-Iproto"}) {
+		t.Errorf("generated sources' options %q", options)
+	}
+
+	// The fake protoc logs its arguments and creates the files for
+	// each --*_out option.
+	protoc := fakeTool(t, "protoc", `echo "$@" >> generate.log
+for arg; do
+  case "$arg" in
+  --cpp_out=*) : > "${arg#*=}/msg.pb.cc"; : > "${arg#*=}/msg.pb.h" ;;
+  --grpc_out=*) : > "${arg#*=}/msg.grpc.pb.cc"; : > "${arg#*=}/msg.grpc.pb.h" ;;
+  esac
+done
+`)
+	env := []string{"PROTOC=" + protoc, "PATH=" + os.Getenv("PATH")}
+	for i := 0; i < 2; i++ {
+		if err := dmake.GenerateSources(env); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log, _ := os.ReadFile("generate.log")
+	expected := "-Iproto/include --proto_path=proto --cpp_out=" + gen +
+		" --plugin=protoc-gen-grpc=/opt/bin/grpc_cpp_plugin --grpc_out=" + gen + " " + input + "\n"
+	if string(log) != expected {
+		t.Errorf("protoc run as\n%s\nexpected, once,\n%s", log, expected)
+	}
+}
@@ -0,0 +1,75 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+//  When embedding version information, -embed-version or the .dmake
+//  GIT_VERSION variable, programs are compiled with DMAKE_VERSION and
+//  DMAKE_BUILD_DATE defined as string literals. The version is that
+//  reported by "git describe", or VERSION outside of a git repository.
+//
+const unknownVersion = "unknown"
+
+//  Return true if version information is to be embedded.
+//
+func (dmake *Dmake) EmbeddingVersion() bool {
+	_, found := dmake.vars.Get("GIT_VERSION")
+	return found || *embedVersionFlag
+}
+
+//  Return the compiler options defining the version information.
+//
+func (dmake *Dmake) VersionOptions() []string {
+	version := GitVersion()
+	if version == "" {
+		if value, found := dmake.vars.GetValue("VERSION"); found {
+			version = value
+		} else {
+			version = unknownVersion
+		}
+	}
+	date := BuildTime().UTC().Format("2006-01-02")
+	return []string{
+		"-DDMAKE_VERSION=" + CString(version),
+		"-DDMAKE_BUILD_DATE=" + CString(date),
+	}
+}
+
+//  Return the description of the current commit given by "git
+//  describe", or an empty string if that fails, e.g. git isn't
+//  installed or this isn't a git repository.
+//
+func GitVersion() string {
+	output, err := exec.Command("git", "describe", "--tags", "--always", "--dirty").Output()
+	if err != nil {
+		logger.Debugf("git describe: %s", err)
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+//  Return a string as a C string literal.
+//
+func CString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, ch := range s {
+		switch ch {
+		case '"', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(ch)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,74 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+//  Write a Graphviz DOT description of the receiver's directory and
+//  its sub-directories. Directories are shown as folders connected
+//  to the targets they build and to their sub-directories, dashed,
+//  and to the directories they depend upon.
+//
+func (dmake *Dmake) GraphAction(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintln(&b, "digraph dmake {")
+	fmt.Fprintln(&b, "\tnode [shape=box];")
+	err := dmake.Walk(".", func(dir string, d *Dmake) error {
+		return d.graph(&b, dir)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(&b, "}")
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+//  Add the nodes and edges for a directory, named by its path
+//  relative to the top of the graph, to the graph.
+//
+func (dmake *Dmake) graph(b *strings.Builder, dir string) error {
+	node := dotQuote("dir:" + dir)
+	label := dir
+	if dir == "." {
+		label = dmake.defaultoutput
+	}
+	fmt.Fprintf(b, "\t%s [label=%s, shape=folder];\n", node, dotQuote(label))
+
+	targets, err := dmake.PreparedTargets()
+	if err != nil {
+		return AddDetail(err, "%s", dir)
+	}
+	for _, target := range targets {
+		output := filepath.Base(target.outputname)
+		id := dotQuote("target:" + filepath.Join(dir, output))
+		fmt.Fprintf(b, "\t%s [label=%s];\n", id, dotQuote(fmt.Sprintf("%s (%s)", output, target.outputtype)))
+		fmt.Fprintf(b, "\t%s -> %s;\n", node, id)
+	}
+
+	for _, path := range dmake.directories {
+		subdir := filepath.Join(dir, path)
+		fmt.Fprintf(b, "\t%s -> %s [style=dashed];\n", node, dotQuote("dir:"+subdir))
+		for _, dependency := range dmake.dependencies[path] {
+			fmt.Fprintf(b, "\t%s -> %s [label=\"depends\"];\n", dotQuote("dir:"+subdir), dotQuote("dir:"+filepath.Join(dir, dependency)))
+		}
+	}
+	return nil
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	return "\"" + s + "\""
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	inTempProject(t, map[string]string{
+		dmakeFileFilename: "DIRS = lib app\nDEPENDS(app) = lib\n",
+		"lib/lib.c":       "int f(void) { return 0; }\n",
+		"app/main.c":      "int main() { return 0; }\n",
+	})
+	dmake := NewDmake("project", "", "")
+	if err := dmake.ReadDmakefile(); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := dmake.GraphAction(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := `digraph dmake {
+	node [shape=box];
+	"dir:." [label="project", shape=folder];
+	"dir:." -> "dir:lib" [style=dashed];
+	"dir:." -> "dir:app" [style=dashed];
+	"dir:app" -> "dir:lib" [label="depends"];
+	"dir:lib" [label="lib", shape=folder];
+	"target:lib/lib.a" [label="lib.a (lib)"];
+	"dir:lib" -> "target:lib/lib.a";
+	"dir:app" [label="app", shape=folder];
+	"target:app/app" [label="app (exe)"];
+	"dir:app" -> "target:app/app";
+}
+`
+	if s := b.String(); s != expected {
+		t.Errorf("graph is\n%s\nexpected\n%s", s, expected)
+	}
+}
+
+func TestDotQuote(t *testing.T) {
+	if s := dotQuote(`dir:a "b"\c`); s != `"dir:a \"b\"\\c"` {
+		t.Errorf("quoted as %s", s)
+	}
+}
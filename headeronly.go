@@ -0,0 +1,217 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//  A header-only library, defined by the .dmake HEADERS_ONLY variable
+//  or its synonym INTERFACE, has no sources to compile and nothing to
+//  link. Installing it installs its HEADERS, as for any library, and a
+//  pkg-config file describing them. Building it does nothing unless
+//  COMPILE_HEADERS is defined, when each header is compiled by itself,
+//  with the library's options, to check it's self-contained. Its TESTS
+//  are built and run as usual.
+//
+//  The headers are C++ if any has a C++ extension, .hpp, .hh, .hxx or
+//  .h++, and C otherwise, unless LANG or -lang say otherwise.
+//
+const headersCheckedSuffix = ".headers"
+
+var cplusplusHeaderExtensions = []string{".hpp", ".hh", ".hxx", ".h++"}
+
+//  The compiler's -x argument for each language.
+//
+var compilerLanguageArgument = map[Language]string{
+	CLanguage:            "c",
+	CplusplusLanguage:    "c++",
+	ObjcLanguage:         "objective-c",
+	ObjcplusplusLanguage: "objective-c++",
+}
+
+//  Return the language of the receiver's header files.
+//
+func (dmake *Dmake) HeaderLanguage() Language {
+	if language := dmake.ForcedLanguage(); language != UnknownLanguage {
+		return language
+	}
+	for _, path := range dmake.headerFiles {
+		if Contains(cplusplusHeaderExtensions, strings.ToLower(filepath.Ext(path))) {
+			return CplusplusLanguage
+		}
+	}
+	return CLanguage
+}
+
+//  Determine a header-only library's options.
+//
+func (dmake *Dmake) PrepareHeaderOnly() error {
+	if len(dmake.headerFiles) < 1 {
+		return fmt.Errorf("%s: a header-only library requires HEADERS", dmake.outputname)
+	}
+	var err error
+	if dmake.modeOptions, err = dmake.ModeOptions(dmake.HeaderLanguage()); err != nil {
+		return err
+	}
+	if len(dmake.packages) > 0 && dmake.packageOptions == nil && dmake.packageLibs == nil {
+		dmake.packageOptions, dmake.packageLibs, err = PackageOptions(dmake.packages, dmake.Static())
+	}
+	return err
+}
+
+//  Perform some action for a header-only library.
+//
+func (dmake *Dmake) HeaderOnlyTarget(action Action, env []string) error {
+	if _, err := dmake.Prepare(); err != nil {
+		return err
+	}
+
+	switch action {
+	case Cleaning:
+		checked := dmake.HeadersCheckedPath()
+		Remove(checked)
+		Remove(filepath.Join(dmake.ObjsDir(), dmake.Name()+".pc"))
+		RemoveEmptyParents(checked, strings.Count(dmake.BuildDirectory(dmake.ObjsRoot()), string(filepath.Separator))+1)
+		if len(dmake.testFiles) > 0 {
+			RemoveAll(dmake.BuildPath(testsDirectory))
+			dmake.CleanObjects(dmake.testFiles)
+		}
+		return nil
+	case Installing:
+		if *noBuildFlag {
+			return dmake.InstallHeaderOnly()
+		}
+	case DefaultAction, Building, Testing:
+	default:
+		return fmt.Errorf("%s is a header-only library, there's nothing to %s", dmake.outputname, action)
+	}
+
+	if err := dmake.RunHook(PreBuildHook, env); err != nil {
+		return err
+	}
+	if err := dmake.CompileHeaders(env); err != nil {
+		return err
+	}
+	if err := dmake.RunHook(PostBuildHook, env); err != nil {
+		return err
+	}
+
+	switch action {
+	case Installing:
+		return dmake.InstallHeaderOnly()
+	case Testing:
+		return dmake.TestAction(env)
+	}
+	return nil
+}
+
+//  Return the pathname of the file recording when a header-only
+//  library's headers were last compiled successfully.
+//
+func (dmake *Dmake) HeadersCheckedPath() string {
+	return filepath.Join(dmake.ObjsDir(), dmake.Name()+headersCheckedSuffix)
+}
+
+//  Compile each of a header-only library's headers, if COMPILE_HEADERS
+//  is defined and any have changed since they were last compiled.
+//
+func (dmake *Dmake) CompileHeaders(env []string) error {
+	if _, found := dmake.vars.Get("COMPILE_HEADERS"); !found {
+		return nil
+	}
+	checked := dmake.HeadersCheckedPath()
+	if IsUpToDate(checked, append(dmake.headerFiles[:len(dmake.headerFiles):len(dmake.headerFiles)], dmakeFileFilename)) {
+		return nil
+	}
+	language := dmake.HeaderLanguage()
+	options, err := dmake.HeaderOptions(language)
+	if err != nil {
+		return err
+	}
+	env = dmake.TargetEnvironment(env)
+	name, defaultValue := dmake.Toolchain().CompilerVariable(language)
+	compiler := ShellWords(exportTool(env, name, defaultValue))
+	var commands [][]string
+	for _, path := range dmake.headerFiles {
+		commands = append(commands, append(compiler[:len(compiler):len(compiler)], dmake.Toolchain().HeaderCompileArgs(options, language, path)...))
+	}
+	failed := RunFileCommands(env, dmake.headerFiles, commands, func(path string, output []byte, err error) {
+		annotations.Writer(CommandOutput()).Write(output)
+		if err != nil {
+			logger.Warnf("FAIL %s (%s)", path, err)
+		}
+	})
+	if *dryRunFlag {
+		return nil
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d header files failed to compile", failed, len(commands))
+	}
+	os.MkdirAll(dmake.ObjsDir(), 0777)
+	return CreateFile(checked, "")
+}
+
+//  Return the compiler options used to compile headers, as a source
+//  file in the language would be compiled.
+//
+func (dmake *Dmake) HeaderOptions(language Language) ([]string, error) {
+	options, err := ReadOptionsFile(filepath.Join(dccOptionsDirectory, compilerOptionsFilename[language]))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	options = append(options, dmake.LanguageOptions(language)...)
+	options = append(options, dmake.ToolchainDescription().LanguageOptions(language)...)
+	options = append(options, dmake.modeOptions...)
+	options = append(options, dmake.SanitizerOptions()...)
+	options = append(options, dmake.packageOptions...)
+	return append(options, dccArgsFlag...), nil
+}
+
+//  Return the arguments used to check a header compiles, without
+//  writing any output. The header is included by an empty source file,
+//  the compiler's standard input, rather than compiled as the source
+//  itself so a #pragma once isn't "in main file".
+//
+func (t *Toolchain) HeaderCompileArgs(options []string, language Language, path string) []string {
+	if t.msvc {
+		args := append([]string{"/nologo"}, MsvcCompileOptions(options)...)
+		if language == CplusplusLanguage {
+			return append(args, "/EHsc", "/Zs", "/Tp"+path)
+		}
+		return append(args, "/Zs", "/Tc"+path)
+	}
+	args := append(options[:len(options):len(options)], "-fsyntax-only", "-include", path)
+	return append(args, "-x", compilerLanguageArgument[language], "-")
+}
+
+// dmake install in cwd, for a header-only library
+//
+// Installs the headers and a pkg-config file for them, along with any
+// manual pages and other files.
+//
+func (dmake *Dmake) InstallHeaderOnly() error {
+	path := dmake.installprefix
+	if path == "" {
+		path = "."
+	}
+	if err := dmake.InstallHeaders(path); err != nil {
+		return err
+	}
+	if err := dmake.InstallManPages(path); err != nil {
+		return err
+	}
+	if err := dmake.InstallExtraFiles(path); err != nil {
+		return err
+	}
+	return dmake.InstallPkgConfig(path)
+}
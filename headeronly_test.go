@@ -0,0 +1,34 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHeaderOnly(t *testing.T) {
+	dmake := &Dmake{vars: make(Vars), outputtype: HeaderOnlyOutputType, outputname: "vec"}
+	dmake.headerFiles = []string{"include/vec.h", "include/detail/impl.hpp"}
+	if language := dmake.HeaderLanguage(); language != CplusplusLanguage {
+		t.Errorf("headers are %s, expected C++", language)
+	}
+	dmake.headerFiles = dmake.headerFiles[:1]
+	if language := dmake.Language(); language != CLanguage {
+		t.Errorf("headers are %s, expected C", language)
+	}
+	if args := gnuToolchain.HeaderCompileArgs([]string{"-Iinclude"}, CLanguage, "include/vec.h"); !reflect.DeepEqual(args, []string{"-Iinclude", "-fsyntax-only", "-include", "include/vec.h", "-x", "c", "-"}) {
+		t.Errorf("header compile args %q", args)
+	}
+	pc := dmake.PkgConfig(filepath.FromSlash("/usr/local"))
+	if strings.Contains(pc, "Libs:") || !strings.Contains(pc, "Cflags: -I${includedir}") {
+		t.Errorf("header-only pkg-config file\n%s", pc)
+	}
+	if err := dmake.PrepareHeaderOnly(); err != nil {
+		t.Error(err)
+	}
+	dmake.headerFiles = nil
+	if err := dmake.PrepareHeaderOnly(); err == nil {
+		t.Error("expected an error for a header-only library without HEADERS")
+	}
+}
@@ -0,0 +1,71 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//  Hooks are commands run before and after building. A hook is
+//  defined by a .dmake variable, PREBUILD or POSTBUILD, holding a
+//  shell command, and by an executable file of the same name, in
+//  lower case, in the hooks directory. If both exist the variable's
+//  command runs first.
+//
+const (
+	PreBuildHook  = "PREBUILD"
+	PostBuildHook = "POSTBUILD"
+
+	hooksDirectory = ".dmake.d/hooks"
+)
+
+//  Run a hook's commands. Hooks run in the current directory with
+//  the environment describing the build.
+//
+func (dmake *Dmake) RunHook(hook string, env []string) error {
+	var commands [][]string
+	if command, found := dmake.vars.GetValue(hook); found && command != "" {
+		commands = append(commands, ShellCommand(command).Args)
+	}
+	path := filepath.Join(hooksDirectory, strings.ToLower(hook))
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		commands = append(commands, []string{"./" + filepath.ToSlash(path)})
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+
+	env = append(env[:len(env):len(env)],
+		"DMAKE_OUTPUT="+dmake.OutputPath(),
+		"DMAKE_OBJDIR="+dmake.ObjsDir(),
+		"DMAKE_TYPE="+dmake.outputtype.String(),
+		"DMAKE_MODE="+dmake.Mode(),
+		"DMAKE_OS="+dmake.Target().os,
+		"DMAKE_ARCH="+dmake.Target().arch,
+	)
+	for _, command := range commands {
+		display := command[len(command)-1]
+		if *dryRunFlag {
+			fmt.Println(display)
+			continue
+		}
+		logger.Verbosef("%s: %s", hook, display)
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Env = env
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, CommandOutput(), os.Stderr
+		if err := RunCommand(cmd); err != nil {
+			return AddDetail(err, "%s: %s", hook, display)
+		}
+	}
+	return nil
+}
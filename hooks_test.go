@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are shell commands")
+	}
+	inTempProject(t, map[string]string{
+		hooksDirectory + "/prebuild": "#!/bin/sh\necho \"file $DMAKE_TYPE $DMAKE_OUTPUT\" >> hooks.log\n",
+	})
+	if err := os.Chmod(hooksDirectory+"/prebuild", 0777); err != nil {
+		t.Fatal(err)
+	}
+	dmake := &Dmake{vars: make(Vars), outputtype: ExeOutputType, outputname: "prog"}
+	dmake.vars.SetValue(PreBuildHook, "echo variable >> hooks.log")
+	if err := dmake.RunHook(PreBuildHook, os.Environ()); err != nil {
+		t.Fatal(err)
+	}
+	if err := dmake.RunHook(PostBuildHook, os.Environ()); err != nil {
+		t.Fatal(err)
+	}
+	if log, _ := os.ReadFile("hooks.log"); string(log) != "variable\nfile exe prog\n" {
+		t.Errorf("hooks ran as\n%s", log)
+	}
+
+	// A failing hook stops any others, and the build.
+	os.Remove("hooks.log")
+	writeFiles(t, ".", map[string]string{
+		dmakeFileFilename: "PREBUILD = echo variable >> hooks.log; exit 3\nPOSTBUILD = echo post >> hooks.log\n",
+		"main.c":          "int main() { return 0; }\n",
+	})
+	err := NewDmake("prog", "", "").Run(Building, os.Environ())
+	if err == nil || !strings.Contains(err.Error(), PreBuildHook) {
+		t.Errorf("failing hook returned %v", err)
+	}
+	if log, _ := os.ReadFile("hooks.log"); string(log) != "variable\n" {
+		t.Errorf("hooks ran as\n%s", log)
+	}
+	if _, err := os.Stat("prog"); !os.IsNotExist(err) {
+		t.Error("built after a hook failed")
+	}
+}
@@ -0,0 +1,147 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//  Files are excluded from source packages using patterns in the
+//  syntax of .gitignore files. A pattern matches a file's name or,
+//  if it contains a slash, the file's path relative to the directory
+//  of the .gitignore file defining it. A trailing slash matches only
+//  directories, ** any number of directories and a leading ! includes
+//  files an earlier pattern excluded. The last pattern matching a
+//  file decides if it's excluded.
+//
+const ignoreFilename = ".gitignore"
+
+//  An IgnorePattern is a single line of a .gitignore file.
+//
+type IgnorePattern struct {
+	dir      string // the directory the pattern applies to, slash separated, "" for the top
+	pattern  string // the pattern less any !, leading and trailing slashes
+	negated  bool   // the pattern re-includes files
+	dirOnly  bool   // the pattern matches only directories
+	anchored bool   // the pattern matches the path rather than the name
+}
+
+//  Parse .gitignore lines whose patterns apply to the files below a
+//  directory.
+//
+func ParseIgnorePatterns(lines []string, dir string) []IgnorePattern {
+	var patterns []IgnorePattern
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := IgnorePattern{dir: dir}
+		if strings.HasPrefix(line, "!") {
+			p.negated = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:] // an escaped # or !
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			p.anchored = true
+			line = strings.TrimLeft(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		p.pattern = line
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+//  Read the patterns in the .gitignore file in a directory, dir
+//  being the directory's slash separated path relative to the top.
+//  A missing file has no patterns.
+//
+func ReadIgnoreFile(dir string) ([]IgnorePattern, error) {
+	file, err := os.Open(filepath.Join(filepath.FromSlash(dir), ignoreFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var lines []string
+	input := bufio.NewScanner(file)
+	for input.Scan() {
+		lines = append(lines, input.Text())
+	}
+	if dir == "." {
+		dir = ""
+	}
+	return ParseIgnorePatterns(lines, dir), input.Err()
+}
+
+//  Return true if the pattern matches a file, given by its slash
+//  separated path relative to the top.
+//
+func (p IgnorePattern) Matches(name string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.dir != "" {
+		if !strings.HasPrefix(name, p.dir+"/") {
+			return false
+		}
+		name = name[len(p.dir)+1:]
+	}
+	if !p.anchored {
+		name = path.Base(name)
+	}
+	return matchSegments(strings.Split(p.pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+//  Return true if the patterns exclude a file.
+//
+func IsIgnored(patterns []IgnorePattern, name string, isDir bool) bool {
+	ignored := false
+	for _, p := range patterns {
+		if p.Matches(name, isDir) {
+			ignored = !p.negated
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestIgnorePatterns(t *testing.T) {
+	patterns := ParseIgnorePatterns([]string{
+		"# comment",
+		"*.o",
+		"!keep.o",
+		"/build/",
+		"docs/**/*.html",
+		".objs/",
+	}, "")
+	patterns = append(patterns, ParseIgnorePatterns([]string{"/local.h"}, "sub")...)
+	tests := []struct {
+		name    string
+		isDir   bool
+		ignored bool
+	}{
+		{"main.o", false, true},
+		{"src/util.o", false, true},
+		{"src/keep.o", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"src/build", true, false},
+		{"docs/index.html", false, true},
+		{"docs/api/x/index.html", false, true},
+		{"src/docs/index.html", false, false},
+		{"src/.objs", true, true},
+		{"sub/local.h", false, true},
+		{"local.h", false, false},
+		{"sub/inner/local.h", false, false},
+		{"main.c", false, false},
+	}
+	for _, test := range tests {
+		if ignored := IsIgnored(patterns, test.name, test.isDir); ignored != test.ignored {
+			t.Errorf("IsIgnored(%q, %v) = %v, expected %v", test.name, test.isDir, ignored, test.ignored)
+		}
+	}
+}
@@ -0,0 +1,697 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//  What dmake init creates beyond the dcc options files, .dmake and
+//  Makefile.
+//
+type InitExtras struct {
+	license   string // the license to write to LICENSE, if any
+	holder    string // the license's copyright holder
+	headers   string // the headers installed, the HEADERS variable
+	tests     bool   // create a tests directory with a first test
+	sources   bool   // create starter sources if there are none
+	gitignore bool   // create a .gitignore
+	git       bool   // create a .gitignore, a git repository and commit
+}
+
+//  The licenses init can write.
+//
+var initLicenses = []string{"none", "MIT", "BSD-2-Clause", "ISC"}
+
+//  The suffixes of the source files created for each language.
+//
+var initSourceSuffixes = map[Language]string{
+	CLanguage:            ".c",
+	CplusplusLanguage:    ".cpp",
+	ObjcLanguage:         ".m",
+	ObjcplusplusLanguage: ".mm",
+}
+
+//  The language standards init accepts, ISO's and GNU's dialects.
+//
+var (
+	cStandards = []string{
+		"c89", "c90", "c99", "c11", "c17", "c18", "c23",
+		"gnu89", "gnu90", "gnu99", "gnu11", "gnu17", "gnu18", "gnu23",
+	}
+	cxxStandards = []string{
+		"c++98", "c++03", "c++11", "c++14", "c++17", "c++20", "c++23", "c++26",
+		"gnu++98", "gnu++03", "gnu++11", "gnu++14", "gnu++17", "gnu++20", "gnu++23", "gnu++26",
+	}
+
+	// The names compilers released before a standard was
+	// published use for it.
+	//
+	provisionalStandards = map[string]string{
+		"c23":     "c2x",
+		"gnu23":   "gnu2x",
+		"c++20":   "c++2a",
+		"gnu++20": "gnu++2a",
+		"c++23":   "c++2b",
+		"gnu++23": "gnu++2b",
+		"c++26":   "c++2c",
+		"gnu++26": "gnu++2c",
+	}
+
+	// The names compilers' -x option uses for the languages.
+	//
+	compilerLanguageNames = map[Language]string{
+		CLanguage:            "c",
+		CplusplusLanguage:    "c++",
+		ObjcLanguage:         "objective-c",
+		ObjcplusplusLanguage: "objective-c++",
+	}
+)
+
+//  Check the compiler used for a language, as defined by the
+//  environment or the toolchain, supports a standard.
+//  Returns the -std= value to use which, for compilers predating the
+//  standard, may be its provisional name, e.g. c++2b for c++23. If
+//  the compiler isn't found the standard is used as given.
+//
+func CheckLanguageStandard(env []string, toolchain *Toolchain, language Language, standard string) (string, error) {
+	variable, compiler := toolchain.CompilerVariable(language)
+	if value, found := LookupEnv(env, variable); found && value != "" {
+		compiler = value
+	}
+	words := strings.Fields(compiler)
+	path, err := exec.LookPath(words[0])
+	if err != nil {
+		logger.Warnf("%s: %s not found, the %s standard isn't checked", variable, words[0], standard)
+		return standard, nil
+	}
+	supports := func(standard string) bool {
+		args := append(words[1:len(words):len(words)], "-std="+standard, "-x", compilerLanguageNames[language], "-fsyntax-only", os.DevNull)
+		return exec.Command(path, args...).Run() == nil
+	}
+	if supports(standard) {
+		return standard, nil
+	}
+	if provisional, found := provisionalStandards[standard]; found && supports(provisional) {
+		logger.Infof("%s supports %s as %s", compiler, standard, provisional)
+		return provisional, nil
+	}
+	return "", fmt.Errorf("%s: not supported by %s, define $%s to use another compiler", standard, compiler, variable)
+}
+
+//  Objective-C programs use Foundation. On Apple platforms that's a
+//  framework, elsewhere it's GNUstep's, whose options gnustep-config
+//  reports, if it's installed, or else just the runtime library.
+//
+func appleTarget() bool {
+	return targetOS == "darwin" || targetOS == "ios"
+}
+
+func gnustepConfig(option string) string {
+	if crossCompiling {
+		return ""
+	}
+	output, err := exec.Command("gnustep-config", option).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+//  Return the compiler options Objective-C needs other than those
+//  init always uses.
+//
+func ObjcOptions() string {
+	if appleTarget() {
+		return ""
+	}
+	return gnustepConfig("--objc-flags")
+}
+
+//  Return the libraries, as lines for a dcc LIBS file, Objective-C
+//  programs are linked with.
+//
+func ObjcLibs() string {
+	if appleTarget() {
+		return "-framework Foundation\n"
+	}
+	if libs := gnustepConfig("--base-libs"); libs != "" {
+		return libs + "\n"
+	}
+	return "-lobjc\n"
+}
+
+//  An initWizard asks the questions for dmake init -i.
+//
+type initWizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+//  Ask a question and return the answer, or the default if none is
+//  given. If choices are given the answer must be one of them.
+//
+func (w *initWizard) ask(question, defaultValue string, choices ...string) (string, error) {
+	for {
+		fmt.Fprint(w.out, question)
+		if len(choices) > 0 {
+			fmt.Fprintf(w.out, " (%s)", strings.Join(choices, ", "))
+		}
+		if defaultValue != "" {
+			fmt.Fprintf(w.out, " [%s]", defaultValue)
+		}
+		fmt.Fprint(w.out, ": ")
+		line, err := w.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return "", fmt.Errorf("%s: no answer", question)
+			}
+			return "", err
+		}
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = defaultValue
+		}
+		if len(choices) == 0 {
+			return answer, nil
+		}
+		for _, choice := range choices {
+			if strings.EqualFold(answer, choice) {
+				return choice, nil
+			}
+		}
+		fmt.Fprintf(w.out, "%q isn't one of %s\n", answer, strings.Join(choices, ", "))
+	}
+}
+
+func (w *initWizard) yes(question string, defaultValue bool) (bool, error) {
+	value := "n"
+	if defaultValue {
+		value = "y"
+	}
+	answer, err := w.ask(question, value, "y", "n")
+	return answer == "y", err
+}
+
+//  Ask what dmake init should create. Returns the equivalent init
+//  arguments and the extras asked for.
+//
+func (dmake *Dmake) InitInteractively(in io.Reader, out io.Writer) ([]string, InitExtras, error) {
+	w := &initWizard{in: bufio.NewReader(in), out: out}
+	var extras InitExtras
+
+	sources, language, err := dmake.Target().SourceFiles()
+	if err != nil {
+		return nil, extras, err
+	}
+	defaultType := "exe"
+	if len(sources) > 0 {
+		defaultType = "lib"
+		for _, path := range sources {
+			if DefinesMain(path) {
+				defaultType = "exe"
+				break
+			}
+		}
+	}
+	projectType, err := w.ask("Project type", defaultType, "exe", "lib", "dll", "plugin")
+	if err != nil {
+		return nil, extras, err
+	}
+	if language == UnknownLanguage {
+		answer, err := w.ask("Language", "c++", "c", "c++", "objc", "objc++")
+		if err != nil {
+			return nil, extras, err
+		}
+		language.Set(answer)
+	}
+	args := []string{projectType, language.String()}
+
+	switch language {
+	case CLanguage, ObjcLanguage:
+		standard, err := w.ask("C standard", defaultCStandard, cStandards...)
+		if err != nil {
+			return nil, extras, err
+		}
+		args = append(args, standard)
+	case CplusplusLanguage, ObjcplusplusLanguage:
+		standard, err := w.ask("C++ standard", defaultCxxStandard, cxxStandards...)
+		if err != nil {
+			return nil, extras, err
+		}
+		args = append(args, standard)
+	}
+
+	name, err := w.ask("Name", dmake.defaultoutput)
+	if err != nil {
+		return nil, extras, err
+	}
+	if name != dmake.defaultoutput {
+		args = append(args, name)
+	}
+
+	if extras.license, err = w.ask("License", "none", initLicenses...); err != nil {
+		return nil, extras, err
+	}
+	if extras.license != "none" {
+		if extras.holder, err = w.ask("Copyright holder", GitConfig("user.name", os.Getenv("USER"))); err != nil {
+			return nil, extras, err
+		}
+	}
+	if projectType == "lib" || projectType == "dll" {
+		if extras.headers, err = w.ask("Headers to install, e.g. *.h", ""); err != nil {
+			return nil, extras, err
+		}
+	}
+	if extras.tests, err = w.yes("Create a tests directory", false); err != nil {
+		return nil, extras, err
+	}
+	if len(sources) == 0 {
+		if extras.sources, err = w.yes("Create starter source files", true); err != nil {
+			return nil, extras, err
+		}
+	}
+	if InsideGitRepository() {
+		if extras.gitignore, err = w.yes("Create a .gitignore", true); err != nil {
+			return nil, extras, err
+		}
+	} else if extras.git, err = w.yes("Create a git repository", false); err != nil {
+		return nil, extras, err
+	}
+	return args, extras, nil
+}
+
+//  Return a git configuration value, or a default if git or the value
+//  isn't found.
+//
+func GitConfig(name, defaultValue string) string {
+	output, err := exec.Command("git", "config", "--get", name).Output()
+	if value := strings.TrimSpace(string(output)); err == nil && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+//  Return a name made into a C identifier.
+//
+func Identifier(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+//  Create a file unless it already exists. Returns true if the file
+//  was created.
+//
+func createNewFile(path, content string) (bool, error) {
+	if _, err := os.Stat(path); err == nil {
+		return false, nil
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return false, err
+		}
+	}
+	return true, CreateFile(path, content)
+}
+
+//  Create starter source files, a program printing hello, world or a
+//  library defining a single function and a header declaring it.
+//
+func CreateStarterSources(projectType string, language Language, name string) error {
+	suffix := initSourceSuffixes[language]
+	if projectType == "exe" {
+		_, err := createNewFile("main"+suffix, starterProgram(language))
+		return err
+	}
+	ident := Identifier(name)
+	guard := strings.ToUpper(ident) + "_H"
+	header := fmt.Sprintf("#ifndef %s\n#define %s\n\n", guard, guard)
+	if language == CLanguage || language == ObjcLanguage {
+		header += fmt.Sprintf("#ifdef __cplusplus\nextern \"C\" {\n#endif\n\nint %s_answer(void);\n\n#ifdef __cplusplus\n}\n#endif\n", ident)
+	} else {
+		header += fmt.Sprintf("int %s_answer();\n", ident)
+	}
+	header += fmt.Sprintf("\n#endif // %s\n", guard)
+	if _, err := createNewFile(name+".h", header); err != nil {
+		return err
+	}
+	params := "void"
+	if language == CplusplusLanguage || language == ObjcplusplusLanguage {
+		params = ""
+	}
+	source := fmt.Sprintf("#include \"%s.h\"\n\nint\n%s_answer(%s)\n{\n    return 42;\n}\n", name, ident, params)
+	_, err := createNewFile(name+suffix, source)
+	return err
+}
+
+func starterProgram(language Language) string {
+	switch language {
+	case CplusplusLanguage:
+		return "#include <iostream>\n\nint\nmain()\n{\n    std::cout << \"hello, world\\n\";\n    return 0;\n}\n"
+	case ObjcLanguage, ObjcplusplusLanguage:
+		return "#import <Foundation/Foundation.h>\n\nint\nmain(void)\n{\n    @autoreleasepool {\n        NSLog(@\"hello, world\");\n    }\n    return 0;\n}\n"
+	default:
+		return "#include <stdio.h>\n\nint\nmain(void)\n{\n    printf(\"hello, world\\n\");\n    return 0;\n}\n"
+	}
+}
+
+//  Create a tests directory with a first test. Returns the TESTS
+//  pattern matching the tests. Test programs are built from a single
+//  source file so a library's test includes the library's source.
+//
+func CreateStarterTests(projectType string, language Language, name string) (string, error) {
+	suffix := initSourceSuffixes[language]
+	var test string
+	if projectType == "exe" {
+		test = "int\nmain(void)\n{\n    return 0;\n}\n"
+	} else {
+		test = fmt.Sprintf("#include <assert.h>\n#include \"../%s%s\"\n\nint\nmain(void)\n{\n    assert(%s_answer() == 42);\n    return 0;\n}\n", name, suffix, Identifier(name))
+	}
+	_, err := createNewFile(filepath.Join("tests", "test_"+Identifier(name)+suffix), test)
+	return "tests/*" + suffix, err
+}
+
+//  Write a LICENSE file.
+//
+func CreateLicense(license, holder string) error {
+	year := time.Now().Year()
+	var text string
+	switch license {
+	case "", "none":
+		return nil
+	case "MIT":
+		text = fmt.Sprintf(mitLicense, year, holder)
+	case "BSD-2-Clause":
+		text = fmt.Sprintf(bsd2License, year, holder)
+	case "ISC":
+		text = fmt.Sprintf(iscLicense, year, holder)
+	default:
+		return fmt.Errorf("%s: unsupported license", license)
+	}
+	_, err := createNewFile("LICENSE", text)
+	return err
+}
+
+const mitLicense = `MIT License
+
+Copyright (c) %d %s
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+`
+
+const bsd2License = `BSD 2-Clause License
+
+Copyright (c) %d, %s
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+`
+
+const iscLicense = `ISC License
+
+Copyright (c) %d %s
+
+Permission to use, copy, modify, and/or distribute this software for any
+purpose with or without fee is hereby granted, provided that the above
+copyright notice and this permission notice appear in all copies.
+
+THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+`
+
+//  Init templates are project skeletons, directories of files, such as
+//  sources, .dcc options files and a .dmake file, copied into the
+//  project by dmake init -template <name>. They're found in the user's
+//  templates directory, $XDG_CONFIG_HOME/dmake/templates, by default
+//  ~/.config/dmake/templates, unless the name is a path.
+//
+//  The names and contents of the files copied have variables, written
+//  @NAME@, replaced,
+//
+//	@NAME@		the output's name
+//	@IDENT@		the name as a C identifier
+//	@IDENT_UPPER@	the identifier in upper case, e.g. for include guards
+//	@TYPE@		the project type, exe, lib, dll or plugin
+//	@LANG@		the language, c, c++, objc or objc++
+//	@STD@		the language standard
+//	@YEAR@		the current year
+//	@AUTHOR@	the user's name from git, or $USER
+//
+const templatesDirectory = "dmake/templates"
+
+//  Return the directory holding a named template.
+//
+func TemplateDirectory(name string) (string, error) {
+	if strings.ContainsRune(name, filepath.Separator) || strings.ContainsRune(name, '/') {
+		return name, nil
+	}
+	config, err := ConfigDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(config, templatesDirectory, name), nil
+}
+
+//  Return the template variables' values.
+//
+func TemplateVars(projectType string, language Language, languageStd, name string) map[string]string {
+	ident := Identifier(name)
+	vars := map[string]string{
+		"NAME":        name,
+		"IDENT":       ident,
+		"IDENT_UPPER": strings.ToUpper(ident),
+		"TYPE":        projectType,
+		"STD":         languageStd,
+		"YEAR":        fmt.Sprint(time.Now().Year()),
+		"AUTHOR":      GitConfig("user.name", os.Getenv("USER")),
+	}
+	if language != UnknownLanguage {
+		vars["LANG"] = language.String()
+	}
+	return vars
+}
+
+//  Replace the @NAME@ variables in a string.
+//
+func ExpandTemplate(s string, vars map[string]string) string {
+	pairs := make([]string, 0, 2*len(vars))
+	for name, value := range vars {
+		pairs = append(pairs, "@"+name+"@", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+//  Return the paths of a template's files.
+//
+func TemplateFiles(dir string) []string {
+	var paths []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths
+}
+
+//  Copy a template's files into the current directory, expanding
+//  variables in their names and contents. Existing files aren't
+//  overwritten. Files that aren't text, containing NUL bytes, are
+//  copied as they are.
+//
+func CopyTemplate(dir string, vars map[string]string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return AddDetail(err, "template")
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s: template is not a directory", dir)
+	}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if info.Name() == ".git" && info.IsDir() {
+			return filepath.SkipDir
+		}
+		target := ExpandTemplate(rel, vars)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0777)
+		}
+		if _, err := os.Stat(target); err == nil {
+			return fmt.Errorf("%s: already exists, not copying the template's %s", target, rel)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !bytes.ContainsRune(content, 0) {
+			content = []byte(ExpandTemplate(string(content), vars))
+		}
+		return os.WriteFile(target, content, info.Mode().Perm())
+	})
+}
+
+//  Remove an option, and its value, from a list of arguments. Returns
+//  the option's value, or "" if it isn't present, and the remaining
+//  arguments.
+//
+func TakeOption(args []string, option string) (string, []string, error) {
+	for i, arg := range args {
+		if arg != option {
+			continue
+		}
+		if i+1 == len(args) {
+			return "", args, fmt.Errorf("%s requires a value", option)
+		}
+		return args[i+1], append(args[:i:i], args[i+2:]...), nil
+	}
+	return "", args, nil
+}
+
+//  Return the linker options for plugins, loaded by programs that
+//  define the symbols they use. On macOS plugins are bundles, whose
+//  undefined symbols are looked up when loaded, elsewhere shared
+//  objects.
+//
+func PluginLinkOptions() []string {
+	if targetOS == "darwin" {
+		return []string{"-bundle", "-undefined dynamic_lookup"}
+	}
+	return DefaultTarget().LinkTypeOptions(PluginOutputType)
+}
+
+//  The project types init creates and their outputs.
+//
+var initOutputTypes = map[string]OutputType{
+	"exe":    ExeOutputType,
+	"lib":    LibOutputType,
+	"dll":    DllOutputType,
+	"plugin": PluginOutputType,
+}
+
+//  Create a .gitignore ignoring the files dmake creates, the objects,
+//  dependencies, test programs, install manifest, compile_commands.json
+//  and the output. An existing .gitignore is left alone.
+//
+func CreateGitIgnore(projectType, outputName string) error {
+	var lines []string
+	for _, dir := range []string{objsRoot, depsRoot, testsDirectory} {
+		if !filepath.IsAbs(dir) {
+			lines = append(lines, "/"+filepath.ToSlash(dir)+"/")
+		}
+	}
+	lines = append(lines, "/"+installManifestFilename, "/"+compileCommandsFilename)
+	if outputType, found := initOutputTypes[projectType]; found {
+		lines = append(lines, "/"+FilenameForType(outputType, outputName))
+	}
+	created, err := createNewFile(".gitignore", strings.Join(lines, "\n")+"\n")
+	if err == nil && !created {
+		logger.Infof(".gitignore already exists, not changed")
+	}
+	return err
+}
+
+//  Return true if the current directory is in a git repository.
+//
+func InsideGitRepository() bool {
+	output, err := exec.Command("git", "rev-parse", "--is-inside-work-tree").Output()
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
+
+//  Create a git repository in the current directory and commit the
+//  files init created. Nothing is done if the directory is already in
+//  a repository, committing there is up to the user.
+//
+func InitGitRepository() error {
+	if InsideGitRepository() {
+		logger.Infof("already in a git repository, not creating another")
+		return nil
+	}
+	git := func(args ...string) error {
+		cmd := exec.Command("git", args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := RunCommand(cmd); err != nil {
+			return fmt.Errorf("git %s: %v", args[0], err)
+		}
+		return nil
+	}
+	if err := git("init", "-q"); err != nil {
+		return err
+	}
+	if err := git("add", "-A"); err != nil {
+		return err
+	}
+	return git("commit", "-q", "-m", "Initial commit")
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCopyTemplate(t *testing.T) {
+	template := t.TempDir()
+	writeFiles(t, template, map[string]string{
+		"include/@NAME@.h": "#ifndef @IDENT_UPPER@_H\n",
+		"README":           "@NAME@, a @LANG@ @TYPE@ using @UNKNOWN@\n",
+	})
+	inTempProject(t, nil)
+
+	vars := TemplateVars("lib", CplusplusLanguage, "c++17", "my-lib")
+	if err := CopyTemplate(template, vars); err != nil {
+		t.Fatal(err)
+	}
+	check := func(path, expected string) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Errorf("%s is %q, expected %q", path, content, expected)
+		}
+	}
+	check(filepath.Join("include", "my-lib.h"), "#ifndef MY_LIB_H\n")
+	check("README", "my-lib, a c++ lib using @UNKNOWN@\n")
+
+	if err := CopyTemplate(template, vars); err == nil {
+		t.Error("existing files overwritten")
+	}
+}
+
+func TestInitInteractively(t *testing.T) {
+	dir := inTempProject(t, nil)
+	dmake := NewDmake(dir, "", "")
+
+	// Project type, language, standard, name, license, holder,
+	// headers, tests, starter sources and git.
+	answers := "library\nlib\nc\nc11\nmylib\nMIT\nA. Holder\n*.h\ny\ny\nn\n"
+	var out strings.Builder
+	if err := dmake.InitAction([]string{"-i"}, dir, strings.NewReader(answers), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"library" isn't one of`) {
+		t.Errorf("an invalid project type wasn't asked again:\n%s", out.String())
+	}
+
+	contains := func(path string, expected ...string) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range expected {
+			if !strings.Contains(string(content), s) {
+				t.Errorf("%s doesn't contain %q:\n%s", path, s, content)
+			}
+		}
+	}
+	contains(".dmake", "LIB = mylib", "HEADERS = *.h", "TESTS = tests/*.c")
+	contains(filepath.Join(".dcc", "CFLAGS"), "-std=c11")
+	contains("LICENSE", "MIT License", "A. Holder")
+	contains(filepath.Join("tests", "test_mylib.c"), "mylib_answer()")
+	contains("mylib.c", "mylib_answer")
+}
+
+func TestInitInteractivelyDefaults(t *testing.T) {
+	dir := inTempProject(t, map[string]string{"main.cpp": "int main() { return 0; }\n"})
+	dmake := NewDmake(dir, "", "")
+
+	// Every answer is the default. The sources define main, so it's a
+	// program, and no language, headers or starter sources are asked
+	// for.
+	if err := dmake.InitAction([]string{"-i"}, dir, strings.NewReader("\n\n\n\n\n\n"), io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(".dmake")
+	if err == nil && strings.Contains(string(content), "LIB") {
+		t.Errorf("a program was made a library:\n%s", content)
+	}
+	content, err = os.ReadFile(filepath.Join(".dcc", "CXXFLAGS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "-std="+defaultCxxStandard) {
+		t.Errorf(".dcc/CXXFLAGS doesn't use %s:\n%s", defaultCxxStandard, content)
+	}
+	if _, err := os.Stat("LICENSE"); err == nil {
+		t.Error("a LICENSE was created without asking for one")
+	}
+	if _, err := os.Stat("tests"); err == nil {
+		t.Error("a tests directory was created without asking for one")
+	}
+}
+
+func TestInitInteractivelyEOF(t *testing.T) {
+	dir := inTempProject(t, nil)
+	dmake := NewDmake(dir, "", "")
+	err := dmake.InitAction([]string{"-i"}, dir, strings.NewReader("exe\nc\n"), io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "no answer") {
+		t.Errorf("running out of answers returned %v", err)
+	}
+	if _, err := os.Stat(".dmake"); err == nil {
+		t.Error(".dmake written after the answers ran out")
+	}
+}
+
+func TestCreateInitMakefile(t *testing.T) {
+	inTempProject(t, nil)
+	if err := CreateInitMakefile(); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile("Makefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var install string
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "install:") {
+			install = line
+		}
+	}
+	for _, expected := range []string{"dmake -no-build", "-prefix $(prefix)", "-bindir $(bindir)", "-libdir $(libdir)", "-includedir $(includedir)", "-mandir $(mandir)", " install"} {
+		if !strings.Contains(install, expected) {
+			t.Errorf("install rule %q doesn't contain %q", install, expected)
+		}
+	}
+}
+
+func TestInitFindsProgram(t *testing.T) {
+	dir := inTempProject(t, map[string]string{"main.c": "int main() { return 0; }\n"})
+	if err := NewDmake(dir, "", "").InitAction([]string{"prog", "-gitignore"}, dir, nil, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range map[string]string{".dmake": "EXE = prog\n", ".gitignore": "/" + FilenameForType(ExeOutputType, "prog") + "\n"} {
+		if content, err := os.ReadFile(path); err != nil {
+			t.Error(err)
+		} else if !strings.HasSuffix(string(content), expected) {
+			t.Errorf("%s is\n%s\nexpected it to end %q", path, content, expected)
+		}
+	}
+}
+
+//  Run dmake init, non-interactively with some arguments, in a
+//  project, named app, holding the files and return the contents of
+//  the files it creates, other than the Makefile and any git
+//  repository, named relative to the project.
+//
+func initProject(t *testing.T, files map[string]string, args ...string) map[string]string {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("expects a Linux host's filenames and options")
+	}
+	dir := inTempProject(t, files)
+	saved := logger
+	defer func() { logger = saved }()
+	logger = &Logger{w: io.Discard, level: InfoLevel}
+	if err := NewDmake("app", "", "").InitAction(args, dir, nil, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	created := make(map[string]string)
+	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(path)
+		if _, given := files[name]; info.IsDir() || given || name == "Makefile" {
+			if name == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		created[name] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+//  Compare the files init created with those expected.
+//
+func checkInit(t *testing.T, files map[string]string, expected map[string]string) {
+	t.Helper()
+	for path, contents := range expected {
+		if files[path] != contents {
+			t.Errorf("%s is\n%s\nexpected\n%s", path, files[path], contents)
+		}
+	}
+	for path := range files {
+		if _, found := expected[path]; !found {
+			t.Errorf("%s created, expected only %d files", path, len(expected))
+		}
+	}
+}
+
+const (
+	initReadByDcc   = "# This file is read by dcc\n#\n\n"
+	initDebugFlags  = "-g\n-DDEBUG\n-O0\n"
+	initWarnings    = "-Wall -Wextra -pedantic\n"
+	initIgnoredDirs = "/.objs/\n/.dcc.d/\n/.tests/\n/.dmake-install-manifest\n/compile_commands.json\n"
+)
+
+func TestInitObjc(t *testing.T) {
+	fakeTool(t, "gnustep-config", "exit 1\n")
+	files := initProject(t, map[string]string{"main.m": "int main() { return 0; }\n"}, "exe")
+	checkInit(t, files, map[string]string{
+		".dcc/OBJCFLAGS": "-std=c11\n" + initWarnings + "-fobjc-arc\n" + initDebugFlags,
+		".dcc/LDFLAGS":   initReadByDcc,
+		".dcc/LIBS":      initReadByDcc + "-lobjc\n",
+	})
+
+	files = initProject(t, map[string]string{"app.mm": "int f() { return 0; }\n"}, "objc++", "lib", "release")
+	checkInit(t, files, map[string]string{
+		".dcc/OBJCXXFLAGS": "-std=c++14\n" + initWarnings + "-fobjc-arc\n-g\n-DNDEBUG\n-O2\n",
+	})
+}
+
+func TestInitStarterSources(t *testing.T) {
+	files := initProject(t, nil)
+	checkInit(t, files, map[string]string{
+		".dcc/CXXFLAGS": "-std=c++14\n" + initWarnings + initDebugFlags,
+		".dcc/LDFLAGS":  initReadByDcc,
+		".dcc/LIBS":     initReadByDcc,
+		"main.cpp":      "#include <iostream>\n\nint\nmain()\n{\n    std::cout << \"hello, world\\n\";\n    return 0;\n}\n",
+	})
+
+	t.Setenv("CC", "no-such-cc")
+	files = initProject(t, nil, "c11", "lib", "tests")
+	checkInit(t, files, map[string]string{
+		".dcc/CFLAGS": "-std=c11\n" + initWarnings + initDebugFlags,
+		".dmake":      "TESTS = tests/*.c\n",
+		"app.h": `#ifndef APP_H
+#define APP_H
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+int app_answer(void);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif // APP_H
+`,
+		"app.c":            "#include \"app.h\"\n\nint\napp_answer(void)\n{\n    return 42;\n}\n",
+		"tests/test_app.c": "#include <assert.h>\n#include \"../app.c\"\n\nint\nmain(void)\n{\n    assert(app_answer() == 42);\n    return 0;\n}\n",
+	})
+}
+
+func TestInitGitIgnore(t *testing.T) {
+	files := initProject(t, map[string]string{"main.c": "int main() { return 0; }\n"}, "prog", "-gitignore")
+	checkInit(t, files, map[string]string{
+		".dcc/CFLAGS": "-std=c11\n" + initWarnings + initDebugFlags,
+		".dmake":      "EXE = prog\n",
+		".gitignore":  initIgnoredDirs + "/prog\n",
+	})
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip(err)
+	}
+	for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(name, "A. Tester")
+	}
+	for _, name := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(name, "tester@example.com")
+	}
+	files = initProject(t, map[string]string{"app.c": "int f(void) { return 0; }\n"}, "-git")
+	checkInit(t, files, map[string]string{
+		".dcc/CFLAGS": "-std=c11\n" + initWarnings + initDebugFlags,
+		".gitignore":  initIgnoredDirs + "/libapp.a\n",
+	})
+	if _, err := os.Stat(".git"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInitFromExisting(t *testing.T) {
+	files := initProject(t, map[string]string{
+		"Makefile": "CFLAGS = -O2 -Wall -Iinclude\nLDLIBS = -lm\nprog: main.o util.o\n\t$(CC) -o $@ $^ $(LDLIBS)\n",
+		"main.c":   "int main() { return 0; }\n",
+		"util.c":   "\n",
+	}, "-from", "make")
+	checkInit(t, files, map[string]string{
+		".dcc/CFLAGS":  "-std=c11\n" + initWarnings + initDebugFlags + "-Iinclude\n",
+		".dcc/LDFLAGS": initReadByDcc,
+		".dcc/LIBS":    initReadByDcc + "-lm\n",
+		".dmake":       "EXE = prog\n",
+	})
+
+	t.Setenv("CC", "no-such-cc")
+	files = initProject(t, map[string]string{
+		cmakeListsFilename: "project(tool)\nset(CMAKE_C_STANDARD 99)\nadd_executable(tool src/main.c)\ntarget_link_libraries(tool m)\n",
+		"src/main.c":       "int main() { return 0; }\n",
+	}, "-from", "cmake")
+	checkInit(t, files, map[string]string{
+		".dcc/CFLAGS":  "-std=c99\n" + initWarnings + initDebugFlags,
+		".dcc/LDFLAGS": initReadByDcc,
+		".dcc/LIBS":    initReadByDcc + "-lm\n",
+		".dmake":       "EXE = tool\nSRCS = src/main.c\n",
+	})
+}
+
+func TestInitLanguageStandard(t *testing.T) {
+	t.Setenv("CC", "no-such-cc")
+	files := initProject(t, map[string]string{"main.c": "int main() { return 0; }\n"}, "gnu17")
+	checkInit(t, files, map[string]string{
+		".dcc/CFLAGS": "-std=gnu17\n" + initWarnings + initDebugFlags,
+	})
+
+	// A compiler that only knows C++23 by its provisional name.
+	t.Setenv("CXX", fakeTool(t, "fake-cxx", "case \"$*\" in *-std=c++23*) exit 1;; esac\n"))
+	files = initProject(t, map[string]string{"main.cpp": "int main() { return 0; }\n"}, "c++23")
+	checkInit(t, files, map[string]string{
+		".dcc/CXXFLAGS": "-std=c++2b\n" + initWarnings + initDebugFlags,
+	})
+}
+
+func TestInitPlugin(t *testing.T) {
+	files := initProject(t, map[string]string{"plugin.c": "int f(void) { return 0; }\n"}, "plugin")
+	checkInit(t, files, map[string]string{
+		".dcc/CFLAGS":  "-std=c11\n" + initWarnings + initDebugFlags,
+		".dcc/LDFLAGS": initReadByDcc + "-shared\n",
+		".dmake":       "PLUGIN = app\n",
+	})
+}
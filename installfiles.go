@@ -0,0 +1,102 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//  The INSTALL_FILES variable lists additional files installed along
+//  with the output, configuration files, desktop files and the like.
+//  Each is a file, or glob pattern, followed by "=" and the directory
+//  it's installed in, relative to the prefix unless absolute, and
+//  optionally ":" and the file's mode in octal, e.g.
+//
+//	INSTALL_FILES = foo.conf=etc:0644 foo.desktop=share/applications
+//
+//  Without a mode, executable files are installed with mode 0555 and
+//  others with mode 0444.
+//
+type InstallFileSpec struct {
+	pattern string
+	dest    string
+	mode    os.FileMode // zero if taken from the file
+}
+
+//  Return the files defined by the INSTALL_FILES variable.
+//
+func InstallFileSpecs(s string) ([]InstallFileSpec, error) {
+	var specs []InstallFileSpec
+	for _, field := range strings.Fields(s) {
+		eq := strings.Index(field, "=")
+		if eq < 1 || eq == len(field)-1 {
+			return nil, fmt.Errorf("INSTALL_FILES: %q: expected file=directory[:mode]", field)
+		}
+		spec := InstallFileSpec{pattern: field[:eq], dest: field[eq+1:]}
+		if colon := strings.LastIndex(spec.dest, ":"); colon != -1 {
+			if mode, err := strconv.ParseUint(spec.dest[colon+1:], 8, 32); err == nil {
+				spec.dest, spec.mode = spec.dest[:colon], os.FileMode(mode)
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+//  Return the mode a file is installed with.
+//
+func (spec InstallFileSpec) FileMode(path string) (os.FileMode, error) {
+	if spec.mode != 0 {
+		return spec.mode, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if info.Mode()&0111 != 0 {
+		return os.FileMode(0555), nil
+	}
+	return os.FileMode(0444), nil
+}
+
+//  Install the files named by the INSTALL_FILES variable.
+//
+func (dmake *Dmake) InstallExtraFiles(prefix string) error {
+	specs, err := InstallFileSpecs(dmake.vars.GetString("INSTALL_FILES"))
+	if err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		paths, err := filepath.Glob(spec.pattern)
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			return fmt.Errorf("INSTALL_FILES: %s: no such file", spec.pattern)
+		}
+		dest := filepath.FromSlash(spec.dest)
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(prefix, dest)
+		}
+		for _, path := range paths {
+			mode, err := spec.FileMode(path)
+			if err != nil {
+				return err
+			}
+			if err := dmake.InstallFile(path, dest, mode); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInstallFileSpecs(t *testing.T) {
+	specs, err := InstallFileSpecs("foo.conf=etc:0644 data/*.png=share/foo C:/x=C:/y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []InstallFileSpec{
+		{pattern: "foo.conf", dest: "etc", mode: 0644},
+		{pattern: "data/*.png", dest: "share/foo"},
+		{pattern: "C:/x", dest: "C:/y"},
+	}
+	if !reflect.DeepEqual(specs, expected) {
+		t.Errorf("specs %v, expected %v", specs, expected)
+	}
+	if _, err := InstallFileSpecs("foo.conf"); err == nil {
+		t.Error("expected an error for a file without a directory")
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script")
+	if err := os.WriteFile(script, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if mode, err := (InstallFileSpec{}).FileMode(script); err != nil || mode != 0555 {
+		t.Errorf("script mode %o, %v", mode, err)
+	}
+}
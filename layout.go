@@ -0,0 +1,101 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//  Installed files go in directories below the prefix, programs in
+//  bin, libraries in lib, header files in include and manual pages
+//  in share/man. Distributions have their own conventions, e.g. lib64
+//  or lib/x86_64-linux-gnu, so each may be changed by a variable,
+//  BINDIR, LIBDIR, INCLUDEDIR and MANDIR, or option, -bindir, -libdir,
+//  -includedir and -mandir. Relative directories are below the
+//  prefix, absolute ones are used as they are.
+//
+const (
+	defaultBinDir     = "bin"
+	defaultLibDir     = "lib"
+	defaultIncludeDir = "include"
+	defaultManDir     = "share/man"
+)
+
+//  Return an installation directory given by an option, a variable
+//  or its default, below the prefix unless it's absolute.
+//
+func (dmake *Dmake) installDirectory(prefix, option, name, defaultDir string) string {
+	dir := option
+	if dir == "" {
+		dir = dmake.vars.GetString(name)
+	}
+	if dir == "" {
+		dir = defaultDir
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(prefix, filepath.FromSlash(dir))
+}
+
+//  Return the directory programs are installed in.
+//
+func (dmake *Dmake) BinDir(prefix string) string {
+	return dmake.installDirectory(prefix, *bindirFlag, "BINDIR", defaultBinDir)
+}
+
+//  Return the directory libraries are installed in.
+//
+func (dmake *Dmake) LibDir(prefix string) string {
+	return dmake.installDirectory(prefix, *libdirFlag, "LIBDIR", defaultLibDir)
+}
+
+//  Return the directory header files are installed below.
+//
+func (dmake *Dmake) IncludeDir(prefix string) string {
+	return dmake.installDirectory(prefix, *includedirFlag, "INCLUDEDIR", defaultIncludeDir)
+}
+
+//  Return the directory manual pages are installed below.
+//
+func (dmake *Dmake) ManDir(prefix string) string {
+	return dmake.installDirectory(prefix, *mandirFlag, "MANDIR", defaultManDir)
+}
+
+//  Return the directory, relative to the prefix if it's below it, used
+//  in pkg-config files, e.g. ${prefix}/lib64.
+//
+func PkgConfigDirectory(dir, prefix string) string {
+	if rel, err := filepath.Rel(prefix, dir); err == nil && !strings.HasPrefix(rel, "..") {
+		return "${prefix}/" + filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(dir)
+}
+
+//  Install the manual pages named by the MANPAGES variable, each in
+//  the directory for its section, given by its suffix, e.g. prog.1
+//  goes in man1.
+//
+func (dmake *Dmake) InstallManPages(prefix string) error {
+	pages := strings.Fields(dmake.vars.GetString("MANPAGES"))
+	for _, path := range pages {
+		section := strings.TrimPrefix(filepath.Ext(path), ".")
+		if section == "" {
+			return fmt.Errorf("%s: a manual page's name must end with its section, e.g. prog.1", path)
+		}
+		dest := filepath.Join(dmake.ManDir(prefix), "man"+section[:1])
+		if err := dmake.InstallFile(path, dest, os.FileMode(0444)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
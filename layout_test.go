@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestInstallDirectories(t *testing.T) {
+	prefix := filepath.FromSlash("/usr/local")
+	dmake := &Dmake{vars: make(Vars)}
+	if dir := dmake.BinDir(prefix); dir != filepath.Join(prefix, "bin") {
+		t.Errorf("bin directory %q", dir)
+	}
+	if dir := dmake.ManDir(prefix); dir != filepath.Join(prefix, "share", "man") {
+		t.Errorf("man directory %q", dir)
+	}
+	dmake.vars.SetValue("LIBDIR", "lib/x86_64-linux-gnu")
+	libdir := dmake.LibDir(prefix)
+	if libdir != filepath.Join(prefix, "lib", "x86_64-linux-gnu") {
+		t.Errorf("lib directory %q", libdir)
+	}
+	if dir := PkgConfigDirectory(libdir, prefix); dir != "${prefix}/lib/x86_64-linux-gnu" {
+		t.Errorf("pkg-config lib directory %q", dir)
+	}
+	absolute := filepath.FromSlash("/opt/include")
+	dmake.vars.SetValue("INCLUDEDIR", absolute)
+	if dir := dmake.IncludeDir(prefix); dir != absolute {
+		t.Errorf("include directory %q, expected %q", dir, absolute)
+	}
+	if dir := PkgConfigDirectory(absolute, prefix); dir != "/opt/include" {
+		t.Errorf("pkg-config include directory %q", dir)
+	}
+}
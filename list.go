@@ -0,0 +1,89 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+//  Write a table describing what would be built in the receiver's
+//  directory and its sub-directories. Nothing is built, this is used
+//  to check dmake's inferences. With -json a target event is written
+//  for each target instead.
+//
+func (dmake *Dmake) ListAction(w io.Writer) error {
+	if *jsonFlag {
+		return dmake.Walk(".", func(dir string, d *Dmake) error {
+			targets, err := d.PreparedTargets()
+			if err != nil {
+				return AddDetail(err, "%s", dir)
+			}
+			for _, target := range targets {
+				description, err := target.TargetDescription()
+				if err != nil {
+					return AddDetail(err, "%s", dir)
+				}
+				EmitEvent(Event{Event: TargetEvent, Target: description})
+			}
+			return nil
+		})
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIRECTORY\tTYPE\tOUTPUT\tSOURCES\tLANGUAGE")
+	err := dmake.Walk(".", func(dir string, d *Dmake) error {
+		targets, err := d.PreparedTargets()
+		if err != nil {
+			return AddDetail(err, "%s", dir)
+		}
+		for _, target := range targets {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n",
+				dir,
+				target.outputtype,
+				target.OutputPath(),
+				len(target.sourceFiles),
+				target.Language())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+//  Return the description of the receiver written by "dmake -json
+//  list". The receiver must have been prepared.
+//
+func (dmake *Dmake) TargetDescription() (*TargetDescription, error) {
+	target, err := dmake.ExportTarget()
+	if err != nil {
+		return nil, err
+	}
+	description := &TargetDescription{
+		Type:     dmake.outputtype.String(),
+		Output:   filepath.ToSlash(target.output),
+		Language: dmake.Language().String(),
+		Sources:  []SourceDescription{},
+	}
+	for _, source := range target.sources {
+		options := source.options
+		if options == nil {
+			options = []string{}
+		}
+		description.Sources = append(description.Sources, SourceDescription{
+			Path:     filepath.ToSlash(source.path),
+			Language: source.language.String(),
+			Options:  options,
+		})
+	}
+	return description, nil
+}
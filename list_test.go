@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	inTempProject(t, map[string]string{
+		dmakeFileFilename: "DIRS = lib app\nDEPENDS(app) = lib\n",
+		"lib/lib.c":       "int f(void) { return 0; }\n",
+		"lib/util.c":      "int g(void) { return 0; }\n",
+		"app/main.cpp":    "int main() { return 0; }\n",
+	})
+	dmake := NewDmake("project", "", "")
+	if err := dmake.ReadDmakefile(); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := dmake.ListAction(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := `DIRECTORY  TYPE  OUTPUT  SOURCES  LANGUAGE
+lib        lib   lib.a   2        c
+app        exe   app     1        c++
+`
+	if s := b.String(); s != expected {
+		t.Errorf("listed\n%s\nexpected\n%s", s, expected)
+	}
+}
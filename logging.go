@@ -0,0 +1,217 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+//  dmake's messages have a level, errors and warnings are always
+//  shown, informational messages unless -quiet is used, verbose
+//  messages with -v and debugging messages with -debug. Messages are
+//  prefixed with the directory being built, relative to the directory
+//  dmake was started in, e.g. "dmake[lib/util]: warning: ...". Levels
+//  are colored when standard error is a terminal, unless -no-color
+//  is used or NO_COLOR is set.
+//
+type LogLevel int
+
+const (
+	ErrorLevel LogLevel = iota
+	WarnLevel
+	InfoLevel
+	VerboseLevel
+	DebugLevel
+)
+
+//  A child dmake, run to build a sub-directory concurrently, prefixes
+//  its messages with the directory named by this environment variable,
+//  its directory relative to the top directory.
+//
+const logDirectoryEnvVar = "DMAKELOGDIR"
+
+//  The label and color of each level's messages.
+//
+var logLevels = [...]struct {
+	label string
+	color string
+}{
+	ErrorLevel:   {"error: ", "\x1b[1;31m"},
+	WarnLevel:    {"warning: ", "\x1b[1;33m"},
+	InfoLevel:    {"", ""},
+	VerboseLevel: {"", ""},
+	DebugLevel:   {"debug: ", "\x1b[2m"},
+}
+
+const resetColor = "\x1b[0m"
+
+//  A Logger writes dmake's messages.
+//
+type Logger struct {
+	sync.Mutex
+	w         io.Writer
+	level     LogLevel // messages above this level aren't written
+	color     bool     // color the labels
+	directory string   // the directory prefixed to every message
+}
+
+var logger = &Logger{
+	w:         os.Stderr,
+	level:     InfoLevel,
+	color:     ColorTerminal(os.Stderr),
+	directory: os.Getenv(logDirectoryEnvVar),
+}
+
+//  Return true if messages written to a file should be colored.
+//
+func ColorTerminal(f *os.File) bool {
+	if _, found := os.LookupEnv("NO_COLOR"); found || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	if os.Getenv("CLICOLOR_FORCE") == "1" {
+		return true
+	}
+	if runtime.GOOS == "windows" && os.Getenv("WT_SESSION") == "" && os.Getenv("TERM") == "" {
+		return false
+	}
+	return IsTerminal(f)
+}
+
+//  Return true if a file is a terminal.
+//
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+//  Set the logger's level and color from the options.
+//
+func (l *Logger) Configure() {
+	l.Lock()
+	defer l.Unlock()
+	switch {
+	case *debugFlag:
+		l.level = DebugLevel
+	case *verboseFlag:
+		l.level = VerboseLevel
+	case *quietFlag:
+		l.level = WarnLevel
+	}
+	if *noColorFlag {
+		l.color = false
+	}
+}
+
+//  Return the environment for a child dmake building a sub-directory,
+//  whose output is collected rather than written to the terminal.
+//
+func (l *Logger) ChildEnvironment(env []string, path string) []string {
+	env = SetEnv(env, logDirectoryEnvVar, l.Directory(path))
+	if l.color {
+		env = SetEnv(env, "CLICOLOR_FORCE", "1")
+	}
+	return env
+}
+
+//  Return the name of a directory, relative to the current directory,
+//  used in messages.
+//
+func (l *Logger) Directory(path string) string {
+	dir := path
+	if cwd, err := os.Getwd(); err == nil && topDirectory != "" {
+		if rel, err := filepath.Rel(topDirectory, filepath.Join(cwd, path)); err == nil {
+			dir = rel
+		}
+	}
+	return filepath.ToSlash(filepath.Join(l.directory, dir))
+}
+
+//  Return true if messages of a level are written.
+//
+func (l *Logger) Enabled(level LogLevel) bool {
+	return level <= l.level
+}
+
+//  Return a message formatted for output.
+//
+func (l *Logger) Format(level LogLevel, directory, message string) string {
+	var b strings.Builder
+	b.WriteString("dmake")
+	if directory != "" && directory != "." {
+		b.WriteString("[" + directory + "]")
+	}
+	b.WriteString(": ")
+	label, color := logLevels[level].label, logLevels[level].color
+	if l.color && color != "" {
+		if level == DebugLevel {
+			label += message
+			message = ""
+		}
+		label = color + label + resetColor
+	}
+	b.WriteString(label)
+	b.WriteString(message)
+	if !strings.HasSuffix(message, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+//  Write a message at a level.
+//
+func (l *Logger) Log(level LogLevel, message string) {
+	if !l.Enabled(level) {
+		return
+	}
+	s := l.Format(level, l.Directory("."), message)
+	progress.Clear()
+	l.Lock()
+	defer l.Unlock()
+	io.WriteString(l.w, s)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.Log(ErrorLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.Log(WarnLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.Log(InfoLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Verbosef(format string, args ...interface{}) {
+	l.Log(VerboseLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.Log(DebugLevel, fmt.Sprintf(format, args...))
+}
+
+//  Write an error, formatted as by fmt.Sprint, and exit.
+//
+func (l *Logger) Fatal(args ...interface{}) {
+	l.Log(ErrorLevel, fmt.Sprint(args...))
+	os.Exit(1)
+}
+
+//  Write an error and exit.
+//
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.Log(ErrorLevel, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
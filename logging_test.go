@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoggerFormat(t *testing.T) {
+	l := &Logger{level: InfoLevel}
+	if s := l.Format(WarnLevel, "lib/util", "no tests defined"); s != "dmake[lib/util]: warning: no tests defined\n" {
+		t.Errorf("warning formatted as %q", s)
+	}
+	if s := l.Format(InfoLevel, ".", "wrote foo.zip"); s != "dmake: wrote foo.zip\n" {
+		t.Errorf("message formatted as %q", s)
+	}
+	l.color = true
+	if s := l.Format(ErrorLevel, "", "failed"); s != "dmake: \x1b[1;31merror: \x1b[0mfailed\n" {
+		t.Errorf("colored error formatted as %q", s)
+	}
+	if l.Enabled(VerboseLevel) || !l.Enabled(WarnLevel) {
+		t.Error("levels enabled incorrectly")
+	}
+
+	var b strings.Builder
+	l = &Logger{w: &b, level: WarnLevel}
+	l.Infof("hidden")
+	l.Warnf("shown %d", 1)
+	if !strings.HasSuffix(b.String(), "warning: shown 1\n") || strings.Contains(b.String(), "hidden") {
+		t.Errorf("logged %q", b.String())
+	}
+}
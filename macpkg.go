@@ -0,0 +1,65 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+//  dmake package -pkg makes a macOS installer package,
+//  <name>-<version>.pkg, using pkgbuild. The files are installed into
+//  a staging directory, under /usr/local unless a PREFIX is defined,
+//  which pkgbuild packages to be installed relative to /. The
+//  package's identifier is defined by the PKG_ID variable, otherwise
+//  BUNDLE_ID or the project's name, and its version by VERSION.
+//
+const (
+	macPackageFormat = "pkg"
+	macDefaultPrefix = "/usr/local"
+)
+
+//  Make a macOS installer package of the files the receiver installs.
+//
+func (dmake *Dmake) MacPackage(env []string, version string) error {
+	identifier := dmake.vars.GetString("PKG_ID")
+	if identifier == "" {
+		identifier = dmake.vars.GetString("BUNDLE_ID")
+	}
+	if identifier == "" {
+		identifier = dmake.defaultoutput
+	}
+	if dmake.installprefix == "" {
+		dmake.installprefix = macDefaultPrefix
+	}
+	filename := dmake.BuildPath(dmake.defaultoutput + "-" + version + ".pkg")
+	return dmake.StagedInstall(env, func(stage string) error {
+		pkgbuild := Getenv("PKGBUILD", "pkgbuild")
+		args := []string{
+			"--root", stage,
+			"--identifier", identifier,
+			"--version", version,
+			"--install-location", "/",
+			filename,
+		}
+		if DryRun(pkgbuild, args...) {
+			return nil
+		}
+		logger.Verbosef("RUN: %s %s", pkgbuild, ShellJoin(args))
+		cmd := exec.Command(pkgbuild, args...)
+		cmd.Env = env
+		cmd.Stdout, cmd.Stderr = CommandOutput(), os.Stderr
+		if err := RunCommand(cmd, filename); err != nil {
+			return fmt.Errorf("%s: %v", pkgbuild, err)
+		}
+		logger.Infof("wrote %s", filename)
+		return nil
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMacPackage(t *testing.T) {
+	inTempProject(t, map[string]string{
+		dmakeFileFilename: "VERSION = 1.2\nBUNDLE_ID = org.example.prog\n",
+		"main.c":          "int main() { return 0; }\n",
+	})
+	// The fake pkgbuild logs its arguments and the staged files, which
+	// are removed once it's run.
+	pkgbuild := fakeTool(t, "pkgbuild", `echo "$@" > pkgbuild.log
+(cd "$2" && find . -type f) >> pkgbuild.log
+: > "$9"
+`)
+	t.Setenv("PKGBUILD", pkgbuild)
+	dmake, _ := builtProgram(t, "")
+	saved := packageFormat
+	defer func() { packageFormat = saved }()
+	packageFormat = macPackageFormat
+	if err := dmake.PackageAction(os.Environ()); err != nil {
+		t.Fatal(err)
+	}
+	log, _ := os.ReadFile("pkgbuild.log")
+	lines := strings.Split(strings.TrimSpace(string(log)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("pkgbuild run as\n%s", log)
+	}
+	args := strings.Fields(lines[0])
+	if len(args) != 9 || args[0] != "--root" || strings.Join(args[2:], " ") != "--identifier org.example.prog --version 1.2 --install-location / prog-1.2.pkg" {
+		t.Errorf("pkgbuild arguments %q", args)
+	}
+	if _, err := os.Stat(args[1]); !os.IsNotExist(err) {
+		t.Errorf("staging directory %s not removed", args[1])
+	}
+	if expected := "./" + strings.TrimPrefix(macDefaultPrefix, "/") + "/bin/prog"; lines[1] != expected {
+		t.Errorf("staged %s, expected %s", lines[1], expected)
+	}
+	if _, err := os.Stat("prog-1.2.pkg"); err != nil {
+		t.Error(err)
+	}
+}
@@ -9,44 +9,112 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"time"
 )
 
 var (
-	langflag Language = UnknownLanguage
+	langflag    Language = UnknownLanguage
+	dccArgsFlag StringList
 
 	chdir                    = flag.String("C", "", "Change to `directory` before doing anything.")
+	builddirFlag             = flag.String("B", "", "Put objects and outputs in the build `directory`.")
+	cacheFlag                = flag.Bool("cache", false, "Compile using ccache or sccache, if found.")
+	distccFlag               = flag.Bool("distcc", false, "Distribute compilation using distcc or icecc, if found.")
 	dllFlag                  = flag.Bool("dll", false, "Implicitly create DLLs instead of static libraries.")
 	pluginFlag               = flag.Bool("plugin", false, "Implicitly create plugins instead of static libraries.")
 	keepGoingFlag            = flag.Bool("k", false, "Keep going. Don't stop on first error.")
+	dryRunFlag               = flag.Bool("n", false, "Print the commands that would be run but don't run them.")
+	embedVersionFlag         = flag.Bool("embed-version", false, "Define DMAKE_VERSION and DMAKE_BUILD_DATE when compiling.")
+	jsonFlag                 = flag.Bool("json", false, "Write build events to stdout as JSON lines.")
+	timeFlag                 = flag.Bool("time", false, "Report how long each directory and dcc invocation took.")
+	modeFlag                 = flag.String("mode", "", "Build using the named `mode`, e.g. debug or release.")
+	sanitizeFlag             = flag.String("sanitize", "", "Build with the `sanitizers`, e.g. address,undefined.")
+	jobsFlag                 = flag.Int("j", runtime.NumCPU(), "Build up to `N` sub-directories concurrently.")
 	oFlag                    = flag.String("o", "", "Define output `filename`.")
+	bindirFlag               = flag.String("bindir", "", "Install programs in `dir`, relative to the prefix unless absolute.")
+	libdirFlag               = flag.String("libdir", "", "Install libraries in `dir`, relative to the prefix unless absolute.")
+	includedirFlag           = flag.String("includedir", "", "Install header files below `dir`, relative to the prefix unless absolute.")
+	mandirFlag               = flag.String("mandir", "", "Install manual pages below `dir`, relative to the prefix unless absolute.")
 	prefixFlag               = flag.String("prefix", Getenv("PREFIX", ""), "Installation `path` prefix.")
 	debugFlag                = flag.Bool("debug", false, "Enable dmake debug output.")
 	dccdebugFlag             = flag.Bool("dcc-debug", false, "Enable dcc debug output")
+	dccFlag                  = flag.String("dcc", "", "Use `command` as dcc. Overrides the DCC environment and .dmake variables.")
 	verboseFlag              = flag.Bool("v", false, "Issue messages.")
 	versionFlag              = flag.Bool("version", false, "Report version and exit.")
 	quietFlag                = flag.Bool("quiet", false, "Avoid output")
+	noColorFlag              = flag.Bool("no-color", false, "Don't color messages.")
+	targetFlag               = flag.String("target", "", "Build for the `os/arch` target, e.g. windows/amd64, or profile, e.g. mingw.")
 	writeCompileCommandsFlag = flag.Bool("write-compile-commands", false, "Have dcc generate a compile_commands.json file.")
+	werrorFlag               = flag.Bool("Werror", false, "Treat clang-tidy's warnings, and analyzers' problems, as errors.")
+	signFlag                 = flag.String("sign", "", "Sign macOS outputs using codesign with the `identity`, - signs ad-hoc.")
+	staticFlag               = flag.Bool("static", false, "Link programs statically.")
+	targetsFlag              = flag.String("targets", "", "Build for each of the comma separated `targets`, e.g. linux/amd64,windows/amd64.")
+	toolchainFlag            = flag.String("toolchain", "", "Build using the toolchain described by the `file`.")
+	stripFlag                = flag.Bool("strip", false, "Strip installed programs and shared libraries.")
+	cleanEnvFlag             = flag.Bool("E", false, "Run commands with a clean environment, only PATH, HOME and the like, and those defined by .env.")
+	keepEnvFlag              = flag.String("keep-env", "", "Keep the comma separated environment `variables` when using -E.")
+	sudoFlag                 = flag.Bool("sudo", false, "Install using sudo, or doas, if the prefix isn't writable.")
+	noBuildFlag              = flag.Bool("no-build", false, "Install what's already built, without building it.")
+	splitDebugFlag           = flag.Bool("split-debug", false, "Split debug information into separate files when stripping.")
+	sarifFlag                = flag.String("sarif", "", "Have dmake analyze write its results as SARIF to `file`.")
+	reproducibleFlag         = flag.Bool("reproducible", false, "Build reproducibly, the same sources give byte-identical outputs.")
+	buildInfoFlag            = flag.Bool("build-info", false, "Write a build-info.json describing the outputs built.")
+	ciAnnotationsFlag        = flag.String("ci-annotations", "", "Annotate compiler diagnostics for the CI `system`, github, gitlab or auto.")
+	noDaemonFlag             = flag.Bool("no-daemon", false, "Build without using a running dmake daemon.")
+	noConfigFlag             = flag.Bool("no-config", false, "Use only the options given, ignoring configuration files, DMAKEFLAGS and .env.")
 
-	depsdir = Getenv("DCCDEPS", defaultDepsFileDir)
-	objsdir = Getenv("OBJDIR", defaultObjFileDir)
+	// Arguments passed to the program by "dmake run".
+	//
+	runArgs []string
+
+	// Variables defined by NAME=VALUE command line arguments.
+	// They override those defined by .dmake files.
+	//
+	commandLineVars = make(Vars)
+
+	// The build file format written by "dmake export".
+	//
+	exportFormat string
+
+	// The address at which "dmake docs -serve" serves the HTML.
+	//
+	docsServeAddress string
 )
 
-func main() {
-	log.SetFlags(0)
-	log.SetPrefix("dmake: ")
+//  The environment variable holding options used by every dmake run.
+//
+const dmakeFlagsEnvVar = "DMAKEFLAGS"
 
+func main() {
 	action := DefaultAction
-	env := os.Environ()
 
 	flag.Var(&langflag, "lang", "Assume all source files are `lang` (one of 'c', 'c++', 'objc', 'objc++')")
+	flag.StringVar(builddirFlag, "builddir", "", "Same as -B.")
+	flag.Var(&dccArgsFlag, "dcc-arg", "Pass `arg` to dcc. May be repeated.")
 
 	flag.Usage = outputUsage
-	flag.Parse()
+	environ := os.Environ()
+	if err := parseFlags(os.Args[1:]); err != nil {
+		logger.Fatal(err)
+	}
+	configDir := *chdir
+	if configDir == "" {
+		configDir = "."
+	}
+	if !*noConfigFlag {
+		if err := ReadConfigFiles(configDir); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	env := os.Environ()
 
 	if *versionFlag {
 		fmt.Print(versionNumber)
@@ -56,32 +124,148 @@ func main() {
 	if *debugFlag {
 		*verboseFlag = true
 	}
+	logger.Configure()
+
+	if flag.NArg() > 0 && flag.Arg(0) == "daemon" {
+		if err := DaemonAction(*chdir, flag.Args()[1:]); err != nil {
+			logger.Fatal(err)
+		}
+		os.Exit(0)
+	}
+	if status, done := ForwardToDaemon(environ); done {
+		os.Exit(status)
+	}
+	if socket := os.Getenv(daemonEnvVar); socket != "" {
+		client, err := ConnectDaemon(socket)
+		if err != nil {
+			logger.Debugf("%s: %v", socket, err)
+		}
+		daemonClient = client
+	}
+
+	if err := StartAnnotations(*ciAnnotationsFlag); err != nil {
+		logger.Fatal(err)
+	}
+
+	if *targetsFlag != "" {
+		if *targetFlag != "" {
+			logger.Fatal("-target and -targets can't be used together")
+		}
+		targets, err := MatrixTargets(*targetsFlag)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		results, err := RunMatrix(targets, flag.Args(), os.Environ())
+		if err != nil {
+			logger.Fatal(err)
+		}
+		fmt.Fprintln(os.Stderr)
+		if failures := SummarizeMatrix(os.Stderr, results); failures > 0 {
+			logger.Warnf("%d of %d targets failed", failures, len(targets))
+			if failures > 125 {
+				failures = 125
+			}
+			os.Exit(failures)
+		}
+		os.Exit(0)
+	}
+
+	if *targetFlag != "" {
+		if err := SetTarget(*targetFlag); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	if *toolchainFlag != "" {
+		if err := LoadToolchainFile(*toolchainFlag); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	if *modeFlag != "" {
+		if err := SetMode(*modeFlag); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	if *sanitizeFlag != "" {
+		if err := SetSanitizers(*sanitizeFlag); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	if *staticFlag {
+		SetStatic()
+	}
 
 	if *chdir != "" {
 		if err := os.Chdir(*chdir); err != nil {
-			log.Fatal(err)
+			logger.Fatal(err)
 		}
 	}
 
 	cwd, err := os.Getwd()
 	if err != nil {
-		log.Fatal(err)
+		logger.Fatal(err)
+	}
+
+	// Anything after a "--" is passed, verbatim, to the program
+	// run by "dmake run".
+	//
+	cmdArgs := flag.Args()
+	for i, arg := range cmdArgs {
+		if arg == "--" {
+			runArgs = cmdArgs[i+1:]
+			cmdArgs = cmdArgs[:i]
+			break
+		}
 	}
 
 	// Collect command line arguments and add any <name>=<value>
-	// to the environment slice passed to dcc.
+	// to the environment slice passed to dcc and to the variables
+	// overriding those in .dmake files.
 	//
-	args := make([]string, 0, flag.NArg())
-	for _, arg := range flag.Args() {
+	args := make([]string, 0, len(cmdArgs))
+	var assignments []string
+	for _, arg := range cmdArgs {
 		eq := strings.Index(arg, "=")
-		if eq < 1 { // -1 or 0
+		if eq < 1 || arg[0] == '-' { // -1 or 0, or an option such as docs' -serve=addr
 			args = append(args, arg)
 		} else { // arg of form <name>=<value>
-			env = append(env, arg)
+			assignments = append(assignments, arg)
+			commandLineVars.SetValue(arg[:eq], arg[eq+1:])
+		}
+	}
+
+	if workspace, err = FindWorkspace(cwd); err != nil {
+		logger.Fatal(err)
+	}
+
+	root := cwd
+	if workspace != nil {
+		root = workspace.root
+	}
+	if !*noConfigFlag {
+		if err = ControlEnvironment(root); err != nil {
+			logger.Fatal(err)
 		}
 	}
+	if *reproducibleFlag {
+		if err = SetReproducible(root); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	env = append(os.Environ(), assignments...)
+	if workspace != nil {
+		workspaceVars = workspace.vars
+	}
 
 	dmake := NewDmake(cwd, *oFlag, *prefixFlag)
+	if *builddirFlag != "" {
+		if dmake.builddir, err = filepath.Abs(*builddirFlag); err != nil {
+			logger.Fatal(err)
+		}
+	}
 	initArgsIndex := -1
 
 loop:
@@ -113,6 +297,133 @@ loop:
 				os.Exit(1)
 			}
 			action = Cleaning
+		case "test":
+			if action != DefaultAction {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Testing
+			if argi+1 < len(args) && args[argi+1] == "-valgrind" {
+				valgrindFlag = true
+				break loop
+			}
+		case "uninstall":
+			if action != DefaultAction {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Uninstalling
+		case "run":
+			if action != DefaultAction {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Running
+		case "debug":
+			if action != DefaultAction {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Debugging
+			if buildMode == "" {
+				if err := SetMode(debugModeName); err != nil {
+					logger.Fatal(err)
+				}
+			}
+		case "graph":
+			if action != DefaultAction {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Graphing
+		case "list":
+			if action != DefaultAction {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Listing
+		case "explain":
+			if action != DefaultAction {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Explaining
+		case "flags":
+			if action != DefaultAction || argi+1 == len(args) {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Flagging
+			flagsFiles = args[argi+1:]
+			break loop
+		case "doctor":
+			if action != DefaultAction {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Diagnosing
+		case "coverage":
+			if action != DefaultAction {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Covering
+			SetCoverage()
+		case "tidy":
+			if action != DefaultAction {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Tidying
+			*writeCompileCommandsFlag = true
+		case "analyze":
+			if action != DefaultAction {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Analyzing
+		case "package":
+			if action != DefaultAction {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Packaging
+			if argi+1 < len(args) && strings.HasPrefix(args[argi+1], "-") {
+				packageFormat = args[argi+1][1:]
+				if !Contains(packageFormats, packageFormat) {
+					logger.Fatalf("%q: unsupported package format, use one of -%s", packageFormat, strings.Join(packageFormats, ", -"))
+				}
+				break loop
+			}
+		case "export":
+			if action != DefaultAction || argi+1 != len(args)-1 {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Exporting
+			exportFormat = args[argi+1]
+			if !Contains(exportFormats, exportFormat) {
+				logger.Fatalf("%q: unsupported export format, use one of %s", exportFormat, strings.Join(exportFormats, ", "))
+			}
+			break loop
+		case "docs":
+			if action != DefaultAction || argi+2 < len(args) {
+				flag.Usage()
+				os.Exit(1)
+			}
+			action = Documenting
+			if argi+1 < len(args) {
+				switch serve := args[argi+1]; {
+				case serve == "-serve":
+					docsServeAddress = defaultDocsAddress
+				case strings.HasPrefix(serve, "-serve="):
+					docsServeAddress = strings.TrimPrefix(serve, "-serve=")
+				default:
+					flag.Usage()
+					os.Exit(1)
+				}
+			}
+			break loop
 		case "dll":
 			dmake.SetOutputType(DllOutputType)
 		case "plugin":
@@ -121,19 +432,31 @@ loop:
 			dmake.SetOutputType(ExeOutputType)
 		case "lib":
 			dmake.SetOutputType(LibOutputType)
+		case "exes":
+			dmake.autoExes = true
 		default:
-			dmake.AddDirectory(arg)
+			if workspace.IsRoot(cwd) && workspace.HasProject(arg) {
+				dmake.projects = append(dmake.projects, arg)
+			} else if info, err := os.Stat(arg); err == nil && info.IsDir() {
+				dmake.AddDirectory(arg)
+			} else {
+				dmake.targetNames = append(dmake.targetNames, arg)
+			}
 		}
 	}
 
 	if dmake.HaveDirs() && *oFlag != "" {
-		log.Fatal("-o flag not permitted when building directories")
+		logger.Fatal("-o flag not permitted when building directories")
+	}
+
+	if dmake.autoExes && *oFlag != "" {
+		logger.Fatal("-o flag not permitted when building an executable per main")
 	}
 
 	if action == Initing {
-		err = dmake.InitAction(args[initArgsIndex:], cwd)
+		err = dmake.InitAction(args[initArgsIndex:], cwd, os.Stdin, os.Stdout)
 		if err != nil {
-			log.Fatal(err)
+			logger.Fatal(err)
 		}
 		os.Exit(0)
 	}
@@ -142,20 +465,121 @@ loop:
 		action = Building
 	}
 
-	if err = dmake.ReadDmakefile(); err != nil {
-		log.Fatal(err)
+	// The doctor reports problems reading the .dmake file itself.
+	//
+	if action != Diagnosing {
+		if err = dmake.ReadDmakefile(); err != nil {
+			logger.Fatal(err)
+		}
 	}
 
+	// Find out if installing needs more privileges before building
+	// anything, in this directory or its sub-directories. With -sudo
+	// only the install is privileged, and only an unwritable install
+	// directory needs it, other errors are reported.
+	//
+	privileged := false
+	if action == Installing && !*noBuildFlag && !*dryRunFlag {
+		if err = dmake.CheckInstallRoot(); err != nil {
+			if !*sudoFlag || !errors.Is(err, os.ErrPermission) {
+				logger.Fatal(err)
+			}
+			privileged = true
+			action = Building
+		}
+	}
+
+	HandleSignals()
+	topDirectory = cwd
+	started := time.Now()
+	EmitEvent(Event{Event: BuildStartEvent, Action: action.String()})
 	err = dmake.Run(action, env)
+	if err == nil && privileged {
+		err = PrivilegedInstall(flag.Args())
+	}
+	EmitFinishEvent(Event{Event: BuildFinishEvent, Directory: cwd, Action: action.String()}, started, err)
+	if err := annotations.Finish(); err != nil {
+		logger.Errorf("%v", err)
+	}
+	if *timeFlag {
+		if path := os.Getenv(timingsEnvVar); path != "" {
+			if err := WriteTimings(path); err != nil {
+				logger.Errorf("%v", err)
+			}
+		} else {
+			ReportTimings(os.Stderr, time.Since(started))
+		}
+	}
+	if _, ok := err.(*exec.ExitError); ok && (action == Running || action == Debugging) {
+		os.Exit(ExitStatus(action, err))
+	}
+	if errs, ok := err.(DirectoryErrors); ok {
+		fmt.Fprintln(os.Stderr)
+		errs.Summarize(os.Stderr)
+		logger.Errorf("%v", errs)
+		os.Exit(ExitStatus(action, err))
+	}
 	if err != nil {
-		log.Fatal(err)
+		logger.Fatal(err)
 	}
 
 	os.Exit(0)
 }
 
+//  Return dmake's exit status after performing an action. Running, or
+//  debugging, a program exits with the program's status. When
+//  sub-directories fail the exit status tells scripts how many did,
+//  up to 125. Any other error is 1.
+//
+func ExitStatus(action Action, err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && (action == Running || action == Debugging) {
+		return exitErr.ExitCode()
+	}
+	if errs, ok := err.(DirectoryErrors); ok {
+		if len(errs) > 125 {
+			return 125
+		}
+		return len(errs)
+	}
+	return 1
+}
+
+//  Parse the options defined by the DMAKEFLAGS environment variable,
+//  defaults for every dmake run, then those on the command line,
+//  which take precedence. DMAKEFLAGS is removed from the environment
+//  as the options are passed on to sub-directories explicitly, and
+//  ignored with -no-config.
+//
+func parseFlags(args []string) error {
+	if Contains(args, "-no-config") {
+		os.Unsetenv(dmakeFlagsEnvVar)
+	}
+	if defaults := ShellWords(os.Getenv(dmakeFlagsEnvVar)); len(defaults) > 0 {
+		if err := flag.CommandLine.Parse(defaults); err != nil {
+			return err
+		}
+		if flag.NArg() > 0 {
+			return fmt.Errorf("%s: %q isn't an option, only options may be used", dmakeFlagsEnvVar, flag.Arg(0))
+		}
+		os.Unsetenv(dmakeFlagsEnvVar)
+	}
+	return flag.CommandLine.Parse(args)
+}
+
 func outputUsage() {
-	fmt.Fprintln(os.Stderr, "usage: dmake [options] [{exe|lib|dll|plugin} [install|clean]]")
+	fmt.Fprintln(os.Stderr, "usage: dmake [options] [{exe|exes|lib|dll|plugin} [install|uninstall|clean|test|coverage|tidy|analyze|package]]")
+	fmt.Fprintln(os.Stderr, "       dmake [options] run [-- args...]")
+	fmt.Fprintln(os.Stderr, "       dmake [options] test -valgrind")
+	fmt.Fprintln(os.Stderr, "       dmake [options] debug [-- args...]")
+	fmt.Fprintln(os.Stderr, "       dmake [options] export {"+strings.Join(exportFormats, "|")+"}")
+	fmt.Fprintln(os.Stderr, "       dmake [options] {graph|list|explain|doctor}")
+	fmt.Fprintln(os.Stderr, "       dmake [options] flags file...")
+	fmt.Fprintln(os.Stderr, "       dmake [options] docs [-serve[=address]]")
+	fmt.Fprintln(os.Stderr, "       dmake [options] daemon [-stop|-http[=address]]")
+	fmt.Fprintln(os.Stderr, "       dmake [options] package [-deb|-zip|-pkg]")
 	fmt.Fprintln(os.Stderr, "       dmake [options] path...")
 	fmt.Fprintln(os.Stderr, "       dmake [options] init [<init-options>...]")
 	fmt.Fprintln(os.Stderr, `
@@ -163,21 +587,91 @@ The first form builds, installs or cleans the specified module type located
 in the current directory. Building and cleaning do the obvious things and
 invoke the dcc command to perform the actual building or cleaning.
 
-The install target runs the "/usr/bin/install" program to copy the program
-or library to the appropriate installation directory under some "prefix"
+The install target copies the program or library to the
+appropriate installation directory under some "prefix"
 directory, defined by the -prefix option. The default prefix is "/usr/local"
 so, by default, executables install under /usr/local/bin and libraries go
-under /usr/local/lib.
+under /usr/local/lib. Every file installed is recorded in a manifest
+file, .dmake-install-manifest, in the build directory when -B is used,
+and the uninstall target removes the files it lists.
+
+The run target builds the program and then runs it, passing it any
+arguments following a "--". dmake exits with the program's exit status.
+The debug target builds the program, in the debug mode unless -mode is
+used, and runs it under gdb or lldb, or $DEBUGGER, with the arguments
+following a "--".
+
+The test target builds the module then builds and runs the test programs
+defined by the .dmake TESTS variable, reporting which tests passed and
+failed. With "dmake test -valgrind" the tests are run under
+valgrind's memcheck and fail if it finds memory errors or leaks. The
+coverage target builds and runs the tests with coverage
+instrumentation and reports how much of the sources they executed.
+The tidy target builds the module and runs clang-tidy over its sources.
+The analyze target builds the module and runs a static analyzer, cppcheck
+or clang's, over its sources. The package target makes tarballs of the
+sources and of the files installed, <name>-<version>.tar.gz and
+<name>-<version>-<os>-<arch>.tar.gz, the version being defined by the
+.dmake VERSION variable. "dmake package -deb" instead makes a Debian
+package, -zip a ZIP archive and -pkg a macOS installer package.
 
 The second form runs dmake in each of the named directories. No options
 may be specified so dmake's module inference is used when building.
-Further control is acheived by creating .dmake files.
+Further control is acheived by creating .dmake files. In the root of a
+workspace, defined by a dmake.work file, the paths may instead name
+projects, which are built along with the projects they depend upon.
+Arguments that aren't directories name targets, e.g. "dmake build libfoo",
+found in the .dmake files of the current directory and its sub-directories,
+and only they and the directories they depend upon are built.
+
+dmake export
+
+The export form writes a build file for another build tool describing
+the compile and link steps dmake would have dcc perform, build.ninja for
+ninja, CMakeLists.txt for cmake and Makefile.dmake for make, used via
+"make -f Makefile.dmake". The Makefile made by "dmake init", which runs
+dmake, isn't replaced. Sub-directories are exported to their own build
+files.
+
+dmake docs
+
+The docs form runs doxygen, writing a minimal Doxyfile if there isn't
+one, and puts the HTML in docs/html. With -serve the HTML is then
+served at localhost:8000, or the given address, e.g. -serve=:8080.
+
+dmake graph
+
+The graph form prints a Graphviz DOT description of the directories,
+the targets they build and the dependencies between directories,
+e.g. "dmake graph | dot -Tsvg > graph.svg".
+
+The list form prints what dmake would build, each directory's
+targets, their output type and filename and the number and language
+of their source files, without building anything.
+
+The explain form reports whether each target is up to date and, if
+not, why it would be rebuilt, the sources and headers that have
+changed, changed options files and missing objects.
+
+The flags form prints the command used to compile each of the source
+files, run in the directory of the target compiling it.
+
+The doctor form checks the environment dmake builds in, that dcc, the
+compilers and other tools are found and run, that .dmake and .dcc files
+can be read and the objects and installation directories written, and
+reports any problems and how they may be fixed.
 
 dmake init
 
 The third form of running dmake initializes a project's directory, creating
 dcc option files and a simple Makefile to direct everything using conventional
-make targets that invoke dmake appropriately.`,
+make targets that invoke dmake appropriately. With -template <name> the
+files of a project skeleton in ~/.config/dmake/templates/<name> are copied
+first, with @NAME@ style variables replaced.
+
+Options in the DMAKEFLAGS environment variable are used before those on
+the command line, e.g. DMAKEFLAGS="-j 4 -quiet". Defaults for options may also
+be set by ~/.config/dmake/config and a project's .dmake.conf.`,
 	)
 	fmt.Fprintln(os.Stderr)
 	flag.PrintDefaults()
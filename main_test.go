@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	savedKeepGoing, savedPrefix, savedMode, savedNoConfig := *keepGoingFlag, *prefixFlag, *modeFlag, *noConfigFlag
+	defer func() {
+		*keepGoingFlag, *prefixFlag, *modeFlag, *noConfigFlag = savedKeepGoing, savedPrefix, savedMode, savedNoConfig
+		flag.CommandLine.Parse(nil)
+	}()
+
+	t.Setenv(dmakeFlagsEnvVar, `-k -prefix "/opt/my tools" -mode=debug`)
+	if err := parseFlags([]string{"-mode", "release", "install"}); err != nil {
+		t.Fatal(err)
+	}
+	if !*keepGoingFlag {
+		t.Error("-k from DMAKEFLAGS not set")
+	}
+	if *prefixFlag != "/opt/my tools" {
+		t.Errorf("prefix %q, expected the quoted DMAKEFLAGS prefix", *prefixFlag)
+	}
+	if *modeFlag != "release" {
+		t.Errorf("mode %q, expected the command line's release", *modeFlag)
+	}
+	if args := flag.Args(); len(args) != 1 || args[0] != "install" {
+		t.Errorf("arguments %q", args)
+	}
+	if _, found := os.LookupEnv(dmakeFlagsEnvVar); found {
+		t.Errorf("%s is passed on to child dmakes", dmakeFlagsEnvVar)
+	}
+
+	t.Setenv(dmakeFlagsEnvVar, "install")
+	if err := parseFlags(nil); err == nil {
+		t.Errorf("expected an error for an argument in %s", dmakeFlagsEnvVar)
+	}
+	*prefixFlag = ""
+	t.Setenv(dmakeFlagsEnvVar, "-prefix /opt")
+	if err := parseFlags([]string{"-no-config"}); err != nil {
+		t.Fatal(err)
+	}
+	if *prefixFlag != "" {
+		t.Errorf("-no-config used %s's prefix %q", dmakeFlagsEnvVar, *prefixFlag)
+	}
+}
@@ -0,0 +1,252 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//  The name of the file, in the objects directory, caching the
+//  results of looking for main functions.
+//
+const mainCacheFilename = "mains"
+
+func DefinesMain(path string) bool {
+	return MainFunction(path) != ""
+}
+
+//  Return the name of the program entry point defined by a source
+//  file, main, or for Windows, wmain, WinMain or wWinMain, or an empty
+//  string if it doesn't define one. Comments, string literals and
+//  code disabled by "#if 0" are ignored.
+//
+func MainFunction(path string) string {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		logger.Warnf("%v", err)
+		return ""
+	}
+	for _, line := range ActiveLines(StripSource(string(source))) {
+		if m := mainFunctionRegexp.FindStringSubmatch(line); m != nil {
+			return m[2]
+		}
+		if m := winMainFunctionRegexp.FindStringSubmatch(line); m != nil {
+			return m[4]
+		}
+	}
+	return ""
+}
+
+//  Return C/C++ source with its comments removed and the contents of
+//  its string and character literals elided. Newlines are retained so
+//  the result has the same lines as the source.
+//
+func StripSource(source string) string {
+	var b strings.Builder
+	for i := 0; i < len(source); i++ {
+		ch := source[i]
+		switch {
+		case ch == '/' && i+1 < len(source) && source[i+1] == '/':
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+			if i < len(source) {
+				b.WriteByte('\n')
+			}
+		case ch == '/' && i+1 < len(source) && source[i+1] == '*':
+			b.WriteByte(' ')
+			for i += 2; i < len(source) && !strings.HasPrefix(source[i:], "*/"); i++ {
+				if source[i] == '\n' {
+					b.WriteByte('\n')
+				}
+			}
+			i++
+		case ch == '"' || ch == '\'' && !(i > 0 && isIdentifierChar(source[i-1])):
+			b.WriteByte(ch)
+			for i++; i < len(source) && source[i] != ch && source[i] != '\n'; i++ {
+				if source[i] == '\\' {
+					i++
+				}
+			}
+			if i < len(source) {
+				b.WriteByte(source[i])
+			}
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+//  Digit separators, 1'000, are not character literals.
+//
+func isIdentifierChar(ch byte) bool {
+	return ch == '_' || '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+}
+
+//  Return the lines of source that aren't obviously disabled by the
+//  preprocessor, i.e. not within an "#if 0" or the "#else" of an
+//  "#if 1". Other conditionals are assumed to be active.
+//
+func ActiveLines(source string) []string {
+	const (
+		unknown = iota
+		isFalse
+		isTrue
+	)
+	type block struct {
+		outer bool // true if the enclosing block is active
+		value int  // the value of the condition, if known
+	}
+	var blocks []block
+	active := true
+	var lines []string
+	for _, line := range strings.Split(source, "\n") {
+		directive := strings.TrimSpace(line)
+		if !strings.HasPrefix(directive, "#") {
+			if active {
+				lines = append(lines, line)
+			}
+			continue
+		}
+		fields := strings.Fields(strings.TrimSpace(directive[1:]))
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "if", "ifdef", "ifndef":
+			value := unknown
+			if fields[0] == "if" && len(fields) == 2 {
+				switch fields[1] {
+				case "0":
+					value = isFalse
+				case "1":
+					value = isTrue
+				}
+			}
+			blocks = append(blocks, block{outer: active, value: value})
+			active = active && value != isFalse
+		case "elif", "else":
+			if len(blocks) == 0 {
+				continue
+			}
+			top := &blocks[len(blocks)-1]
+			if top.value == isFalse && fields[0] == "elif" {
+				top.value = unknown
+			}
+			active = top.outer && top.value != isTrue
+		case "endif":
+			if len(blocks) == 0 {
+				continue
+			}
+			active = blocks[len(blocks)-1].outer
+			blocks = blocks[:len(blocks)-1]
+		}
+	}
+	return lines
+}
+
+//  ----------------------------------------------------------------
+
+//  A MainCache records the main functions found in source files
+//  along with the files' modification times so unchanged files aren't
+//  re-read.
+//
+type MainCache struct {
+	path    string
+	entries map[string]mainCacheEntry
+	changed bool
+}
+
+type mainCacheEntry struct {
+	modtime int64  // the file's modification time, in nanoseconds
+	name    string // the main function found, if any
+}
+
+//  Read the cache stored in path. A missing or malformed file
+//  results in an empty cache.
+//
+func ReadMainCache(path string) *MainCache {
+	cache := &MainCache{path: path, entries: make(map[string]mainCacheEntry)}
+	file, err := os.Open(path)
+	if err != nil {
+		return cache
+	}
+	defer file.Close()
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		modtime, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		cache.entries[fields[2]] = mainCacheEntry{modtime: modtime, name: fields[1]}
+	}
+	return cache
+}
+
+//  Return the main function defined by the file path, using the
+//  cached result if the file hasn't changed.
+//
+func (cache *MainCache) MainFunction(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		logger.Warnf("%v", err)
+		return ""
+	}
+	modtime := info.ModTime().UnixNano()
+	if entry, found := cache.entries[path]; found && entry.modtime == modtime {
+		return entry.name
+	}
+	name := daemonClient.MainFunction(path)
+	cache.entries[path] = mainCacheEntry{modtime: modtime, name: name}
+	cache.changed = true
+	return name
+}
+
+//  Write the cache back to its file if it has changed.
+//
+func (cache *MainCache) Write() error {
+	if !cache.changed || *dryRunFlag {
+		return nil
+	}
+	var b strings.Builder
+	for path, entry := range cache.entries {
+		fmt.Fprintf(&b, "%d\t%s\t%s\n", entry.modtime, entry.name, path)
+	}
+	if err := os.MkdirAll(filepath.Dir(cache.path), 0777); err != nil {
+		return err
+	}
+	return CreateFile(cache.path, b.String())
+}
+
+//  Return the main function defined by the receiver's source files,
+//  if any.
+//
+func (dmake *Dmake) FindMainFunction() string {
+	cache := ReadMainCache(filepath.Join(dmake.ObjsDir(), mainCacheFilename))
+	defer func() {
+		if err := cache.Write(); err != nil {
+			logger.Debugf("%v", err)
+		}
+	}()
+	for _, path := range dmake.sourceFiles {
+		if name := cache.MainFunction(dmake.OriginalSource(path)); name != "" {
+			return name
+		}
+	}
+	return ""
+}
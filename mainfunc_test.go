@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMainFunction(t *testing.T) {
+	dir := t.TempDir()
+	for source, expected := range map[string]string{
+		"int main(int argc, char **argv)\n":                                  "main",
+		"int\nmain(void)\n":                                                  "main",
+		"int wmain(int argc, wchar_t **argv)\n":                              "wmain",
+		"int WINAPI WinMain(HINSTANCE h, HINSTANCE p, LPSTR c, int n)\n":     "WinMain",
+		"int APIENTRY wWinMain(HINSTANCE h, HINSTANCE p, LPWSTR c, int n)\n": "wWinMain",
+		"int domain(int x)\n":                                                "",
+		"void f(void)\n":                                                     "",
+	} {
+		path := filepath.Join(dir, "main.c")
+		if err := CreateFile(path, source); err != nil {
+			t.Fatal(err)
+		}
+		if name := MainFunction(path); name != expected {
+			t.Errorf("%q: found %q, expected %q", source, name, expected)
+		}
+	}
+}
+
+func TestMainCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.c")
+	if err := CreateFile(path, "int main(void)\n"); err != nil {
+		t.Fatal(err)
+	}
+	cachePath := filepath.Join(dir, ".objs", mainCacheFilename)
+	cache := ReadMainCache(cachePath)
+	if name := cache.MainFunction(path); name != "main" {
+		t.Fatalf("found %q, expected main", name)
+	}
+	if err := cache.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	cache = ReadMainCache(cachePath)
+	if entry := cache.entries[path]; entry.name != "main" {
+		t.Fatalf("cached %q, expected main", entry.name)
+	}
+	if cache.MainFunction(path); cache.changed {
+		t.Fatal("unchanged file was re-read")
+	}
+
+	if err := CreateFile(path, "void f(void)\n"); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if name := cache.MainFunction(path); name != "" {
+		t.Fatalf("found %q in a changed file, expected none", name)
+	}
+}
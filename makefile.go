@@ -0,0 +1,98 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+//  The name of the Makefile written by dmake export make. This is
+//  not "Makefile" as dmake init writes a Makefile that runs dmake.
+//
+const exportMakefileFilename = "Makefile.dmake"
+
+//  Write a standalone Makefile that builds the targets without dmake
+//  or dcc. Sub-directories are built, first, by running make in each
+//  using their own exported Makefile.
+//
+func WriteMakefile(path string, targets []*ExportTarget, directories []string, tools ExportTools) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s generated by dmake export make\n\n", path)
+	fmt.Fprintf(&b, "CC = %s\n", makeEscape(tools.cc))
+	fmt.Fprintf(&b, "CXX = %s\n", makeEscape(tools.cxx))
+	fmt.Fprintf(&b, "AR = %s\n", makeEscape(tools.ar))
+	fmt.Fprintln(&b)
+
+	var outputs, objectDirs []string
+	for _, target := range targets {
+		outputs = append(outputs, makeEscape(filepath.ToSlash(target.output)))
+	}
+
+	fmt.Fprintf(&b, "DIRS := %s\n", makeEscape(strings.Join(directories, " ")))
+	fmt.Fprintln(&b, ".PHONY: all clean $(DIRS)")
+	fmt.Fprintf(&b, "all: %s\n", strings.Join(append([]string{"$(DIRS)"}, outputs...), " "))
+	fmt.Fprintln(&b, "$(DIRS):; $(MAKE) -C $@ -f "+exportMakefileFilename)
+	fmt.Fprintln(&b)
+
+	var cleanFiles []string
+	for _, target := range targets {
+		var objects []string
+		for _, source := range target.sources {
+			object := makeEscape(filepath.ToSlash(source.object))
+			compiler := "$(CC)"
+			if source.language == CplusplusLanguage || source.language == ObjcplusplusLanguage {
+				compiler = "$(CXX)"
+			}
+			dir := filepath.ToSlash(filepath.Dir(source.object))
+			if !Contains(objectDirs, dir) {
+				objectDirs = append(objectDirs, dir)
+			}
+			fmt.Fprintf(&b, "%s: %s | $(DIRS)\n", object, makeEscape(filepath.ToSlash(source.path)))
+			fmt.Fprintf(&b, "\t@mkdir -p $(@D)\n")
+			fmt.Fprintf(&b, "\t%s %s -MMD -MP -c $< -o $@\n", compiler, makeEscape(strings.Join(source.options, " ")))
+			fmt.Fprintf(&b, "-include %s\n\n", strings.TrimSuffix(object, filepath.Ext(object))+".d")
+			objects = append(objects, object)
+		}
+		output := makeEscape(filepath.ToSlash(target.output))
+		fmt.Fprintf(&b, "%s: %s\n", output, strings.Join(objects, " "))
+		if target.outputtype == LibOutputType {
+			fmt.Fprintln(&b, "\t@rm -f $@")
+			fmt.Fprintln(&b, "\t$(AR) rcs $@ $^")
+		} else {
+			linker := "$(CC)"
+			if target.linker == CplusplusLanguage {
+				linker = "$(CXX)"
+			}
+			fmt.Fprintf(&b, "\t%s %s -o $@ $^ %s\n", linker, makeEscape(strings.Join(target.ldflags, " ")), makeEscape(strings.Join(target.libs, " ")))
+		}
+		fmt.Fprintln(&b)
+		cleanFiles = append(cleanFiles, output)
+		cleanFiles = append(cleanFiles, objects...)
+	}
+
+	fmt.Fprintln(&b, "clean:")
+	for _, dir := range directories {
+		fmt.Fprintf(&b, "\t$(MAKE) -C %s -f %s clean\n", makeEscape(dir), exportMakefileFilename)
+	}
+	if len(cleanFiles) > 0 {
+		fmt.Fprintf(&b, "\trm -f %s\n", strings.Join(cleanFiles, " "))
+		for _, dir := range objectDirs {
+			fmt.Fprintf(&b, "\trm -f %s/*.d\n", makeEscape(dir))
+		}
+	}
+
+	return CreateFile(path, b.String())
+}
+
+func makeEscape(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestExportMakefile(t *testing.T) {
+	files := exportProject(t, "make", exportMakefileFilename)
+	checkExported(t, files, map[string]string{
+		"Makefile.dmake": `# Makefile.dmake generated by dmake export make
+
+CC = cc
+CXX = c++
+AR = ar
+
+DIRS := lib
+.PHONY: all clean $(DIRS)
+all: $(DIRS) app
+$(DIRS):; $(MAKE) -C $@ -f Makefile.dmake
+
+$OBJS/main.o: main.c | $(DIRS)
+	@mkdir -p $(@D)
+	$(CC) -Wall -Iinclude -MMD -MP -c $< -o $@
+-include $OBJS/main.d
+
+app: $OBJS/main.o
+	$(CC)  -o $@ $^ -Llib -llib -lm
+
+clean:
+	$(MAKE) -C lib -f Makefile.dmake clean
+	rm -f app $OBJS/main.o
+	rm -f $OBJS/*.d
+`,
+		"lib/Makefile.dmake": `# Makefile.dmake generated by dmake export make
+
+CC = cc
+CXX = c++
+AR = ar
+
+DIRS := 
+.PHONY: all clean $(DIRS)
+all: $(DIRS) lib.a
+$(DIRS):; $(MAKE) -C $@ -f Makefile.dmake
+
+$OBJS/lib.o: lib.c | $(DIRS)
+	@mkdir -p $(@D)
+	$(CC)  -MMD -MP -c $< -o $@
+-include $OBJS/lib.d
+
+lib.a: $OBJS/lib.o
+	@rm -f $@
+	$(AR) rcs $@ $^
+
+clean:
+	rm -f lib.a $OBJS/lib.o
+	rm -f $OBJS/*.d
+`,
+	})
+}
@@ -0,0 +1,138 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//  dmake -targets linux/amd64,windows/amd64,darwin/arm64 builds for
+//  each of the targets, or profiles, in turn, each by a child dmake
+//  using its own build directory, build/<os>-<arch>, or below the -B
+//  directory, so outputs built for different targets don't collide.
+//  The other options and arguments are passed on, e.g. adding package
+//  makes the packages for every target. The results are summarized
+//  once every target is built, as with directories -k keeps going
+//  after a target fails.
+//
+const defaultMatrixDirectory = "build"
+
+//  The result of building for one target.
+//
+type MatrixResult struct {
+	target   string
+	err      error // nil if the build succeeded
+	skipped  bool  // not built as an earlier target failed
+	duration time.Duration
+}
+
+//  Return the targets named by a comma separated list, resolving
+//  profiles.
+//
+func MatrixTargets(list string) ([]string, error) {
+	var targets []string
+	for _, target := range strings.Split(list, ",") {
+		target = strings.TrimSpace(target)
+		if profile, found := targetProfiles[target]; found {
+			target = profile
+		}
+		if target == "" || Contains(targets, target) {
+			continue
+		}
+		if parts := strings.SplitN(target, "/", 2); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("%q: target must be of the form os/arch", target)
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("-targets requires at least one target")
+	}
+	return targets, nil
+}
+
+//  Return the build directory used for a target.
+//
+func MatrixBuildDirectory(root, target string) string {
+	if root == "" {
+		root = defaultMatrixDirectory
+	}
+	return filepath.Join(root, strings.Replace(target, "/", "-", 1))
+}
+
+//  Return the arguments given to the child dmake building for a
+//  target, the options given to this dmake, other than those
+//  selecting the targets and build directory, and its arguments.
+//
+func MatrixArgs(target string, args []string) []string {
+	childArgs := []string{"-target", target, "-B", MatrixBuildDirectory(*builddirFlag, target)}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "B", "builddir", "target", "targets":
+		default:
+			childArgs = append(childArgs, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	for _, arg := range dccArgsFlag {
+		childArgs = append(childArgs, "-dcc-arg", arg)
+	}
+	return append(childArgs, args...)
+}
+
+//  Build for each target, in turn, returning the results.
+//
+func RunMatrix(targets []string, args []string, env []string) ([]MatrixResult, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	var results []MatrixResult
+	failed := false
+	for _, target := range targets {
+		if failed && !*keepGoingFlag {
+			results = append(results, MatrixResult{target: target, skipped: true})
+			continue
+		}
+		logger.Infof("building for %s", target)
+		started := time.Now()
+		cmd := exec.Command(self, MatrixArgs(target, args)...)
+		cmd.Env = env
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, os.Stdout, os.Stderr
+		err := RunCommand(cmd)
+		results = append(results, MatrixResult{target: target, err: err, duration: time.Since(started)})
+		failed = failed || err != nil
+	}
+	return results, nil
+}
+
+//  Write a summary of the results, one line per target, and return
+//  the number of targets that failed or weren't built.
+//
+func SummarizeMatrix(w io.Writer, results []MatrixResult) int {
+	failures := 0
+	for _, result := range results {
+		switch {
+		case result.skipped:
+			fmt.Fprintf(w, "%-20s skipped\n", result.target)
+			failures++
+		case result.err != nil:
+			fmt.Fprintf(w, "%-20s FAILED  %5.1fs  %v\n", result.target, result.duration.Seconds(), result.err)
+			failures++
+		default:
+			fmt.Fprintf(w, "%-20s ok      %5.1fs\n", result.target, result.duration.Seconds())
+		}
+	}
+	return failures
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatrixTargets(t *testing.T) {
+	targets, err := MatrixTargets("linux/amd64, mingw,windows/amd64,,darwin/arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"linux/amd64", "windows/amd64", "darwin/arm64"}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("targets %q, expected %q", targets, expected)
+	}
+	if _, err := MatrixTargets("linux"); err == nil {
+		t.Error("expected an error for a malformed target")
+	}
+	if dir := MatrixBuildDirectory("", "windows/amd64"); dir != filepath.Join("build", "windows-amd64") {
+		t.Errorf("build directory %q", dir)
+	}
+
+	var b strings.Builder
+	results := []MatrixResult{
+		{target: "linux/amd64"},
+		{target: "windows/amd64", err: errors.New("exit status 1")},
+		{target: "darwin/arm64", skipped: true},
+	}
+	if failures := SummarizeMatrix(&b, results); failures != 2 {
+		t.Errorf("%d failures, expected 2", failures)
+	}
+	if lines := strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 3 || !strings.Contains(lines[1], "FAILED") {
+		t.Errorf("summary %q", b.String())
+	}
+}
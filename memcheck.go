@@ -0,0 +1,189 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//  "dmake test -valgrind", or defining the .dmake MEMCHECK variable,
+//  runs each test program under valgrind's memcheck. A test fails if
+//  memcheck finds invalid reads, writes or frees, uses of uninitialised
+//  values or memory definitely or indirectly leaked, even if the
+//  program exits successfully. What it found is summarized for each
+//  test and its report is left in the tests directory, named for the
+//  test with a .memcheck suffix.
+//
+//  MEMCHECK's value, if any, is the valgrind command and any options
+//  to use, e.g. "valgrind --track-origins=yes". MEMCHECK_SUPPRESSIONS
+//  names valgrind suppressions files, glob patterns, for errors that
+//  aren't the project's.
+//
+const (
+	defaultMemcheck = "valgrind"
+	memcheckSuffix  = ".memcheck"
+)
+
+//  True if "dmake test -valgrind" was used.
+//
+var valgrindFlag bool
+
+//  What memcheck found running a test.
+//
+type MemcheckResult struct {
+	errors  int   // the number of errors reported, including leaks
+	invalid int   // invalid reads, writes and frees
+	uninit  int   // uses of uninitialised values
+	leaked  int64 // bytes definitely or indirectly lost
+}
+
+var (
+	memcheckErrorSummaryRegexp = regexp.MustCompile(`ERROR SUMMARY: ([0-9,]+) errors?`)
+	memcheckLostRegexp         = regexp.MustCompile(`(definitely|indirectly) lost: ([0-9,]+) bytes`)
+	memcheckInvalidRegexp      = regexp.MustCompile(`^(Invalid (read|write|free)|Mismatched free|Source and destination overlap)`)
+	memcheckUninitRegexp       = regexp.MustCompile(`uninitialised`)
+)
+
+//  Return the command the receiver's tests are run under, nil if
+//  they aren't checked.
+//
+func (dmake *Dmake) MemcheckCommand() []string {
+	value, found := dmake.vars.GetValue("MEMCHECK")
+	if !found && !valgrindFlag {
+		return nil
+	}
+	command := ShellWords(value)
+	if len(command) == 0 {
+		command = []string{defaultMemcheck}
+	}
+	return command
+}
+
+//  Return the receiver's valgrind suppressions files.
+//
+func (dmake *Dmake) MemcheckSuppressions() ([]string, error) {
+	patterns, found := dmake.vars.GetValue("MEMCHECK_SUPPRESSIONS")
+	if !found {
+		return nil, nil
+	}
+	files, err := dmake.Target().ExpandGlobs(patterns)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) < 1 {
+		return nil, fmt.Errorf("MEMCHECK_SUPPRESSIONS=%s matches no files", patterns)
+	}
+	return files, nil
+}
+
+//  Return the command line running a test program under memcheck,
+//  writing its report to a file.
+//
+func MemcheckArgs(command []string, report string, suppressions []string, program string) []string {
+	args := append(command[:len(command):len(command)],
+		"--tool=memcheck",
+		"--leak-check=full",
+		"--errors-for-leak-kinds=definite,indirect",
+		"--log-file="+report,
+	)
+	for _, path := range suppressions {
+		args = append(args, "--suppressions="+path)
+	}
+	return append(args, program)
+}
+
+//  Return the name of the file memcheck's report for a test program
+//  is written to.
+//
+func MemcheckReportFilename(program string) string {
+	return strings.TrimSuffix(program, filepath.Ext(program)) + memcheckSuffix
+}
+
+//  Read what memcheck found from its report.
+//
+func ReadMemcheckReport(path string) (*MemcheckResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseMemcheckReport(file)
+}
+
+//  Parse a memcheck report, lines prefixed by ==pid==.
+//
+func ParseMemcheckReport(r io.Reader) (*MemcheckResult, error) {
+	result := &MemcheckResult{}
+	summary := false
+	input := bufio.NewScanner(r)
+	for input.Scan() {
+		line := input.Text()
+		if i := strings.Index(line, "== "); strings.HasPrefix(line, "==") && i > 0 {
+			line = line[i+3:]
+		}
+		if m := memcheckErrorSummaryRegexp.FindStringSubmatch(line); m != nil {
+			result.errors += memcheckNumber(m[1])
+			summary = true
+		} else if m := memcheckLostRegexp.FindStringSubmatch(line); m != nil {
+			result.leaked += int64(memcheckNumber(m[2]))
+		} else if memcheckInvalidRegexp.MatchString(line) {
+			result.invalid++
+		} else if !strings.HasPrefix(line, " ") && memcheckUninitRegexp.MatchString(line) {
+			result.uninit++
+		}
+	}
+	if err := input.Err(); err != nil {
+		return nil, err
+	}
+	if !summary {
+		return nil, fmt.Errorf("no error summary, the program didn't finish")
+	}
+	return result, nil
+}
+
+func memcheckNumber(s string) int {
+	n, _ := strconv.Atoi(strings.ReplaceAll(s, ",", ""))
+	return n
+}
+
+//  Return true if memcheck found problems.
+//
+func (r *MemcheckResult) Failed() bool {
+	return r.errors > 0
+}
+
+//  Describe what memcheck found.
+//
+func (r *MemcheckResult) String() string {
+	if !r.Failed() {
+		return "no memory errors"
+	}
+	s := fmt.Sprintf("%d memory errors", r.errors)
+	var details []string
+	if r.invalid > 0 {
+		details = append(details, fmt.Sprintf("%d invalid accesses", r.invalid))
+	}
+	if r.uninit > 0 {
+		details = append(details, fmt.Sprintf("%d uses of uninitialised values", r.uninit))
+	}
+	if r.leaked > 0 {
+		details = append(details, fmt.Sprintf("%d bytes leaked", r.leaked))
+	}
+	if len(details) > 0 {
+		s += ", " + strings.Join(details, ", ")
+	}
+	return s
+}
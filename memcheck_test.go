@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemcheckReport(t *testing.T) {
+	report := `==42== Memcheck, a memory error detector
+==42== Invalid write of size 4
+==42==    at 0x10914B: main (t.c:5)
+==42== Conditional jump or move depends on uninitialised value(s)
+==42==    at 0x109160: main (t.c:7)
+==42==  Uninitialised value was created by a heap allocation
+==42== LEAK SUMMARY:
+==42==    definitely lost: 1,024 bytes in 1 blocks
+==42==    indirectly lost: 16 bytes in 1 blocks
+==42==      possibly lost: 8 bytes in 1 blocks
+==42== ERROR SUMMARY: 4 errors from 4 contexts (suppressed: 0 from 0)
+`
+	result, err := ParseMemcheckReport(strings.NewReader(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := MemcheckResult{errors: 4, invalid: 1, uninit: 1, leaked: 1040}
+	if *result != expected || !result.Failed() {
+		t.Errorf("parsed %+v, expected %+v", *result, expected)
+	}
+	if _, err := ParseMemcheckReport(strings.NewReader("==42== Invalid read of size 1\n")); err == nil {
+		t.Errorf("report without a summary parsed")
+	}
+	args := MemcheckArgs([]string{"valgrind", "-q"}, ".tests/t.memcheck", []string{"a.supp"}, ".tests/t")
+	if args[0] != "valgrind" || args[1] != "-q" || args[len(args)-2] != "--suppressions=a.supp" || args[len(args)-1] != ".tests/t" {
+		t.Errorf("memcheck command %q", args)
+	}
+}
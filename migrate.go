@@ -0,0 +1,949 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//  dmake init -from cmake or make reads an existing project's
+//  CMakeLists.txt or Makefile and initializes the project to build the
+//  same output from the same sources, with the same include
+//  directories, definitions and libraries. Only simple, declarative,
+//  files, the sort most small projects have, are understood. Anything
+//  else is reported and left for the user to translate.
+//
+type ImportedProject struct {
+	name        string   // the output's name
+	projectType string   // exe, lib or dll, "" if not known
+	sources     []string // the source files
+	std         string   // the language standard, e.g. c++17
+	cflags      []string // compiler options, include directories and definitions
+	ldflags     []string // linker options
+	libs        []string // libraries
+}
+
+//  The makefiles make reads, in the order it looks for them.
+//
+var makefileNames = []string{"GNUmakefile", "makefile", "Makefile"}
+
+//  Read the project defined by the build files of another build tool,
+//  "cmake" or "make".
+//
+func ImportProject(from string) (*ImportedProject, error) {
+	switch from {
+	case "cmake":
+		return ImportCMakeLists(cmakeListsFilename)
+	case "make":
+		for _, name := range makefileNames {
+			if _, err := os.Stat(name); err == nil {
+				return ImportMakefile(name)
+			}
+		}
+		return nil, fmt.Errorf("no makefile found to import")
+	default:
+		return nil, fmt.Errorf("%s: unsupported project type, use cmake or make", from)
+	}
+}
+
+//  Add compiler options, dropping those init itself provides, the
+//  debug and optimization options it chooses by build mode and the
+//  warnings it always uses, and taking any language standard.
+//
+func (p *ImportedProject) addCompilerOptions(options ...string) {
+	for _, option := range options {
+		switch {
+		case option == "" || option == "-c" || strings.HasPrefix(option, "-g") || strings.HasPrefix(option, "-O"):
+		case option == "-DDEBUG" || option == "-DNDEBUG":
+		case Contains(strings.Fields(defaultWarningOpts), option):
+		case strings.HasPrefix(option, "-std="):
+			p.std = strings.TrimPrefix(option, "-std=")
+		case !Contains(p.cflags, option):
+			p.cflags = append(p.cflags, option)
+		}
+	}
+}
+
+//  Return options as the lines of a dcc options file.
+//
+func OptionsLines(options []string) string {
+	if len(options) == 0 {
+		return ""
+	}
+	return strings.Join(options, "\n") + "\n"
+}
+
+//  Return true if two lists name the same files.
+//
+func SameFiles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if filepath.Clean(a[i]) != filepath.Clean(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+//  Add linker options, -l options are libraries.
+//
+func (p *ImportedProject) addLinkerOptions(options ...string) {
+	for _, option := range options {
+		if strings.HasPrefix(option, "-l") {
+			p.addLibraries(option)
+		} else if option != "" && !Contains(p.ldflags, option) {
+			p.ldflags = append(p.ldflags, option)
+		}
+	}
+}
+
+func (p *ImportedProject) addLibraries(libs ...string) {
+	for _, lib := range libs {
+		if lib != "" && !Contains(p.libs, lib) {
+			p.libs = append(p.libs, lib)
+		}
+	}
+}
+
+//  Add the source files from a list of files, ignoring headers and
+//  anything else that isn't compiled.
+//
+func (p *ImportedProject) addSources(paths ...string) {
+	for _, path := range paths {
+		path = filepath.Clean(filepath.FromSlash(path))
+		if HaveSourceFiles([]string{path}) && !Contains(p.sources, path) {
+			p.sources = append(p.sources, path)
+		}
+	}
+}
+
+// ----------------------------------------------------------------
+//  CMake
+//
+
+//  A command in a CMakeLists.txt, e.g. add_executable(app main.cpp).
+//
+type cmakeCommand struct {
+	name   string       // the command's name, in lower case
+	args   []string     // the arguments as written
+	quoted map[int]bool // which arguments are quoted
+	line   int          // where the command is
+}
+
+//  Split a CMakeLists.txt into its commands.
+//
+func ParseCMakeLists(text string) ([]cmakeCommand, error) {
+	var commands []cmakeCommand
+	s := []rune(text)
+	line := 1
+	i := 0
+	bracket := func() (string, bool) {
+		// [[...]], [=[...]=], etc.
+		j := i + 1
+		for j < len(s) && s[j] == '=' {
+			j++
+		}
+		if j >= len(s) || s[j] != '[' {
+			return "", false
+		}
+		closing := "]" + strings.Repeat("=", j-i-1) + "]"
+		end := strings.Index(string(s[j+1:]), closing)
+		if end < 0 {
+			return "", false
+		}
+		body := []rune(string(s[j+1:])[:end])
+		i = j + 1 + len(body) + len(closing)
+		line += strings.Count(string(body), "\n")
+		return string(body), true
+	}
+	skipComment := func() {
+		i++
+		if i < len(s) && s[i] == '[' {
+			if _, ok := bracket(); ok {
+				return
+			}
+		}
+		for i < len(s) && s[i] != '\n' {
+			i++
+		}
+	}
+	for i < len(s) {
+		switch c := s[i]; {
+		case c == '\n':
+			line++
+			i++
+		case unicode.IsSpace(c):
+			i++
+		case c == '#':
+			skipComment()
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(s) && (s[i] == '_' || unicode.IsLetter(s[i]) || unicode.IsDigit(s[i])) {
+				i++
+			}
+			command := cmakeCommand{name: strings.ToLower(string(s[start:i])), quoted: make(map[int]bool), line: line}
+			for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+				i++
+			}
+			if i >= len(s) || s[i] != '(' {
+				return nil, fmt.Errorf("line %d: expected ( after %s", line, command.name)
+			}
+			i++
+			depth := 1
+			for depth > 0 {
+				if i >= len(s) {
+					return nil, fmt.Errorf("line %d: %s is missing a )", command.line, command.name)
+				}
+				switch c := s[i]; {
+				case c == '\n':
+					line++
+					i++
+				case unicode.IsSpace(c):
+					i++
+				case c == '#':
+					skipComment()
+				case c == '(':
+					depth++
+					i++
+				case c == ')':
+					depth--
+					i++
+				case c == '"':
+					var b strings.Builder
+					for i++; i < len(s) && s[i] != '"'; i++ {
+						if s[i] == '\\' && i+1 < len(s) {
+							i++
+							switch s[i] {
+							case 'n':
+								b.WriteRune('\n')
+							case 't':
+								b.WriteRune('\t')
+							case '\n':
+								line++
+							default:
+								b.WriteRune(s[i])
+							}
+							continue
+						}
+						if s[i] == '\n' {
+							line++
+						}
+						b.WriteRune(s[i])
+					}
+					i++
+					command.quoted[len(command.args)] = true
+					command.args = append(command.args, b.String())
+				case c == '[':
+					if body, ok := bracket(); ok {
+						command.quoted[len(command.args)] = true
+						command.args = append(command.args, body)
+						break
+					}
+					fallthrough
+				default:
+					start := i
+					for i < len(s) && !unicode.IsSpace(s[i]) && !strings.ContainsRune(`()"#`, s[i]) {
+						if s[i] == '\\' && i+1 < len(s) {
+							i++
+						}
+						i++
+					}
+					command.args = append(command.args, string(s[start:i]))
+				}
+			}
+			commands = append(commands, command)
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %q", line, c)
+		}
+	}
+	return commands, nil
+}
+
+var cmakeVariableRegexp = regexp.MustCompile(`\$(ENV)?\{([^${}]*)\}`)
+
+//  A cmakeImporter evaluates a CMakeLists.txt's commands.
+//
+type cmakeImporter struct {
+	path    string
+	vars    map[string]string
+	targets []*cmakeTarget
+	global  cmakeTarget // the directory-wide settings
+	ignored map[string]bool
+}
+
+type cmakeTarget struct {
+	name        string
+	projectType string
+	sources     []string
+	includes    []string
+	definitions []string
+	options     []string
+	linkOptions []string
+	libs        []string
+	properties  map[string]string
+}
+
+//  Replace variable references. Inner references are replaced first
+//  so ${${name}_SOURCES} works.
+//
+func (c *cmakeImporter) expand(s string) string {
+	for n := 0; n < 100 && cmakeVariableRegexp.MatchString(s); n++ {
+		s = cmakeVariableRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+			match := cmakeVariableRegexp.FindStringSubmatch(ref)
+			if match[1] == "ENV" {
+				return os.Getenv(match[2])
+			}
+			return c.vars[match[2]]
+		})
+	}
+	return s
+}
+
+//  Return a command's arguments with variables replaced. Unquoted
+//  arguments are lists, split at semicolons.
+//
+func (c *cmakeImporter) arguments(command cmakeCommand) []string {
+	var args []string
+	for i, arg := range command.args {
+		value := c.expand(arg)
+		if command.quoted[i] {
+			args = append(args, value)
+			continue
+		}
+		for _, element := range strings.Split(value, ";") {
+			if element != "" {
+				args = append(args, element)
+			}
+		}
+	}
+	return args
+}
+
+//  Report something ignored, once.
+//
+func (c *cmakeImporter) ignore(what string, line int, why string) {
+	if !c.ignored[what] {
+		logger.Warnf("%s:%d: %s ignored, %s", c.path, line, what, why)
+		c.ignored[what] = true
+	}
+}
+
+func (c *cmakeImporter) target(name string) *cmakeTarget {
+	for _, t := range c.targets {
+		if t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+//  Remove the keywords that may appear in a list of arguments.
+//
+func withoutKeywords(args []string, keywords ...string) []string {
+	var result []string
+	for _, arg := range args {
+		if !Contains(keywords, arg) {
+			result = append(result, arg)
+		}
+	}
+	return result
+}
+
+var cmakeScopes = []string{"PUBLIC", "PRIVATE", "INTERFACE", "SYSTEM", "BEFORE", "AFTER"}
+
+//  Read a CMakeLists.txt. The first executable or library it defines
+//  is the project's output, dmake builds one output per directory.
+//
+func ImportCMakeLists(path string) (*ImportedProject, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	commands, err := ParseCMakeLists(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	c := &cmakeImporter{
+		path:    path,
+		vars:    make(map[string]string),
+		ignored: make(map[string]bool),
+	}
+	for _, name := range []string{"CMAKE_SOURCE_DIR", "CMAKE_CURRENT_SOURCE_DIR", "CMAKE_CURRENT_LIST_DIR", "PROJECT_SOURCE_DIR", "CMAKE_BINARY_DIR", "CMAKE_CURRENT_BINARY_DIR", "PROJECT_BINARY_DIR"} {
+		c.vars[name] = "."
+	}
+
+	for _, command := range commands {
+		args := c.arguments(command)
+		var t *cmakeTarget
+		if len(args) > 0 {
+			t = c.target(args[0])
+		}
+		switch command.name {
+		case "cmake_minimum_required", "cmake_policy", "install", "enable_testing", "add_test", "message", "option", "include", "find_package":
+			// Nothing to do, or nothing dmake can do.
+		case "project":
+			if len(args) > 0 {
+				c.vars["PROJECT_NAME"] = args[0]
+				if _, found := c.vars["CMAKE_PROJECT_NAME"]; !found {
+					c.vars["CMAKE_PROJECT_NAME"] = args[0]
+				}
+			}
+		case "set":
+			if len(args) > 0 {
+				values := args[1:]
+				for i, value := range values {
+					if value == "CACHE" || value == "PARENT_SCOPE" {
+						values = values[:i]
+						break
+					}
+				}
+				c.vars[args[0]] = strings.Join(values, ";")
+			}
+		case "list":
+			if len(args) > 1 && (args[0] == "APPEND" || args[0] == "PREPEND") {
+				values := args[2:]
+				if old := c.vars[args[1]]; old != "" {
+					if args[0] == "APPEND" {
+						values = append([]string{old}, values...)
+					} else {
+						values = append(values, old)
+					}
+				}
+				c.vars[args[1]] = strings.Join(values, ";")
+			} else {
+				c.ignore("list", command.line, "only list(APPEND) and list(PREPEND) are understood")
+			}
+		case "add_executable", "add_library":
+			if len(args) < 1 || Contains(args, "IMPORTED") || Contains(args, "ALIAS") || Contains(args, "INTERFACE") || Contains(args, "OBJECT") {
+				continue
+			}
+			t := &cmakeTarget{name: args[0], projectType: "exe", properties: make(map[string]string)}
+			if command.name == "add_library" {
+				t.projectType = "lib"
+				if c.vars["BUILD_SHARED_LIBS"] == "ON" {
+					t.projectType = "dll"
+				}
+				if Contains(args, "SHARED") || Contains(args, "MODULE") {
+					t.projectType = "dll"
+				}
+			}
+			t.sources = withoutKeywords(args[1:], "WIN32", "MACOSX_BUNDLE", "EXCLUDE_FROM_ALL", "STATIC", "SHARED", "MODULE")
+			c.targets = append(c.targets, t)
+		case "target_sources":
+			if t != nil {
+				t.sources = append(t.sources, withoutKeywords(args[1:], cmakeScopes...)...)
+			}
+		case "include_directories":
+			c.global.includes = append(c.global.includes, withoutKeywords(args, cmakeScopes...)...)
+		case "target_include_directories":
+			if t != nil {
+				t.includes = append(t.includes, withoutKeywords(args[1:], cmakeScopes...)...)
+			}
+		case "add_definitions", "add_compile_options":
+			c.global.options = append(c.global.options, args...)
+		case "add_compile_definitions":
+			c.global.definitions = append(c.global.definitions, args...)
+		case "target_compile_definitions":
+			if t != nil {
+				t.definitions = append(t.definitions, withoutKeywords(args[1:], cmakeScopes...)...)
+			}
+		case "target_compile_options":
+			if t != nil {
+				t.options = append(t.options, withoutKeywords(args[1:], cmakeScopes...)...)
+			}
+		case "target_compile_features":
+			if t != nil {
+				for _, feature := range args[1:] {
+					if strings.HasPrefix(feature, "cxx_std_") {
+						t.properties["CXX_STANDARD"] = strings.TrimPrefix(feature, "cxx_std_")
+					} else if strings.HasPrefix(feature, "c_std_") {
+						t.properties["C_STANDARD"] = strings.TrimPrefix(feature, "c_std_")
+					}
+				}
+			}
+		case "link_libraries":
+			c.global.libs = append(c.global.libs, args...)
+		case "target_link_libraries":
+			if t != nil {
+				t.libs = append(t.libs, withoutKeywords(args[1:], append(cmakeScopes, "debug", "optimized", "general", "LINK_PUBLIC", "LINK_PRIVATE")...)...)
+			}
+		case "link_directories":
+			for _, dir := range withoutKeywords(args, cmakeScopes...) {
+				c.global.linkOptions = append(c.global.linkOptions, "-L"+dir)
+			}
+		case "target_link_directories":
+			if t != nil {
+				for _, dir := range withoutKeywords(args[1:], cmakeScopes...) {
+					t.linkOptions = append(t.linkOptions, "-L"+dir)
+				}
+			}
+		case "add_link_options":
+			c.global.linkOptions = append(c.global.linkOptions, args...)
+		case "target_link_options":
+			if t != nil {
+				t.linkOptions = append(t.linkOptions, withoutKeywords(args[1:], cmakeScopes...)...)
+			}
+		case "set_target_properties":
+			for i, arg := range args {
+				if arg == "PROPERTIES" {
+					for j := i + 1; j+1 < len(args); j += 2 {
+						for _, name := range args[:i] {
+							if t := c.target(name); t != nil {
+								t.properties[args[j]] = args[j+1]
+							}
+						}
+					}
+					break
+				}
+			}
+		case "if", "elseif", "else", "endif":
+			c.ignore("conditionals", command.line, "all branches are used")
+		case "add_subdirectory":
+			if len(args) > 0 {
+				logger.Warnf("%s:%d: add_subdirectory(%s) ignored, run dmake init -from cmake in %s", path, command.line, args[0], args[0])
+			}
+		default:
+			c.ignore(command.name, command.line, "it's not understood")
+		}
+	}
+
+	if len(c.targets) == 0 {
+		return nil, fmt.Errorf("%s: no executable or library defined", path)
+	}
+	for _, t := range c.targets[1:] {
+		logger.Warnf("%s: target %s ignored, dmake builds one output per directory", path, t.name)
+	}
+	return c.project(c.targets[0]), nil
+}
+
+//  Return the imported project building a target.
+//
+func (c *cmakeImporter) project(t *cmakeTarget) *ImportedProject {
+	p := &ImportedProject{name: t.name, projectType: t.projectType}
+	if name := t.properties["OUTPUT_NAME"]; name != "" {
+		p.name = name
+	}
+	var sources []string
+	for _, source := range t.sources {
+		if strings.Contains(source, "$<") {
+			logger.Warnf("%s: %s: generator expressions are not understood, source ignored", c.path, source)
+			continue
+		}
+		sources = append(sources, source)
+	}
+	p.addSources(sources...)
+
+	for _, dir := range append(c.global.includes, t.includes...) {
+		if !strings.Contains(dir, "$<") {
+			p.addCompilerOptions("-I" + filepath.Clean(dir))
+		}
+	}
+	for _, definition := range append(c.global.definitions, t.definitions...) {
+		if !strings.HasPrefix(definition, "-D") {
+			definition = "-D" + definition
+		}
+		p.addCompilerOptions(definition)
+	}
+	p.addCompilerOptions(c.global.options...)
+	p.addCompilerOptions(t.options...)
+	p.addLinkerOptions(c.global.linkOptions...)
+	p.addLinkerOptions(t.linkOptions...)
+
+	for _, lib := range append(c.global.libs, t.libs...) {
+		switch {
+		case lib == "Threads::Threads":
+			p.addLinkerOptions("-pthread")
+		case strings.Contains(lib, "::") || strings.Contains(lib, "$<"):
+			logger.Warnf("%s: library %s isn't understood, add it to .dcc/LIBS or PKGS in .dmake", c.path, lib)
+		case c.target(lib) != nil:
+			logger.Warnf("%s: library %s is built by this project, add it to .dcc/LIBS once built", c.path, lib)
+		case strings.HasPrefix(lib, "-") || strings.ContainsAny(lib, `/\`) || filepath.Ext(lib) != "":
+			p.addLinkerOptions(lib)
+		default:
+			p.addLibraries("-l" + lib)
+		}
+	}
+
+	standard := func(property, prefix string) string {
+		if value := t.properties[property]; value != "" {
+			return prefix + value
+		}
+		if value := c.vars["CMAKE_"+property]; value != "" {
+			return prefix + value
+		}
+		return ""
+	}
+	if language := LanguageOf(p.sources); language == CLanguage || language == ObjcLanguage {
+		p.std = standard("C_STANDARD", "c")
+	} else {
+		p.std = standard("CXX_STANDARD", "c++")
+	}
+	return p
+}
+
+// ----------------------------------------------------------------
+//  Make
+//
+
+var (
+	makeAssignmentRegexp = regexp.MustCompile(`^\s*(?:override\s+|export\s+)?([A-Za-z_][A-Za-z0-9_.]*)\s*(:::=|::=|:=|\?=|\+=|!=|=)\s*(.*)$`)
+	makeRuleRegexp       = regexp.MustCompile(`^([^:=#\t][^:=]*?)\s*::?\s*([^=].*|)$`)
+	makeSourcesRegexp    = regexp.MustCompile(`^([A-Za-z0-9]+_)?(SRCS|SOURCES|SRC|SOURCE)$`)
+	makeObjectsRegexp    = regexp.MustCompile(`^([A-Za-z0-9]+_)?(OBJS|OBJECTS|OBJ)$`)
+)
+
+//  The variables conventionally naming a makefile's output.
+//
+var makeOutputVariables = []string{"TARGET", "PROG", "PROGRAM", "EXE", "BIN", "NAME", "LIB", "LIBRARY"}
+
+//  A makeImporter evaluates a makefile's variables.
+//
+type makeImporter struct {
+	path    string
+	vars    map[string]string
+	ignored map[string]bool
+}
+
+func (m *makeImporter) ignore(what, why string) {
+	if !m.ignored[what] {
+		logger.Warnf("%s: %s ignored, %s", m.path, what, why)
+		m.ignored[what] = true
+	}
+}
+
+//  Return the value of a variable, from the makefile or, as make
+//  does, the environment.
+//
+func (m *makeImporter) value(name string) string {
+	if value, found := m.vars[name]; found {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+//  Replace variable references and the functions commonly used to
+//  list sources and objects.
+//
+func (m *makeImporter) expand(s string, depth int) string {
+	if depth > 50 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		open := s[i]
+		if open != '(' && open != '{' {
+			if open == '$' {
+				b.WriteByte('$')
+			} else {
+				b.WriteString(m.expand(m.value(string(open)), depth+1))
+			}
+			continue
+		}
+		close := byte(')')
+		if open == '{' {
+			close = '}'
+		}
+		end, nesting := i+1, 1
+		for ; end < len(s); end++ {
+			if s[end] == open {
+				nesting++
+			} else if s[end] == close {
+				if nesting--; nesting == 0 {
+					break
+				}
+			}
+		}
+		if end == len(s) {
+			b.WriteString(s[i-1:])
+			break
+		}
+		b.WriteString(m.reference(s[i+1:end], depth))
+		i = end
+	}
+	return b.String()
+}
+
+//  Return the value of a reference, the text between $( and ).
+//
+func (m *makeImporter) reference(ref string, depth int) string {
+	if space := strings.IndexAny(ref, " \t"); space > 0 && !strings.Contains(ref[:space], ":") {
+		function, args := ref[:space], strings.TrimSpace(ref[space+1:])
+		split := func(n int) []string {
+			parts := strings.SplitN(args, ",", n)
+			for i := range parts {
+				parts[i] = m.expand(parts[i], depth+1)
+			}
+			for len(parts) < n {
+				parts = append(parts, "")
+			}
+			return parts
+		}
+		switch function {
+		case "wildcard":
+			files, _ := DefaultTarget().ExpandGlobs(m.expand(args, depth+1))
+			return strings.Join(files, " ")
+		case "patsubst":
+			parts := split(3)
+			return patsubst(parts[0], parts[1], parts[2])
+		case "addprefix", "addsuffix":
+			parts := split(2)
+			var words []string
+			for _, word := range strings.Fields(parts[1]) {
+				if function == "addprefix" {
+					words = append(words, parts[0]+word)
+				} else {
+					words = append(words, word+parts[0])
+				}
+			}
+			return strings.Join(words, " ")
+		case "notdir", "sort", "strip":
+			words := strings.Fields(m.expand(args, depth+1))
+			if function == "notdir" {
+				for i, word := range words {
+					words[i] = filepath.Base(word)
+				}
+			} else if function == "sort" {
+				sort.Strings(words)
+			}
+			return strings.Join(words, " ")
+		default:
+			m.ignore("$("+function+")", "the function isn't understood")
+			return ""
+		}
+	}
+	name := m.expand(ref, depth+1)
+	// A substitution reference, $(SRCS:.c=.o).
+	if colon := strings.Index(name, ":"); colon > 0 {
+		if equals := strings.Index(name[colon:], "="); equals > 0 {
+			value := m.expand(m.value(name[:colon]), depth+1)
+			from, to := name[colon+1:colon+equals], name[colon+equals+1:]
+			if !strings.Contains(from, "%") {
+				from, to = "%"+from, "%"+to
+			}
+			return patsubst(from, to, value)
+		}
+	}
+	return m.expand(m.value(name), depth+1)
+}
+
+//  Replace words matching a % pattern as make's patsubst does.
+//
+func patsubst(pattern, replacement, text string) string {
+	var words []string
+	percent := strings.Index(pattern, "%")
+	for _, word := range strings.Fields(text) {
+		switch {
+		case percent < 0:
+			if word == pattern {
+				word = replacement
+			}
+		case strings.HasPrefix(word, pattern[:percent]) && strings.HasSuffix(word[percent:], pattern[percent+1:]):
+			stem := word[percent : len(word)-len(pattern)+percent+1]
+			word = strings.Replace(replacement, "%", stem, 1)
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " ")
+}
+
+//  Read a makefile's logical lines, joining continued lines and
+//  removing comments. Recipe lines are dropped.
+//
+func makefileLines(text string) []string {
+	var lines []string
+	var current string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if strings.HasSuffix(line, "\\") {
+			current += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		line = current + line
+		current = ""
+		if strings.HasPrefix(line, "\t") {
+			continue
+		}
+		if hash := strings.Index(line, "#"); hash >= 0 && (hash == 0 || line[hash-1] != '\\') {
+			line = line[:hash]
+		}
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+//  Read a simple makefile, the sort that defines variables listing
+//  the sources or objects, CFLAGS, LDFLAGS and LDLIBS and has a rule
+//  linking the output.
+//
+func ImportMakefile(path string) (*ImportedProject, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &makeImporter{path: path, vars: make(map[string]string), ignored: make(map[string]bool)}
+
+	var order []string
+	var firstTarget string
+	var prerequisites []string
+	for _, line := range makefileLines(string(content)) {
+		if match := makeAssignmentRegexp.FindStringSubmatch(line); match != nil {
+			name, operator, value := match[1], match[2], strings.TrimSpace(match[3])
+			if !Contains(order, name) {
+				order = append(order, name)
+			}
+			switch operator {
+			case ":=", "::=", ":::=":
+				m.vars[name] = m.expand(value, 0)
+			case "+=":
+				m.vars[name] = strings.TrimSpace(m.vars[name] + " " + value)
+			case "?=":
+				if _, found := m.vars[name]; !found {
+					m.vars[name] = value
+				}
+			case "!=":
+				m.ignore(name+" != ...", "shell commands aren't run")
+			default:
+				m.vars[name] = value
+			}
+			continue
+		}
+		words := strings.Fields(line)
+		switch words[0] {
+		case "ifeq", "ifneq", "ifdef", "ifndef", "else", "endif":
+			m.ignore("conditionals", "all branches are used")
+			continue
+		case "include", "-include", "sinclude":
+			m.ignore(line, "included makefiles aren't read")
+			continue
+		case "define", "endef", "vpath", "export", "unexport":
+			continue
+		}
+		if match := makeRuleRegexp.FindStringSubmatch(line); match != nil && firstTarget == "" {
+			for _, target := range strings.Fields(m.expand(match[1], 0)) {
+				if strings.HasPrefix(target, ".") || strings.Contains(target, "%") || filepath.Ext(target) == ".o" {
+					continue
+				}
+				if Contains([]string{"all", "clean", "distclean", "install", "uninstall", "test", "check"}, target) {
+					continue
+				}
+				firstTarget = target
+				prerequisites = strings.Fields(m.expand(match[2], 0))
+				break
+			}
+		}
+	}
+
+	p := &ImportedProject{}
+
+	output := firstTarget
+	for _, name := range makeOutputVariables {
+		if value := strings.TrimSpace(m.expand(m.vars[name], 0)); value != "" && len(strings.Fields(value)) == 1 {
+			output = value
+			if (name == "LIB" || name == "LIBRARY") && filepath.Ext(value) == "" {
+				output = "lib" + value + ".a"
+			}
+			break
+		}
+	}
+	if output == "" {
+		return nil, fmt.Errorf("%s: the output built isn't known", path)
+	}
+	base := filepath.Base(output)
+	switch filepath.Ext(base) {
+	case ".a", ".lib":
+		p.projectType = "lib"
+	case ".so", ".dylib", ".dll":
+		p.projectType = "dll"
+	default:
+		p.projectType = "exe"
+	}
+	if p.projectType != "exe" {
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+		if strings.HasPrefix(base, "lib") && len(base) > 3 {
+			base = base[3:]
+		}
+	} else {
+		base = strings.TrimSuffix(base, ".exe")
+	}
+	p.name = base
+
+	for _, name := range order {
+		if makeSourcesRegexp.MatchString(name) {
+			p.addSources(strings.Fields(m.expand(m.vars[name], 0))...)
+		}
+	}
+	if len(p.sources) == 0 {
+		var objects []string
+		for _, name := range order {
+			if makeObjectsRegexp.MatchString(name) {
+				objects = append(objects, strings.Fields(m.expand(m.vars[name], 0))...)
+			}
+		}
+		if len(objects) == 0 {
+			objects = prerequisites
+		}
+		for _, object := range objects {
+			if filepath.Ext(object) != ".o" {
+				p.addSources(object)
+				continue
+			}
+			if source := sourceForObject(object); source != "" {
+				p.addSources(source)
+			} else {
+				logger.Warnf("%s: no source file found for %s", path, object)
+			}
+		}
+	}
+	if len(p.sources) == 0 {
+		return nil, fmt.Errorf("%s: no source files found", path)
+	}
+
+	for _, name := range []string{"CPPFLAGS", "CFLAGS", "CXXFLAGS", "OBJCFLAGS"} {
+		p.addCompilerOptions(ShellWords(m.expand(m.vars[name], 0))...)
+	}
+	p.addLinkerOptions(ShellWords(m.expand(m.vars["LDFLAGS"], 0))...)
+	for _, name := range []string{"LDLIBS", "LIBS", "LOADLIBES"} {
+		p.addLinkerOptions(ShellWords(m.expand(m.vars[name], 0))...)
+	}
+	return p, nil
+}
+
+//  Return the source file an object file is compiled from, if any.
+//
+func sourceForObject(object string) string {
+	stem := strings.TrimSuffix(object, ".o")
+	for _, patterns := range languageExtension {
+		for _, pattern := range patterns {
+			path := stem + strings.TrimPrefix(pattern, "*")
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestImportProject(t *testing.T) {
+	inTempProject(t, map[string]string{
+		"src/main.cpp": "int main() {}\n",
+		"src/util.cpp": "\n",
+	})
+	os.WriteFile(cmakeListsFilename, []byte(`project(app)
+set(CMAKE_CXX_STANDARD 17)
+set(SOURCES src/main.cpp # the program
+    "src/util.cpp")
+add_executable(${PROJECT_NAME} ${SOURCES} src/util.h)
+target_include_directories(${PROJECT_NAME} PRIVATE include)
+target_compile_definitions(${PROJECT_NAME} PRIVATE VERBOSE=1)
+target_link_libraries(${PROJECT_NAME} PUBLIC m)
+`), 0666)
+	p, err := ImportProject("cmake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &ImportedProject{
+		name:        "app",
+		projectType: "exe",
+		sources:     []string{filepath.Join("src", "main.cpp"), filepath.Join("src", "util.cpp")},
+		std:         "c++17",
+		cflags:      []string{"-Iinclude", "-DVERBOSE=1"},
+		libs:        []string{"-lm"},
+	}
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("imported %+v from CMakeLists.txt, expected %+v", p, expected)
+	}
+
+	os.WriteFile("Makefile", []byte(`CFLAGS = -O2 -Wall -DNAME=\"x\" \
+	-Iinclude
+SRCS = $(wildcard src/*.cpp)
+OBJS = $(SRCS:.cpp=.o)
+libapp.a: $(OBJS)
+	$(AR) rc $@ $^
+`), 0666)
+	if p, err = ImportProject("make"); err != nil {
+		t.Fatal(err)
+	}
+	expected = &ImportedProject{
+		name:        "app",
+		projectType: "lib",
+		sources:     []string{filepath.Join("src", "main.cpp"), filepath.Join("src", "util.cpp")},
+		cflags:      []string{`-DNAME="x"`, "-Iinclude"},
+	}
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("imported %+v from Makefile, expected %+v", p, expected)
+	}
+}
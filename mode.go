@@ -0,0 +1,197 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const dccOptionsDirectory = ".dcc"
+
+var (
+	// The build mode given by -mode, or implied by the action, e.g.
+	// debug. It takes precedence over the mode selected by a .dmake
+	// file's MODE variable. Empty if no mode was given.
+	//
+	buildMode string
+
+	// The directories under which object and dependency files
+	// are placed, in sub-directories for the mode and target. A
+	// .dmake file's OBJDIR may select another objects directory.
+	//
+	objsRoot = Getenv("OBJDIR", defaultObjFileDir)
+	depsRoot = Getenv("DCCDEPS", defaultDepsFileDir)
+
+	// The names of the dcc options files used to compile each
+	// language.
+	//
+	compilerOptionsFilename = map[Language]string{
+		CLanguage:            "CFLAGS",
+		CplusplusLanguage:    "CXXFLAGS",
+		ObjcLanguage:         "OBJCFLAGS",
+		ObjcplusplusLanguage: "OBJCXXFLAGS",
+	}
+)
+
+//  Select the build mode for every directory, as per -mode. Each mode
+//  uses its own object and dependency directories,
+//  .objs/<mode>/<os>-<arch>, and places its output in a directory
+//  named for the mode so switching modes doesn't clobber another
+//  mode's files.
+//
+func SetMode(mode string) error {
+	if err := CheckMode(mode); err != nil {
+		return err
+	}
+	if buildMode != "" && mode != buildMode {
+		return fmt.Errorf("%q: build mode already set to %s", mode, buildMode)
+	}
+	buildMode = mode
+	return nil
+}
+
+//  Return an error if a build mode's name can't be used as a
+//  directory name.
+//
+func CheckMode(mode string) error {
+	if mode == "" || strings.ContainsAny(mode, `/\`) || len(strings.Fields(mode)) != 1 {
+		return fmt.Errorf("%q: malformed build mode", mode)
+	}
+	return nil
+}
+
+//  Return the receiver's build mode, that given by -mode, otherwise
+//  that selected by its .dmake file's MODE variable, if any. A
+//  directory's mode doesn't affect other directories, or sections.
+//
+func (dmake *Dmake) Mode() string {
+	if buildMode != "" {
+		return buildMode
+	}
+	return dmake.mode
+}
+
+//  Return the directory, under root, used for the files built for
+//  the receiver's mode and the target, root/<mode>/<os>-<arch>.
+//
+func (dmake *Dmake) BuildDirectory(root string) string {
+	return filepath.Join(root, dmake.ModeDirectory(), dmake.Target().os+"-"+dmake.Target().arch)
+}
+
+//  Return the name of the directory for the mode's files, the mode
+//  followed by the name of any sanitizers used, static when linking
+//  statically and cov when measuring coverage, e.g. debug-asan.
+//
+func (dmake *Dmake) ModeDirectory() string {
+	var names []string
+	for _, name := range []string{dmake.Mode(), dmake.SanitizerName()} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if dmake.Static() {
+		names = append(names, staticModeName)
+	}
+	if coverageBuild {
+		names = append(names, coverageModeName)
+	}
+	return strings.Join(names, "-")
+}
+
+//  Return the directory under which the receiver's object files are
+//  placed, that named by the OBJDIR environment variable, otherwise
+//  by its .dmake file's OBJDIR variable, otherwise .objs.
+//
+func (dmake *Dmake) ObjsRoot() string {
+	if dmake.objsRoot != "" && os.Getenv("OBJDIR") == "" {
+		return dmake.objsRoot
+	}
+	return objsRoot
+}
+
+//  Return the compiler options for the build mode used when
+//  compiling the given language. These are read from the mode's dcc
+//  options file, e.g. .dcc/CXXFLAGS.release, if it exists. The debug
+//  mode always includes debug information.
+//
+func (dmake *Dmake) ModeOptions(language Language) ([]string, error) {
+	mode := dmake.Mode()
+	filename, found := compilerOptionsFilename[language]
+	if mode == "" || !found {
+		return nil, nil
+	}
+	options, err := ReadOptionsFile(filepath.Join(dccOptionsDirectory, filename+"."+mode))
+	if os.IsNotExist(err) {
+		options, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return DebugModeOptions(mode, options), nil
+}
+
+//  A build variant is a mode and target that files have been built
+//  for, identified by its directory under the objects directory.
+//
+type BuildVariant struct {
+	mode   string // the build mode, if any
+	goos   string // the target's operating system
+	goarch string // the target's architecture
+}
+
+//  Return the directory, under root, used for the variant's files.
+//
+func (v BuildVariant) Directory(root string) string {
+	return filepath.Join(root, v.mode, v.goos+"-"+v.goarch)
+}
+
+//  Return the variants that have a directory under root.
+//
+func BuildVariants(root string) []BuildVariant {
+	var variants []BuildVariant
+	for _, pattern := range []string{"*", filepath.Join("*", "*")} {
+		dirs, _ := filepath.Glob(filepath.Join(root, pattern))
+		for _, dir := range dirs {
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				continue
+			}
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				continue
+			}
+			if v, ok := ParseBuildVariant(rel); ok {
+				variants = append(variants, v)
+			}
+		}
+	}
+	return variants
+}
+
+//  Parse a variant's directory, relative to its root, of the form
+//  <os>-<arch> or <mode>/<os>-<arch>.
+//
+func ParseBuildVariant(path string) (BuildVariant, bool) {
+	var v BuildVariant
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	if len(parts) == 2 {
+		v.mode, parts = parts[0], parts[1:]
+	}
+	if len(parts) != 1 {
+		return v, false
+	}
+	dash := strings.Index(parts[0], "-")
+	if dash < 1 || dash == len(parts[0])-1 {
+		return v, false
+	}
+	v.goos, v.goarch = parts[0][:dash], parts[0][dash+1:]
+	return v, Contains(knownPlatforms, v.goos)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirectoryModes(t *testing.T) {
+	release, other := &Dmake{}, &Dmake{}
+	vars := make(Vars)
+	vars.SetValue("MODE", "release")
+	if err := release.InitFromVars(vars); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.InitFromVars(make(Vars)); err != nil {
+		t.Fatal(err)
+	}
+	platform := targetOS + "-" + targetArch
+	if dir := release.ObjsDir(); dir != filepath.Join(objsRoot, "release", platform) {
+		t.Errorf("release objects directory %q", dir)
+	}
+	if dir := other.ObjsDir(); dir != filepath.Join(objsRoot, platform) {
+		t.Errorf("another directory's objects directory %q, the release mode leaked", dir)
+	}
+
+	vars.SetValue("MODE", "debug")
+	if err := other.InitFromVars(vars); err != nil {
+		t.Errorf("a directory's mode conflicted with another's: %v", err)
+	}
+
+	defer func() { buildMode = "" }()
+	if err := SetMode("profile"); err != nil {
+		t.Fatal(err)
+	}
+	if mode := release.Mode(); mode != "profile" {
+		t.Errorf("mode %q, -mode didn't take precedence", mode)
+	}
+	vars.SetValue("MODE", "a/b")
+	if err := other.InitFromVars(vars); err == nil {
+		t.Error("expected an error for a malformed MODE")
+	}
+}
+
+func TestDirectoryObjectsRoot(t *testing.T) {
+	if os.Getenv("OBJDIR") != "" {
+		t.Skip("OBJDIR is set")
+	}
+	build, other := &Dmake{}, &Dmake{}
+	vars := make(Vars)
+	vars.SetValue("OBJDIR", "build")
+	if err := build.InitFromVars(vars); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.InitFromVars(make(Vars)); err != nil {
+		t.Fatal(err)
+	}
+	if root := build.ObjsRoot(); root != "build" {
+		t.Errorf("objects root %q, expected build", root)
+	}
+	if root := other.ObjsRoot(); root != defaultObjFileDir {
+		t.Errorf("another directory's objects root %q, OBJDIR leaked", root)
+	}
+}
+
+func TestDirectoryLanguage(t *testing.T) {
+	cplusplus, other := &Dmake{}, &Dmake{}
+	vars := make(Vars)
+	vars.SetValue("LANG", "c++")
+	if err := cplusplus.InitFromVars(vars); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.InitFromVars(make(Vars)); err != nil {
+		t.Fatal(err)
+	}
+	if language := cplusplus.LanguageOf([]string{"a.c"}); language != CplusplusLanguage {
+		t.Errorf("language %v, expected c++", language)
+	}
+	if language := other.LanguageOf([]string{"a.c"}); language != CLanguage {
+		t.Errorf("another directory's language %v, LANG leaked", language)
+	}
+	if language := other.LinkerLanguage(); language != CLanguage {
+		t.Errorf("another directory's linker language %v, LANG leaked", language)
+	}
+}
+
+func TestParseBuildVariant(t *testing.T) {
+	check := func(path string, expected BuildVariant, ok bool) {
+		v, parsed := ParseBuildVariant(path)
+		if parsed != ok || ok && v != expected {
+			t.Errorf("%q parsed as %+v, %v, expected %+v, %v", path, v, parsed, expected, ok)
+		}
+	}
+	check("linux-amd64", BuildVariant{goos: "linux", goarch: "amd64"}, true)
+	check(filepath.Join("release", "windows-arm64"), BuildVariant{mode: "release", goos: "windows", goarch: "arm64"}, true)
+	check("notes", BuildVariant{}, false)
+	check("x-y", BuildVariant{}, false)
+	check("linux-", BuildVariant{}, false)
+	check(filepath.Join("a", "b", "linux-amd64"), BuildVariant{}, false)
+}
@@ -0,0 +1,147 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//  Targets may be named on the command line, e.g. "dmake build libfoo",
+//  rather than by the directory building them. A name is found by
+//  searching the current directory and its sub-directories for a target
+//  whose section, output filename or output name, e.g. foo for libfoo.a,
+//  is the name. A target in the current directory is preferred,
+//  otherwise the name must be unique.
+//
+//  Only the named targets and the directories they depend upon, as
+//  declared by DEPENDS(dir) or a workspace's DEPENDS, are built.
+//
+
+//  Return true if the target has the given name.
+//
+func (target *Dmake) HasName(name string) bool {
+	if target.outputname == name {
+		return true
+	}
+	// Preparing determines the output's name. The target itself is
+	// prepared when it's built so a copy is used.
+	//
+	prepared := *target
+	if ok, err := prepared.Prepare(); !ok || err != nil {
+		return false
+	}
+	return prepared.Name() == name || filepath.Base(prepared.outputname) == name
+}
+
+//  Return those of the receiver's targets with any of the given names,
+//  a section's name being one of them.
+//
+func (dmake *Dmake) NamedTargets(names []string) []*Dmake {
+	sections := len(dmake.targets) > 0
+	targets := dmake.targets
+	if !sections {
+		targets = []*Dmake{dmake}
+	}
+	var named []*Dmake
+	for _, target := range targets {
+		for _, name := range names {
+			if sections && target.defaultoutput == name || target.HasName(name) {
+				named = append(named, target)
+				break
+			}
+		}
+	}
+	return named
+}
+
+//  Find the directories building the named targets. Returns the names
+//  found in each directory, by path relative to the current directory,
+//  and the dependencies between all the directories searched.
+//
+func (dmake *Dmake) FindNamedTargets(names []string) (map[string][]string, map[string][]string, error) {
+	found := make(map[string][]string)
+	dependencies := make(map[string][]string)
+	err := dmake.Walk(".", func(dir string, d *Dmake) error {
+		for path, paths := range d.dependencies {
+			path = filepath.Join(dir, path)
+			for _, dependency := range paths {
+				dependencies[path] = append(dependencies[path], filepath.Join(dir, dependency))
+			}
+		}
+		for _, name := range names {
+			if len(d.NamedTargets([]string{name})) > 0 {
+				found[name] = append(found[name], dir)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	selected := make(map[string][]string)
+	for _, name := range names {
+		dirs := found[name]
+		switch {
+		case len(dirs) == 0:
+			return nil, nil, fmt.Errorf("%s: no target of that name is defined", name)
+		case Contains(dirs, "."):
+			dirs = []string{"."}
+		case len(dirs) > 1:
+			return nil, nil, fmt.Errorf("%s: targets of that name are defined in %s", name, strings.Join(dirs, ", "))
+		}
+		selected[dirs[0]] = append(selected[dirs[0]], name)
+	}
+	return selected, dependencies, nil
+}
+
+//  Limit what the receiver builds to the targets named on the command
+//  line. Named targets in the receiver's own directory are built along
+//  with all its sub-directories, as usual. Otherwise only the
+//  directories building the targets, and those they depend upon, are
+//  built and each is told which of its targets to build.
+//
+func (dmake *Dmake) SelectNamedTargets() error {
+	selected, dependencies, err := dmake.FindNamedTargets(dmake.targetNames)
+	if err != nil {
+		return err
+	}
+	if names, found := selected["."]; found {
+		if len(dmake.targets) > 0 {
+			dmake.targets = dmake.NamedTargets(names)
+		}
+		return nil
+	}
+	dmake.targets = nil
+	dmake.onlyDirectories = true
+	dmake.directories = nil
+	dmake.dependencies = dependencies
+	dmake.selected = selected
+	var add func(dir string)
+	add = func(dir string) {
+		if Contains(dmake.directories, dir) {
+			return
+		}
+		for _, dependency := range dependencies[dir] {
+			add(dependency)
+		}
+		dmake.AddDirectory(dir)
+	}
+	dirs := make([]string, 0, len(selected))
+	for dir := range selected {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		add(dir)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamedTargets(t *testing.T) {
+	dmake := &Dmake{
+		targets: []*Dmake{
+			{defaultoutput: "foo", outputname: "libfoo.a"},
+			{defaultoutput: "bar", outputname: "bar-tool"},
+		},
+	}
+	check := func(names []string, expected ...string) {
+		var outputs []string
+		for _, target := range dmake.NamedTargets(names) {
+			outputs = append(outputs, target.outputname)
+		}
+		if !reflect.DeepEqual(outputs, expected) {
+			t.Errorf("%q named %q, expected %q", names, outputs, expected)
+		}
+	}
+
+	check([]string{"foo"}, "libfoo.a")
+	check([]string{"libfoo.a"}, "libfoo.a")
+	check([]string{"bar-tool", "foo"}, "libfoo.a", "bar-tool")
+	check([]string{"bar"}, "bar-tool")
+}
@@ -0,0 +1,110 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const ninjaFilename = "build.ninja"
+
+//  Write a ninja build file that builds the targets after building
+//  the sub-directories, each of which has its own build.ninja.
+//
+func WriteNinjaFile(path string, targets []*ExportTarget, directories []string, tools ExportTools) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s generated by dmake export ninja\n\n", path)
+	fmt.Fprintf(&b, "cc = %s\n", ninjaEscapeValue(tools.cc))
+	fmt.Fprintf(&b, "cxx = %s\n", ninjaEscapeValue(tools.cxx))
+	fmt.Fprintf(&b, "ar = %s\n", ninjaEscapeValue(tools.ar))
+	fmt.Fprintln(&b)
+
+	for _, compiler := range []string{"cc", "cxx"} {
+		fmt.Fprintf(&b, "rule %s\n", compiler)
+		fmt.Fprintf(&b, "  command = $%s $flags -MMD -MF $out.d -c $in -o $out\n", compiler)
+		fmt.Fprintln(&b, "  depfile = $out.d")
+		fmt.Fprintln(&b, "  deps = gcc")
+		fmt.Fprintf(&b, "  description = %s $in\n\n", strings.ToUpper(compiler))
+	}
+	fmt.Fprintln(&b, "rule ar")
+	fmt.Fprintln(&b, "  command = rm -f $out && $ar rcs $out $in")
+	fmt.Fprintln(&b, "  description = AR $out")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "rule link")
+	fmt.Fprintln(&b, "  command = $ld $ldflags -o $out $in $libs")
+	fmt.Fprintln(&b, "  description = LINK $out")
+	fmt.Fprintln(&b)
+	if len(directories) > 0 {
+		fmt.Fprintln(&b, "rule ninja")
+		fmt.Fprintln(&b, "  command = ninja -C $dir")
+		fmt.Fprintln(&b, "  description = NINJA $dir")
+		fmt.Fprintln(&b, "  pool = console")
+		fmt.Fprintln(&b)
+	}
+
+	var all, dirs []string
+	for _, dir := range directories {
+		stamp := "dir-" + filepath.ToSlash(dir)
+		fmt.Fprintf(&b, "build %s: ninja\n", ninjaEscapePath(stamp))
+		fmt.Fprintf(&b, "  dir = %s\n\n", ninjaEscapeValue(dir))
+		dirs = append(dirs, ninjaEscapePath(stamp))
+	}
+	all = append(all, dirs...)
+
+	orderOnly := ""
+	if len(dirs) > 0 {
+		orderOnly = " || " + strings.Join(dirs, " ")
+	}
+
+	for _, target := range targets {
+		var objects []string
+		for _, source := range target.sources {
+			rule := "cc"
+			if source.language == CplusplusLanguage || source.language == ObjcplusplusLanguage {
+				rule = "cxx"
+			}
+			object := ninjaEscapePath(source.object)
+			fmt.Fprintf(&b, "build %s: %s %s%s\n", object, rule, ninjaEscapePath(source.path), orderOnly)
+			fmt.Fprintf(&b, "  flags = %s\n\n", ninjaEscapeValue(strings.Join(source.options, " ")))
+			objects = append(objects, object)
+		}
+		output := ninjaEscapePath(target.output)
+		if target.outputtype == LibOutputType {
+			fmt.Fprintf(&b, "build %s: ar %s\n\n", output, strings.Join(objects, " "))
+		} else {
+			ld := "$cc"
+			if target.linker == CplusplusLanguage {
+				ld = "$cxx"
+			}
+			fmt.Fprintf(&b, "build %s: link %s\n", output, strings.Join(objects, " "))
+			fmt.Fprintf(&b, "  ld = %s\n", ld)
+			fmt.Fprintf(&b, "  ldflags = %s\n", ninjaEscapeValue(strings.Join(target.ldflags, " ")))
+			fmt.Fprintf(&b, "  libs = %s\n\n", ninjaEscapeValue(strings.Join(target.libs, " ")))
+		}
+		all = append(all, output)
+	}
+
+	fmt.Fprintf(&b, "build all: phony %s\n", strings.Join(all, " "))
+	fmt.Fprintln(&b, "default all")
+
+	return CreateFile(path, b.String())
+}
+
+func ninjaEscapeValue(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
+
+func ninjaEscapePath(s string) string {
+	s = ninjaEscapeValue(filepath.ToSlash(s))
+	s = strings.ReplaceAll(s, " ", "$ ")
+	return strings.ReplaceAll(s, ":", "$:")
+}
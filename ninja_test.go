@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+const ninjaRules = `cc = cc
+cxx = c++
+ar = ar
+
+rule cc
+  command = $cc $flags -MMD -MF $out.d -c $in -o $out
+  depfile = $out.d
+  deps = gcc
+  description = CC $in
+
+rule cxx
+  command = $cxx $flags -MMD -MF $out.d -c $in -o $out
+  depfile = $out.d
+  deps = gcc
+  description = CXX $in
+
+rule ar
+  command = rm -f $out && $ar rcs $out $in
+  description = AR $out
+
+rule link
+  command = $ld $ldflags -o $out $in $libs
+  description = LINK $out
+
+`
+
+func TestExportNinja(t *testing.T) {
+	files := exportProject(t, "ninja", ninjaFilename)
+	checkExported(t, files, map[string]string{
+		"build.ninja": "# build.ninja generated by dmake export ninja\n\n" + ninjaRules + `rule ninja
+  command = ninja -C $dir
+  description = NINJA $dir
+  pool = console
+
+build dir-lib: ninja
+  dir = lib
+
+build $OBJS/main.o: cc main.c || dir-lib
+  flags = -Wall -Iinclude
+
+build app: link $OBJS/main.o
+  ld = $cc
+  ldflags = 
+  libs = -Llib -llib -lm
+
+build all: phony dir-lib app
+default all
+`,
+		"lib/build.ninja": "# build.ninja generated by dmake export ninja\n\n" + ninjaRules + `build $OBJS/lib.o: cc lib.c
+  flags = 
+
+build lib.a: ar $OBJS/lib.o
+
+build all: phony lib.a
+default all
+`,
+	})
+}
@@ -0,0 +1,272 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//  dmake package makes two tarballs, <name>-<version>.tar.gz of the
+//  sources and <name>-<version>-<os>-<arch>.tar.gz of the installed
+//  files. The version is defined by the VERSION variable. Source files
+//  are those in the directory tree less those excluded by .gitignore
+//  files and the files dmake itself creates. The installed files are
+//  those installed by "dmake install" into a staging directory, via
+//  DESTDIR, so the binary tarball holds the files as installed
+//  beneath the prefix. Other formats, Debian packages, ZIP archives
+//  and macOS installer packages, are made from the same staged
+//  install.
+//
+const packageSuffix = ".tar.gz"
+
+//  The format made by dmake package, "" for tarballs.
+//
+var packageFormat string
+
+var packageFormats = []string{debPackageFormat, zipPackageFormat, macPackageFormat}
+
+//  The staging directory prefixed to every installed file's name
+//  while packaging, in place of any DESTDIR.
+//
+var stagingDir string
+
+// dmake package in cwd
+//
+func (dmake *Dmake) PackageAction(env []string) error {
+	version := dmake.vars.GetString("VERSION")
+	if version == "" {
+		return fmt.Errorf("package requires a VERSION")
+	}
+	switch packageFormat {
+	case debPackageFormat:
+		return dmake.DebPackage(env, version)
+	case zipPackageFormat:
+		return dmake.ZipPackage(env, version)
+	case macPackageFormat:
+		return dmake.MacPackage(env, version)
+	}
+	base := dmake.defaultoutput + "-" + version
+
+	sourcePackage := dmake.BuildPath(base + packageSuffix)
+	files, err := dmake.PackageSourceFiles()
+	if err != nil {
+		return err
+	}
+	if !DryRun("tar", "-czf", sourcePackage, base) {
+		if err := WriteTarball(sourcePackage, base, ".", files); err != nil {
+			return err
+		}
+		logger.Infof("wrote %s, %d files", sourcePackage, len(files))
+	}
+
+	binaryPackage := dmake.BuildPath(base + "-" + dmake.Target().os + "-" + dmake.Target().arch + packageSuffix)
+	return dmake.StagedInstall(env, func(stage string) error {
+		if DryRun("tar", "-czf", binaryPackage, "-C", stage, ".") {
+			return nil
+		}
+		var installed []string
+		err := filepath.Walk(stage, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(stage, path)
+			installed = append(installed, rel)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if err := WriteTarball(binaryPackage, "", stage, installed); err != nil {
+			return err
+		}
+		logger.Infof("wrote %s, %d files", binaryPackage, len(installed))
+		return nil
+	})
+}
+
+//  Install the receiver's files, and those of its sub-directories,
+//  into a temporary staging directory, as per DESTDIR, and call a
+//  function to package them. The staging directory is then removed.
+//
+func (dmake *Dmake) StagedInstall(env []string, packager func(stage string) error) error {
+	stage, err := os.MkdirTemp("", "dmake-package-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stage)
+	savedVars := commandLineVars.Copy()
+	stagingDir = stage
+	commandLineVars.SetValue("DESTDIR", stage) // for sub-directories
+	defer func() { stagingDir, commandLineVars = "", savedVars }()
+	if err := dmake.Run(Installing, env); err != nil {
+		return err
+	}
+	return packager(stage)
+}
+
+//  Return the directory prefixed to the names of the files the
+//  receiver installs, the staging directory when packaging, otherwise
+//  that defined by its DESTDIR variable, or environment variable.
+//
+func (dmake *Dmake) DestDir() string {
+	if stagingDir != "" {
+		return stagingDir
+	}
+	return dmake.destDir
+}
+
+//  Return the patterns excluding the files dmake creates from source
+//  packages, object and dependency files, tests, generated sources,
+//  reports, outputs and packages.
+//
+func (dmake *Dmake) PackageExcludes() ([]string, error) {
+	patterns := []string{".git/", installManifestFilename, compileCommandsFilename}
+	for _, dir := range []string{dmake.ObjsRoot(), depsRoot, testsDirectory, defaultGenDir} {
+		if dir = filepath.ToSlash(filepath.Clean(dir)); !filepath.IsAbs(dir) && !strings.HasPrefix(dir, "..") {
+			if strings.Contains(dir, "/") {
+				dir = "/" + dir
+			}
+			patterns = append(patterns, dir+"/")
+		}
+	}
+	if IsCoverageReport(coverageDirectory) {
+		patterns = append(patterns, "/"+coverageDirectory+"/")
+	}
+	if IsDoxygenOutput(docsDirectory) {
+		patterns = append(patterns, "/"+docsDirectory+"/html/")
+	}
+	if dir := dmake.ModeDirectory(); dir != "" {
+		patterns = append(patterns, "/"+dir+"/")
+	}
+	patterns = append(patterns,
+		"/"+dmake.defaultoutput+"-*"+packageSuffix,
+		"/"+dmake.defaultoutput+"-*.zip",
+		"/"+dmake.defaultoutput+"-*.pkg",
+		"/"+dmake.DebName()+"_*.deb",
+	)
+
+	candidates := dmake.targets
+	if len(candidates) == 0 {
+		candidates = []*Dmake{dmake}
+	}
+	for _, candidate := range candidates {
+		ok, err := candidate.Prepare()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			patterns = append(patterns, "/"+filepath.ToSlash(filepath.Clean(candidate.OutputPath())))
+		}
+	}
+	return patterns, nil
+}
+
+//  Return the files, relative to the current directory, put in a
+//  source package.
+//
+func (dmake *Dmake) PackageSourceFiles() ([]string, error) {
+	excludes, err := dmake.PackageExcludes()
+	if err != nil {
+		return nil, err
+	}
+	patterns := ParseIgnorePatterns(excludes, "")
+	var files []string
+	err = filepath.Walk(".", func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := filepath.ToSlash(name)
+		if rel != "." && IsIgnored(patterns, rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			more, err := ReadIgnoreFile(rel)
+			patterns = append(patterns, more...)
+			return err
+		}
+		files = append(files, name)
+		return nil
+	})
+	return files, err
+}
+
+//  Write a gzipped tarball of files, named relative to a root
+//  directory, with the given prefix prepended to their names.
+//  Symbolic links are kept as links and owners aren't recorded.
+//
+func WriteTarball(filename, prefix, root string, files []string) (err error) {
+	sort.Strings(files)
+	defer WritingFile(filename)()
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(filename)
+		}
+	}()
+	zw := gzip.NewWriter(file)
+	tw := tar.NewWriter(zw)
+	for _, name := range files {
+		pathname := filepath.Join(root, name)
+		info, err := os.Lstat(pathname)
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(pathname); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(prefix, filepath.ToSlash(name))
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if err := copyFileTo(tw, pathname); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func copyFileTo(w io.Writer, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
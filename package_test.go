@@ -0,0 +1,134 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDirectoryDestDir(t *testing.T) {
+	t.Setenv("DESTDIR", "/env/stage")
+	staged, other := &Dmake{}, &Dmake{}
+	vars := make(Vars)
+	vars.SetValue("DESTDIR", "/tmp/stage")
+	if err := staged.InitFromVars(vars); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.InitFromVars(make(Vars)); err != nil {
+		t.Fatal(err)
+	}
+	if dir := staged.DestDir(); dir != "/tmp/stage" {
+		t.Errorf("DESTDIR %q, expected /tmp/stage", dir)
+	}
+	if dir := other.DestDir(); dir != "/env/stage" {
+		t.Errorf("another directory's DESTDIR %q, expected $DESTDIR", dir)
+	}
+
+	stagingDir = "/package/stage"
+	defer func() { stagingDir = "" }()
+	if dir := staged.DestDir(); dir != stagingDir {
+		t.Errorf("DESTDIR %q when packaging, expected %s", dir, stagingDir)
+	}
+}
+
+//  Return the names of the files in a gzipped tarball and their
+//  contents.
+//
+func readTarball(t *testing.T, filename string) map[string]string {
+	t.Helper()
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Uid != 0 || hdr.Uname != "" {
+			t.Errorf("%s: %s owned by %s", filename, hdr.Name, hdr.Uname)
+		}
+		files[hdr.Name] = string(data)
+	}
+}
+
+//  Return the Dmake for a program, in the current directory, that's
+//  already been built, so packaging installs it without building.
+//  The messages logged during the rest of the test are returned.
+//
+func builtProgram(t *testing.T, prefix string) (*Dmake, *strings.Builder) {
+	t.Helper()
+	dmake := NewDmake("prog", "", prefix)
+	if err := dmake.ReadDmakefile(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dmake.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, ".", map[string]string{dmake.OutputPath(): "program", filepath.Join(dmake.ObjsDir(), "main.o"): "object"})
+	saved, savedLogger := *noBuildFlag, logger
+	t.Cleanup(func() { *noBuildFlag, logger = saved, savedLogger })
+	*noBuildFlag = true
+	var b strings.Builder
+	logger = &Logger{w: &b, level: InfoLevel}
+	return dmake, &b
+}
+
+func TestPackage(t *testing.T) {
+	inTempProject(t, map[string]string{
+		dmakeFileFilename: "VERSION = 1.2\n",
+		".gitignore":      "*.log\n",
+		"main.c":          "int main() { return 0; }\n",
+		"doc/prog.txt":    "docs",
+		"build.log":       "ignored",
+		"prog-1.1.tar.gz": "an old package",
+	})
+	dmake, log := builtProgram(t, "/usr/local")
+	if err := dmake.PackageAction(os.Environ()); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := commandLineVars["DESTDIR"]; found {
+		t.Error("DESTDIR left defined after packaging")
+	}
+	if s := log.String(); !strings.Contains(s, "wrote prog-1.2.tar.gz, 4 files") {
+		t.Errorf("logged %q", s)
+	}
+	sources := readTarball(t, "prog-1.2.tar.gz")
+	expected := map[string]string{
+		"prog-1.2/" + dmakeFileFilename: "VERSION = 1.2\n",
+		"prog-1.2/.gitignore":           "*.log\n",
+		"prog-1.2/main.c":               "int main() { return 0; }\n",
+		"prog-1.2/doc/prog.txt":         "docs",
+	}
+	if !reflect.DeepEqual(sources, expected) {
+		t.Errorf("source package holds %q, expected %q", sources, expected)
+	}
+	binaries := readTarball(t, "prog-1.2-"+DefaultTarget().os+"-"+DefaultTarget().arch+".tar.gz")
+	if !reflect.DeepEqual(binaries, map[string]string{"usr/local/bin/prog": "program"}) {
+		t.Errorf("binary package holds %q", binaries)
+	}
+
+	dmake.vars = make(Vars)
+	if err := dmake.PackageAction(os.Environ()); err == nil {
+		t.Error("packaged without a VERSION")
+	}
+}
@@ -0,0 +1,116 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultPkgConfigVersion = "0.0.0"
+)
+
+//  Return the contents of a pkg-config file describing the
+//  receiver's library when installed under prefix.
+//
+func (dmake *Dmake) PkgConfig(prefix string) string {
+	name := dmake.Name()
+
+	version, found := dmake.vars.GetValue("VERSION")
+	if !found {
+		version = defaultPkgConfigVersion
+	}
+	description, found := dmake.vars.GetValue("DESCRIPTION")
+	if !found {
+		description = name + " library"
+	}
+	if absPrefix, err := filepath.Abs(prefix); err == nil {
+		prefix = absPrefix
+	}
+	includedir, found := dmake.vars.GetValue("INCDIR")
+	if !found {
+		includedir = PkgConfigDirectory(dmake.IncludeDir(prefix), prefix)
+	} else if !filepath.IsAbs(includedir) {
+		includedir = "${prefix}/" + includedir
+	}
+	libdir := strings.Replace(PkgConfigDirectory(dmake.LibDir(prefix), prefix), "${prefix}", "${exec_prefix}", 1)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "prefix=%s\n", filepath.ToSlash(prefix))
+	fmt.Fprintln(&b, "exec_prefix=${prefix}")
+	fmt.Fprintf(&b, "libdir=%s\n", libdir)
+	fmt.Fprintf(&b, "includedir=%s\n", filepath.ToSlash(includedir))
+	fmt.Fprintln(&b)
+	fmt.Fprintf(&b, "Name: %s\n", name)
+	fmt.Fprintf(&b, "Description: %s\n", description)
+	fmt.Fprintf(&b, "Version: %s\n", version)
+	if len(dmake.packages) > 0 {
+		fmt.Fprintf(&b, "Requires: %s\n", strings.Join(dmake.packages, " "))
+	}
+	if dmake.outputtype != HeaderOnlyOutputType {
+		fmt.Fprintf(&b, "Libs: -L${libdir} -l%s\n", name)
+	}
+	fmt.Fprintln(&b, "Cflags: -I${includedir}")
+	return b.String()
+}
+
+//  Return the compiler options and the libraries, and associated
+//  linker options, needed to use the named packages as reported by
+//  pkg-config, those needed to link statically when linking
+//  statically. The PKG_CONFIG environment variable may name the
+//  pkg-config program to use.
+//
+func PackageOptions(packages []string, static bool) ([]string, []string, error) {
+	pkgconfig := Getenv("PKG_CONFIG", "pkg-config")
+	if _, err := exec.LookPath(pkgconfig); err != nil {
+		return nil, nil, fmt.Errorf("PKGS requires pkg-config: %s", err)
+	}
+	run := func(args ...string) ([]string, error) {
+		logger.Debugf("RUN: %s %v", pkgconfig, args)
+		output, err := exec.Command(pkgconfig, args...).Output()
+		return strings.Fields(string(output)), err
+	}
+	for _, pkg := range packages {
+		if _, err := run("--exists", pkg); err != nil {
+			return nil, nil, fmt.Errorf("PKGS: package %q not found by %s", pkg, pkgconfig)
+		}
+	}
+	cflags, err := run(append([]string{"--cflags"}, packages...)...)
+	if err != nil {
+		return nil, nil, AddDetail(err, "%s --cflags", pkgconfig)
+	}
+	libsArgs := []string{"--libs"}
+	if static {
+		libsArgs = append(libsArgs, "--static")
+	}
+	libs, err := run(append(libsArgs, packages...)...)
+	if err != nil {
+		return nil, nil, AddDetail(err, "%s --libs", pkgconfig)
+	}
+	return cflags, libs, nil
+}
+
+//  Generate and install a pkg-config file for the receiver's library
+//  into the pkgconfig directory in the library directory.
+//
+func (dmake *Dmake) InstallPkgConfig(prefix string) error {
+	objsdir := dmake.ObjsDir()
+	filename := filepath.Join(objsdir, dmake.Name()+".pc")
+	if !*dryRunFlag {
+		os.MkdirAll(objsdir, 0777)
+		if err := CreateFile(filename, dmake.PkgConfig(prefix)); err != nil {
+			return err
+		}
+	}
+	return dmake.InstallFile(filename, filepath.Join(dmake.LibDir(prefix), "pkgconfig"), os.FileMode(0444))
+}
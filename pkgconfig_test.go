@@ -0,0 +1,90 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPkgConfig(t *testing.T) {
+	dmake := &Dmake{vars: make(Vars), outputtype: LibOutputType, outputname: "libvec.a", packages: []string{"zlib"}}
+	dmake.vars.SetValue("VERSION", "1.2.3")
+	dmake.vars.SetValue("DESCRIPTION", "Vectors")
+	expected := `prefix=/usr/local
+exec_prefix=${prefix}
+libdir=${exec_prefix}/lib
+includedir=${prefix}/include
+
+Name: vec
+Description: Vectors
+Version: 1.2.3
+Requires: zlib
+Libs: -L${libdir} -lvec
+Cflags: -I${includedir}
+`
+	if pc := dmake.PkgConfig(filepath.FromSlash("/usr/local")); pc != expected {
+		t.Errorf("pkg-config file\n%s\nexpected\n%s", pc, expected)
+	}
+
+	dmake = &Dmake{vars: make(Vars), outputtype: LibOutputType, outputname: "libvec.a"}
+	dmake.vars.SetValue("INCDIR", "include/vec")
+	expected = `prefix=/opt/vec
+exec_prefix=${prefix}
+libdir=${exec_prefix}/lib
+includedir=${prefix}/include/vec
+
+Name: vec
+Description: vec library
+Version: 0.0.0
+Libs: -L${libdir} -lvec
+Cflags: -I${includedir}
+`
+	if pc := dmake.PkgConfig(filepath.FromSlash("/opt/vec")); pc != expected {
+		t.Errorf("pkg-config file\n%s\nexpected\n%s", pc, expected)
+	}
+}
+
+func TestPackageOptions(t *testing.T) {
+	pkgconfig := fakeTool(t, "fake-pkg-config", `case "$1" in
+--exists) [ "$2" = zlib ] || [ "$2" = png ] ;;
+--cflags) echo -I/opt/zlib/include -DPNG ;;
+--libs) shift; if [ "$1" = --static ]; then echo -L/opt/zlib/lib -lz -lm; else echo -L/opt/zlib/lib -lz; fi ;;
+esac
+`)
+	t.Setenv("PKG_CONFIG", pkgconfig)
+	cflags, libs, err := PackageOptions([]string{"zlib", "png"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cflags, []string{"-I/opt/zlib/include", "-DPNG"}) || !reflect.DeepEqual(libs, []string{"-L/opt/zlib/lib", "-lz"}) {
+		t.Errorf("options %q, libraries %q", cflags, libs)
+	}
+	if _, libs, err = PackageOptions([]string{"zlib"}, true); err != nil || !reflect.DeepEqual(libs, []string{"-L/opt/zlib/lib", "-lz", "-lm"}) {
+		t.Errorf("static libraries %q, %v", libs, err)
+	}
+	if _, _, err = PackageOptions([]string{"zlib", "nosuch"}, false); err == nil || !strings.Contains(err.Error(), `"nosuch" not found`) {
+		t.Errorf("missing package error %v", err)
+	}
+
+	// A directory's PKGS are used when it's prepared.
+	inTempProject(t, map[string]string{
+		dmakeFileFilename: "PKGS = zlib\n",
+		"main.c":          "int main() { return 0; }\n",
+	})
+	dmake := NewDmake("prog", "", "")
+	if err := dmake.ReadDmakefile(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dmake.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dmake.packages, []string{"zlib"}) || !reflect.DeepEqual(dmake.packageLibs, []string{"-L/opt/zlib/lib", "-lz"}) {
+		t.Errorf("PKGS %q used libraries %q", dmake.packages, dmake.packageLibs)
+	}
+
+	t.Setenv("PKG_CONFIG", filepath.Join(t.TempDir(), "nosuch-pkg-config"))
+	if _, _, err = PackageOptions([]string{"zlib"}, false); err == nil || !strings.Contains(err.Error(), "PKGS requires pkg-config") {
+		t.Errorf("missing pkg-config error %v", err)
+	}
+}
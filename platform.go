@@ -9,7 +9,7 @@
 package main
 
 import (
-	"os"
+	"fmt"
 	"path/filepath"
 	"regexp"
 	"runtime"
@@ -25,7 +25,6 @@ type PlatformSpecific struct {
 	dllsuffix    string
 	pluginprefix string
 	pluginsuffix string
-	installfile  func(filename, destdir string, filemode os.FileMode) error
 }
 
 var (
@@ -38,7 +37,6 @@ var (
 		dllsuffix:    ".dll",
 		pluginprefix: "",
 		pluginsuffix: ".dll",
-		installfile:  installByCopyingFile,
 	}
 	macosPlatform = PlatformSpecific{
 		objsuffix:    ".o",
@@ -49,7 +47,6 @@ var (
 		dllsuffix:    ".dylib",
 		pluginprefix: "",
 		pluginsuffix: ".bundle",
-		installfile:  installWithUsrBinInstall,
 	}
 	elfPlatform = PlatformSpecific{
 		objsuffix:    ".o",
@@ -60,27 +57,51 @@ var (
 		dllsuffix:    ".so",
 		pluginprefix: "lib",
 		pluginsuffix: ".so",
-		installfile:  installWithUsrBinInstall,
+	}
+	wasmPlatform = PlatformSpecific{
+		objsuffix:    ".o",
+		exesuffix:    ".js",
+		libprefix:    "lib",
+		libsuffix:    ".a",
+		dllprefix:    "lib",
+		dllsuffix:    ".wasm",
+		pluginprefix: "",
+		pluginsuffix: ".wasm",
 	}
 )
 
 var (
-	// The PlatformSpecific for the build host.
+	// The PlatformSpecific for the target platform, by default
+	// the build host.
 	//
 	platform *PlatformSpecific
 
+	// The target operating system and architecture, using Go's
+	// names. These are the build host's unless a -target is
+	// being used. A .dmake file's TARGET variable selects the
+	// target for its own directory, see (*Dmake).Target.
+	//
+	targetOS   = runtime.GOOS
+	targetArch = runtime.GOARCH
+
+	// True if building for something other than the build host.
+	//
+	crossCompiling bool
+
 	// This matches platforms **other** than this one. This is
 	// used to ignore files using Go-style platform-specific
 	// filenames.
 	//
 	otherPlatformNamesRegexp *regexp.Regexp
-)
 
-func init() {
-	platforms := []string{
+	// The operating systems we know about.
+	//
+	knownPlatforms = []string{
 		"aix",
+		"android",
 		"darwin",
 		"dragonfly",
+		"emscripten",
 		"freebsd",
 		"illumos",
 		"ios",
@@ -91,22 +112,223 @@ func init() {
 		"windows",
 	}
 
-	switch runtime.GOOS {
+	// Profiles, names for targets built using well known cross
+	// toolchains, e.g. mingw for 64-bit Windows using MinGW-w64.
+	//
+	targetProfiles = map[string]string{
+		"mingw":       "windows/amd64",
+		"mingw64":     "windows/amd64",
+		"mingw32":     "windows/386",
+		"wasm":        "emscripten/wasm32",
+		"android":     "android/arm64",
+		"arm64-v8a":   "android/arm64",
+		"armeabi-v7a": "android/arm",
+		"x86_64":      "android/amd64",
+		"x86":         "android/386",
+	}
+
+	// GNU architecture names used to form cross-compiler names.
+	//
+	gnuArchNames = map[string]string{
+		"386":     "i686",
+		"amd64":   "x86_64",
+		"arm":     "arm",
+		"arm64":   "aarch64",
+		"ppc64le": "powerpc64le",
+		"riscv64": "riscv64",
+	}
+)
+
+func init() {
+	platform = PlatformFor(targetOS)
+	otherPlatformNamesRegexp = OtherPlatformNamesRegexp(targetOS)
+}
+
+//  Return the PlatformSpecific for the named OS.
+//
+func PlatformFor(goos string) *PlatformSpecific {
+	switch goos {
 	case "windows":
-		platform = &windowsPlatform
-	case "darwin":
-		platform = &macosPlatform
+		return &windowsPlatform
+	case "darwin", "ios":
+		return &macosPlatform
+	case wasmOS:
+		return &wasmPlatform
 	default:
-		platform = &elfPlatform
+		return &elfPlatform
 	}
+}
 
+//  Return a regexp that matches the names of files specific to
+//  platforms other than the named OS.
+//
+func OtherPlatformNamesRegexp(goos string) *regexp.Regexp {
 	var otherPlatformNames []string
-	for _, name := range platforms {
-		if name != runtime.GOOS {
+	for _, name := range knownPlatforms {
+		if name != goos {
 			otherPlatformNames = append(otherPlatformNames, name)
 		}
 	}
-	otherPlatformNamesRegexp = regexp.MustCompile("_(" + strings.Join(otherPlatformNames, "|") + ")\\.")
+	return regexp.MustCompile("_(" + strings.Join(otherPlatformNames, "|") + ")\\.")
+}
+
+//  A Target is a platform outputs are built for, its operating
+//  system and architecture, using Go's names, and the filename
+//  conventions used for it.
+//
+type Target struct {
+	os       string
+	arch     string
+	cross    bool                // true if not the build host
+	platform *PlatformSpecific   // the target's filename conventions
+	others   *regexp.Regexp      // matches other platforms' filenames
+}
+
+//  Select the target platform, an "os/arch" string or the name of a
+//  profile, for which every directory's outputs are built. Object and
+//  dependency files for a target other than the build host are kept
+//  in per-target sub-directories so they don't get mixed up with the
+//  host's.
+//
+func SetTarget(name string) error {
+	target, err := NewTarget(name)
+	if err != nil {
+		return err
+	}
+	if target.os == targetOS && target.arch == targetArch {
+		return nil
+	}
+	if crossCompiling {
+		return fmt.Errorf("%q: target already set to %s", name, TargetName())
+	}
+	targetOS, targetArch = target.os, target.arch
+	crossCompiling = target.cross
+	platform = target.platform
+	otherPlatformNamesRegexp = target.others
+	return nil
+}
+
+//  Return the target named by an "os/arch" string or the name of a
+//  profile.
+//
+func NewTarget(name string) (*Target, error) {
+	target := name
+	if profile, found := targetProfiles[target]; found {
+		target = profile
+	}
+	parts := strings.SplitN(target, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("%q: target must be of the form os/arch", name)
+	}
+	goos, goarch := parts[0], parts[1]
+	if !Contains(knownPlatforms, goos) {
+		return nil, fmt.Errorf("%q: unknown target operating system %q", name, goos)
+	}
+	return &Target{
+		os:       goos,
+		arch:     goarch,
+		cross:    goos != runtime.GOOS || goarch != runtime.GOARCH,
+		platform: PlatformFor(goos),
+		others:   OtherPlatformNamesRegexp(goos),
+	}, nil
+}
+
+//  Return the target every directory is built for unless its .dmake
+//  file selects another, that given by -target or a toolchain file,
+//  otherwise the build host.
+//
+func DefaultTarget() *Target {
+	return &Target{
+		os:       targetOS,
+		arch:     targetArch,
+		cross:    crossCompiling,
+		platform: platform,
+		others:   otherPlatformNamesRegexp,
+	}
+}
+
+//  Return the receiver's target, that given by -target, otherwise that
+//  selected by its .dmake file's TARGET variable, otherwise the
+//  default target. A directory's target doesn't affect other
+//  directories, or sections.
+//
+func (dmake *Dmake) Target() *Target {
+	if dmake.target != nil {
+		return dmake.target
+	}
+	return DefaultTarget()
+}
+
+//  Return the default target's name, "os/arch".
+//
+func TargetName() string {
+	return DefaultTarget().Name()
+}
+
+//  Return the target's name, "os/arch".
+//
+func (t *Target) Name() string {
+	return t.os + "/" + t.arch
+}
+
+//  Return the GNU-style target triple used to name cross-compilers
+//  for the target, e.g. x86_64-w64-mingw32.
+//
+func (t *Target) Triple() string {
+	arch, found := gnuArchNames[t.arch]
+	if !found {
+		arch = t.arch
+	}
+	switch t.os {
+	case "linux":
+		if t.arch == "arm" {
+			return arch + "-linux-gnueabihf"
+		}
+		return arch + "-linux-gnu"
+	case "windows":
+		return arch + "-w64-mingw32"
+	case "darwin":
+		return arch + "-apple-darwin"
+	case wasmOS:
+		return arch + "-unknown-emscripten"
+	case androidOS:
+		if abi, found := androidABIs[t.arch]; found {
+			return abi[1]
+		}
+		return arch + "-linux-android"
+	default:
+		return arch + "-" + t.os
+	}
+}
+
+//  Return the environment used to run dcc for the receiver's target.
+//  When cross-compiling with the GNU toolchain the compiler, linker,
+//  archiver and, for Windows, resource compiler default to the
+//  target's GNU-style cross tools, Emscripten's for WebAssembly or the
+//  NDK's for Android, unless already defined. Tools defined by a
+//  toolchain file take precedence.
+//
+func (dmake *Dmake) TargetEnvironment(env []string) []string {
+	env = dmake.ToolchainDescription().Environment(env)
+	target := dmake.Target()
+	if !target.cross || dmake.Toolchain().msvc {
+		return env
+	}
+	if target.os == androidOS {
+		return dmake.AndroidEnvironment(env)
+	}
+	if target.os == wasmOS {
+		env = DefaultEnv(env, "CC", "emcc")
+		env = DefaultEnv(env, "CXX", "em++")
+		return DefaultEnv(env, "AR", "emar")
+	}
+	triple := target.Triple()
+	env = DefaultEnv(env, "CC", triple+"-gcc")
+	env = DefaultEnv(env, "CXX", triple+"-g++")
+	if target.os == "windows" {
+		env = DefaultEnv(env, "RC", triple+"-windres")
+	}
+	return DefaultEnv(env, "AR", triple+"-ar")
 }
 
 func (p *PlatformSpecific) LibFilename(path string) string {
@@ -129,6 +351,86 @@ func (p *PlatformSpecific) ObjFilename(path string) string {
 	return formFilename("", path, p.objsuffix)
 }
 
+//  Return the filename of a shared library with a version number,
+//  e.g. libfoo.so.1.2.3 or, on macOS, libfoo.1.2.3.dylib.
+//
+func (p *PlatformSpecific) VersionedDllFilename(path, version string) string {
+	if p == &macosPlatform {
+		return strings.TrimSuffix(path, p.dllsuffix) + "." + version + p.dllsuffix
+	}
+	return path + "." + version
+}
+
+//  Return the linker options used to record a shared library's
+//  version, and the name programs linked with it use to find it,
+//  the soname, on the target platform. On macOS the library's install
+//  name is in the installation directory if there is one, otherwise
+//  it is found via the run-path.
+//
+func (t *Target) SharedLibraryVersionOptions(soname, version, installdir string) []string {
+	if t.os == "darwin" || t.os == "ios" {
+		installname := "@rpath/" + soname
+		if installdir != "" {
+			installname = filepath.Join(installdir, soname)
+		}
+		major := strings.SplitN(version, ".", 2)[0]
+		return []string{
+			"-Wl,-install_name," + installname,
+			"-Wl,-current_version," + version,
+			"-Wl,-compatibility_version," + major,
+		}
+	}
+	return []string{"-Wl,-soname," + soname}
+}
+
+//  Return the compiler options required to compile code for an
+//  output type on the target platform.
+//
+func (t *Target) CompileTypeOptions(outputtype OutputType) []string {
+	if (outputtype == DllOutputType || outputtype == PluginOutputType || outputtype == FrameworkOutputType) && t.os != "windows" {
+		return []string{"-fPIC"}
+	}
+	return nil
+}
+
+//  Return the linker options required to create an output type on
+//  the target platform.
+//
+func (t *Target) LinkTypeOptions(outputtype OutputType) []string {
+	if t.os == wasmOS {
+		return WasmLinkTypeOptions(outputtype)
+	}
+	switch outputtype {
+	case DllOutputType:
+		if t.os == "darwin" {
+			return []string{"-dynamiclib"}
+		}
+		return []string{"-shared"}
+	case PluginOutputType:
+		if t.os == "darwin" {
+			return []string{"-bundle"}
+		}
+		return []string{"-shared"}
+	case FrameworkOutputType:
+		return []string{"-dynamiclib"}
+	}
+	return nil
+}
+
+//  Return the name used to link against a library, its filename
+//  without any directory, prefix or suffix, e.g. libfoo.a -> foo.
+//
+func (p *PlatformSpecific) LibraryName(path string) string {
+	basename := filepath.Base(path)
+	for _, affixes := range [][2]string{{p.dllprefix, p.dllsuffix}, {p.libprefix, p.libsuffix}} {
+		if affixes[1] != "" && strings.HasSuffix(basename, affixes[1]) {
+			basename = strings.TrimSuffix(basename, affixes[1])
+			return strings.TrimPrefix(basename, affixes[0])
+		}
+	}
+	return basename
+}
+
 func formFilename(prefix, path, suffix string) string {
 	dirname, basename := filepath.Dir(path), filepath.Base(path)
 	if prefix != "" && !strings.HasPrefix(basename, prefix) {
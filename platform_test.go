@@ -0,0 +1,66 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestTargetProfile(t *testing.T) {
+	savedOS, savedArch, savedCross := targetOS, targetArch, crossCompiling
+	defer func() {
+		targetOS, targetArch, crossCompiling = savedOS, savedArch, savedCross
+		platform = PlatformFor(targetOS)
+		otherPlatformNamesRegexp = OtherPlatformNamesRegexp(targetOS)
+	}()
+
+	targetOS, targetArch, crossCompiling = "linux", "amd64", false
+	if err := SetTarget("mingw"); err != nil {
+		t.Fatal(err)
+	}
+	if TargetName() != "windows/amd64" || platform != &windowsPlatform {
+		t.Fatalf("mingw selected %s", TargetName())
+	}
+	if name := platform.ExeFilename("prog"); name != "prog.exe" {
+		t.Errorf("mingw program named %q", name)
+	}
+	if !crossCompiling {
+		return // building on Windows
+	}
+	env := (&Dmake{}).TargetEnvironment(nil)
+	if cc, _ := LookupEnv(env, "CC"); cc != "x86_64-w64-mingw32-gcc" {
+		t.Errorf("mingw CC is %q", cc)
+	}
+	if cxx, _ := LookupEnv(env, "CXX"); cxx != "x86_64-w64-mingw32-g++" {
+		t.Errorf("mingw CXX is %q", cxx)
+	}
+}
+
+func TestDirectoryTarget(t *testing.T) {
+	windows, other := &Dmake{}, &Dmake{}
+	vars := make(Vars)
+	vars.SetValue("TARGET", "windows/amd64")
+	vars.SetValue("LIB", "util")
+	if err := windows.InitFromVars(vars); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.InitFromVars(make(Vars)); err != nil {
+		t.Fatal(err)
+	}
+	if name := windows.Target().Name(); name != "windows/amd64" {
+		t.Errorf("target %s, expected windows/amd64", name)
+	}
+	if windows.outputname != "util.lib" {
+		t.Errorf("Windows library named %q", windows.outputname)
+	}
+	if name := other.Target().Name(); name != TargetName() {
+		t.Errorf("another directory's target %s, TARGET leaked", name)
+	}
+	if dir := other.ObjsDir(); dir != filepath.Join(objsRoot, targetOS+"-"+targetArch) {
+		t.Errorf("another directory's objects directory %q, TARGET leaked", dir)
+	}
+
+	vars.SetValue("TARGET", "plan9/amd64")
+	if err := other.InitFromVars(vars); err == nil {
+		t.Error("expected an error for an unknown TARGET")
+	}
+}
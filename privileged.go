@@ -0,0 +1,219 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+//  dmake install checks the directories it installs into are writable
+//  before building anything. If they aren't, and -sudo is used, dmake
+//  builds as usual and then re-runs itself, using sudo or doas, with
+//  -no-build to install what it built. Only the install is privileged,
+//  the build's files stay owned by the user. The privileged dmake is
+//  given the options and environment this dmake resolved, with
+//  -no-config, so it doesn't read configuration files or a .env file,
+//  as root, and come to a different configuration. The install
+//  manifest the privileged dmake writes is given back to the user.
+//
+var privilegeCommands = []string{"sudo", "doas"}
+
+//  Return the directories the receiver and its targets install files
+//  in, without any DESTDIR.
+//
+func (dmake *Dmake) InstallDirectories() ([]string, error) {
+	prefix := dmake.installprefix
+	if prefix == "" {
+		prefix = "."
+	}
+	dirs := []string{prefix, dmake.BinDir(prefix), dmake.LibDir(prefix), dmake.IncludeDir(prefix), dmake.ManDir(prefix)}
+	specs, err := InstallFileSpecs(dmake.vars.GetString("INSTALL_FILES"))
+	if err != nil {
+		return nil, err
+	}
+	for _, spec := range specs {
+		dest := filepath.FromSlash(spec.dest)
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(prefix, dest)
+		}
+		dirs = append(dirs, dest)
+	}
+	for _, target := range dmake.targets {
+		targetDirs, err := target.InstallDirectories()
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, targetDirs...)
+	}
+	return dirs, nil
+}
+
+//  The error returned when an install directory isn't writable.
+//
+type installRootError struct {
+	dir string
+	err error
+}
+
+func (e *installRootError) Error() string {
+	return fmt.Sprintf("%s isn't writable, install using -sudo or use a different -prefix", e.dir)
+}
+
+func (e *installRootError) Unwrap() error {
+	return e.err
+}
+
+//  Return an error if the receiver can't install files, in any of the
+//  directories it or its sub-directories install into, without more
+//  privileges. A sub-directory whose .dmake file can't be read is left
+//  for the build to report.
+//
+func (dmake *Dmake) CheckInstallRoot() error {
+	dirs, err := dmake.InstallDirectories()
+	if err != nil {
+		return err
+	}
+	checked := make(map[string]bool)
+	for _, dir := range dirs {
+		dir = filepath.Join(dmake.DestDir(), dir)
+		if checked[dir] {
+			continue
+		}
+		checked[dir] = true
+		if dir, err := writableDirectory(dir); err != nil {
+			if !os.IsPermission(err) {
+				return err
+			}
+			return &installRootError{dir, err}
+		}
+	}
+	for _, path := range dmake.directories {
+		if err := dmake.checkSubdirectoryInstallRoot(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dmake *Dmake) checkSubdirectoryInstallRoot(path string) error {
+	savedCwd, err := ChangeDirectory(path)
+	if err != nil {
+		return err
+	}
+	defer savedCwd.Restore()
+	subdir := NewDmake(path, "", dmake.installprefix)
+	if subdir.ReadDmakefile() != nil {
+		return nil
+	}
+	return subdir.CheckInstallRoot()
+}
+
+//  Return the command used to run a command with more privileges.
+//
+func PrivilegeCommand() (string, error) {
+	for _, name := range privilegeCommands {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("-sudo requires sudo or doas, neither was found")
+}
+
+//  Return the arguments given to the privileged dmake installing what
+//  was built, the options set for this dmake, by the command line,
+//  DMAKEFLAGS or configuration files, other than -sudo and -C, and its
+//  arguments. The environment is passed on as it is, so -E, and
+//  -keep-env, aren't.
+//
+func PrivilegedInstallArgs(args []string) []string {
+	childArgs := []string{"-no-config", "-no-build"}
+	if *prefixFlag != "" {
+		childArgs = append(childArgs, "-prefix", AbsolutePath(*prefixFlag))
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "C", "E", "dcc-arg", "keep-env", "no-build", "no-config", "prefix", "sudo":
+		default:
+			childArgs = append(childArgs, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	return append(childArgs, args...)
+}
+
+//  Install what's been built by running dmake with more privileges.
+//
+func PrivilegedInstall(args []string) error {
+	privileged, err := PrivilegeCommand()
+	if err != nil {
+		return err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	env := SetEnv(os.Environ(), "SUDO_UID", strconv.Itoa(os.Getuid()))
+	env = SetEnv(env, "SUDO_GID", strconv.Itoa(os.Getgid()))
+	command := append([]string{"env", "-i"}, env...)
+	command = append(append(command, self), PrivilegedInstallArgs(args)...)
+	logger.Verbosef("installing using %s", filepath.Base(privileged))
+	logger.Debugf("RUN: %s %v", privileged, command)
+	cmd := exec.Command(privileged, command...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return RunCommand(cmd)
+}
+
+//  Return the user and group ids of the user who ran dmake using sudo,
+//  given by SUDO_UID and SUDO_GID, or doas, given by DOAS_USER.
+//
+func InvokingUser(env []string) (int, int, bool) {
+	if uid, found := LookupEnv(env, "SUDO_UID"); found {
+		gid, _ := LookupEnv(env, "SUDO_GID")
+		return parseIds(uid, gid)
+	}
+	if name, found := LookupEnv(env, "DOAS_USER"); found {
+		if u, err := user.Lookup(name); err == nil {
+			return parseIds(u.Uid, u.Gid)
+		}
+	}
+	return 0, 0, false
+}
+
+//  Return user and group ids given as strings.
+//
+func parseIds(uid, gid string) (int, int, bool) {
+	u, err := strconv.Atoi(uid)
+	if err != nil {
+		return 0, 0, false
+	}
+	g, err := strconv.Atoi(gid)
+	if err != nil {
+		return 0, 0, false
+	}
+	return u, g, true
+}
+
+//  Give a file created by dmake running as root, using sudo or doas,
+//  to the user who ran it so it isn't left owned by root.
+//
+func GiveToInvokingUser(path string) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	uid, gid, found := InvokingUser(os.Environ())
+	if !found {
+		return nil
+	}
+	return os.Chown(path, uid, gid)
+}
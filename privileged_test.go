@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCheckInstallRoot(t *testing.T) {
+	dir := t.TempDir()
+	dmake := &Dmake{installprefix: filepath.Join(dir, "usr", "local")}
+	if err := dmake.CheckInstallRoot(); err != nil {
+		t.Error(err)
+	}
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		return
+	}
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0755)
+	if err := dmake.CheckInstallRoot(); err == nil || !strings.Contains(err.Error(), "-sudo") || !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected a permission error suggesting -sudo, got %v", err)
+	}
+}
+
+func TestPrivilegedInstallDirectories(t *testing.T) {
+	vars := make(Vars)
+	vars.SetValue("LIBDIR", "/opt/lib")
+	vars.SetValue("INSTALL_FILES", "x.conf=etc/x")
+	target := &Dmake{installprefix: "/usr", vars: make(Vars)}
+	target.vars.SetValue("BINDIR", "/opt/bin")
+	dmake := &Dmake{installprefix: "/usr", vars: vars, targets: []*Dmake{target}}
+	dirs, err := dmake.InstallDirectories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"/usr", "/usr/bin", "/opt/lib", "/usr/include", "/usr/share/man", "/usr/etc/x", "/opt/bin"} {
+		if !Contains(dirs, filepath.FromSlash(dir)) {
+			t.Errorf("%s isn't one of the install directories %q", dir, dirs)
+		}
+	}
+	if args := PrivilegedInstallArgs([]string{"install"}); !Contains(args, "-no-config") || args[len(args)-1] != "install" {
+		t.Errorf("privileged install arguments %q", args)
+	}
+}
+
+func TestInvokingUser(t *testing.T) {
+	if uid, gid, found := InvokingUser([]string{"SUDO_UID=1000", "SUDO_GID=100"}); !found || uid != 1000 || gid != 100 {
+		t.Errorf("sudo user %d:%d, %v", uid, gid, found)
+	}
+	if _, _, found := InvokingUser([]string{"HOME=/root"}); found {
+		t.Error("found a user without sudo or doas")
+	}
+	if runtime.GOOS == "windows" || os.Geteuid() != 0 {
+		return
+	}
+	t.Setenv("SUDO_UID", "1000")
+	t.Setenv("SUDO_GID", "100")
+	inTempProject(t, nil)
+	dmake := &Dmake{}
+	if err := dmake.RecordInstalledFile("/usr/local/bin/prog"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(installManifestFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := reflect.Indirect(reflect.ValueOf(info.Sys()))
+	if uid, gid := st.FieldByName("Uid").Uint(), st.FieldByName("Gid").Uint(); uid != 1000 || gid != 100 {
+		t.Errorf("install manifest owned by %d:%d, expected 1000:100", uid, gid)
+	}
+}
+
+func TestCheckSubdirectoryInstallRoot(t *testing.T) {
+	prefix := t.TempDir()
+	dir := inTempProject(t, map[string]string{
+		".dmake":   "DIRS = a b\n",
+		"a/main.c": "int main() { return 0; }\n",
+		"b/.dmake": "EXE = b\nBINDIR = " + filepath.Join(prefix, "file", "bin") + "\n",
+		"b/main.c": "int main() { return 0; }\n",
+	})
+	dmake := NewDmake(dir, "", prefix)
+	if err := dmake.ReadDmakefile(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dmake.CheckInstallRoot(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A sub-directory's install directory that can't be created is
+	// found, and isn't something -sudo would fix.
+	if err := os.WriteFile(filepath.Join(prefix, "file"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	err := dmake.CheckInstallRoot()
+	if err == nil {
+		t.Fatal("expected an error for a sub-directory's install directory")
+	}
+	if errors.Is(err, os.ErrPermission) {
+		t.Errorf("%v is a permission error", err)
+	}
+	if cwd, _ := os.Getwd(); cwd != dir {
+		t.Errorf("current directory %q, expected %q", cwd, dir)
+	}
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		return
+	}
+	os.Remove(filepath.Join(prefix, "file"))
+	if err := os.Chmod(prefix, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(prefix, 0755)
+	if err := dmake.CheckInstallRoot(); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected a permission error, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+//  When building several directories dmake reports its progress,
+//  "[12/40] building lib/foo", as it starts each directory. When the
+//  directories are built concurrently, and dmake writes all of their
+//  output, the line is updated in place on a terminal and cleared
+//  before other messages. Otherwise the commands run write to the
+//  terminal themselves and each step is an ordinary message. Progress
+//  is only reported for the top-level directories, those in nested
+//  DIRS are part of their parent's step.
+//
+type Progress struct {
+	sync.Mutex
+	w       io.Writer
+	total   int  // the number of directories
+	started int  // the number of directories started
+	inPlace bool // update the line in place
+	shown   bool // the line is on the terminal
+	line    string
+}
+
+//  The progress being reported, if any.
+//
+var progress *Progress
+
+//  The verb used to describe each action.
+//
+var progressVerbs = map[Action]string{
+	DefaultAction: "building",
+	Building:      "building",
+	Cleaning:      "cleaning",
+	Installing:    "installing",
+	Testing:       "testing",
+	Uninstalling:  "uninstalling",
+	Exporting:     "exporting",
+	Covering:      "covering",
+	Tidying:       "tidying",
+	Analyzing:     "analyzing",
+	Documenting:   "documenting",
+	Packaging:     "packaging",
+}
+
+//  Start reporting progress building some number of directories,
+//  updating the line in place if possible and inPlace is true. Returns
+//  nil if progress isn't reported, for a nested build, a
+//  child dmake or a single directory.
+//
+func StartProgress(total int, inPlace bool) *Progress {
+	if progress != nil || total < 2 || logger.directory != "" || !logger.Enabled(InfoLevel) {
+		return nil
+	}
+	progress = &Progress{w: os.Stderr, total: total, inPlace: inPlace && IsTerminal(os.Stderr)}
+	return progress
+}
+
+//  Report starting to build a directory.
+//
+func (p *Progress) Step(path string, action Action) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	p.started++
+	verb, found := progressVerbs[action]
+	if !found {
+		verb = action.String()
+	}
+	p.line = fmt.Sprintf("[%d/%d] %s %s", p.started, p.total, verb, path)
+	if p.inPlace {
+		p.show()
+		p.Unlock()
+		return
+	}
+	p.Unlock()
+	logger.Infof("%s", p.line)
+}
+
+//  Show the progress line again after other output.
+//
+func (p *Progress) Redraw() {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	if p.inPlace && p.line != "" {
+		p.show()
+	}
+}
+
+func (p *Progress) show() {
+	fmt.Fprintf(p.w, "\r%s\x1b[K", p.line)
+	p.shown = true
+}
+
+//  Clear the progress line so other output starts at the beginning
+//  of a line.
+//
+func (p *Progress) Clear() {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	if p.shown {
+		fmt.Fprint(p.w, "\r\x1b[K")
+		p.shown = false
+	}
+}
+
+//  Stop reporting progress.
+//
+func (p *Progress) Finish() {
+	if p == nil {
+		return
+	}
+	p.Clear()
+	progress = nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	var b strings.Builder
+	saved := logger
+	defer func() { logger = saved }()
+	logger = &Logger{w: &b, level: InfoLevel}
+
+	p := StartProgress(2, false)
+	if p == nil {
+		t.Fatal("no progress for two directories")
+	}
+	if StartProgress(3, false) != nil {
+		t.Error("nested progress started")
+	}
+	p.inPlace = false
+	p.Step("lib/foo", Building)
+	p.Step("bin/bar", Cleaning)
+	p.Finish()
+	if s := b.String(); s != "dmake: [1/2] building lib/foo\ndmake: [2/2] cleaning bin/bar\n" {
+		t.Errorf("progress reported as %q", s)
+	}
+
+	var w strings.Builder
+	p = StartProgress(2, false)
+	p.w, p.inPlace = &w, true
+	p.Step("lib/foo", Testing)
+	logger.Warnf("no tests defined")
+	p.Finish()
+	if s := w.String(); s != "\r[1/2] testing lib/foo\x1b[K\r\x1b[K" {
+		t.Errorf("progress updated as %q", s)
+	}
+	if StartProgress(1, false) != nil {
+		t.Error("progress started for a single directory")
+	}
+}
@@ -0,0 +1,172 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//  Qt programs use the Qt modules named by the QT variable, e.g.
+//  "QT = widgets network". The modules are found using pkg-config and
+//  Qt's code generators, moc, uic and rcc, generate sources from
+//  headers declaring Q_OBJECT classes, .ui forms and .qrc resources.
+//
+const defaultQtVersion = "5"
+
+//  Module names that aren't simply capitalized in package names.
+//
+var qtModuleNames = map[string]string{
+	"dbus":   "DBus",
+	"opengl": "OpenGL",
+	"qml":    "Qml",
+	"svg":    "Svg",
+	"xml":    "Xml",
+}
+
+//  Return the pkg-config package names of Qt modules, e.g. widgets is
+//  Qt5Widgets. The core module is always used.
+//
+func QtPackages(modules []string, version string) []string {
+	packages := []string{"Qt" + version + "Core"}
+	for _, module := range modules {
+		name, found := qtModuleNames[strings.ToLower(module)]
+		if !found {
+			name = strings.ToUpper(module[:1]) + strings.ToLower(module[1:])
+		}
+		if pkg := "Qt" + version + name; !Contains(packages, pkg) {
+			packages = append(packages, pkg)
+		}
+	}
+	return packages
+}
+
+//  Return the files in the source files' directories that Qt's code
+//  generators process, headers declaring Q_OBJECT or Q_GADGET
+//  classes, .ui forms and .qrc resource collections.
+//
+func QtInputs(sources []string) ([]string, error) {
+	var dirs, inputs []string
+	for _, path := range sources {
+		dir := filepath.Dir(path)
+		if Contains(dirs, dir) || filepath.Base(dir) == defaultGenDir {
+			continue
+		}
+		dirs = append(dirs, dir)
+		for _, pattern := range []string{"*.h", "*.hh", "*.hpp", "*.hxx"} {
+			headers, err := filepath.Glob(filepath.Join(dir, pattern))
+			if err != nil {
+				return nil, err
+			}
+			for _, header := range headers {
+				if declaresQObject(header) {
+					inputs = append(inputs, header)
+				}
+			}
+		}
+		for _, pattern := range []string{"*.ui", "*.qrc"} {
+			matches, err := filepath.Glob(filepath.Join(dir, pattern))
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, matches...)
+		}
+	}
+	return inputs, nil
+}
+
+func declaresQObject(path string) bool {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	text = []byte(StripSource(string(text)))
+	return bytes.Contains(text, []byte("Q_OBJECT")) || bytes.Contains(text, []byte("Q_GADGET"))
+}
+
+//  Return a GeneratedSource for a file processed by one of Qt's code
+//  generators, or nil if it isn't.
+//
+func (dmake *Dmake) qtGeneratorFor(path string) *GeneratedSource {
+	gendir := dmake.GenDir()
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var tool string
+	var output string
+	var args func(output string) []string
+	switch filepath.Ext(path) {
+	case ".h", ".hh", ".hpp", ".hxx":
+		tool, output = "moc", filepath.Join(gendir, "moc_"+name+".cpp")
+		args = func(output string) []string { return []string{"-o", output, path} }
+	case ".ui":
+		tool, output = "uic", filepath.Join(gendir, "ui_"+name+".h")
+		args = func(output string) []string { return []string{"-o", output, path} }
+	case ".qrc":
+		tool, output = "rcc", filepath.Join(gendir, "qrc_"+name+".cpp")
+		args = func(output string) []string { return []string{"-name", name, "-o", output, path} }
+	default:
+		return nil
+	}
+	return &GeneratedSource{
+		input:   path,
+		outputs: []string{output},
+		command: func(env []string) []string {
+			return append(dmake.qtTool(env, tool), args(output)...)
+		},
+	}
+}
+
+//  Return the command for one of Qt's tools. The tool may be defined
+//  by an environment variable named for it, e.g. $MOC. Otherwise the
+//  tool is looked for in the directories given by the Qt packages,
+//  Qt installs them outside of $PATH, and finally on $PATH.
+//
+func (dmake *Dmake) qtTool(env []string, tool string) []string {
+	if value, found := LookupEnv(env, strings.ToUpper(tool)); found && value != "" {
+		return strings.Fields(value)
+	}
+	pkgconfig := Getenv("PKG_CONFIG", "pkg-config")
+	core := QtPackages(nil, dmake.QtVersion())[0]
+	for _, variable := range []string{"host_bins", "libexecdir", "bindir"} {
+		output, err := exec.Command(pkgconfig, "--variable="+variable, core).Output()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(strings.TrimSpace(string(output)), tool)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return []string{path}
+		}
+	}
+	return []string{tool}
+}
+
+//  Return the Qt major version used, defined by QT_VERSION.
+//
+func (dmake *Dmake) QtVersion() string {
+	if version, found := dmake.vars.GetValue("QT_VERSION"); found {
+		return version
+	}
+	return defaultQtVersion
+}
+
+//  Return the compiler options Qt requires beyond those given by
+//  pkg-config. Qt 5 on ELF platforms is usually built such that code
+//  using it must be position independent.
+//
+func (dmake *Dmake) QtOptions() []string {
+	if len(dmake.qtModules) == 0 || dmake.QtVersion() != "5" {
+		return nil
+	}
+	if dmake.Target().os == "windows" || dmake.Target().os == "darwin" || dmake.Target().os == "ios" {
+		return nil
+	}
+	return []string{"-fPIC"}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQtPackages(t *testing.T) {
+	packages := QtPackages([]string{"Widgets", "opengl", "core"}, "6")
+	if !reflect.DeepEqual(packages, []string{"Qt6Core", "Qt6Widgets", "Qt6OpenGL"}) {
+		t.Errorf("packages %q", packages)
+	}
+}
+
+func TestQtGenerators(t *testing.T) {
+	inTempProject(t, map[string]string{
+		"main.cpp":     "",
+		"window.h":     "class Window : public QWidget {\n\tQ_OBJECT\n};\n",
+		"plain.h":      "// no Q_OBJECT here\nstruct Plain {};\n",
+		"window.ui":    "",
+		"icons.qrc":    "",
+		".gen/moc_x.h": "Q_OBJECT\n",
+	})
+	inputs, err := QtInputs([]string{"main.cpp", filepath.Join(".gen", "moc_window.cpp")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inputs, []string{"window.h", "window.ui", "icons.qrc"}) {
+		t.Fatalf("Qt inputs %q", inputs)
+	}
+
+	dmake := &Dmake{vars: make(Vars), sourceFiles: []string{"main.cpp"}, qtModules: []string{"widgets"}}
+	dmake.AddGeneratedSources(inputs...)
+	gen := dmake.GenDir()
+	if expected := []string{"main.cpp", filepath.Join(gen, "moc_window.cpp"), filepath.Join(gen, "qrc_icons.cpp")}; !reflect.DeepEqual(dmake.sourceFiles, expected) {
+		t.Errorf("sources %q, expected %q", dmake.sourceFiles, expected)
+	}
+	if len(dmake.generated) != 3 || !reflect.DeepEqual(dmake.generated[1].outputs, []string{filepath.Join(gen, "ui_window.h")}) {
+		t.Errorf("generated %+v", dmake.generated)
+	}
+
+	// The tools are found in the Qt package's host_bins directory
+	// unless named by the environment.
+	bin := t.TempDir()
+	for _, tool := range []string{"moc", "uic", "rcc"} {
+		writeFiles(t, bin, map[string]string{tool: "#!/bin/sh\necho " + tool + ` "$@" >> generate.log
+while [ $# -gt 0 ]; do
+  if [ "$1" = -o ]; then shift; : > "$1"; fi
+  shift
+done
+`})
+		os.Chmod(filepath.Join(bin, tool), 0777)
+	}
+	t.Setenv("PKG_CONFIG", fakeTool(t, "pkg-config", `[ "$1" = --variable=host_bins ] && [ "$2" = Qt5Core ] && echo `+bin+"\n"))
+	if tool := dmake.qtTool(nil, "moc"); !reflect.DeepEqual(tool, []string{filepath.Join(bin, "moc")}) {
+		t.Errorf("moc is %q", tool)
+	}
+	if tool := dmake.qtTool([]string{"MOC=/opt/qt/moc -x"}, "moc"); !reflect.DeepEqual(tool, []string{"/opt/qt/moc", "-x"}) {
+		t.Errorf("moc given by $MOC is %q", tool)
+	}
+
+	env := []string{"PATH=" + os.Getenv("PATH")}
+	for i := 0; i < 2; i++ {
+		if err := dmake.GenerateSources(env); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log, _ := os.ReadFile("generate.log")
+	expected := strings.Join([]string{
+		"moc -o " + filepath.Join(gen, "moc_window.cpp") + " window.h",
+		"uic -o " + filepath.Join(gen, "ui_window.h") + " window.ui",
+		"rcc -name icons -o " + filepath.Join(gen, "qrc_icons.cpp") + " icons.qrc",
+	}, "\n") + "\n"
+	if string(log) != expected {
+		t.Errorf("Qt's tools run as\n%s\nexpected, once,\n%s", log, expected)
+	}
+
+	if options := dmake.QtOptions(); DefaultTarget().os == "linux" && !reflect.DeepEqual(options, []string{"-fPIC"}) {
+		t.Errorf("Qt 5 options %q", options)
+	}
+	dmake.vars.SetValue("QT_VERSION", "6")
+	if options := dmake.QtOptions(); options != nil {
+		t.Errorf("Qt 6 options %q", options)
+	}
+}
@@ -0,0 +1,122 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//  With -reproducible a build doesn't depend on when or where it's
+//  done, building the same sources gives byte-identical outputs.
+//
+//  SOURCE_DATE_EPOCH, used by compilers for __DATE__ and __TIME__ and
+//  for DMAKE_BUILD_DATE, is set to the time of the last git commit,
+//  unless it's already defined, or 0 outside of a git repository.
+//  Sources are compiled with -ffile-prefix-map mapping the source root,
+//  the top of the git repository, the workspace root or the directory
+//  dmake is run in, to ".", so debug information and __FILE__ don't
+//  record where the project was built. Archives are created using ar's
+//  deterministic mode, zeroing member timestamps, owners and modes,
+//  and on macOS ZERO_AR_DATE has the linker do the same.
+//
+const sourceDateEpochEnvVar = "SOURCE_DATE_EPOCH"
+
+//  A child dmake is given the source root of the dmake that started it
+//  in this environment variable so its outputs are the same as if the
+//  parent built its directory itself.
+//
+const sourceRootEnvVar = "DMAKESOURCEROOT"
+
+//  The directory mapped to "." when building reproducibly.
+//
+var sourceRoot string
+
+//  Set up the environment for a reproducible build of the project in
+//  the root directory.
+//
+func SetReproducible(root string) error {
+	if dir := os.Getenv(sourceRootEnvVar); dir != "" {
+		root = dir
+	} else if dir := gitOutput(root, "rev-parse", "--show-toplevel"); dir != "" {
+		root = dir
+	}
+	sourceRoot = root
+	if err := os.Setenv(sourceRootEnvVar, root); err != nil {
+		return err
+	}
+	if os.Getenv(sourceDateEpochEnvVar) != "" {
+		return nil
+	}
+	epoch := gitOutput(root, "log", "-1", "--format=%ct")
+	if epoch == "" {
+		epoch = "0"
+	}
+	logger.Verbosef("%s=%s", sourceDateEpochEnvVar, epoch)
+	return os.Setenv(sourceDateEpochEnvVar, epoch)
+}
+
+//  Return the output of a git command run in a directory, or an empty
+//  string if it fails.
+//
+func gitOutput(dir string, args ...string) string {
+	output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	if err != nil {
+		logger.Debugf("git %s: %s", strings.Join(args, " "), err)
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+//  Return the compiler options used for a reproducible build of the
+//  receiver's outputs.
+//
+func (dmake *Dmake) ReproducibleOptions() []string {
+	if !*reproducibleFlag || dmake.Toolchain().msvc {
+		return nil
+	}
+	return []string{"-ffile-prefix-map=" + sourceRoot + "=."}
+}
+
+//  Return the options given to ar to create an archive for the
+//  target.
+//
+func (t *Target) ArchiveFlags() string {
+	if *reproducibleFlag && t.os != "darwin" {
+		return "rcsD"
+	}
+	return "rcs"
+}
+
+//  Return the environment for the commands run for a reproducible
+//  build for the target.
+//
+func (t *Target) ReproducibleEnvironment(env []string) []string {
+	if !*reproducibleFlag {
+		return env
+	}
+	env = SetEnv(env, "ARFLAGS", t.ArchiveFlags())
+	if t.os == "darwin" {
+		env = SetEnv(env, "ZERO_AR_DATE", "1")
+	}
+	return env
+}
+
+//  Return the time the build is done, SOURCE_DATE_EPOCH if it's
+//  defined.
+//
+func BuildTime() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv(sourceDateEpochEnvVar), 10, 64); err == nil {
+		return time.Unix(epoch, 0)
+	}
+	return time.Now()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReproducible(t *testing.T) {
+	for _, name := range []string{sourceDateEpochEnvVar, sourceRootEnvVar} {
+		if value, found := os.LookupEnv(name); found {
+			defer os.Setenv(name, value)
+		} else {
+			defer os.Unsetenv(name)
+		}
+		os.Unsetenv(name)
+	}
+	dir := t.TempDir()
+	if err := SetReproducible(dir); err != nil {
+		t.Fatal(err)
+	}
+	if sourceRoot != dir || os.Getenv(sourceRootEnvVar) != dir {
+		t.Errorf("source root %q", sourceRoot)
+	}
+	if epoch := os.Getenv(sourceDateEpochEnvVar); epoch != "0" {
+		t.Errorf("%s=%s outside of a git repository", sourceDateEpochEnvVar, epoch)
+	}
+	os.Setenv(sourceDateEpochEnvVar, "1700000000")
+	if err := SetReproducible(filepath.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	if sourceRoot != dir {
+		t.Errorf("child's source root %q, expected %q", sourceRoot, dir)
+	}
+	if date := BuildTime().UTC().Format("2006-01-02"); date != "2023-11-14" {
+		t.Errorf("build date %s", date)
+	}
+}
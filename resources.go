@@ -0,0 +1,100 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//  Windows programs and DLLs may have resources, icons, version
+//  information and the like, defined by resource scripts, .rc files.
+//  These are compiled to object files, using windres or rc.exe as
+//  defined by $RC, by default the toolchain's, and linked with the
+//  output.
+//
+//  Return the names of the resource scripts in the directories
+//  containing the source files.
+//
+func ResourceScripts(sources []string) ([]string, error) {
+	var dirs, scripts []string
+	for _, path := range sources {
+		dir := filepath.Dir(path)
+		if Contains(dirs, dir) {
+			continue
+		}
+		dirs = append(dirs, dir)
+		matches, err := filepath.Glob(filepath.Join(dir, "*.rc"))
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, matches...)
+	}
+	return scripts, nil
+}
+
+//  Return true if the resource compiler is Microsoft's rc.exe, or
+//  compatible, rather than windres.
+//
+func isRcExe(compiler string) bool {
+	name := strings.ToLower(strings.TrimSuffix(filepath.Base(compiler), ".exe"))
+	return name == "rc" || name == "llvm-rc"
+}
+
+//  Return the name of the file a resource script compiles to. rc.exe
+//  creates a .res file, windres an object file. Either way the name
+//  differs from that of any source file's object file.
+//
+func (t *Target) ResourceObjectFilename(path, objsdir, compiler string) string {
+	object := t.ObjectFilename(path, objsdir)
+	object = strings.TrimSuffix(object, filepath.Ext(object))
+	if isRcExe(compiler) {
+		return object + ".res"
+	}
+	return object + ".res" + t.platform.objsuffix
+}
+
+//  Return the resource compiler command, possibly more than one word.
+//
+func (dmake *Dmake) ResourceCompiler(env []string) []string {
+	if value, found := LookupEnv(dmake.TargetEnvironment(env), "RC"); found && value != "" {
+		return strings.Fields(value)
+	}
+	return []string{dmake.Toolchain().rc}
+}
+
+//  Compile a resource script, if its object file is out of date, and
+//  return the name of the object file.
+//
+func (dmake *Dmake) CompileResource(env []string, path string) (string, error) {
+	compiler := dmake.ResourceCompiler(env)
+	object := dmake.Target().ResourceObjectFilename(path, dmake.ObjsDir(), compiler[0])
+	if IsUpToDate(object, []string{path}) {
+		return object, nil
+	}
+
+	var args []string
+	if isRcExe(compiler[0]) {
+		args = []string{"/nologo", "/fo", object, path}
+	} else {
+		args = []string{"-O", "coff", "-i", path, "-o", object}
+	}
+	args = append(compiler[1:len(compiler):len(compiler)], args...)
+	if DryRun(compiler[0], args...) {
+		return object, nil
+	}
+	logger.Verbosef("compiling %s", path)
+	logger.Debugf("RUN: %s %v", compiler[0], args)
+	cmd := exec.Command(compiler[0], args...)
+	cmd.Env = dmake.TargetEnvironment(env)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, CommandOutput(), os.Stderr
+	return object, RunCommand(cmd, object)
+}
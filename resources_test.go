@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResources(t *testing.T) {
+	inTempProject(t, map[string]string{
+		"main.c":       "",
+		"app.rc":       "1 ICON app.ico\n",
+		"gui/window.c": "",
+		"gui/gui.rc":   "",
+		"other/x.rc":   "",
+	})
+	scripts, err := ResourceScripts([]string{"main.c", filepath.Join("gui", "window.c"), filepath.Join("gui", "dialog.c")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(scripts, []string{"app.rc", filepath.Join("gui", "gui.rc")}) {
+		t.Errorf("resource scripts %q", scripts)
+	}
+
+	target := DefaultTarget()
+	object := target.ObjectFilename("app.rc", "objs")
+	base := strings.TrimSuffix(object, filepath.Ext(object))
+	if name := target.ResourceObjectFilename("app.rc", "objs", "x86_64-w64-mingw32-windres"); name != base+".res"+target.platform.objsuffix {
+		t.Errorf("windres output %q", name)
+	}
+	if name := target.ResourceObjectFilename("app.rc", "objs", "llvm-rc"); name != base+".res" {
+		t.Errorf("rc.exe output %q", name)
+	}
+
+	// The fake windres records its arguments and creates its output.
+	windres := fakeTool(t, "windres", `echo "$@" >> windres.log
+while [ $# -gt 0 ]; do
+  if [ "$1" = -o ]; then shift; : > "$1"; fi
+  shift
+done
+`)
+	dmake := &Dmake{}
+	if err := os.MkdirAll(dmake.ObjsDir(), 0777); err != nil {
+		t.Fatal(err)
+	}
+	env := []string{"RC=" + windres + " --target=pe-x86-64", "PATH=" + os.Getenv("PATH")}
+	for i := 0; i < 2; i++ {
+		object, err = dmake.CompileResource(env, "app.rc")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	log, _ := os.ReadFile("windres.log")
+	if expected := "--target=pe-x86-64 -O coff -i app.rc -o " + object + "\n"; string(log) != expected {
+		t.Errorf("windres run as\n%s\nexpected, once,\n%s", log, expected)
+	}
+}
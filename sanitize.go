@@ -0,0 +1,121 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+//  Sanitizers instrument code to find errors at run-time. They're
+//  selected by the -sanitize option or the SANITIZE variable, e.g.
+//  address,undefined, and add the -fsanitize options when compiling
+//  and linking. Instrumented objects can't be mixed with others so a
+//  sanitized build is like a build mode, its objects and output go in
+//  a directory named for the sanitizers, e.g. .objs/asan and asan.
+//
+//  The sanitizers given by -sanitize are used by every directory and
+//  take precedence over those selected by a .dmake file's SANITIZE
+//  variable, which only apply to the file's own directory.
+//
+var sanitizers []string
+
+//  The sanitizers known and the short names used for their
+//  directories.
+//
+var sanitizerNames = map[string]string{
+	"address":   "asan",
+	"undefined": "ubsan",
+	"thread":    "tsan",
+	"memory":    "msan",
+	"leak":      "lsan",
+}
+
+//  The sanitizers that can't be used together.
+//
+var incompatibleSanitizers = [][2]string{
+	{"address", "thread"},
+	{"address", "memory"},
+	{"thread", "memory"},
+	{"leak", "thread"},
+	{"leak", "memory"},
+}
+
+//  Select the sanitizers used by every directory from a comma
+//  separated list, as per -sanitize.
+//
+func SetSanitizers(value string) error {
+	selected, err := ParseSanitizers(value)
+	if err != nil {
+		return err
+	}
+	if strings.Join(selected, ",") == strings.Join(sanitizers, ",") {
+		return nil
+	}
+	if len(sanitizers) > 0 {
+		return fmt.Errorf("%q: sanitizers already set to %s", value, strings.Join(sanitizers, ","))
+	}
+	sanitizers = selected
+	return nil
+}
+
+//  Return the sanitizers named by a comma separated list.
+//
+func ParseSanitizers(value string) ([]string, error) {
+	var selected []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || Contains(selected, name) {
+			continue
+		}
+		if _, found := sanitizerNames[name]; !found {
+			return nil, fmt.Errorf("%q: unknown sanitizer, use address, undefined, thread, memory or leak", name)
+		}
+		selected = append(selected, name)
+	}
+	for _, pair := range incompatibleSanitizers {
+		if Contains(selected, pair[0]) && Contains(selected, pair[1]) {
+			return nil, fmt.Errorf("the %s and %s sanitizers can't be used together", pair[0], pair[1])
+		}
+	}
+	return selected, nil
+}
+
+//  Return the receiver's sanitizers, those given by -sanitize,
+//  otherwise those selected by its .dmake file's SANITIZE variable.
+//
+func (dmake *Dmake) Sanitizers() []string {
+	if len(sanitizers) > 0 {
+		return sanitizers
+	}
+	return dmake.sanitizers
+}
+
+//  Return the name used for the sanitizers' directories, e.g.
+//  asan-ubsan, or "" if none are used.
+//
+func (dmake *Dmake) SanitizerName() string {
+	var names []string
+	for _, name := range dmake.Sanitizers() {
+		names = append(names, sanitizerNames[name])
+	}
+	return strings.Join(names, "-")
+}
+
+//  Return the options used to compile and link with the sanitizers.
+//  Frame pointers are kept so the sanitizers' stack traces are
+//  complete.
+//
+func (dmake *Dmake) SanitizerOptions() []string {
+	selected := dmake.Sanitizers()
+	if len(selected) == 0 {
+		return nil
+	}
+	return []string{"-fsanitize=" + strings.Join(selected, ","), "-fno-omit-frame-pointer"}
+}
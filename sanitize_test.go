@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetSanitizers(t *testing.T) {
+	defer func() {
+		sanitizers = nil
+	}()
+
+	if err := SetSanitizers("address,thread"); err == nil {
+		t.Error("incompatible sanitizers accepted")
+	}
+	if err := SetSanitizers("adress"); err == nil {
+		t.Error("unknown sanitizer accepted")
+	}
+	if err := SetSanitizers("address, undefined,address"); err != nil {
+		t.Fatal(err)
+	}
+	if name := (&Dmake{}).ModeDirectory(); name != "asan-ubsan" {
+		t.Errorf("sanitizers' directory is %q, expected asan-ubsan", name)
+	}
+	expected := []string{"-fsanitize=address,undefined", "-fno-omit-frame-pointer"}
+	if options := (&Dmake{}).SanitizerOptions(); !reflect.DeepEqual(options, expected) {
+		t.Errorf("sanitizer options are %q, expected %q", options, expected)
+	}
+	if err := SetSanitizers("leak"); err == nil {
+		t.Error("sanitizers changed")
+	}
+}
+
+func TestDirectorySanitizers(t *testing.T) {
+	sanitized, other := &Dmake{}, &Dmake{}
+	vars := make(Vars)
+	vars.SetValue("SANITIZE", "address")
+	if err := sanitized.InitFromVars(vars); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.InitFromVars(make(Vars)); err != nil {
+		t.Fatal(err)
+	}
+	if name := sanitized.ModeDirectory(); name != "asan" {
+		t.Errorf("sanitized directory is %q, expected asan", name)
+	}
+	if options := other.SanitizerOptions(); options != nil {
+		t.Errorf("another directory's sanitizer options are %q, SANITIZE leaked", options)
+	}
+	if name := other.ModeDirectory(); name != "" {
+		t.Errorf("another directory's mode directory is %q, SANITIZE leaked", name)
+	}
+
+	vars.SetValue("SANITIZE", "thread")
+	if err := other.InitFromVars(vars); err != nil {
+		t.Errorf("a directory's sanitizers conflicted with another's: %v", err)
+	}
+
+	defer func() { sanitizers = nil }()
+	if err := SetSanitizers("undefined"); err != nil {
+		t.Fatal(err)
+	}
+	if name := sanitized.SanitizerName(); name != "ubsan" {
+		t.Errorf("sanitizers %q, -sanitize didn't take precedence", name)
+	}
+}
@@ -0,0 +1,156 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//  When interrupted, by SIGINT or SIGTERM, dmake forwards the signal
+//  to the commands it's running, waits for them to exit and removes
+//  any files they were part way through writing. Otherwise an
+//  interrupted link could leave a truncated library that, being newer
+//  than its objects, later builds would happily use.
+//
+const interruptedWait = 10 * time.Second
+
+var errInterrupted = errors.New("interrupted")
+
+var running = struct {
+	sync.Mutex
+	commands map[*exec.Cmd]bool // the commands running
+	outputs  map[string]int     // the files being written and by how many commands
+	done     *sync.Cond         // signalled as commands finish
+	stopping bool               // interrupted, no more commands are run
+}{
+	commands: make(map[*exec.Cmd]bool),
+	outputs:  make(map[string]int),
+}
+
+func init() {
+	running.done = sync.NewCond(&running.Mutex)
+}
+
+//  Handle interrupts for the rest of the process' life.
+//
+func HandleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logger.Warnf("%v, stopping", sig)
+		Interrupted(sig)
+		status := 1
+		if s, ok := sig.(syscall.Signal); ok {
+			status = 128 + int(s)
+		}
+		os.Exit(status)
+	}()
+}
+
+//  Forward a signal to the running commands, wait a while for them to
+//  exit and remove the files they were writing.
+//
+func Interrupted(sig os.Signal) {
+	running.Lock()
+	defer running.Unlock()
+	running.stopping = true
+	for cmd := range running.commands {
+		if cmd.Process != nil && cmd.Process.Signal(sig) != nil {
+			cmd.Process.Kill()
+		}
+	}
+	deadline := time.AfterFunc(interruptedWait, func() {
+		running.Lock()
+		for cmd := range running.commands {
+			if cmd.Process != nil {
+				cmd.Process.Kill()
+			}
+		}
+		running.Unlock()
+	})
+	for len(running.commands) > 0 {
+		running.done.Wait()
+	}
+	deadline.Stop()
+	for path := range running.outputs {
+		if os.Remove(path) == nil && *verboseFlag {
+			logger.Warnf("removed partially written %s", path)
+		}
+	}
+}
+
+//  Run a command, starting and waiting for it, so it can be signalled
+//  if we're interrupted. The files the command writes may be given so
+//  they're removed if it's interrupted.
+//
+func RunCommand(cmd *exec.Cmd, outputs ...string) error {
+	running.Lock()
+	if running.stopping {
+		running.Unlock()
+		return errInterrupted
+	}
+	if err := cmd.Start(); err != nil {
+		running.Unlock()
+		return err
+	}
+	running.commands[cmd] = true
+	for _, path := range outputs {
+		running.outputs[path]++
+	}
+	running.Unlock()
+
+	err := cmd.Wait()
+
+	running.Lock()
+	delete(running.commands, cmd)
+	stopping := running.stopping
+	if !stopping {
+		// An interrupted command's outputs are kept for the
+		// signal handler to remove.
+		//
+		for _, path := range outputs {
+			if running.outputs[path]--; running.outputs[path] == 0 {
+				delete(running.outputs, path)
+			}
+		}
+	}
+	running.done.Broadcast()
+	running.Unlock()
+	if stopping {
+		// The command was interrupted, leave exiting to the
+		// signal handler once it's cleaned up.
+		//
+		select {}
+	}
+	return err
+}
+
+//  Record a file being written by dmake itself, rather than a command,
+//  so it's removed if we're interrupted. The returned function is
+//  called once the file has been written.
+//
+func WritingFile(path string) func() {
+	running.Lock()
+	running.outputs[path]++
+	running.Unlock()
+	return func() {
+		running.Lock()
+		if running.outputs[path]--; running.outputs[path] == 0 {
+			delete(running.outputs, path)
+		}
+		running.Unlock()
+	}
+}
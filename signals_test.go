@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterrupted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("can't send SIGINT to a child process")
+	}
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip(err)
+	}
+	inTempProject(t, map[string]string{"prog.o": "partial", "prog.d": "partial", "done.o": "complete"})
+	defer func() {
+		running.Lock()
+		running.stopping = false
+		running.outputs = make(map[string]int)
+		running.Unlock()
+	}()
+
+	cmd := exec.Command("sleep", "30")
+	go RunCommand(cmd, "prog.o")
+	finished := WritingFile("done.o")
+	finished()
+	WritingFile("prog.d")
+	for started := time.Now(); ; {
+		running.Lock()
+		n := len(running.commands)
+		running.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Since(started) > 5*time.Second {
+			t.Fatal("sleep didn't start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	started := time.Now()
+	Interrupted(os.Interrupt)
+	if time.Since(started) >= interruptedWait {
+		t.Error("sleep was killed rather than interrupted")
+	}
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() || status.Signal() != syscall.SIGINT {
+		t.Errorf("sleep exited with %v, expected SIGINT", cmd.ProcessState)
+	}
+	for _, path := range []string{"prog.o", "prog.d"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("partially written %s not removed", path)
+		}
+	}
+	if _, err := os.Stat("done.o"); err != nil {
+		t.Error(err)
+	}
+	if err := RunCommand(exec.Command("sleep", "30")); err != errInterrupted {
+		t.Errorf("command run after an interrupt returned %v", err)
+	}
+}
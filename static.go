@@ -0,0 +1,140 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+//  The -static option, or STATIC variable, links programs statically
+//  so they run on systems without the libraries they use, e.g. to make
+//  portable Linux binaries. Programs are linked with -static, shared
+//  libraries and plugins can't be static but are linked with the
+//  static runtime libraries. pkg-config is asked for the libraries
+//  needed to link statically.
+//
+//  macOS doesn't support static programs, there they're linked with
+//  the static versions of the libraries they use, when they exist, and
+//  the system libraries dynamically. Statically linked objects and
+//  outputs go in a static directory, like a build mode.
+//
+//  The -static option links every directory statically, a .dmake
+//  file's STATIC variable only its own directory.
+//
+const staticModeName = "static"
+
+//  Statically linked outputs are being built, as per -static.
+//
+var staticBuild bool
+
+//  Where static libraries are looked for, after any -L directories,
+//  when the platform can't link programs statically.
+//
+var staticLibraryDirectories = []string{"/usr/local/lib", "/opt/homebrew/lib", "/opt/local/lib", "/usr/lib"}
+
+var warnStaticOnce sync.Once
+
+//  Link every directory statically.
+//
+func SetStatic() {
+	staticBuild = true
+}
+
+//  Return true if the receiver's outputs are linked statically, as
+//  per -static or its .dmake file's STATIC variable.
+//
+func (dmake *Dmake) Static() bool {
+	return staticBuild || dmake.static
+}
+
+//  Return true if the target platform links programs fully
+//  statically.
+//
+func (t *Target) FullyStatic() bool {
+	return t.os != "darwin"
+}
+
+//  Return the options used to link the receiver's output statically.
+//
+func (dmake *Dmake) StaticOptions() []string {
+	if !dmake.Static() {
+		return nil
+	}
+	if !dmake.Target().FullyStatic() {
+		warnStaticOnce.Do(func() {
+			logger.Warnf("%s doesn't support static programs, linking static libraries where possible", dmake.Target().os)
+		})
+		return nil
+	}
+	switch dmake.outputtype {
+	case ExeOutputType:
+		return []string{"-static"}
+	case DllOutputType, PluginOutputType:
+		return []string{"-static-libgcc", "-static-libstdc++"}
+	}
+	return nil
+}
+
+//  Return libraries with the -l options replaced by the static
+//  libraries they name, if they're found in the -L directories given
+//  by the linker options or libraries, or the usual places, for
+//  platforms that can't link programs fully statically.
+//
+func (dmake *Dmake) StaticLibraries(ldflags, libs []string) []string {
+	if !dmake.Static() || dmake.Target().FullyStatic() {
+		return libs
+	}
+	var dirs []string
+	for _, arg := range append(ldflags[:len(ldflags):len(ldflags)], libs...) {
+		if strings.HasPrefix(arg, "-L") && len(arg) > 2 {
+			dirs = append(dirs, arg[2:])
+		}
+	}
+	dirs = append(dirs, staticLibraryDirectories...)
+	result := make([]string, 0, len(libs))
+	for _, arg := range libs {
+		if strings.HasPrefix(arg, "-l") && len(arg) > 2 {
+			if path := FindStaticLibrary(arg[2:], dirs); path != "" {
+				arg = path
+			}
+		}
+		result = append(result, arg)
+	}
+	return result
+}
+
+//  Return the pathname of the static library with the given name in
+//  the first of the directories holding it, or "" if none do.
+//
+func FindStaticLibrary(name string, dirs []string) string {
+	for _, dir := range dirs {
+		path := filepath.Join(dir, "lib"+name+".a")
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path
+		}
+	}
+	return ""
+}
+
+//  Return the static linking mode given by the STATIC variable's
+//  value.
+//
+func ParseStaticValue(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "", "yes", "on", "true", "1":
+		return true, nil
+	case "no", "off", "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("STATIC: %q: use on or off", value)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStaticLibraries(t *testing.T) {
+	savedOS := targetOS
+	defer func() {
+		targetOS = savedOS
+		staticBuild = false
+	}()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "libfoo.a"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	libs := []string{"-L" + dir, "-lfoo", "-lno-such-library", "-pthread"}
+
+	SetStatic()
+	dmake := &Dmake{outputtype: ExeOutputType}
+	if name := dmake.ModeDirectory(); name != "static" {
+		t.Errorf("static directory is %q, expected static", name)
+	}
+	targetOS = "linux"
+	if result := dmake.StaticLibraries(nil, libs); !reflect.DeepEqual(result, libs) {
+		t.Errorf("linux libraries changed to %q", result)
+	}
+	if options := dmake.StaticOptions(); !reflect.DeepEqual(options, []string{"-static"}) {
+		t.Errorf("linux static options are %q", options)
+	}
+	targetOS = "darwin"
+	expected := []string{"-L" + dir, filepath.Join(dir, "libfoo.a"), "-lno-such-library", "-pthread"}
+	if result := dmake.StaticLibraries(nil, libs); !reflect.DeepEqual(result, expected) {
+		t.Errorf("macOS libraries are %q, expected %q", result, expected)
+	}
+	if result := dmake.StaticLibraries([]string{"-L" + dir}, []string{"-lfoo"}); !reflect.DeepEqual(result, expected[1:2]) {
+		t.Errorf("macOS libraries found via LDFLAGS are %q, expected %q", result, expected[1:2])
+	}
+}
+
+func TestDirectoryStatic(t *testing.T) {
+	static, other := &Dmake{}, &Dmake{}
+	vars := make(Vars)
+	vars.SetValue("STATIC", "on")
+	if err := static.InitFromVars(vars); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.InitFromVars(make(Vars)); err != nil {
+		t.Fatal(err)
+	}
+	if name := static.ModeDirectory(); name != staticModeName {
+		t.Errorf("static directory is %q, expected %s", name, staticModeName)
+	}
+	if other.Static() {
+		t.Error("another directory links statically, STATIC leaked")
+	}
+	if name := other.ModeDirectory(); name != "" {
+		t.Errorf("another directory's mode directory is %q, STATIC leaked", name)
+	}
+
+	vars.SetValue("STATIC", "maybe")
+	if err := other.InitFromVars(vars); err == nil {
+		t.Error("expected an error for a malformed STATIC")
+	}
+}
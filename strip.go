@@ -0,0 +1,201 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//  Installed programs and shared libraries may be stripped of their
+//  symbols, enabled by the -strip option or the STRIP variable which,
+//  like CACHE, may name the strip command, be "yes" or "no". The build
+//  output is left alone, a stripped copy is made and installed.
+//
+//  With -split-debug, or SPLIT_DEBUG, the debug information is first
+//  split into its own file, by objcopy --only-keep-debug or, on macOS,
+//  into a .dSYM bundle by dsymutil. The debug file is installed below
+//  the DEBUG_DIR directory, by default prefix/lib/debug, in the
+//  directory named by the stripped file's installed path, where
+//  debuggers look for it, e.g. /usr/lib/debug/usr/bin/prog.debug.
+//
+const (
+	strippedDirectory   = "stripped"
+	debugFileSuffix     = ".debug"
+	debugBundleSuffix   = ".dSYM"
+	defaultDebugDirName = "debug"
+)
+
+//  Return the strip command used when installing, or nil if installed
+//  files aren't stripped.
+//
+func (dmake *Dmake) StripCommand() ([]string, error) {
+	value, found := dmake.vars.GetValue("STRIP")
+	if !found {
+		if !*stripFlag && !dmake.SplittingDebug() {
+			return nil, nil
+		}
+		value = "yes"
+	}
+	switch strings.ToLower(value) {
+	case "no", "off", "false", "0":
+		return nil, nil
+	case "", "yes", "on", "true", "1", "auto":
+		if strip := dmake.ToolchainDescription().StripCommand(); strip != nil {
+			return strip, nil
+		}
+		if dmake.Target().os == androidOS {
+			return AndroidStripCommand(), nil
+		}
+		if dmake.Target().cross {
+			return []string{dmake.Target().Triple() + "-strip"}, nil
+		}
+		return []string{"strip"}, nil
+	}
+	command := strings.Fields(value)
+	if _, err := exec.LookPath(command[0]); err != nil {
+		return nil, fmt.Errorf("STRIP: %s not found", command[0])
+	}
+	return command, nil
+}
+
+//  Return true if debug information is split into its own file when
+//  stripping.
+//
+func (dmake *Dmake) SplittingDebug() bool {
+	_, found := dmake.vars.Get("SPLIT_DEBUG")
+	return found || *splitDebugFlag
+}
+
+//  Return the directory below which split debug files are installed.
+//
+func (dmake *Dmake) DebugDirectory(prefix string) string {
+	if dir := dmake.vars.GetString("DEBUG_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(prefix, "lib", defaultDebugDirName)
+}
+
+//  Install a program or shared library, built by the receiver, into a
+//  directory, stripping it, and splitting its debug information, if
+//  requested. Static libraries are never stripped, their symbols are
+//  needed to link with them, nor is WebAssembly.
+//
+func (dmake *Dmake) InstallBinary(env []string, path, dest string, mode os.FileMode, prefix string) error {
+	strip, err := dmake.StripCommand()
+	if err != nil {
+		return err
+	}
+	if strip == nil || dmake.outputtype == LibOutputType || dmake.Target().os == wasmOS {
+		return dmake.InstallFile(path, dest, mode)
+	}
+
+	env = dmake.TargetEnvironment(env)
+	dir := filepath.Join(dmake.ObjsDir(), strippedDirectory)
+	if !*dryRunFlag {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return err
+		}
+	}
+	stripped := filepath.Join(dir, filepath.Base(path))
+	split := dmake.SplittingDebug()
+	macos := dmake.Target().os == "darwin"
+	debug := stripped + debugFileSuffix
+	if macos {
+		debug = stripped + debugBundleSuffix
+	}
+	objcopy := []string{"objcopy"}
+	if dmake.Target().cross {
+		objcopy = []string{dmake.Target().Triple() + "-objcopy"}
+	}
+
+	if split {
+		var err error
+		if macos {
+			err = runTool(env, []string{"dsymutil", path, "-o", debug}, debug)
+		} else {
+			err = runTool(env, append(objcopy, "--only-keep-debug", path, debug), debug)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	args := append(strip[:len(strip):len(strip)], StripOptions(dmake.outputtype, macos)...)
+	if err := runTool(env, append(args, "-o", stripped, path), stripped); err != nil {
+		return err
+	}
+	if split && !macos {
+		if err := runTool(env, append(objcopy, "--add-gnu-debuglink="+debug, stripped), stripped); err != nil {
+			return err
+		}
+	}
+	if err := dmake.InstallFile(stripped, dest, mode); err != nil {
+		return err
+	}
+	if !split {
+		return nil
+	}
+
+	debugdest := filepath.Join(dmake.DebugDirectory(prefix), AbsolutePath(dest))
+	if !macos {
+		return dmake.InstallFile(debug, debugdest, os.FileMode(0444))
+	}
+	return filepath.Walk(debug, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(filepath.Dir(debug), file)
+		if err != nil {
+			return err
+		}
+		return dmake.InstallFile(file, filepath.Join(debugdest, filepath.Dir(rel)), os.FileMode(0444))
+	})
+}
+
+//  Return the strip options for an output type. Shared libraries keep
+//  the symbols needed to link with them.
+//
+func StripOptions(outputtype OutputType, macos bool) []string {
+	if outputtype == ExeOutputType {
+		return nil
+	}
+	if macos {
+		return []string{"-x"}
+	}
+	return []string{"--strip-unneeded"}
+}
+
+//  Return the absolute form of a path, or the path itself if that
+//  fails.
+//
+func AbsolutePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+//  Run a tool, given the files it writes.
+//
+func runTool(env []string, command []string, outputs ...string) error {
+	if DryRun(command[0], command[1:]...) {
+		return nil
+	}
+	logger.Verbosef("RUN: %s", ShellJoin(command))
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = env
+	cmd.Stdout, cmd.Stderr = CommandOutput(), os.Stderr
+	if err := RunCommand(cmd, outputs...); err != nil {
+		return AddDetail(err, "%s", strings.Join(command, " "))
+	}
+	return nil
+}
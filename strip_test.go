@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStripCommand(t *testing.T) {
+	tests := []struct {
+		value    string // the STRIP variable, "" if undefined
+		split    bool
+		expected []string
+	}{
+		{"", false, nil},
+		{"", true, []string{"strip"}},
+		{"yes", false, []string{"strip"}},
+		{"on", false, []string{"strip"}},
+		{"no", true, nil},
+		{"sh -c true", false, []string{"sh", "-c", "true"}},
+	}
+	for _, test := range tests {
+		dmake := &Dmake{vars: make(Vars)}
+		if test.value != "" {
+			dmake.vars.SetValue("STRIP", test.value)
+		}
+		if test.split {
+			dmake.vars.SetValue("SPLIT_DEBUG", "")
+		}
+		strip, err := dmake.StripCommand()
+		if err != nil {
+			t.Errorf("STRIP=%q: %v", test.value, err)
+		} else if !reflect.DeepEqual(strip, test.expected) {
+			t.Errorf("STRIP=%q, split %v: command %q, expected %q", test.value, test.split, strip, test.expected)
+		}
+	}
+	dmake := &Dmake{vars: make(Vars)}
+	dmake.vars.SetValue("STRIP", "no-such-strip-command")
+	if _, err := dmake.StripCommand(); err == nil {
+		t.Error("expected an error for a missing strip command")
+	}
+}
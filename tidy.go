@@ -0,0 +1,151 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+//  dmake tidy builds the module, having dcc write compile_commands.json,
+//  and runs clang-tidy over its source files. clang-tidy finds each
+//  file's options in compile_commands.json, files it doesn't list, e.g.
+//  when dcc didn't write one, are given the options dmake would have
+//  dcc use. The TIDY_CHECKS variable selects the checks, otherwise
+//  clang-tidy uses any .clang-tidy file. Diagnostics are reported but
+//  only fail the build when TIDY_WERROR is defined or with -Werror.
+//
+const defaultClangTidy = "clang-tidy"
+
+// dmake tidy in cwd
+//
+// Runs clang-tidy over the receiver's source files, up to -j at once.
+//
+func (dmake *Dmake) TidyAction(env []string) error {
+	tidy := dmake.TidyCommand(env)
+	if _, err := exec.LookPath(tidy[0]); err != nil && !*dryRunFlag {
+		return fmt.Errorf("%s: not found, define $CLANG_TIDY to use another command", tidy[0])
+	}
+	listed := make(map[string]bool)
+	if entries, err := ReadCompileCommands(compileCommandsFilename); err == nil {
+		for _, entry := range entries {
+			directory, _ := entry["directory"].(string)
+			file, _ := entry["file"].(string)
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(directory, file)
+			}
+			listed[filepath.Clean(file)] = true
+		}
+	} else if !os.IsNotExist(err) {
+		return AddDetail(err, "%s", compileCommandsFilename)
+	}
+	target, err := dmake.ExportTarget()
+	if err != nil {
+		return err
+	}
+
+	var options []string
+	if checks, found := dmake.vars.GetValue("TIDY_CHECKS"); found && checks != "" {
+		options = append(options, "--checks="+strings.Join(strings.Fields(checks), ""))
+	}
+	_, werror := dmake.vars.Get("TIDY_WERROR")
+	if werror || *werrorFlag {
+		options = append(options, "--warnings-as-errors=*")
+	}
+
+	var paths []string
+	var commands [][]string
+	for _, source := range target.sources {
+		if dmake.OriginalSource(source.path) != source.path {
+			continue // generated
+		}
+		args := append(tidy[1:len(tidy):len(tidy)], options...)
+		if abs, err := filepath.Abs(source.path); err == nil && listed[abs] {
+			args = append(args, "-p", ".", source.path)
+		} else {
+			args = append(args, source.path, "--")
+			args = append(args, source.options...)
+			args = append(args, dmake.GeneratedOptions()...)
+		}
+		paths = append(paths, source.path)
+		commands = append(commands, append([]string{tidy[0]}, args...))
+	}
+
+	failed := RunFileCommands(env, paths, commands, func(path string, output []byte, err error) {
+		annotations.Writer(CommandOutput()).Write(output)
+		if err != nil {
+			logger.Warnf("FAIL %s (%s)", path, err)
+		}
+	})
+	if *dryRunFlag {
+		return nil
+	}
+	if failed > 0 {
+		return fmt.Errorf("clang-tidy failed for %d of %d files", failed, len(commands))
+	}
+	return nil
+}
+
+//  Return the clang-tidy command, the .dmake CLANG_TIDY variable or
+//  $CLANG_TIDY if defined, otherwise clang-tidy.
+//
+func (dmake *Dmake) TidyCommand(env []string) []string {
+	if value, found := dmake.vars.GetValue("CLANG_TIDY"); found && value != "" {
+		return strings.Fields(value)
+	}
+	if value, found := LookupEnv(env, "CLANG_TIDY"); found && value != "" {
+		return strings.Fields(value)
+	}
+	return []string{defaultClangTidy}
+}
+
+//  Run commands for each of the source files, up to -j at once, and
+//  return how many failed. Each command's output is given to the
+//  handler once it's finished, one at a time, so the output for
+//  different files isn't interleaved.
+//
+func RunFileCommands(env []string, paths []string, commands [][]string, handler func(path string, output []byte, err error)) int {
+	jobs := *jobsFlag
+	if jobs < 1 {
+		jobs = 1
+	}
+	semaphore := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	for i, command := range commands {
+		if DryRun(command[0], command[1:]...) {
+			continue
+		}
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(path string, command []string) {
+			defer func() { <-semaphore; wg.Done() }()
+			logger.Verbosef("RUN: %s", ShellJoin(command))
+			var output bytes.Buffer
+			cmd := exec.Command(command[0], command[1:]...)
+			cmd.Env = env
+			cmd.Stdout, cmd.Stderr = &output, &output
+			err := RunCommand(cmd)
+			mu.Lock()
+			defer mu.Unlock()
+			handler(path, output.Bytes(), err)
+			if err != nil {
+				failed++
+			}
+		}(paths[i], command)
+	}
+	wg.Wait()
+	return failed
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTidy(t *testing.T) {
+	dir := inTempProject(t, map[string]string{
+		dmakeFileFilename: "CFLAGS = -DTIDY\nTIDY_CHECKS = -*, bugprone-*\nTIDY_WERROR =\n",
+		"main.c":          "int main() { return 0; }\n",
+		"util.c":          "",
+	})
+	writeFiles(t, dir, map[string]string{
+		compileCommandsFilename: `[{"directory": "` + filepath.ToSlash(dir) + `", "file": "main.c", "command": "cc -c main.c"}]`,
+	})
+	// The fake clang-tidy logs its arguments and fails for util.c.
+	tidy := fakeTool(t, "clang-tidy", `echo "$@" >> tidy.log
+for arg; do [ "$arg" = util.c ] && exit 1; done
+exit 0
+`)
+	dmake := NewDmake("prog", "", "")
+	if err := dmake.ReadDmakefile(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dmake.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	saved := logger
+	defer func() { logger = saved }()
+	logger = &Logger{w: &b, level: InfoLevel}
+
+	env := []string{"CLANG_TIDY=" + tidy + " --quiet"}
+	if command := dmake.TidyCommand(env); strings.Join(command, " ") != tidy+" --quiet" {
+		t.Errorf("clang-tidy command %q", command)
+	}
+	err := dmake.TidyAction(env)
+	if err == nil || err.Error() != "clang-tidy failed for 1 of 2 files" {
+		t.Errorf("tidy returned %v", err)
+	}
+	if s := b.String(); !strings.Contains(s, "FAIL util.c (exit status 1)") {
+		t.Errorf("logged %q", s)
+	}
+	log, _ := os.ReadFile("tidy.log")
+	lines := strings.Split(strings.TrimSpace(string(log)), "\n")
+	sort.Strings(lines)
+	expected := []string{
+		"--quiet --checks=-*,bugprone-* --warnings-as-errors=* -p . main.c",
+		"--quiet --checks=-*,bugprone-* --warnings-as-errors=* util.c -- -DTIDY",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("clang-tidy run as\n%s\nexpected\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if err := dmake.TidyAction(nil); err == nil || !strings.Contains(err.Error(), "clang-tidy: not found") {
+		t.Errorf("tidy without clang-tidy returned %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+//  A child dmake, run to build a sub-directory concurrently, writes
+//  its timings to the file named by this environment variable rather
+//  than reporting them itself. The parent adds them to its own.
+//
+const timingsEnvVar = "DMAKETIMINGS"
+
+//  A Timing records how long something took.
+//
+type Timing struct {
+	kind     string        // "directory" or "dcc"
+	name     string        // relative to the top directory
+	duration time.Duration // wall-clock time
+}
+
+var (
+	timingMutex sync.Mutex
+	timings     []Timing
+
+	// The directory dmake was started in. Timing names are
+	// relative to it.
+	//
+	topDirectory string
+)
+
+//  Record how long something, named by a path relative to the
+//  current directory, has taken since it started, if -time was given.
+//
+func RecordTiming(kind, path string, started time.Time) {
+	if !*timeFlag {
+		return
+	}
+	duration := time.Since(started)
+	if cwd, err := os.Getwd(); err == nil && topDirectory != "" {
+		if rel, err := filepath.Rel(topDirectory, filepath.Join(cwd, path)); err == nil {
+			path = rel
+		}
+	}
+	AddTimings("", []Timing{{kind, path, duration}})
+}
+
+//  Add timings, prefixing their names with a path.
+//
+func AddTimings(prefix string, t []Timing) {
+	timingMutex.Lock()
+	defer timingMutex.Unlock()
+	for _, timing := range t {
+		timing.name = filepath.Join(prefix, timing.name)
+		timings = append(timings, timing)
+	}
+}
+
+//  Write a table of the recorded timings, longest first, followed by
+//  the total time taken.
+//
+func ReportTimings(w io.Writer, total time.Duration) {
+	timingMutex.Lock()
+	defer timingMutex.Unlock()
+	sort.SliceStable(timings, func(i, j int) bool {
+		return timings[i].duration > timings[j].duration
+	})
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "%10s\tKIND\tNAME\n", "TIME")
+	for _, timing := range timings {
+		fmt.Fprintf(tw, "%10s\t%s\t%s\n", timing.duration.Round(time.Millisecond), timing.kind, timing.name)
+	}
+	fmt.Fprintf(tw, "%10s\ttotal\n", total.Round(time.Millisecond))
+	tw.Flush()
+}
+
+//  Write the recorded timings to a file, one per line, for a parent
+//  dmake to read.
+//
+func WriteTimings(path string) error {
+	var b strings.Builder
+	timingMutex.Lock()
+	for _, timing := range timings {
+		fmt.Fprintf(&b, "%d\t%s\t%s\n", timing.duration, timing.kind, timing.name)
+	}
+	timingMutex.Unlock()
+	return CreateFile(path, b.String())
+}
+
+//  Read the timings written by a child dmake.
+//
+func ReadTimings(path string) ([]Timing, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var t []Timing
+	input := bufio.NewScanner(file)
+	for input.Scan() {
+		fields := strings.SplitN(input.Text(), "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		duration, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: malformed timing %q", path, input.Text())
+		}
+		t = append(t, Timing{fields[1], fields[2], time.Duration(duration)})
+	}
+	return t, input.Err()
+}
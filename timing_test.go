@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimings(t *testing.T) {
+	savedFlag, savedTimings, savedTop := *timeFlag, timings, topDirectory
+	defer func() { *timeFlag, timings, topDirectory = savedFlag, savedTimings, savedTop }()
+	timings = nil
+
+	dir := inTempProject(t, map[string]string{"lib/lib.c": ""})
+	*timeFlag, topDirectory = true, dir
+	if err := os.Chdir("lib"); err != nil {
+		t.Fatal(err)
+	}
+	RecordTiming("dcc", "lib.c", time.Now().Add(-time.Second))
+	os.Chdir(dir)
+	RecordTiming("directory", "lib", time.Now().Add(-2*time.Second))
+	if len(timings) != 2 || timings[0].name != filepath.Join("lib", "lib.c") || timings[1].name != "lib" || timings[1].duration < 2*time.Second {
+		t.Fatalf("recorded timings %+v", timings)
+	}
+
+	// A child dmake's timings are written to a file and read by its
+	// parent which names them relative to itself.
+	timings = []Timing{{"dcc", "lib.c", 1500 * time.Millisecond}, {"directory", "sub dir", 2 * time.Second}}
+	path := filepath.Join(dir, "timings")
+	if err := WriteTimings(path); err != nil {
+		t.Fatal(err)
+	}
+	child, err := ReadTimings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(child, timings) {
+		t.Fatalf("read timings %+v, expected %+v", child, timings)
+	}
+	timings = []Timing{{"directory", "lib", 4 * time.Second}}
+	AddTimings("lib", child)
+	var b strings.Builder
+	ReportTimings(&b, 5*time.Second)
+	expected := `      TIME  KIND       NAME
+        4s  directory  lib
+        2s  directory  lib/sub dir
+      1.5s  dcc        lib/lib.c
+        5s  total
+`
+	if s := b.String(); s != filepath.FromSlash(expected) {
+		t.Errorf("reported\n%s\nexpected\n%s", s, expected)
+	}
+
+	writeFiles(t, dir, map[string]string{"timings": "x\tdcc\tlib.c\n"})
+	if _, err := ReadTimings(path); err == nil {
+		t.Error("expected an error reading a malformed timing")
+	}
+}
@@ -0,0 +1,375 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+//  A Toolchain is the family of compiler, linker and archiver used to
+//  build outputs. The GNU toolchain, gcc, clang and compatible
+//  compilers, is the default and dcc drives it. Microsoft's cl.exe,
+//  link.exe and lib.exe, and LLVM's compatible clang-cl, lld-link and
+//  llvm-lib, spell their options differently and are driven by the
+//  built-in compiler driver which translates the usual options, e.g.
+//  -I, -D, -O2, -g and -l, into theirs.
+//
+//  The toolchain is selected by the TOOLCHAIN variable, or environment
+//  variable, gnu, msvc or clang-cl. When building on Windows without a
+//  C compiler, cc or gcc, msvc or clang-cl is used if its compiler is
+//  found, e.g. in a Visual Studio developer command prompt.
+//
+type Toolchain struct {
+	name string
+	cc   string // the C compiler
+	cxx  string // the C++ compiler
+	ar   string // the archiver
+	ld   string // the linker, when not the compiler
+	rc   string // the resource compiler
+	msvc bool   // true if the tools use Microsoft's options
+}
+
+var (
+	gnuToolchain = Toolchain{
+		name: "gnu",
+		cc:   "cc",
+		cxx:  "c++",
+		ar:   "ar",
+		rc:   "windres",
+	}
+	msvcToolchain = Toolchain{
+		name: "msvc",
+		cc:   "cl",
+		cxx:  "cl",
+		ar:   "lib",
+		ld:   "link",
+		rc:   "rc",
+		msvc: true,
+	}
+	clangclToolchain = Toolchain{
+		name: "clang-cl",
+		cc:   "clang-cl",
+		cxx:  "clang-cl",
+		ar:   "llvm-lib",
+		ld:   "lld-link",
+		rc:   "llvm-rc",
+		msvc: true,
+	}
+
+	// The toolchain used to build outputs when a directory's .dmake
+	// file, or the environment, doesn't select one.
+	//
+	toolchain = &gnuToolchain
+
+	// The toolchains known, by name.
+	//
+	toolchains = map[string]*Toolchain{
+		gnuToolchain.name:     &gnuToolchain,
+		msvcToolchain.name:    &msvcToolchain,
+		clangclToolchain.name: &clangclToolchain,
+	}
+)
+
+//  The MSVC runtime library is selected by the MSVC_RUNTIME variable,
+//  MD, MT, MDd or MTd. The default is the DLL runtime, /MD, or the
+//  static runtime, /MT, when linking statically.
+//
+var msvcRuntimes = []string{"MD", "MT", "MDd", "MTd"}
+
+//  Return the toolchain with a name, checking it can build for the
+//  target.
+//
+func FindToolchain(name string, target *Target) (*Toolchain, error) {
+	t, found := toolchains[strings.ToLower(name)]
+	if !found {
+		return nil, fmt.Errorf("TOOLCHAIN: %q: unknown toolchain, use gnu, msvc or clang-cl", name)
+	}
+	if t.msvc && target.os != "windows" {
+		return nil, fmt.Errorf("TOOLCHAIN: the %s toolchain only builds for Windows", t.name)
+	}
+	return t, nil
+}
+
+//  Select the toolchain used by every directory that doesn't select
+//  its own, as a toolchain file does.
+//
+func SetToolchain(name string) error {
+	t, err := FindToolchain(name, DefaultTarget())
+	if err != nil {
+		return err
+	}
+	toolchain = t
+	return nil
+}
+
+//  Select the toolchain used to build for a target when none is
+//  named. On Windows, without a C compiler, Microsoft's or LLVM's is
+//  used if it's found.
+//
+func DefaultToolchain(env []string, target *Target) *Toolchain {
+	if runtime.GOOS != "windows" || target.cross {
+		return &gnuToolchain
+	}
+	if value, found := LookupEnv(env, "CC"); found && value != "" {
+		return &gnuToolchain
+	}
+	for _, cc := range []string{"cc", "gcc"} {
+		if _, err := exec.LookPath(cc); err == nil {
+			return &gnuToolchain
+		}
+	}
+	for _, t := range []*Toolchain{&msvcToolchain, &clangclToolchain} {
+		if _, err := exec.LookPath(t.cc); err == nil {
+			return t
+		}
+	}
+	return &gnuToolchain
+}
+
+//  Return the compiler options selecting the MSVC runtime library.
+//
+func MsvcRuntimeOption(value string, static bool) (string, error) {
+	if value == "" {
+		if static {
+			return "/MT", nil
+		}
+		return "/MD", nil
+	}
+	for _, name := range msvcRuntimes {
+		if strings.EqualFold(strings.TrimLeft(value, "/-"), name) {
+			return "/" + name, nil
+		}
+	}
+	return "", fmt.Errorf("MSVC_RUNTIME: %q: use MD, MT, MDd or MTd", value)
+}
+
+//  Return the option selecting the MSVC runtime library used by the
+//  receiver, that named by MSVC_RUNTIME or the default for its
+//  linking mode.
+//
+func (dmake *Dmake) MsvcRuntime() (string, error) {
+	return MsvcRuntimeOption(dmake.msvcRuntime, dmake.Static())
+}
+
+//  Return the toolchain used to build the receiver's outputs, that
+//  selected by its .dmake file or the environment, otherwise that of
+//  the toolchain file, if any, or the default.
+//
+func (dmake *Dmake) Toolchain() *Toolchain {
+	if dmake.toolchain != nil {
+		return dmake.toolchain
+	}
+	return toolchain
+}
+
+//  Return the name of the environment variable defining the compiler
+//  for a language and its default value, the toolchain's compiler.
+//
+func (t *Toolchain) CompilerVariable(language Language) (string, string) {
+	if language == CplusplusLanguage || language == ObjcplusplusLanguage {
+		return "CXX", t.cxx
+	}
+	return "CC", t.cc
+}
+
+//  Return true if dcc-style options request debug information.
+//
+func hasDebugOption(options []string) bool {
+	for _, option := range options {
+		if strings.HasPrefix(option, "-g") && option != "-g0" {
+			return true
+		}
+	}
+	return false
+}
+
+//  Translate dcc-style compiler options, as used with gcc and clang,
+//  into those used by cl.exe. Options already in Microsoft's form,
+//  starting with a /, are used as they are, linker options are
+//  dropped and others are passed on for the compiler to accept or
+//  warn about.
+//
+func MsvcCompileOptions(options []string) []string {
+	var result []string
+	for i := 0; i < len(options); i++ {
+		option := options[i]
+		switch {
+		case strings.HasPrefix(option, "/"):
+			result = append(result, option)
+		case option == "-I" || option == "-D" || option == "-U" || option == "-include":
+			if i+1 < len(options) {
+				i++
+				result = append(result, MsvcCompileOptions([]string{option + options[i]})...)
+			}
+		case strings.HasPrefix(option, "-include"):
+			result = append(result, "/FI"+strings.TrimPrefix(option, "-include"))
+		case strings.HasPrefix(option, "-I"), strings.HasPrefix(option, "-D"), strings.HasPrefix(option, "-U"):
+			result = append(result, "/"+option[1:])
+		case option == "-O0":
+			result = append(result, "/Od")
+		case option == "-O1", option == "-Os", option == "-Oz":
+			result = append(result, "/O1")
+		case option == "-O", option == "-O2", option == "-O3", option == "-Ofast":
+			result = append(result, "/O2")
+		case option == "-g0":
+		case strings.HasPrefix(option, "-g"):
+			if !Contains(result, "/Z7") {
+				result = append(result, "/Z7")
+			}
+		case option == "-w":
+			result = append(result, "/w")
+		case option == "-Wall", option == "-Wextra":
+			if !Contains(result, "/W4") {
+				result = append(result, "/W4")
+			}
+		case option == "-Werror":
+			result = append(result, "/WX")
+		case strings.HasPrefix(option, "-std="):
+			result = append(result, "/std:"+strings.Replace(strings.TrimPrefix(option, "-std="), "gnu", "c", 1))
+		case strings.HasPrefix(option, "-fsanitize=address"):
+			result = append(result, "/fsanitize=address")
+		case option == "-municode":
+			result = append(result, "/DUNICODE", "/D_UNICODE")
+		case strings.HasPrefix(option, "-l"), strings.HasPrefix(option, "-L"), strings.HasPrefix(option, "-Wl,"),
+			strings.HasPrefix(option, "-fsanitize"), strings.HasPrefix(option, "-fno-omit-frame-pointer"),
+			option == "-mwindows", option == "-mconsole", option == "-shared", option == "-static",
+			option == "-pthread", option == "-fPIC", strings.HasPrefix(option, "-static-"):
+		default:
+			result = append(result, option)
+		}
+	}
+	return result
+}
+
+//  Translate dcc-style linker options and libraries into those used
+//  by link.exe. Compiler options are dropped, including those in
+//  Microsoft's form, link.exe's own options are given using -Wl, e.g.
+//  -Wl,/LTCG.
+//
+func MsvcLinkOptions(options []string) []string {
+	var result []string
+	for i := 0; i < len(options); i++ {
+		option := options[i]
+		switch {
+		case option == "-L" && i+1 < len(options):
+			i++
+			result = append(result, "/LIBPATH:"+options[i])
+		case strings.HasPrefix(option, "-L"):
+			result = append(result, "/LIBPATH:"+option[2:])
+		case strings.HasPrefix(option, "-l"):
+			result = append(result, option[2:]+".lib")
+		case strings.HasPrefix(option, "-Wl,"):
+			for _, arg := range strings.Split(option[4:], ",") {
+				if strings.HasSuffix(arg, ".def") {
+					arg = "/DEF:" + arg
+				}
+				result = append(result, arg)
+			}
+		case option == "-mwindows":
+			result = append(result, "/SUBSYSTEM:WINDOWS")
+		case option == "-mconsole":
+			result = append(result, "/SUBSYSTEM:CONSOLE")
+		case option == "-I" || option == "-D" || option == "-U" || option == "-include":
+			i++
+		}
+	}
+	return result
+}
+
+//  Return the arguments used to compile a source file with cl.exe,
+//  whose header dependencies are reported by /showIncludes.
+//
+func MsvcCompileArgs(options []string, crt string, language Language, path, object string) []string {
+	args := []string{"/nologo", "/showIncludes", crt}
+	args = append(args, MsvcCompileOptions(options)...)
+	if language == CplusplusLanguage {
+		args = append(args, "/EHsc", "/c", "/Tp"+path)
+	} else {
+		args = append(args, "/c", "/Tc"+path)
+	}
+	return append(args, "/Fo"+object)
+}
+
+//  Return the arguments used to link an output with link.exe. Debug
+//  information is written to a PDB file named for the output.
+//
+func MsvcLinkArgs(options []string, outputtype OutputType, output string, inputs []string) []string {
+	args := []string{"/nologo", "/OUT:" + output}
+	if outputtype == DllOutputType || outputtype == PluginOutputType {
+		args = append(args, "/DLL")
+	}
+	if hasDebugOption(options) {
+		args = append(args, "/DEBUG", "/PDB:"+strings.TrimSuffix(output, filepath.Ext(output))+".pdb")
+	}
+	args = append(args, MsvcLinkOptions(options)...)
+	for _, input := range inputs {
+		if strings.HasPrefix(input, "-l") {
+			input = input[2:] + ".lib"
+		}
+		args = append(args, input)
+	}
+	return args
+}
+
+//  The prefix of the lines cl.exe writes for each header file
+//  included when using /showIncludes.
+//
+const showIncludesPrefix = "Note: including file:"
+
+//  Separate cl.exe's /showIncludes output from its messages, returning
+//  the header files included, other than the system's, found in the
+//  directories listed by $INCLUDE, and the messages. The name of the
+//  source file cl.exe prints is dropped.
+//
+func ParseShowIncludes(output []byte, path string, systemDirs []string) ([]string, []byte) {
+	var headers []string
+	var messages bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if !strings.HasPrefix(line, showIncludesPrefix) {
+			if line != filepath.Base(path) {
+				fmt.Fprintln(&messages, line)
+			}
+			continue
+		}
+		header := strings.TrimSpace(strings.TrimPrefix(line, showIncludesPrefix))
+		system := false
+		for _, dir := range systemDirs {
+			if dir != "" && strings.HasPrefix(strings.ToLower(header), strings.ToLower(dir)) {
+				system = true
+				break
+			}
+		}
+		if !system && !Contains(headers, header) {
+			headers = append(headers, header)
+		}
+	}
+	return headers, messages.Bytes()
+}
+
+//  Write a make-style dependency file, as the GNU toolchain's -MMD
+//  does, for an object file.
+//
+func WriteDepsFile(path, object string, inputs []string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:", object)
+	for _, input := range inputs {
+		fmt.Fprintf(&b, " \\\n  %s", input)
+	}
+	fmt.Fprintln(&b)
+	return os.WriteFile(path, []byte(b.String()), 0666)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestMsvcOptions(t *testing.T) {
+	options := []string{"-O2", "-g", "-Wall", "-Wextra", "-I", "include", "-DX=1", "-std=gnu++17", "-fPIC", "-Lsdk/lib", "-lws2_32", "-Wl,/LTCG,objs/exports.def", "/permissive-"}
+	compile := []string{"/O2", "/Z7", "/W4", "/Iinclude", "/DX=1", "/std:c++17", "/permissive-"}
+	if result := MsvcCompileOptions(options); !reflect.DeepEqual(result, compile) {
+		t.Errorf("compiler options %q, expected %q", result, compile)
+	}
+	link := []string{"/LIBPATH:sdk/lib", "ws2_32.lib", "/LTCG", "/DEF:objs/exports.def"}
+	if result := MsvcLinkOptions(options); !reflect.DeepEqual(result, link) {
+		t.Errorf("linker options %q, expected %q", result, link)
+	}
+
+	output := "main.c\r\nNote: including file: C:\\src\\a.h\r\nNote: including file:  C:\\VC\\include\\stdio.h\r\nmain.c(3): warning C4101: 'x': unreferenced local variable\r\n"
+	headers, messages := ParseShowIncludes([]byte(output), "main.c", []string{`c:\vc\include`})
+	if !reflect.DeepEqual(headers, []string{`C:\src\a.h`}) {
+		t.Errorf("headers %q, expected C:\\src\\a.h", headers)
+	}
+	if expected := "main.c(3): warning C4101: 'x': unreferenced local variable\n"; string(messages) != expected {
+		t.Errorf("messages %q, expected %q", messages, expected)
+	}
+}
+
+func TestDirectoryToolchain(t *testing.T) {
+	msvc, other := &Dmake{}, &Dmake{}
+	vars := make(Vars)
+	vars.SetValue("TARGET", "windows/amd64")
+	vars.SetValue("TOOLCHAIN", "msvc")
+	vars.SetValue("MSVC_RUNTIME", "MTd")
+	if err := msvc.InitFromVars(vars); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.InitFromVars(make(Vars)); err != nil {
+		t.Fatal(err)
+	}
+	if name := msvc.Toolchain().name; name != "msvc" {
+		t.Errorf("toolchain %s, expected msvc", name)
+	}
+	if crt, _ := msvc.MsvcRuntime(); crt != "/MTd" {
+		t.Errorf("runtime library %s, expected /MTd", crt)
+	}
+	if other.Toolchain().msvc && runtime.GOOS != "windows" {
+		t.Errorf("another directory's toolchain %s, TOOLCHAIN leaked", other.Toolchain().name)
+	}
+	if crt, _ := other.MsvcRuntime(); crt != "/MD" {
+		t.Errorf("another directory's runtime library %s, MSVC_RUNTIME leaked", crt)
+	}
+
+	vars = make(Vars)
+	vars.SetValue("TARGET", "linux/amd64")
+	vars.SetValue("TOOLCHAIN", "msvc")
+	if err := other.InitFromVars(vars); err == nil {
+		t.Error("expected an error using msvc to build for linux")
+	}
+}
@@ -0,0 +1,268 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+//  A toolchain file describes a cross toolchain, named by the
+//  -toolchain option or the TOOLCHAIN_FILE variable. It's written like
+//  a .dmake file and may define
+//
+//	TARGET		the os/arch, or profile, built for
+//	TOOLCHAIN	gnu, msvc or clang-cl
+//	CROSS_COMPILE	the tools' prefix, e.g. arm-none-eabi-, used to
+//			name the compiler, archiver and strip
+//	CC, CXX, AR, RC, LD, STRIP
+//			the tools, overriding the environment
+//	SYSROOT		the sysroot, compiled and linked with --sysroot
+//	CFLAGS, CXXFLAGS, OBJCFLAGS, OBJCXXFLAGS, LDFLAGS, LIBS
+//			options used when compiling and linking
+//	OBJ_SUFFIX, EXE_SUFFIX, LIB_PREFIX, LIB_SUFFIX, DLL_PREFIX,
+//	DLL_SUFFIX, PLUGIN_PREFIX, PLUGIN_SUFFIX
+//			the target's filename conventions, if they
+//			differ from those of the target's OS
+//
+type ToolchainDescription struct {
+	path      string
+	target    *Target               // the target built for, with the file's filename conventions
+	toolchain *Toolchain            // the toolchain the file selects, if any
+	tools     map[string]string     // tools by environment variable name
+	sysroot   []string              // the --sysroot option, if any
+	options   map[Language][]string // compiler options for each language
+	ldflags   []string              // linker options
+	libs      []string              // libraries
+}
+
+//  The toolchain file named by -toolchain, if any, used by every
+//  directory.
+//
+var toolchainDescription *ToolchainDescription
+
+//  The tools a toolchain file may define, and the names they have
+//  after the CROSS_COMPILE prefix.
+//
+var toolchainTools = [][2]string{
+	{"CC", "gcc"},
+	{"CXX", "g++"},
+	{"AR", "ar"},
+	{"RC", "windres"},
+	{"LD", "ld"},
+	{"STRIP", "strip"},
+}
+
+//  Read the toolchain file named by -toolchain and use the toolchain
+//  it describes for every directory.
+//
+func LoadToolchainFile(path string) error {
+	if toolchainDescription != nil {
+		if toolchainDescription.path == path {
+			return nil
+		}
+		return fmt.Errorf("%s: toolchain file already set to %s", path, toolchainDescription.path)
+	}
+	description, err := ReadToolchainFile(path, DefaultTarget())
+	if err != nil {
+		return err
+	}
+	if description.target.Name() != TargetName() {
+		if err = SetTarget(description.target.Name()); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	platform = description.target.platform
+	if description.toolchain != nil {
+		toolchain = description.toolchain
+	}
+	toolchainDescription = description
+	return nil
+}
+
+//  Read a toolchain file. The toolchain builds for the target unless
+//  the file names another.
+//
+func ReadToolchainFile(path string, target *Target) (*ToolchainDescription, error) {
+	vars := make(Vars)
+	sections, err := vars.ReadFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(sections) > 0 {
+		return nil, fmt.Errorf("%s: a toolchain file can't define targets", path)
+	}
+	return NewToolchainDescription(path, vars, target)
+}
+
+//  Return the toolchain described by a toolchain file's variables,
+//  selecting its target, toolchain and filename conventions. The
+//  target is used if the file doesn't name one, or -target was given.
+//
+func NewToolchainDescription(path string, vars Vars, target *Target) (*ToolchainDescription, error) {
+	d := &ToolchainDescription{
+		path:    path,
+		tools:   make(map[string]string),
+		options: make(map[Language][]string),
+	}
+	if name, found := vars.GetValue("TARGET"); found && *targetFlag == "" {
+		var err error
+		if target, err = NewTarget(name); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	custom := *target
+	custom.platform = ToolchainPlatform(target.platform, vars)
+	d.target = &custom
+	if name, found := vars.GetValue("TOOLCHAIN"); found {
+		var err error
+		if d.toolchain, err = FindToolchain(name, d.target); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	prefix := vars.GetString("CROSS_COMPILE")
+	for _, tool := range toolchainTools {
+		if value := vars.GetString(tool[0]); value != "" {
+			d.tools[tool[0]] = value
+		} else if prefix != "" && (tool[0] != "RC" || d.target.os == "windows") && tool[0] != "LD" {
+			d.tools[tool[0]] = prefix + tool[1]
+		}
+	}
+	if dir := vars.GetString("SYSROOT"); dir != "" {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(path), dir)
+		}
+		d.sysroot = []string{"--sysroot=" + dir}
+	}
+	for language, name := range compilerOptionsFilename {
+		d.options[language] = strings.Fields(vars.GetString(name))
+	}
+	d.ldflags = strings.Fields(vars.GetString("LDFLAGS"))
+	d.libs = strings.Fields(vars.GetString("LIBS"))
+	return d, nil
+}
+
+//  Return the receiver's toolchain file, that named by -toolchain,
+//  otherwise that named by its .dmake file's TOOLCHAIN_FILE variable,
+//  if any. A directory's toolchain file doesn't affect other
+//  directories.
+//
+func (dmake *Dmake) ToolchainDescription() *ToolchainDescription {
+	if dmake.toolchainDescription != nil {
+		return dmake.toolchainDescription
+	}
+	return toolchainDescription
+}
+
+//  Return the platform with the filename conventions defined by a
+//  toolchain file, or the platform itself if it defines none.
+//
+func ToolchainPlatform(p *PlatformSpecific, vars Vars) *PlatformSpecific {
+	custom := *p
+	fields := map[string]*string{
+		"OBJ_SUFFIX":    &custom.objsuffix,
+		"EXE_SUFFIX":    &custom.exesuffix,
+		"LIB_PREFIX":    &custom.libprefix,
+		"LIB_SUFFIX":    &custom.libsuffix,
+		"DLL_PREFIX":    &custom.dllprefix,
+		"DLL_SUFFIX":    &custom.dllsuffix,
+		"PLUGIN_PREFIX": &custom.pluginprefix,
+		"PLUGIN_SUFFIX": &custom.pluginsuffix,
+	}
+	changed := false
+	for name, field := range fields {
+		if value, found := vars.GetValue(name); found {
+			*field = value
+			changed = true
+		}
+	}
+	if !changed {
+		return p
+	}
+	return &custom
+}
+
+//  Return the environment with the tools the toolchain file defines.
+//
+func (d *ToolchainDescription) Environment(env []string) []string {
+	if d == nil {
+		return env
+	}
+	for _, tool := range toolchainTools {
+		if value, found := d.tools[tool[0]]; found {
+			env = SetEnv(env, tool[0], value)
+		}
+	}
+	return env
+}
+
+//  Return the compiler options the toolchain file defines for a
+//  language, including the sysroot.
+//
+func (d *ToolchainDescription) LanguageOptions(language Language) []string {
+	if d == nil {
+		return nil
+	}
+	return append(d.SysrootOptions(), d.options[language]...)
+}
+
+//  Return the option selecting the toolchain file's sysroot, if any.
+//
+func (d *ToolchainDescription) SysrootOptions() []string {
+	if d == nil {
+		return nil
+	}
+	return d.sysroot[:len(d.sysroot):len(d.sysroot)]
+}
+
+//  Return the linker options the toolchain file defines.
+//
+func (d *ToolchainDescription) LinkerOptions() []string {
+	if d == nil {
+		return nil
+	}
+	return d.ldflags
+}
+
+//  Return the libraries the toolchain file defines.
+//
+func (d *ToolchainDescription) Libraries() []string {
+	if d == nil {
+		return nil
+	}
+	return d.libs
+}
+
+//  Return the strip command the toolchain file defines, if any.
+//
+func (d *ToolchainDescription) StripCommand() []string {
+	if d == nil {
+		return nil
+	}
+	return strings.Fields(d.tools["STRIP"])
+}
+
+//  Return env with name defined as value, replacing any definition.
+//
+func SetEnv(env []string, name, value string) []string {
+	return append(RemoveEnv(env, name), name+"="+value)
+}
+
+//  Return a copy of an environment without a variable.
+//
+func RemoveEnv(env []string, name string) []string {
+	result := make([]string, 0, len(env)+1)
+	for _, s := range env {
+		if !strings.HasPrefix(s, name+"=") {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestToolchainDescription(t *testing.T) {
+	vars := make(Vars)
+	vars.SetValue("CROSS_COMPILE", "arm-none-eabi-")
+	vars.SetValue("CXX", "clang++ --target=arm-none-eabi")
+	vars.SetValue("SYSROOT", "sysroot")
+	vars.SetValue("CFLAGS", "-mcpu=cortex-m4")
+	vars.SetValue("EXE_SUFFIX", ".elf")
+	d, err := NewToolchainDescription(filepath.Join("boards", "m4.toolchain"), vars, DefaultTarget())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := d.Environment([]string{"CC=cc", "HOME=/home/x"})
+	expected := []string{"HOME=/home/x", "CC=arm-none-eabi-gcc", "CXX=clang++ --target=arm-none-eabi", "AR=arm-none-eabi-ar", "STRIP=arm-none-eabi-strip"}
+	if targetOS == "windows" {
+		expected = []string{"HOME=/home/x", "CC=arm-none-eabi-gcc", "CXX=clang++ --target=arm-none-eabi", "AR=arm-none-eabi-ar", "RC=arm-none-eabi-windres", "STRIP=arm-none-eabi-strip"}
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("environment %q, expected %q", env, expected)
+	}
+	sysroot := "--sysroot=" + filepath.Join("boards", "sysroot")
+	if options := d.LanguageOptions(CLanguage); !reflect.DeepEqual(options, []string{sysroot, "-mcpu=cortex-m4"}) {
+		t.Errorf("C options %q", options)
+	}
+	if options := d.LanguageOptions(CplusplusLanguage); !reflect.DeepEqual(options, []string{sysroot}) {
+		t.Errorf("C++ options %q", options)
+	}
+	if name := d.target.platform.ExeFilename("prog"); name != "prog.elf" {
+		t.Errorf("program named %q, expected prog.elf", name)
+	}
+	if platform.ExeFilename("prog") == "prog.elf" {
+		t.Error("the target's platform was changed")
+	}
+	var none *ToolchainDescription
+	if env := none.Environment([]string{"CC=cc"}); !reflect.DeepEqual(env, []string{"CC=cc"}) {
+		t.Errorf("environment %q without a toolchain file", env)
+	}
+}
+
+func TestDirectoryToolchainFile(t *testing.T) {
+	inTempProject(t, map[string]string{
+		"mingw.toolchain": "TARGET = windows/amd64\nCROSS_COMPILE = x86_64-w64-mingw32-\nEXE_SUFFIX = .elf\n",
+		"arm.toolchain":   "CROSS_COMPILE = arm-none-eabi-\n",
+	})
+	mingw, other := &Dmake{}, &Dmake{}
+	vars := make(Vars)
+	vars.SetValue("TOOLCHAIN_FILE", "mingw.toolchain")
+	vars.SetValue("EXE", "prog")
+	if err := mingw.InitFromVars(vars); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.InitFromVars(make(Vars)); err != nil {
+		t.Fatal(err)
+	}
+	if name := mingw.Target().Name(); name != "windows/amd64" {
+		t.Errorf("target %s, expected windows/amd64", name)
+	}
+	if mingw.outputname != "prog.elf" {
+		t.Errorf("program named %q, expected prog.elf", mingw.outputname)
+	}
+	if cc, _ := LookupEnv(mingw.TargetEnvironment(nil), "CC"); cc != "x86_64-w64-mingw32-gcc" {
+		t.Errorf("CC %q, expected x86_64-w64-mingw32-gcc", cc)
+	}
+	if other.ToolchainDescription() != nil {
+		t.Error("another directory has a toolchain file, TOOLCHAIN_FILE leaked")
+	}
+	if name := other.Target().Name(); name != TargetName() {
+		t.Errorf("another directory's target %s, TOOLCHAIN_FILE leaked", name)
+	}
+	if dir := other.ObjsDir(); dir != filepath.Join(objsRoot, targetOS+"-"+targetArch) {
+		t.Errorf("another directory's objects directory %q, TOOLCHAIN_FILE leaked", dir)
+	}
+	if platform.ExeFilename("prog") == "prog.elf" {
+		t.Error("the default platform was changed")
+	}
+
+	vars = make(Vars)
+	vars.SetValue("TOOLCHAIN_FILE", "arm.toolchain")
+	if err := other.InitFromVars(vars); err != nil {
+		t.Errorf("a second toolchain file: %v", err)
+	}
+}
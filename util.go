@@ -10,14 +10,16 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
+	"unicode"
 )
 
 var (
@@ -37,9 +39,28 @@ var (
 	//	int main(void)
 	//	int main(int
 	//
-	mainFunctionRegexp = regexp.MustCompile("^[ \t]*(func|int)?[ \t]*main[ \t]*\\((void|int|)")
+	mainFunctionRegexp = regexp.MustCompile("^[ \t]*(func|int)?[ \t]*((w|_t)?main)[ \t]*\\((void|int|)")
+
+	// Windows GUI programs define WinMain, or its wide character
+	// version, usually with a calling convention macro.
+	//
+	winMainFunctionRegexp = regexp.MustCompile("^[ \t]*(int[ \t]+)?((WINAPI|APIENTRY|CALLBACK|PASCAL|__stdcall)[ \t]+)?((w|_t)?WinMain)[ \t]*\\(")
 )
 
+// A StringList is a flag.Value for flags that may be repeated,
+// each use of the flag adds its value to the list.
+//
+type StringList []string
+
+func (l *StringList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *StringList) Set(arg string) error {
+	*l = append(*l, arg)
+	return nil
+}
+
 func Getenv(name, defaultValue string) string {
 	if s := os.Getenv(name); s != "" {
 		return s
@@ -47,33 +68,59 @@ func Getenv(name, defaultValue string) string {
 	return defaultValue
 }
 
-func AddDetail(err error, format string, args ...interface{}) error {
-	return fmt.Errorf("%s (%s)", err, fmt.Sprintf(format, args...))
+// Return the value of a variable defined in an environment slice.
+// Later definitions take precedence, as with exec.Cmd.
+//
+func LookupEnv(env []string, name string) (string, bool) {
+	for i := len(env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(env[i], name+"=") {
+			return env[i][len(name)+1:], true
+		}
+	}
+	return "", false
 }
 
-func DefinesMain(path string) bool {
-	file, err := os.Open(path)
-	if err != nil {
-		log.Print(err)
-		return false
+// Return the named files that exist.
+//
+func ExistingFiles(paths ...string) []string {
+	var existing []string
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			existing = append(existing, path)
+		}
 	}
-	defer file.Close()
-	for scanner := bufio.NewScanner(file); scanner.Scan(); {
-		line := scanner.Text()
-		if mainFunctionRegexp.MatchString(line) {
-			return true
+	return existing
+}
+
+// Return env with name defined as value if env does not already
+// define name.
+//
+func DefaultEnv(env []string, name, value string) []string {
+	for _, s := range env {
+		if strings.HasPrefix(s, name+"=") {
+			return env
 		}
 	}
-	return false
+	return append(env, name+"="+value)
+}
+
+func AddDetail(err error, format string, args ...interface{}) error {
+	return fmt.Errorf("%s (%s)", err, fmt.Sprintf(format, args...))
 }
 
-func ObjectFilename(srcfile string, objsdir string) string {
+//  Return the name of the object file compiled from a source file
+//  for the target.
+//
+func (t *Target) ObjectFilename(srcfile string, objsdir string) string {
 	dirname, basename := filepath.Dir(srcfile), filepath.Base(srcfile)
+	if filepath.IsAbs(objsdir) {
+		dirname = ""
+	}
 	path := filepath.Clean(filepath.Join(filepath.Join(dirname, objsdir), basename))
-	return platform.ObjFilename(strings.TrimSuffix(path, filepath.Ext(basename)))
+	return t.platform.ObjFilename(strings.TrimSuffix(path, filepath.Ext(basename)))
 }
 
-func DependenciesFilename(ofile string, depsdir string) string {
+func DependenciesFilename(ofile, objsdir, depsdir string) string {
 	dirname, basename := filepath.Dir(ofile), filepath.Base(ofile)
 	if strings.HasSuffix(dirname, objsdir) {
 		return filepath.Join(dirname, basename)
@@ -82,19 +129,26 @@ func DependenciesFilename(ofile string, depsdir string) string {
 	}
 }
 
-func Glob(pattern string) (filenames []string, matched bool, err error) {
+// Return the names of files matching a glob pattern. In addition
+// to filepath.Glob's patterns a "**" path element matches zero or
+// more directories, e.g. src/**/*.cpp. Files named for platforms
+// other than the target platform are ignored.
+//
+func (t *Target) Glob(pattern string) (filenames []string, matched bool, err error) {
 	var matches []string
-	matches, err = filepath.Glob(pattern)
+	if strings.Contains(pattern, "**") {
+		matches, err = daemonClient.RecursiveGlob(pattern)
+	} else {
+		matches, err = filepath.Glob(pattern)
+	}
 	if err != nil {
 		return
 	}
 	if len(matches) > 0 {
 		filenames = make([]string, 0, len(matches))
 		for _, name := range matches {
-			if otherPlatformNamesRegexp.MatchString(name) {
-				if *debugFlag {
-					log.Printf("DEBUG: glob ignoring %q", name)
-				}
+			if t.others.MatchString(name) {
+				logger.Debugf("glob ignoring %q", name)
 				continue
 			}
 			filenames = append(filenames, name)
@@ -104,10 +158,71 @@ func Glob(pattern string) (filenames []string, matched bool, err error) {
 	return
 }
 
-func ExpandGlobs(patterns string) ([]string, error) {
+// Return the names of the files matching a pattern containing a
+// "**" element. The part of the pattern before the "**" names the
+// directory to be searched, the part after is matched against the
+// trailing elements of the names of the files found below it.
+// Hidden directories are not searched.
+//
+func RecursiveGlob(pattern string) ([]string, error) {
+	return recursiveGlob(pattern, nil)
+}
+
+// As RecursiveGlob, recording the modification times of the
+// directories searched in dirs, if it's not nil. A missing directory
+// is recorded as -1.
+//
+func recursiveGlob(pattern string, dirs map[string]int64) ([]string, error) {
+	index := strings.Index(pattern, "**")
+	root := filepath.Clean(pattern[:index])
+	rest := strings.TrimLeft(pattern[index+2:], "/"+string(filepath.Separator))
+	if _, err := filepath.Match(rest, ""); err != nil {
+		return nil, err
+	}
+	var matches []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				if dirs != nil {
+					dirs[root] = -1
+				}
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path != root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if dirs != nil {
+				dirs[path] = info.ModTime().UnixNano()
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if rest == "" {
+			matches = append(matches, path)
+			return nil
+		}
+		elements := strings.Split(filepath.ToSlash(rel), "/")
+		for i := range elements {
+			if ok, _ := filepath.Match(rest, filepath.Join(elements[i:]...)); ok {
+				matches = append(matches, path)
+				break
+			}
+		}
+		return nil
+	})
+	return matches, err
+}
+
+func (t *Target) ExpandGlobs(patterns string) ([]string, error) {
 	var filenames []string
 	for _, pattern := range strings.Fields(patterns) {
-		if names, matched, err := Glob(pattern); err != nil {
+		if names, matched, err := t.Glob(pattern); err != nil {
 			return nil, err
 		} else if matched {
 			filenames = append(filenames, names...)
@@ -116,6 +231,193 @@ func ExpandGlobs(patterns string) ([]string, error) {
 	return filenames, nil
 }
 
+// Return a pathname that may be used to run a program, relative
+// names without a directory component are made explicitly relative
+// so they're not searched for in the PATH.
+//
+func AsCommand(path string) string {
+	if filepath.IsAbs(path) || strings.ContainsRune(path, filepath.Separator) {
+		return path
+	}
+	return "." + string(filepath.Separator) + path
+}
+
+// Return true if names contains name.
+//
+func Contains(names []string, name string) bool {
+	for _, s := range names {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the elements of names that are not in exclude.
+//
+func Without(names []string, exclude []string) []string {
+	result := make([]string, 0, len(names))
+outer:
+	for _, name := range names {
+		for _, x := range exclude {
+			if name == x {
+				continue outer
+			}
+		}
+		result = append(result, name)
+	}
+	return result
+}
+
+//  Return true, having printed the command, if dmake is doing a dry
+//  run and the command should not be run.
+//
+func DryRun(command string, args ...string) bool {
+	if !*dryRunFlag {
+		return false
+	}
+	fmt.Println(ShellJoin(append([]string{command}, args...)))
+	return true
+}
+
+//  Split a string into words as the shell does, removing quotes and
+//  backslashes. Words that are quoted or escaped may contain spaces.
+//
+func ShellWords(s string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+//  Return words joined into a command line suitable for a shell,
+//  quoting any words that need it.
+//
+func ShellJoin(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		if word != "" && !strings.ContainsAny(word, " \t\n'\"\\$`*?[]{}()<>|&;#~!") {
+			quoted[i] = word
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+//  Remove a file, or when doing a dry run, print the command that
+//  would remove it if it exists.
+//
+func Remove(path string) error {
+	if *dryRunFlag {
+		if _, err := os.Lstat(path); err == nil {
+			DryRun("rm", "-f", path)
+		}
+		return nil
+	}
+	return os.Remove(path)
+}
+
+//  Remove a directory and its contents, or when doing a dry run,
+//  print the command that would remove it if it exists.
+//
+func RemoveAll(path string) error {
+	if *dryRunFlag {
+		if _, err := os.Lstat(path); err == nil {
+			DryRun("rm", "-rf", path)
+		}
+		return nil
+	}
+	return os.RemoveAll(path)
+}
+
+//  Return a command running a command line using the shell.
+//
+func ShellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/c", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+//  Run a command line using the shell and return its output with
+//  newlines replaced by spaces, as per make's $(shell).
+//
+func ShellOutput(command string) (string, error) {
+	cmd := ShellCommand(command)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			err = AddDetail(err, "%s", message)
+		}
+		return "", AddDetail(err, "shell %s", command)
+	}
+	return strings.Join(strings.Fields(string(output)), " "), nil
+}
+
+//  Remove up to n of a directory's parent directories, stopping at
+//  the first that isn't empty. Used to tidy up after removing
+//  directories such as .objs/release/linux-amd64.
+//
+func RemoveEmptyParents(dir string, n int) {
+	for ; n > 0 && !*dryRunFlag; n-- {
+		dir = filepath.Dir(dir)
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+//  Create, or atomically replace, a symbolic link. When doing a dry run the
+//  command that would create it is printed instead.
+//
+func Symlink(target, link string) error {
+	if DryRun("ln", "-sf", target, link) {
+		return nil
+	}
+	temporary := link + temporaryOutputSuffix
+	if err := os.Remove(temporary); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(target, temporary); err != nil {
+		return err
+	}
+	return renameIntoPlace(temporary, link)
+}
+
 func CreateFile(path string, content string) error {
 	file, err := os.Create(path)
 	if err != nil {
@@ -129,10 +431,10 @@ func CreateFile(path string, content string) error {
 	return err
 }
 
-func SourceFiles() ([]string, Language, error) {
+func (t *Target) SourceFiles() ([]string, Language, error) {
 	for lang, patterns := range languageExtension {
 		for _, pattern := range patterns {
-			paths, matches, err := Glob(pattern)
+			paths, matches, err := t.Glob(pattern)
 			if err != nil {
 				return nil, UnknownLanguage, err
 			}
@@ -147,16 +449,93 @@ func SourceFiles() ([]string, Language, error) {
 	return nil, UnknownLanguage, nil
 }
 
+//  Return true if any of the paths are source files.
+//
+func HaveSourceFiles(paths []string) bool {
+	for _, path := range paths {
+		for _, patterns := range languageExtension {
+			for _, pattern := range patterns {
+				if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Return the language used by a set of source files, determined by
+// the first file with a recognized filename extension.
+//
+func LanguageOf(paths []string) Language {
+	if langflag != UnknownLanguage {
+		return langflag
+	}
+	for _, path := range paths {
+		if lang := FileLanguage(path); lang != UnknownLanguage {
+			return lang
+		}
+	}
+	return UnknownLanguage
+}
+
+// Return the language of a source file, as per its filename
+// extension, regardless of -lang.
+//
+func FileLanguage(path string) Language {
+	for lang, patterns := range languageExtension {
+		for _, pattern := range patterns {
+			if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
+				return lang
+			}
+		}
+	}
+	return UnknownLanguage
+}
+
+// Read a dcc-style options file and return the options it
+// contains. Options may be written over multiple lines and
+// #-style comments and blank lines are ignored.
+//
+func ReadOptionsFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var options []string
+	input := bufio.NewScanner(file)
+	for input.Scan() {
+		line := input.Text()
+		if index := strings.Index(line, "#"); index != -1 {
+			line = line[:index]
+		}
+		options = append(options, strings.Fields(line)...)
+	}
+	return options, input.Err()
+}
+
+//  Return the filename of an output of the given type for the default
+//  target.
+//
 func FilenameForType(outputtype OutputType, name string) string {
+	return platform.FilenameForType(outputtype, name)
+}
+
+func (p *PlatformSpecific) FilenameForType(outputtype OutputType, name string) string {
 	switch outputtype {
 	case DllOutputType:
-		return platform.DllFilename(name)
+		return p.DllFilename(name)
 	case PluginOutputType:
-		return platform.PluginFilename(name)
+		return p.PluginFilename(name)
 	case ExeOutputType:
-		return platform.ExeFilename(name)
+		return p.ExeFilename(name)
 	case LibOutputType:
-		return platform.LibFilename(name)
+		return p.LibFilename(name)
+	case FrameworkOutputType:
+		return p.FrameworkFilename(name)
+	case AppBundleOutputType:
+		return p.AppBundleFilename(name)
 	default:
 		panic("unexpected outputtype: " + outputtype.String())
 	}
@@ -189,34 +568,196 @@ func (r CwdRestorer) Restore() {
 	}
 }
 
-func installWithUsrBinInstall(filename, destdir string, filemode os.FileMode) error {
-	args := []string{"-c", "-m", fmt.Sprintf("%o", int(filemode)), filename, filepath.Join(destdir, filename)}
-	if *debugFlag {
-		log.Printf("RUN: /usr/bin/install %v", args)
+// Install a file into a directory, below the receiver's DESTDIR,
+// creating the directory if required, and record the installed file
+// in the install manifest. Files are installed by copying them unless
+// the receiver's INSTALL variable, or environment variable, names a
+// program used to install them, e.g. /usr/bin/install.
+//
+func (dmake *Dmake) InstallFile(filename, destdir string, filemode os.FileMode) error {
+	destdir = filepath.Join(dmake.DestDir(), destdir)
+	program := strings.Fields(dmake.installProgram)
+	if *dryRunFlag {
+		for _, command := range InstallCommands(program, filename, destdir, filemode) {
+			DryRun(command[0], command[1:]...)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(destdir, 0777); err != nil {
+		return err
+	}
+	install := installByCopyingFile
+	if len(program) > 0 {
+		install = func(filename, destdir string, filemode os.FileMode) error {
+			return installWithProgram(program, filename, destdir, filemode)
+		}
 	}
-	cmd := exec.Command("/usr/bin/install", args...)
-	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, os.Stdout, os.Stderr
-	return cmd.Run()
+	if err := install(filename, destdir, filemode); err != nil {
+		return err
+	}
+	return dmake.RecordInstalledFile(filepath.Join(destdir, filepath.Base(filename)))
 }
 
-func installByCopyingFile(filename, destdir string, filemode os.FileMode) error {
-	dstFilename := filepath.Join(destdir, filename)
-	if *debugFlag {
-		log.Printf("COPY: %q -> %q", filename, dstFilename)
+// Install a symbolic link, named name, in a directory, below the
+// receiver's DESTDIR, and record it in the install manifest.
+//
+func (dmake *Dmake) InstallSymlink(target, destdir, name string) error {
+	destdir = filepath.Join(dmake.DestDir(), destdir)
+	path := filepath.Join(destdir, name)
+	if !*dryRunFlag {
+		if err := os.MkdirAll(destdir, 0777); err != nil {
+			return err
+		}
+	}
+	if err := Symlink(target, path); err != nil || *dryRunFlag {
+		return err
+	}
+	return dmake.RecordInstalledFile(path)
+}
+
+// Return the pathname of the install manifest, the list of installed
+// files kept in the current directory, or the build directory when
+// one is being used.
+//
+func (dmake *Dmake) InstallManifestPath() string {
+	return dmake.BuildPath(installManifestFilename)
+}
+
+// Add a file to the install manifest. Files installed into a staging
+// directory, DESTDIR, aren't recorded. The files already listed are
+// read once, when the first file is recorded.
+//
+func (dmake *Dmake) RecordInstalledFile(path string) error {
+	if dmake.DestDir() != "" {
+		return nil
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if err = dmake.ReadInstalledFiles(); err != nil {
+		return err
+	}
+	if dmake.installed[path] {
+		return nil
 	}
+	manifest := dmake.InstallManifestPath()
+	file, err := os.OpenFile(manifest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(file, path)
+	if err = file.Close(); err != nil {
+		return err
+	}
+	dmake.installed[path] = true
+	return GiveToInvokingUser(manifest)
+}
+
+// Read the files listed in the install manifest, if not already read.
+//
+func (dmake *Dmake) ReadInstalledFiles() error {
+	if dmake.installed != nil {
+		return nil
+	}
+	paths, err := ReadInstallManifest(dmake.InstallManifestPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	dmake.installed = make(map[string]bool)
+	for _, path := range paths {
+		dmake.installed[path] = true
+	}
+	return nil
+}
+
+// Return the names of the files listed in an install manifest.
+//
+func ReadInstallManifest(manifest string) ([]string, error) {
+	file, err := os.Open(manifest)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var paths []string
+	input := bufio.NewScanner(file)
+	for input.Scan() {
+		if line := strings.TrimSpace(input.Text()); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, input.Err()
+}
+
+// Return the commands equivalent to installing a file, the INSTALL
+// program's command line if one is used, otherwise the cp and chmod
+// done by copying the file.
+//
+func InstallCommands(program []string, filename, destdir string, filemode os.FileMode) [][]string {
+	dstFilename := filepath.Join(destdir, filepath.Base(filename))
+	mode := fmt.Sprintf("%o", int(filemode))
+	if len(program) > 0 {
+		command := append(program[:len(program):len(program)], "-c", "-m", mode, filename, dstFilename)
+		return [][]string{command}
+	}
+	return [][]string{{"cp", filename, dstFilename}, {"chmod", mode, dstFilename}}
+}
+
+// Install a file using the program named by the INSTALL variable,
+// e.g. /usr/bin/install, rather than by copying it.
+//
+func installWithProgram(program []string, filename, destdir string, filemode os.FileMode) error {
+	command := InstallCommands(program, filename, destdir, filemode)[0]
+	logger.Verbosef("RUN: %s", ShellJoin(command))
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, CommandOutput(), os.Stderr
+	return RunCommand(cmd, command[len(command)-1])
+}
+
+// Install a file by copying it to a temporary file in the destination
+// directory, setting its mode and renaming it into place, so the
+// installed file is never seen partially written and running programs
+// using the old file are unaffected.
+//
+func installByCopyingFile(filename, destdir string, filemode os.FileMode) error {
+	dstFilename := filepath.Join(destdir, filepath.Base(filename))
+	logger.Verbosef("COPY: %s -> %s, mode %o", filename, dstFilename, int(filemode))
 	src, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
 	defer src.Close()
-	dst, err := os.OpenFile(dstFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filemode)
+	dst, err := os.CreateTemp(destdir, "."+filepath.Base(filename)+".*")
 	if err != nil {
 		return err
 	}
+	tmpFilename := dst.Name()
+	defer WritingFile(tmpFilename)()
 	_, err = io.Copy(dst, src)
+	if err == nil {
+		err = dst.Chmod(filemode)
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = renameIntoPlace(tmpFilename, dstFilename)
+	}
 	if err != nil {
-		dst.Close()
-		os.Remove(dstFilename)
+		os.Remove(tmpFilename)
 	}
-	return dst.Close()
+	return err
+}
+
+// Rename a file, replacing any existing file. Windows won't replace a
+// read-only file so its mode is changed first.
+//
+func renameIntoPlace(oldpath, newpath string) error {
+	err := os.Rename(oldpath, newpath)
+	if err != nil && runtime.GOOS == "windows" {
+		if os.Chmod(newpath, 0666) == nil {
+			err = os.Rename(oldpath, newpath)
+		}
+	}
+	return err
 }
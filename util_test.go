@@ -0,0 +1,167 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestRecursiveGlob(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		"top.cpp",
+		"top.h",
+		"a/a.cpp",
+		"a/b/b.cpp",
+		"a/b/b.h",
+		".hidden/h.cpp",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := CreateFile(path, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func(pattern string, expected ...string) {
+		names, _, err := DefaultTarget().Glob(filepath.Join(root, pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range expected {
+			expected[i] = filepath.Join(root, expected[i])
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Fatalf("%s matched %q, expected %q", pattern, names, expected)
+		}
+	}
+
+	check("**/*.cpp", "a/a.cpp", "a/b/b.cpp", "top.cpp")
+	check("a/**/*.h", "a/b/b.h")
+	check("a/**", "a/a.cpp", "a/b/b.cpp", "a/b/b.h")
+	check("**/b/*.cpp", "a/b/b.cpp")
+	check("none/**/*.cpp")
+}
+
+func TestInstallByCopyingFile(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	filename := filepath.Join(src, "prog")
+	if err := os.WriteFile(filename, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	installed := filepath.Join(dest, "prog")
+	if err := os.WriteFile(installed, []byte("old"), 0444); err != nil {
+		t.Fatal(err)
+	}
+	if err := installByCopyingFile(filename, dest, 0555); err != nil {
+		t.Fatal(err)
+	}
+	if contents, err := os.ReadFile(installed); err != nil || string(contents) != "new" {
+		t.Errorf("installed %q, %v", contents, err)
+	}
+	info, err := os.Stat(installed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0555 {
+		t.Errorf("installed mode %v, expected 0555", info.Mode())
+	}
+	if entries, _ := os.ReadDir(dest); len(entries) != 1 {
+		t.Errorf("%d files in the destination, expected 1", len(entries))
+	}
+}
+
+func TestInstallCommands(t *testing.T) {
+	dest := filepath.Join("usr", "bin")
+	installed := filepath.Join(dest, "prog")
+	commands := InstallCommands(nil, "prog", dest, 0555)
+	expected := [][]string{{"cp", "prog", installed}, {"chmod", "555", installed}}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("copying commands %q, expected %q", commands, expected)
+	}
+	commands = InstallCommands([]string{"/usr/bin/install", "-s"}, "prog", dest, 0555)
+	expected = [][]string{{"/usr/bin/install", "-s", "-c", "-m", "555", "prog", installed}}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("INSTALL program commands %q, expected %q", commands, expected)
+	}
+}
+
+func TestShellWords(t *testing.T) {
+	for s, expected := range map[string][]string{
+		"":                         nil,
+		"  cc  -O2 ":               {"cc", "-O2"},
+		`-DNAME="a b" -I'x y'`:     {"-DNAME=a b", "-Ix y"},
+		`a\ b "c\"d" 'e\f' ""`:     {"a b", `c"d`, `e\f`, ""},
+		"ccache\tgcc\n-std=c11":    {"ccache", "gcc", "-std=c11"},
+		`-DMSG='it'\''s' -DQ="'"`:  {"-DMSG=it's", "-DQ='"},
+		`unterminated "quote here`: {"unterminated", "quote here"},
+	} {
+		if words := ShellWords(s); !reflect.DeepEqual(words, expected) {
+			t.Errorf("ShellWords(%q) = %q, expected %q", s, words, expected)
+		}
+	}
+}
+
+func TestDirectoryInstallProgram(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses false as the INSTALL program")
+	}
+	t.Setenv("INSTALL", "")
+	dir := inTempProject(t, map[string]string{"prog": "program"})
+	failing, other := &Dmake{}, &Dmake{}
+	vars := make(Vars)
+	vars.SetValue("INSTALL", "false")
+	if err := failing.InitFromVars(vars); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.InitFromVars(make(Vars)); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(dir, "bin")
+	if err := failing.InstallFile("prog", dest, 0555); err == nil {
+		t.Error("expected an error installing using false")
+	}
+	if err := other.InstallFile("prog", dest, 0555); err != nil {
+		t.Errorf("another directory's install failed, INSTALL leaked: %v", err)
+	}
+}
+
+func TestInstallManifest(t *testing.T) {
+	t.Setenv("INSTALL", "")
+	t.Setenv("DESTDIR", "")
+	dir := inTempProject(t, map[string]string{"prog": "program", "x.conf": "conf"})
+	builddir := filepath.Join(t.TempDir(), "build")
+	if err := os.MkdirAll(builddir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	dmake := &Dmake{builddir: builddir}
+	dest := filepath.Join(dir, "bin")
+	for _, filename := range []string{"prog", "x.conf", "prog"} {
+		if err := dmake.InstallFile(filename, dest, 0555); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(installManifestFilename); !os.IsNotExist(err) {
+		t.Error("install manifest written in the source directory")
+	}
+	manifest := filepath.Join(builddir, installManifestFilename)
+	expected := []string{filepath.Join(dest, "prog"), filepath.Join(dest, "x.conf")}
+	if paths, err := ReadInstallManifest(manifest); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("install manifest lists %q, expected %q", paths, expected)
+	}
+
+	if err := (&Dmake{builddir: builddir}).UninstallAction(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range append(expected, manifest) {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s wasn't removed", path)
+		}
+	}
+}
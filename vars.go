@@ -13,7 +13,7 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"runtime"
+	"sort"
 	"strings"
 	"unicode"
 )
@@ -69,6 +69,35 @@ func (vars *Vars) GetString(key string) string {
 	return s
 }
 
+//  Return the names of the variables, sorted.
+//
+func (vars *Vars) Names() []string {
+	names := make([]string, 0, len(*vars))
+	for name := range *vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (vars *Vars) Copy() Vars {
+	c := make(Vars, len(*vars))
+	for key, v := range *vars {
+		c[key] = v
+	}
+	return c
+}
+
+//  ----------------------------------------------------------------
+
+//  A Section is a named set of variables introduced by a "[name]"
+//  line in a .dmake file. Each section defines a separate target.
+//
+type Section struct {
+	name string
+	vars Vars
+}
+
 func readAndAppend(r *strings.Reader, s string, stopFn func(rune) bool) (string, error) {
 	for {
 		if ch, _, err := r.ReadRune(); err != nil {
@@ -84,6 +113,11 @@ func readAndAppend(r *strings.Reader, s string, stopFn func(rune) bool) (string,
 	}
 }
 
+//  Return a string with references to variables, $NAME or ${NAME},
+//  replaced by the variables' values. $(shell command) is replaced by
+//  the output of the command, run using the shell, and $(NAME) is
+//  another way to refer to a variable.
+//
 func (vars *Vars) Interpolate(s string) (string, error) {
 	var b strings.Builder
 	r := strings.NewReader(s)
@@ -108,6 +142,16 @@ func (vars *Vars) Interpolate(s string) (string, error) {
 			var key string
 			if ch == '$' {
 				b.WriteRune(ch)
+			} else if ch == '(' {
+				var text, output string
+				text, err = readParenthesized(r)
+				if err == nil && strings.HasPrefix(text, "shell ") {
+					if output, err = vars.shell(text[len("shell "):]); err == nil {
+						b.WriteString(output)
+					}
+				} else {
+					key = strings.TrimSpace(text)
+				}
 			} else if ch == '{' {
 				key, err = readAndAppend(r, "", func(ch rune) bool { return ch == '}' })
 			} else {
@@ -121,6 +165,38 @@ func (vars *Vars) Interpolate(s string) (string, error) {
 	}
 }
 
+//  Read the text up to the parenthesis closing one that has been
+//  read, allowing for nested parentheses.
+//
+func readParenthesized(r *strings.Reader) (string, error) {
+	depth := 1
+	text, err := readAndAppend(r, "", func(ch rune) bool {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		return depth == 0
+	})
+	if err == nil && depth != 0 {
+		err = fmt.Errorf("missing closing ')'")
+	}
+	return text, err
+}
+
+//  Run a shell command, after interpolating any variables it refers
+//  to, and return its output.
+//
+func (vars *Vars) shell(command string) (string, error) {
+	command, err := vars.Interpolate(command)
+	if err != nil {
+		return "", err
+	}
+	logger.Debugf("shell %s", command)
+	return ShellOutput(command)
+}
+
 // Read a .dmake file and return a Vars containing the variables it
 // defines.
 //
@@ -135,22 +211,64 @@ func (vars *Vars) Interpolate(s string) (string, error) {
 // If no value is supplied the variable is assumed to be a "boolean"
 // style value and is assigned a default, string, value of "true".
 //
+// As well as "=" variables may be assigned using "+=", appending a
+// space and the value to any existing value, "-=", removing the
+// value from the existing value, and "?=", assigning the value only
+// if the variable isn't already defined, by the file or in the
+// environment. An environment variable's value is used if it is.
+//
+// A line of the form "[name]" starts a section. Variables that
+// follow a section line are defined in that section rather than the
+// receiver. A section starts with a copy of the variables defined
+// before it.
+//
+// Lines may be conditionally processed using make-like directives,
+//
+//	ifeq <value> <value>
+//	ifneq <value> <value>
+//	ifdef <name>
+//	ifndef <name>
+//	else
+//	endif
+//
+// The ifeq and ifneq values are single words that may refer to
+// variables, e.g. "ifeq $OS linux". Conditionals may be nested.
+//
+// Variables defined on the command line, NAME=VALUE, take precedence
+// over those in the file, assignments to them are ignored. Variables
+// defined by a workspace file provide defaults.
+//
 // Blank lines and those beginning with '#' are ignored.
 //
-func (vars *Vars) ReadFromFile(path string) error {
+func (vars *Vars) ReadFromFile(path string) ([]Section, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer file.Close()
 	return vars.ReadFromReader(file, path)
 }
 
-func (vars *Vars) ReadFromReader(file io.Reader, path string) error {
+//  Define the variables defined before reading a .dmake file, OS and
+//  ARCH, any shared by the workspace and those defined on the command
+//  line.
+//
+func (vars *Vars) SetPredefined() {
+	vars.SetValue("OS", targetOS)
+	vars.SetValue("ARCH", targetArch)
+	for key, v := range workspaceVars {
+		vars.Set(key, v)
+	}
+	for key, v := range commandLineVars {
+		vars.Set(key, v)
+	}
+}
+
+func (vars *Vars) ReadFromReader(file io.Reader, path string) ([]Section, error) {
 	var err error
+	var sections []Section
 
-	vars.SetValue("OS", runtime.GOOS)
-	vars.SetValue("ARCH", runtime.GOARCH)
+	vars.SetPredefined()
 
 	lineno := 0
 
@@ -158,19 +276,72 @@ func (vars *Vars) ReadFromReader(file io.Reader, path string) error {
 		return fmt.Errorf("%s:%d - %s", path, lineno, message)
 	}
 
+	current := vars
+
+	var conditions []condition
+	active := func() bool {
+		return len(conditions) == 0 || conditions[len(conditions)-1].active()
+	}
+
 	for input := bufio.NewScanner(file); input.Scan(); {
 		lineno++
 		line := strings.TrimSpace(input.Text())
 		if line == "" || line[0] == '#' {
 			continue
 		}
-		var key, op, val string
-		opIndex := -1
-		for _, op = range operators {
-			opIndex = strings.Index(line, op)
-			if opIndex != -1 {
-				break
+		if fields := strings.Fields(line); isDirective(fields[0]) {
+			switch fields[0] {
+			case "else":
+				if len(conditions) == 0 {
+					return nil, fail("else without a matching if")
+				}
+				if conditions[len(conditions)-1].inElse {
+					return nil, fail("more than one else")
+				}
+				conditions[len(conditions)-1].inElse = true
+			case "endif":
+				if len(conditions) == 0 {
+					return nil, fail("endif without a matching if")
+				}
+				conditions = conditions[:len(conditions)-1]
+			default:
+				c := condition{outer: active()}
+				if c.outer {
+					if c.value, err = current.Evaluate(fields[0], fields[1:]); err != nil {
+						return nil, fail(err.Error())
+					}
+				}
+				conditions = append(conditions, c)
 			}
+			continue
+		}
+		if !active() {
+			continue
+		}
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fail("malformed section, no closing ']'")
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if len(strings.Fields(name)) != 1 {
+				return nil, fail("malformed section, section names are a single word")
+			}
+			for _, section := range sections {
+				if section.name == name {
+					return nil, fail(fmt.Sprintf("section %q already defined", name))
+				}
+			}
+			sectionVars := vars.Copy()
+			sections = append(sections, Section{name: name, vars: sectionVars})
+			current = &sectionVars
+			continue
+		}
+		var key, op, val string
+		opIndex := strings.Index(line, "=")
+		op = "="
+		if opIndex > 0 && strings.ContainsRune("+-?", rune(line[opIndex-1])) {
+			opIndex--
+			op = line[opIndex : opIndex+2]
 		}
 		switch opIndex {
 		case -1:
@@ -178,21 +349,109 @@ func (vars *Vars) ReadFromReader(file io.Reader, path string) error {
 			op = "="
 			val = "true"
 		case 0:
-			return fail(fmt.Sprintf("malformed line, no variable name before %q", op))
+			return nil, fail(fmt.Sprintf("malformed line, no variable name before %q", op))
 		default:
 			key = strings.TrimSpace(line[0:opIndex])
 			if len(strings.Fields(key)) != 1 {
-				return fail("malformed line, variable names may not contain spaces")
+				return nil, fail("malformed line, variable names may not contain spaces")
+			}
+			val = strings.TrimSpace(line[opIndex+len(op):])
+			if val, err = current.Interpolate(val); err != nil {
+				return nil, fail(err.Error())
 			}
-			val = strings.TrimSpace(line[opIndex+1:])
-			if val, err = vars.Interpolate(val); err != nil {
-				return err
+			if existing := current.GetString(key); op == "+=" && existing != "" && val != "" {
+				val = " " + val
 			}
 		}
-		vars.Apply(key, Var{OpFromString(op), val})
+		if _, overridden := commandLineVars[key]; overridden {
+			continue
+		}
+		current.Apply(key, Var{OpFromString(op), val})
+	}
+
+	if len(conditions) > 0 {
+		return nil, fail("missing endif")
+	}
+
+	return sections, nil
+}
+
+//  Merge variables specific to the target platform into the general
+//  variables. A variable named with a suffix of the target operating
+//  system, architecture or both, e.g. SRCS_windows, LIBS_arm64 or
+//  CFLAGS_linux_amd64, has its value appended to the unsuffixed
+//  variable. Variables for other platforms are ignored.
+//
+func (vars *Vars) MergePlatformVars(target *Target) {
+	suffixes := []string{
+		"_" + target.os,
+		"_" + target.arch,
+		"_" + target.os + "_" + target.arch,
+	}
+	keys := vars.Names()
+	for _, suffix := range suffixes {
+		for _, key := range keys {
+			name := strings.TrimSuffix(key, suffix)
+			if name == key || name == "" {
+				continue
+			}
+			value := vars.GetString(key)
+			if existing := vars.GetString(name); existing != "" && value != "" {
+				value = existing + " " + value
+			}
+			vars.SetValue(name, value)
+		}
+	}
+}
+
+//  ----------------------------------------------------------------
+
+//  The state of a conditional block while reading a .dmake file.
+//
+type condition struct {
+	outer  bool // true if the enclosing block is being processed
+	value  bool // the result of the if directive's test
+	inElse bool // true once else has been seen
+}
+
+func (c condition) active() bool {
+	return c.outer && c.value != c.inElse
+}
+
+func isDirective(word string) bool {
+	switch word {
+	case "ifeq", "ifneq", "ifdef", "ifndef", "else", "endif":
+		return true
 	}
+	return false
+}
 
-	return nil
+//  Evaluate the test of an if directive.
+//
+func (vars *Vars) Evaluate(directive string, args []string) (bool, error) {
+	switch directive {
+	case "ifeq", "ifneq":
+		if len(args) != 2 {
+			return false, fmt.Errorf("%s requires two values", directive)
+		}
+		lhs, err := vars.Interpolate(args[0])
+		if err != nil {
+			return false, err
+		}
+		rhs, err := vars.Interpolate(args[1])
+		if err != nil {
+			return false, err
+		}
+		return (lhs == rhs) == (directive == "ifeq"), nil
+	case "ifdef", "ifndef":
+		if len(args) != 1 {
+			return false, fmt.Errorf("%s requires a variable name", directive)
+		}
+		_, found := vars.Get(args[0])
+		return found == (directive == "ifdef"), nil
+	default:
+		return false, fmt.Errorf("%q is not a conditional directive", directive)
+	}
 }
 
 func (vars *Vars) Apply(key string, rhs Var) {
@@ -212,6 +471,15 @@ func (vars *Vars) Apply(key string, rhs Var) {
 		} else {
 			vars.SetValue(key, rhs.value)
 		}
+	case OpQuestionEq:
+		if found {
+			break
+		}
+		if value, defined := os.LookupEnv(key); defined {
+			vars.SetValue(key, value)
+		} else {
+			vars.SetValue(key, rhs.value)
+		}
 	default:
 		panic(fmt.Errorf("unexpected operator - %q", rhs.op.String()))
 	}
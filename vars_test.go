@@ -16,7 +16,7 @@ BOOLEAN
 
 	vars := make(Vars)
 	r := strings.NewReader(goodInput)
-	err := vars.ReadFromReader(r, goodInput)
+	_, err := vars.ReadFromReader(r, goodInput)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -168,3 +168,193 @@ func TestOps(t *testing.T) {
 	}
 
 }
+
+func TestSections(t *testing.T) {
+	input := `PREFIX = /usr/local
+
+[libfoo]
+SRCS = foo.c
+LIB = foo
+
+[footest]
+SRCS = footest.c
+EXE = footest
+`
+
+	vars := make(Vars)
+	sections, err := vars.ReadFromReader(strings.NewReader(input), "sections")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 2 {
+		t.Fatalf("%d sections, expected 2", len(sections))
+	}
+	if sections[0].name != "libfoo" || sections[1].name != "footest" {
+		t.Fatalf("unexpected section names %q and %q", sections[0].name, sections[1].name)
+	}
+	if _, found := vars.Get("SRCS"); found {
+		t.Fatal("section variable SRCS defined outside of its section")
+	}
+	if sections[0].vars.GetString("PREFIX") != "/usr/local" {
+		t.Fatal("section does not inherit PREFIX")
+	}
+	if sections[0].vars.GetString("SRCS") != "foo.c" {
+		t.Fatal("wrong SRCS in libfoo section")
+	}
+	if _, found := sections[1].vars.Get("LIB"); found {
+		t.Fatal("footest section sees LIB from libfoo section")
+	}
+
+	vars = make(Vars)
+	_, err = vars.ReadFromReader(strings.NewReader("[a]\n[a]\n"), "duplicate")
+	if err == nil {
+		t.Fatal("duplicate section not detected")
+	}
+}
+
+func TestConditionals(t *testing.T) {
+	input := `PLATFORM = unix
+ifeq $PLATFORM unix
+  LIBS = -lm
+  ifdef WINDOWS
+    LIBS = -lws2_32
+  else
+    EXTRA = yes
+  endif
+else
+  LIBS = -luser32
+endif
+ifneq ${PLATFORM} unix
+  WRONG
+endif
+ifndef UNDEFINED
+  RIGHT
+endif
+`
+
+	vars := make(Vars)
+	if _, err := vars.ReadFromReader(strings.NewReader(input), "conditionals"); err != nil {
+		t.Fatal(err)
+	}
+	if vars.GetString("LIBS") != "-lm" {
+		t.Fatalf("LIBS is %q, expected %q", vars.GetString("LIBS"), "-lm")
+	}
+	if vars.GetString("EXTRA") != "yes" {
+		t.Fatal("nested else not processed")
+	}
+	if _, found := vars.Get("WRONG"); found {
+		t.Fatal("ifneq processed a false condition")
+	}
+	if _, found := vars.Get("RIGHT"); !found {
+		t.Fatal("ifndef did not process a true condition")
+	}
+
+	for _, bad := range []string{"endif\n", "else\n", "ifdef X\n", "ifeq a\nendif\n", "ifdef X\nelse\nelse\nendif\n"} {
+		vars := make(Vars)
+		if _, err := vars.ReadFromReader(strings.NewReader(bad), "bad"); err == nil {
+			t.Fatalf("malformed conditional %q not detected", bad)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	input := `PREFIX = /usr/local
+CFLAGS = -O2
+CFLAGS += -Wall
+CFLAGS+=-g
+LIBS = -lm -lz
+LIBS -= -lz
+PREFIX ?= /opt/tools
+BINDIR ?= ${PREFIX}/bin
+DMAKE_TEST_FROM_ENV ?= default
+DEFINES = -DX=1
+`
+	t.Setenv("DMAKE_TEST_FROM_ENV", "environment")
+	vars := make(Vars)
+	if _, err := vars.ReadFromReader(strings.NewReader(input), "operators"); err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]string{
+		"PREFIX":              "/usr/local",
+		"CFLAGS":              "-O2 -Wall -g",
+		"LIBS":                "-lm ",
+		"BINDIR":              "/usr/local/bin",
+		"DMAKE_TEST_FROM_ENV": "environment",
+		"DEFINES":             "-DX=1",
+	} {
+		if actual := vars.GetString(key); actual != expected {
+			t.Errorf("%s is %q, expected %q", key, actual, expected)
+		}
+	}
+}
+
+func TestShell(t *testing.T) {
+	input := `NAME = world
+GREETING = $(shell echo hello; echo ${NAME})
+NESTED = $(shell echo "(a)")
+SAME = $(NAME)
+`
+	vars := make(Vars)
+	if _, err := vars.ReadFromReader(strings.NewReader(input), "shell"); err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]string{
+		"GREETING": "hello world",
+		"NESTED":   "(a)",
+		"SAME":     "world",
+	} {
+		if actual := vars.GetString(key); actual != expected {
+			t.Errorf("%s is %q, expected %q", key, actual, expected)
+		}
+	}
+
+	vars = make(Vars)
+	if _, err := vars.ReadFromReader(strings.NewReader("BAD = $(shell exit 1)\n"), "bad"); err == nil {
+		t.Error("failing shell command not reported")
+	}
+	if _, err := vars.ReadFromReader(strings.NewReader("BAD = $(shell echo\n"), "unclosed"); err == nil {
+		t.Error("unclosed $( not reported")
+	}
+}
+
+func TestPlatformVars(t *testing.T) {
+	other := "windows"
+	if targetOS == other {
+		other = "linux"
+	}
+	input := "SRCS = main.c\n" +
+		"SRCS_" + targetOS + " = os.c\n" +
+		"SRCS_" + targetArch + " = arch.c\n" +
+		"SRCS_" + other + " = other.c\n" +
+		"LIBS_" + targetOS + " = -lm\n"
+	vars := make(Vars)
+	if _, err := vars.ReadFromReader(strings.NewReader(input), "platform"); err != nil {
+		t.Fatal(err)
+	}
+	vars.MergePlatformVars(DefaultTarget())
+	if srcs := vars.GetString("SRCS"); srcs != "main.c os.c arch.c" {
+		t.Errorf("SRCS is %q", srcs)
+	}
+	if libs := vars.GetString("LIBS"); libs != "-lm" {
+		t.Errorf("LIBS is %q", libs)
+	}
+}
+
+func TestCommandLineVars(t *testing.T) {
+	saved := commandLineVars
+	defer func() { commandLineVars = saved }()
+	commandLineVars = Vars{}
+	commandLineVars.SetValue("PREFIX", "/tmp/x")
+
+	input := "PREFIX = /usr/local\nBINDIR = ${PREFIX}/bin\nPREFIX += /opt\n"
+	vars := make(Vars)
+	if _, err := vars.ReadFromReader(strings.NewReader(input), "overrides"); err != nil {
+		t.Fatal(err)
+	}
+	if prefix := vars.GetString("PREFIX"); prefix != "/tmp/x" {
+		t.Errorf("PREFIX is %q, expected /tmp/x", prefix)
+	}
+	if bindir := vars.GetString("BINDIR"); bindir != "/tmp/x/bin" {
+		t.Errorf("BINDIR is %q, expected /tmp/x/bin", bindir)
+	}
+}
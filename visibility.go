@@ -0,0 +1,137 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//  The symbols a shared library or plugin exports may be listed in a
+//  file named by the EXPORTS variable, one symbol per line, # starting
+//  a comment. dmake translates the list into the form the target's
+//  linker uses, a version script for ELF platforms, a .def file for
+//  Windows or an exported symbols list for macOS, written to the
+//  object files directory, and links with it. Only the listed symbols
+//  are exported, wildcards, e.g. foo_*, may be used except on Windows.
+//
+//  VISIBILITY = hidden compiles code with -fvisibility=hidden so only
+//  symbols declared with default visibility are exported.
+//
+const exportsBasename = "exports"
+
+//  Return the compiler options for the VISIBILITY variable's value.
+//
+func VisibilityOptions(visibility string) ([]string, error) {
+	switch visibility {
+	case "", "default":
+		return nil, nil
+	case "hidden":
+		return []string{"-fvisibility=hidden"}, nil
+	}
+	return nil, fmt.Errorf("VISIBILITY: %q: use hidden or default", visibility)
+}
+
+//  Return the symbols listed in an exports file.
+//
+func ReadExportsFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var symbols []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		symbols = append(symbols, strings.Fields(line)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(symbols) == 0 {
+		return nil, fmt.Errorf("%s: no symbols are exported", filename)
+	}
+	return symbols, nil
+}
+
+//  Return the name and contents of the file listing the exported
+//  symbols for the target operating system's linker, and the linker
+//  option used to link with it.
+//
+func ExportsFile(symbols []string, goos, dir string) (string, string, string) {
+	var b strings.Builder
+	switch goos {
+	case "windows":
+		path := filepath.Join(dir, exportsBasename+".def")
+		fmt.Fprintln(&b, "EXPORTS")
+		for _, symbol := range symbols {
+			fmt.Fprintf(&b, "\t%s\n", symbol)
+		}
+		return path, b.String(), "-Wl," + path
+	case "darwin", "ios":
+		path := filepath.Join(dir, exportsBasename+".exp")
+		for _, symbol := range symbols {
+			fmt.Fprintf(&b, "_%s\n", symbol)
+		}
+		return path, b.String(), "-Wl,-exported_symbols_list," + path
+	}
+	path := filepath.Join(dir, exportsBasename+".map")
+	fmt.Fprintln(&b, "{")
+	fmt.Fprintln(&b, "  global:")
+	for _, symbol := range symbols {
+		fmt.Fprintf(&b, "    %s;\n", symbol)
+	}
+	fmt.Fprintln(&b, "  local:")
+	fmt.Fprintln(&b, "    *;")
+	fmt.Fprintln(&b, "};")
+	return path, b.String(), "-Wl,--version-script=" + path
+}
+
+//  Return the linker options restricting the symbols exported by the
+//  receiver's shared library or plugin to those listed by the EXPORTS
+//  file, writing the target's form of the list. The output is removed,
+//  so it's linked again, when the list has changed since it was built.
+//
+func (dmake *Dmake) ExportOptions(output string) ([]string, error) {
+	filename := dmake.vars.GetString("EXPORTS")
+	if filename == "" {
+		return nil, nil
+	}
+	switch dmake.outputtype {
+	case DllOutputType, PluginOutputType, FrameworkOutputType:
+	default:
+		return nil, fmt.Errorf("EXPORTS: %s outputs don't export symbols", dmake.outputtype)
+	}
+	symbols, err := ReadExportsFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	path, contents, option := ExportsFile(symbols, dmake.Target().os, dmake.ObjsDir())
+	if *dryRunFlag {
+		return []string{option}, nil
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != contents {
+		if err := CreateFile(path, contents); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := os.Stat(output); err == nil && !IsUpToDate(output, []string{filename}) {
+		if err := os.Remove(output); err != nil {
+			return nil, err
+		}
+	}
+	return []string{option}, nil
+}
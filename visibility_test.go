@@ -0,0 +1,29 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExportsFile(t *testing.T) {
+	symbols := []string{"foo", "bar_*"}
+	tests := []struct {
+		goos     string
+		path     string
+		contents string
+		option   string
+	}{
+		{"linux", "objs/exports.map", "{\n  global:\n    foo;\n    bar_*;\n  local:\n    *;\n};\n", "-Wl,--version-script=objs/exports.map"},
+		{"windows", "objs/exports.def", "EXPORTS\n\tfoo\n\tbar_*\n", "-Wl,objs/exports.def"},
+		{"darwin", "objs/exports.exp", "_foo\n_bar_*\n", "-Wl,-exported_symbols_list,objs/exports.exp"},
+	}
+	for _, test := range tests {
+		path, contents, option := ExportsFile(symbols, test.goos, "objs")
+		if path != filepath.FromSlash(test.path) || contents != test.contents || option != test.option {
+			t.Errorf("%s: exports file %q %q %q, expected %q %q %q", test.goos, path, contents, option, test.path, test.contents, test.option)
+		}
+	}
+	if _, err := VisibilityOptions("protected"); err == nil {
+		t.Error("expected an error for an unknown visibility")
+	}
+}
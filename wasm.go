@@ -0,0 +1,75 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//  The wasm target profile, emscripten/wasm32, builds WebAssembly
+//  using Emscripten's emcc, em++ and emar. Programs are JavaScript
+//  modules, prog.js, that load the WebAssembly, prog.wasm, or with
+//  WASM_HTML defined, web pages, prog.html, that run them. Shared
+//  libraries and plugins are side modules, libfoo.wasm, loaded by
+//  programs linked as main modules.
+//
+const (
+	wasmOS         = "emscripten"
+	wasmSuffix     = ".wasm"
+	wasmHTMLSuffix = ".html"
+)
+
+//  Return true if the receiver's program is a web page.
+//
+func (dmake *Dmake) WasmHTML() bool {
+	_, found := dmake.vars.Get("WASM_HTML")
+	return found
+}
+
+//  Return the linker options used to create an output type using
+//  Emscripten.
+//
+func WasmLinkTypeOptions(outputtype OutputType) []string {
+	switch outputtype {
+	case DllOutputType, PluginOutputType:
+		return []string{"-sSIDE_MODULE=1"}
+	}
+	return nil
+}
+
+//  Return the files Emscripten creates along with a program, the
+//  WebAssembly and, for a web page, the JavaScript that loads it.
+//
+func (t *Target) WasmCompanions(output string) []string {
+	if t.os != wasmOS {
+		return nil
+	}
+	base := strings.TrimSuffix(output, filepath.Ext(output))
+	switch filepath.Ext(output) {
+	case wasmPlatform.exesuffix:
+		return []string{base + wasmSuffix}
+	case wasmHTMLSuffix:
+		return []string{base + wasmPlatform.exesuffix, base + wasmSuffix}
+	}
+	return nil
+}
+
+//  Install the files created along with a program built by the
+//  receiver.
+//
+func (dmake *Dmake) InstallWasmCompanions(output, dest string) error {
+	for _, path := range dmake.Target().WasmCompanions(output) {
+		if err := dmake.InstallFile(path, dest, os.FileMode(0444)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWasmCompanions(t *testing.T) {
+	savedOS, savedArch, savedCross := targetOS, targetArch, crossCompiling
+	defer func() {
+		targetOS, targetArch, crossCompiling = savedOS, savedArch, savedCross
+		platform = PlatformFor(targetOS)
+		otherPlatformNamesRegexp = OtherPlatformNamesRegexp(targetOS)
+	}()
+
+	if companions := DefaultTarget().WasmCompanions("prog.js"); companions != nil {
+		t.Errorf("companions %q when not building WebAssembly", companions)
+	}
+	targetOS, targetArch, crossCompiling = "linux", "amd64", false
+	if err := SetTarget("wasm"); err != nil {
+		t.Fatal(err)
+	}
+	if name := platform.ExeFilename("prog"); name != "prog.js" {
+		t.Errorf("WebAssembly program named %q", name)
+	}
+	if name := platform.DllFilename("foo"); name != "libfoo.wasm" {
+		t.Errorf("WebAssembly side module named %q", name)
+	}
+	tests := map[string][]string{
+		"prog.js":     {"prog.wasm"},
+		"prog.html":   {"prog.js", "prog.wasm"},
+		"libfoo.wasm": nil,
+	}
+	for output, expected := range tests {
+		if companions := DefaultTarget().WasmCompanions(output); !reflect.DeepEqual(companions, expected) {
+			t.Errorf("%s: companions %q, expected %q", output, companions, expected)
+		}
+	}
+}
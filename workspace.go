@@ -0,0 +1,185 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//  A workspace is a directory, usually the root of a repository,
+//  containing several projects. The workspace file, dmake.work, uses
+//  the .dmake syntax. Its variables are shared by every .dmake file in
+//  the workspace, as defaults the files may override or add to, and
+//  each of its sections names a project,
+//
+//	CFLAGS = -Wall
+//	DEFAULT = server
+//
+//	[common]
+//	DIR = lib/common
+//
+//	[server]
+//	DEPENDS = common
+//
+//  A project's DIR defaults to its name and DEPENDS lists the projects
+//  it depends upon. DEFAULT names the projects built when none are
+//  named, otherwise all are built.
+//
+const workspaceFilename = "dmake.work"
+
+type Workspace struct {
+	root     string                       // the directory containing the workspace file
+	vars     Vars                         // variables shared by the projects
+	projects map[string]*WorkspaceProject // the projects, by name
+	defaults []string                     // the projects built by default
+}
+
+type WorkspaceProject struct {
+	dir     string   // the project's directory, relative to the root
+	depends []string // the names of the projects it depends upon
+}
+
+var (
+	// The workspace containing the current directory, if any,
+	// and the variables it shares with .dmake files.
+	//
+	workspace     *Workspace
+	workspaceVars Vars
+)
+
+//  Find the workspace file in a directory or its parents and read
+//  it. Returns nil if there isn't one.
+//
+func FindWorkspace(dir string) (*Workspace, error) {
+	for {
+		path := filepath.Join(dir, workspaceFilename)
+		if _, err := os.Stat(path); err == nil {
+			return ReadWorkspace(path)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+//  Read a workspace file.
+//
+func ReadWorkspace(path string) (*Workspace, error) {
+	vars := make(Vars)
+	sections, err := vars.ReadFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &Workspace{
+		root:     filepath.Dir(path),
+		vars:     vars,
+		projects: make(map[string]*WorkspaceProject),
+		defaults: strings.Fields(vars.GetString("DEFAULT")),
+	}
+	delete(w.vars, "DEFAULT")
+	for _, section := range sections {
+		dir, found := section.vars.GetValue("DIR")
+		if !found {
+			dir = section.name
+		}
+		w.projects[section.name] = &WorkspaceProject{
+			dir:     filepath.Clean(dir),
+			depends: strings.Fields(section.vars.GetString("DEPENDS")),
+		}
+	}
+	for name, project := range w.projects {
+		for _, dependency := range project.depends {
+			if _, found := w.projects[dependency]; !found {
+				return nil, fmt.Errorf("%s: project %s depends upon %q, which isn't a project", path, name, dependency)
+			}
+		}
+	}
+	for _, name := range w.defaults {
+		if _, found := w.projects[name]; !found {
+			return nil, fmt.Errorf("%s: DEFAULT project %q isn't a project", path, name)
+		}
+	}
+	return w, nil
+}
+
+//  Return true if dir is the workspace's root directory.
+//
+func (w *Workspace) IsRoot(dir string) bool {
+	return w != nil && filepath.Clean(dir) == w.root
+}
+
+//  Return true if name is one of the workspace's projects.
+//
+func (w *Workspace) HasProject(name string) bool {
+	_, found := w.projects[name]
+	return found
+}
+
+//  Add the directories of the named projects, and those they depend
+//  upon, to the receiver's directories. With no names the projects
+//  whose directories the receiver already has are used or, if it has
+//  none, the default projects. When targets are named all projects are
+//  added so the targets may be found in any of them.
+//
+func (dmake *Dmake) AddWorkspaceProjects(names []string) error {
+	cwd, err := os.Getwd()
+	if err != nil || !workspace.IsRoot(cwd) {
+		return err
+	}
+	if len(names) == 0 {
+		var all []string
+		for name := range workspace.projects {
+			all = append(all, name)
+		}
+		sort.Strings(all)
+		for _, name := range all {
+			if Contains(dmake.directories, workspace.projects[name].dir) {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 && !dmake.HaveDirs() {
+			names = workspace.defaults
+			if len(names) == 0 || len(dmake.targetNames) > 0 {
+				names = all
+			}
+		}
+	}
+	if dmake.dependencies == nil {
+		dmake.dependencies = make(map[string][]string)
+	}
+	added := make(map[string]bool)
+	var add func(name string)
+	add = func(name string) {
+		if added[name] {
+			return
+		}
+		added[name] = true
+		project := workspace.projects[name]
+		if !Contains(dmake.directories, project.dir) {
+			dmake.AddDirectory(project.dir)
+		}
+		for _, dependency := range project.depends {
+			dir := workspace.projects[dependency].dir
+			if !Contains(dmake.dependencies[project.dir], dir) {
+				dmake.dependencies[project.dir] = append(dmake.dependencies[project.dir], dir)
+			}
+			add(dependency)
+		}
+	}
+	for _, name := range names {
+		add(name)
+	}
+	return nil
+}
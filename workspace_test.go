@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, workspaceFilename)
+	text := "CFLAGS = -Wall\nDEFAULT = server\n[common]\nDIR = lib/common\n[server]\nDEPENDS = common\n"
+	if err := os.WriteFile(path, []byte(text), 0666); err != nil {
+		t.Fatal(err)
+	}
+	w, err := ReadWorkspace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cflags := w.vars.GetString("CFLAGS"); cflags != "-Wall" {
+		t.Errorf("CFLAGS is %q", cflags)
+	}
+	if _, found := w.vars.GetValue("DEFAULT"); found {
+		t.Error("DEFAULT is a shared variable")
+	}
+	if !reflect.DeepEqual(w.defaults, []string{"server"}) {
+		t.Errorf("defaults are %q", w.defaults)
+	}
+	if dir := w.projects["common"].dir; dir != filepath.Join("lib", "common") {
+		t.Errorf("common's DIR is %q", dir)
+	}
+	if dir := w.projects["server"].dir; dir != "server" {
+		t.Errorf("server's DIR is %q", dir)
+	}
+	if !reflect.DeepEqual(w.projects["server"].depends, []string{"common"}) {
+		t.Errorf("server depends upon %q", w.projects["server"].depends)
+	}
+
+	text += "[client]\nDEPENDS = missing\n"
+	if err := os.WriteFile(path, []byte(text), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadWorkspace(path); err == nil {
+		t.Error("dependency upon an unknown project not detected")
+	}
+}
@@ -0,0 +1,122 @@
+// dmake - a build tool on top of dcc
+//
+// Copyright (C) 2017 A.Newman.
+//
+// This source code is released under version 2 of the GNU Public
+// License.  See the file LICENSE for details.
+//
+
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//  dmake package -zip makes a ZIP archive, the usual form of Windows
+//  releases, <name>-<version>-<os>-<arch>.zip. The files are installed
+//  into a staging directory and put in the archive in a
+//  <name>-<version> directory. Windows finds DLLs in the program's
+//  directory so programs and DLLs are put together at the top of that
+//  directory, other files, e.g. headers, keep their place below the
+//  prefix.
+//
+const zipPackageFormat = "zip"
+
+//  Make a ZIP archive of the files the receiver installs.
+//
+func (dmake *Dmake) ZipPackage(env []string, version string) error {
+	base := dmake.defaultoutput + "-" + version
+	target := dmake.Target()
+	filename := dmake.BuildPath(base + "-" + target.os + "-" + target.arch + ".zip")
+	return dmake.StagedInstall(env, func(stage string) error {
+		if DryRun("zip", "-r", filename, base) {
+			return nil
+		}
+		root := filepath.Join(stage, dmake.installprefix)
+		names := make(map[string]string) // archive name -> file
+		err := filepath.Walk(root, func(pathname string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(root, pathname)
+			if err != nil {
+				return err
+			}
+			names[path.Join(base, target.ZipName(filepath.ToSlash(rel)))] = pathname
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := WriteZip(filename, names); err != nil {
+			return err
+		}
+		logger.Infof("wrote %s, %d files", filename, len(names))
+		return nil
+	})
+}
+
+//  Return the name used in a ZIP archive for an installed file, given
+//  by its slash separated path relative to the prefix. Programs and
+//  DLLs go at the top.
+//
+func (t *Target) ZipName(rel string) string {
+	dir, name := path.Split(rel)
+	switch {
+	case dir == "bin/":
+		return name
+	case dir == "lib/" && t.platform.dllsuffix != "" && strings.HasSuffix(name, t.platform.dllsuffix):
+		return name
+	}
+	return rel
+}
+
+//  Write a ZIP archive, names maps the names of the archive's entries
+//  to the files they hold.
+//
+func WriteZip(filename string, names map[string]string) (err error) {
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	defer WritingFile(filename)()
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(filename)
+		}
+	}()
+	zw := zip.NewWriter(file)
+	for _, name := range sorted {
+		info, err := os.Stat(names[name])
+		if err != nil {
+			return err
+		}
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		hdr.Method = zip.Deflate
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if err := copyFileTo(w, names[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
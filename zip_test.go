@@ -0,0 +1,65 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestZipName(t *testing.T) {
+	target, err := NewTarget("windows/amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"bin/tool.exe":             "tool.exe",
+		"lib/util.dll":             "util.dll",
+		"lib/libutil.a":            "lib/libutil.a",
+		"include/util/util.h":      "include/util/util.h",
+		"lib/pkgconfig/util.pc":    "lib/pkgconfig/util.pc",
+		"bin/tools/other/tool.exe": "bin/tools/other/tool.exe",
+	}
+	for rel, expected := range tests {
+		if name := target.ZipName(rel); name != expected {
+			t.Errorf("ZipName(%q) = %q, expected %q", rel, name, expected)
+		}
+	}
+}
+
+func TestZipPackage(t *testing.T) {
+	inTempProject(t, map[string]string{
+		dmakeFileFilename: "VERSION = 1.2\n",
+		"main.c":          "int main() { return 0; }\n",
+	})
+	dmake, _ := builtProgram(t, "/opt/prog")
+	saved := packageFormat
+	defer func() { packageFormat = saved }()
+	packageFormat = zipPackageFormat
+	if err := dmake.PackageAction(os.Environ()); err != nil {
+		t.Fatal(err)
+	}
+	filename := "prog-1.2-" + DefaultTarget().os + "-" + DefaultTarget().arch + ".zip"
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(data)
+	}
+	if !reflect.DeepEqual(files, map[string]string{"prog-1.2/prog": "program"}) {
+		t.Errorf("%s holds %q", filename, files)
+	}
+}